@@ -2,9 +2,13 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/spf13/viper"
 )
@@ -16,24 +20,70 @@ type KeyAlbum struct {
 
 // GooglePhotosConfig defines the configuration specific to Google Photos.
 type GooglePhotosConfig struct {
-	ClientId     string `mapstructure:"client_id"`
-	ClientSecret string `mapstructure:"client_secret"`
+	ClientId     string `mapstructure:"client_id" schema:"required"`
+	ClientSecret string `mapstructure:"client_secret" schema:"required"`
 	RedirectURI  string `mapstructure:"redirect_uri"`
 
+	// BaseURL is the base URL of the Google Photos Library API. Override it to point camflow
+	// at a proxy or a record/replay server.
+	BaseURL string `mapstructure:"base_url"`
+
 	Photos GPPhotosConfig `mapstructure:"photos"`
 	Videos GPVideosConfig `mapstructure:"videos"`
 }
 
 // GPPhotosConfig defines the configuration for Photos in Google Photos.
 type GPPhotosConfig struct {
+	// DefaultAlbums are the albums that every uploaded photo is added to.
+	DefaultAlbums []string `mapstructure:"default_albums"`
+	// DefaultAlbum is a single default album, from before DefaultAlbums. It is added to them.
 	DefaultAlbum string `mapstructure:"default_album"`
 
 	LabelAlbums   []KeyAlbum `mapstructure:"label_albums"`
 	SubjectAlbums []KeyAlbum `mapstructure:"subject_albums"`
+
+	// UnmatchedAlbum is the album for photos that have a label or subjects,
+	// but none that map to a label or subject album, eg "Uncategorized".
+	UnmatchedAlbum string `mapstructure:"unmatched_album"`
+
+	// DefaultAlbumOnlyWhenUnmatched makes the default albums a catch-all: photos that are added to
+	// a label or subject album aren't also added to the default albums.
+	DefaultAlbumOnlyWhenUnmatched bool `mapstructure:"default_album_only_when_unmatched"`
+
+	// AppendDateRangeToAlbumTitles renames label and subject albums that camflow creates
+	// to append the date range of the photos uploaded to them, eg "Japan (May 3–17)".
+	// The range is extended when later uploads add photos to them.
+	AppendDateRangeToAlbumTitles bool `mapstructure:"append_date_range_to_album_titles"`
+
+	// CameraModelAlbums adds each photo to an album named for the camera model in its EXIF metadata,
+	// eg "Canon EOS R5".
+	CameraModelAlbums bool `mapstructure:"camera_model_albums"`
+
+	// RawJpegPairs selects which files of a RAW+JPEG pair in the upload queue, eg IMG_0001.CR3 and
+	// IMG_0001.JPG, are uploaded: RawJpegPairsBoth (the default), RawJpegPairsJpegOnly, or RawJpegPairsRawOnly.
+	// The file that isn't uploaded is moved to the uploaded dir with the other.
+	RawJpegPairs string `mapstructure:"raw_jpeg_pairs"`
+}
+
+const (
+	RawJpegPairsBoth     = "both"
+	RawJpegPairsJpegOnly = "jpeg-only"
+	RawJpegPairsRawOnly  = "raw-only"
+)
+
+func (c *GPPhotosConfig) Validate() error {
+	switch c.RawJpegPairs {
+	case "":
+		c.RawJpegPairs = RawJpegPairsBoth
+	case RawJpegPairsBoth, RawJpegPairsJpegOnly, RawJpegPairsRawOnly:
+	default:
+		return fmt.Errorf("invalid raw_jpeg_pairs %q: must be %q, %q, or %q", c.RawJpegPairs, RawJpegPairsBoth, RawJpegPairsJpegOnly, RawJpegPairsRawOnly)
+	}
+	return nil
 }
 
-func (c *GPPhotosConfig) GetDefaultAlbum() string {
-	return c.DefaultAlbum
+func (c *GPPhotosConfig) GetDefaultAlbums() []string {
+	return mergeDefaultAlbums(c.DefaultAlbum, c.DefaultAlbums)
 }
 
 func (c *GPPhotosConfig) GetLabelAlbums() []KeyAlbum {
@@ -44,13 +94,40 @@ func (c *GPPhotosConfig) GetSubjectAlbums() []KeyAlbum {
 	return c.SubjectAlbums
 }
 
+func (c *GPPhotosConfig) GetUnmatchedAlbum() string {
+	return c.UnmatchedAlbum
+}
+
+func (c *GPPhotosConfig) GetDefaultAlbumOnlyWhenUnmatched() bool {
+	return c.DefaultAlbumOnlyWhenUnmatched
+}
+
+func (c *GPPhotosConfig) GetAppendDateRangeToAlbumTitles() bool {
+	return c.AppendDateRangeToAlbumTitles
+}
+
+func (c *GPPhotosConfig) GetCameraModelAlbums() bool {
+	return c.CameraModelAlbums
+}
+
+func (c *GPPhotosConfig) GetRawJpegPairs() string {
+	return c.RawJpegPairs
+}
+
 // GPVideosConfig defines the configuration for Videos in Google Photos.
 type GPVideosConfig struct {
+	// DefaultAlbums are the albums that every uploaded video is added to.
+	DefaultAlbums []string `mapstructure:"default_albums"`
+	// DefaultAlbum is a single default album, from before DefaultAlbums. It is added to them.
 	DefaultAlbum string `mapstructure:"default_album"`
+
+	// CameraModelAlbums adds each video to an album named for the camera model in its EXIF metadata,
+	// eg "Canon EOS R5".
+	CameraModelAlbums bool `mapstructure:"camera_model_albums"`
 }
 
-func (c *GPVideosConfig) GetDefaultAlbum() string {
-	return c.DefaultAlbum
+func (c *GPVideosConfig) GetDefaultAlbums() []string {
+	return mergeDefaultAlbums(c.DefaultAlbum, c.DefaultAlbums)
 }
 
 func (c *GPVideosConfig) GetLabelAlbums() []KeyAlbum {
@@ -61,28 +138,104 @@ func (c *GPVideosConfig) GetSubjectAlbums() []KeyAlbum {
 	return nil
 }
 
+func (c *GPVideosConfig) GetUnmatchedAlbum() string {
+	return ""
+}
+
+func (c *GPVideosConfig) GetDefaultAlbumOnlyWhenUnmatched() bool {
+	return false
+}
+
+func (c *GPVideosConfig) GetAppendDateRangeToAlbumTitles() bool {
+	return false
+}
+
+func (c *GPVideosConfig) GetCameraModelAlbums() bool {
+	return c.CameraModelAlbums
+}
+
+func (c *GPVideosConfig) GetRawJpegPairs() string {
+	return RawJpegPairsBoth
+}
+
+// mergeDefaultAlbums returns the default albums configured by default_album and default_albums,
+// without empty titles and duplicates.
+func mergeDefaultAlbums(defaultAlbum string, defaultAlbums []string) []string {
+	var albums []string
+	for _, album := range append([]string{defaultAlbum}, defaultAlbums...) {
+		if album != "" && !slices.Contains(albums, album) {
+			albums = append(albums, album)
+		}
+	}
+	return albums
+}
+
 // TODO: rename to camflow.
 // CamflowConfig defines the configuration for Camflow.
 // TODO: move flat fields into the new structs.
 type CamflowConfig struct {
-	PhotosProcessQueueRoot string            `mapstructure:"photos_process_queue_root"`
-	PhotosUploadQueueDir   string            `mapstructure:"photos_upload_queue_dir"`
-	PhotosUploadedRoot     string            `mapstructure:"photos_uploaded_root"`
+	PhotosProcessQueueRoot string            `mapstructure:"photos_process_queue_root" schema:"required"`
+	PhotosUploadQueueDir   string            `mapstructure:"photos_upload_queue_dir" schema:"required"`
+	PhotosUploadedRoot     string            `mapstructure:"photos_uploaded_root" schema:"required"`
 	LocalPhotos            LocalPhotosConfig `mapstructure:"-"`
 
-	VideosUploadQueueRoot  string            `mapstructure:"videos_upload_queue_root"`
-	VideosUploadedRoot     string            `mapstructure:"videos_uploaded_root"`
-	LocalVideos            LocalVideosConfig `mapstructure:"-"`
+	VideosUploadQueueRoot string            `mapstructure:"videos_upload_queue_root" schema:"required"`
+	VideosUploadedRoot    string            `mapstructure:"videos_uploaded_root" schema:"required"`
+	LocalVideos           LocalVideosConfig `mapstructure:"-"`
+
+	// Symlinks selects how symlinks found in the source and queue dirs are handled: SymlinksSkip
+	// (the default), SymlinksFollow, or SymlinksFollowWithinRoot, which only follows symlinks to
+	// files and dirs within the dir being walked.
+	Symlinks string `mapstructure:"symlinks"`
+
+	// LongNames selects how the names of files whose path camflow creates would be too long for the
+	// filesystem are shortened, keeping their date prefix and extension: LongNamesHash (the default)
+	// truncates the rest of the name and appends a hash of the full name, so that shortened names stay
+	// unique, and LongNamesTruncate only truncates it.
+	LongNames string `mapstructure:"long_names"`
+
+	// MaxOpenFiles is the most files that camflow's concurrent work, eg copying, hashing, validating,
+	// and uploading, opens at once, so that big batches stay under the process's file limit.
+	// Defaults to DefaultMaxOpenFiles.
+	MaxOpenFiles int `mapstructure:"max_open_files"`
+
+	// AccountLabel is a free-form name for the Google Photos account that the config is for, eg "Personal".
+	// It is shown in the output, logs, and run reports, so that runs against several accounts can be told apart.
+	AccountLabel string `mapstructure:"account_label"`
+
+	Import ImportConfig `mapstructure:"import"`
+	Upload UploadConfig `mapstructure:"upload"`
+
+	Notifications NotificationsConfig `mapstructure:"notifications"`
 
 	GooglePhotos GooglePhotosConfig `mapstructure:"google_photos"`
 
 	path string `mapstructure:"-"`
 }
 
+const (
+	SymlinksSkip             = "skip"
+	SymlinksFollow           = "follow"
+	SymlinksFollowWithinRoot = "follow-within-root"
+)
+
+const (
+	LongNamesHash     = "hash"
+	LongNamesTruncate = "truncate"
+)
+
+// DefaultMaxOpenFiles is below the default file limits of macOS (256) and Linux (1024),
+// leaving room for the files that camflow opens outside its concurrent work.
+const DefaultMaxOpenFiles = 128
+
 type LocalPhotosConfig struct {
 	ProcessQueueRoot string `mapstructure:"photos_process_queue_root"`
 	UploadQueueDir   string `mapstructure:"photos_upload_queue_dir"`
 	UploadedRoot     string `mapstructure:"photos_uploaded_root"`
+	// Symlinks is set from CamflowConfig.Symlinks by Validate.
+	Symlinks string `mapstructure:"-"`
+	// LongNames is set from CamflowConfig.LongNames by Validate.
+	LongNames string `mapstructure:"-"`
 }
 
 func (c *LocalPhotosConfig) GetUploadQueueRoot() string {
@@ -93,9 +246,21 @@ func (c *LocalPhotosConfig) GetUploadedRoot() string {
 	return c.UploadedRoot
 }
 
+func (c *LocalPhotosConfig) GetSymlinks() string {
+	return c.Symlinks
+}
+
+func (c *LocalPhotosConfig) GetLongNames() string {
+	return c.LongNames
+}
+
 type LocalVideosConfig struct {
 	UploadQueueRoot string `mapstructure:"videos_upload_queue_root"`
 	UploadedRoot    string `mapstructure:"videos_uploaded_root"`
+	// Symlinks is set from CamflowConfig.Symlinks by Validate.
+	Symlinks string `mapstructure:"-"`
+	// LongNames is set from CamflowConfig.LongNames by Validate.
+	LongNames string `mapstructure:"-"`
 }
 
 func (c *LocalVideosConfig) GetUploadQueueRoot() string {
@@ -106,19 +271,601 @@ func (c *LocalVideosConfig) GetUploadedRoot() string {
 	return c.UploadedRoot
 }
 
+func (c *LocalVideosConfig) GetSymlinks() string {
+	return c.Symlinks
+}
+
+func (c *LocalVideosConfig) GetLongNames() string {
+	return c.LongNames
+}
+
+// ImportConfig defines the configuration for importing media from an sdcard.
+type ImportConfig struct {
+	// PerceptualHash enables computing perceptual hashes of imported photos,
+	// so that find-duplicates can report near-duplicates across imports.
+	PerceptualHash bool `mapstructure:"perceptual_hash"`
+
+	// ZeroByteFiles selects how zero-byte media files (eg, from a failed write) are handled:
+	// ZeroByteFilesSkip (the default) skips them with a warning and ZeroByteFilesError fails the import.
+	ZeroByteFiles string `mapstructure:"zero_byte_files"`
+
+	// Hardlink makes import hard link files into the destination instead of copying them,
+	// falling back to copying when they are on different filesystems.
+	Hardlink bool `mapstructure:"hardlink"`
+
+	// SniffExtensionless makes import detect the type of files without an extension from their content,
+	// and import the JPEGs and MP4s among them. Otherwise, they are skipped with a warning.
+	SniffExtensionless bool `mapstructure:"sniff_extensionless"`
+
+	// PreserveMetadata makes import copy each file's mode bits, access time, and extended attributes
+	// (best effort), in addition to its modification time, which is always kept.
+	PreserveMetadata bool `mapstructure:"preserve_metadata"`
+
+	// PhotoFolders selects the dirs that photos are imported into, under the process queue root:
+	// PhotoFoldersDay (the default) for YYYY/MM/DD/, PhotoFoldersYearDate for YYYY/YYYY-MM-DD/,
+	// PhotoFoldersMonth for YYYY/MM/, or PhotoFoldersYear for YYYY/. The file names keep their date
+	// prefix either way.
+	PhotoFolders string `mapstructure:"photo_folders"`
+
+	// CompareContent makes import compare the content of a file that is already at its destination,
+	// eg from an interrupted import, with the source before skipping copying it. Otherwise only their
+	// sizes and modification times are compared. Files that don't match are copied over.
+	CompareContent bool `mapstructure:"compare_content"`
+
+	// CopyBufferKiB is the size in KiB of the buffer that import copies files with. The progress is updated
+	// once per buffer. If unset, files are copied with 1 MiB, and files of 256 MiB or more, eg videos,
+	// with 8 MiB. Bigger buffers help most where each read or write is slow, eg on network shares.
+	CopyBufferKiB int `mapstructure:"copy_buffer_kib"`
+
+	// Verify makes import re-read each copied file and compare it with the source before deleting the
+	// source. A copy that doesn't match is removed and its source is kept on the card.
+	Verify bool `mapstructure:"verify"`
+
+	// CameraClockOffset is added to the modification time of each imported file before it is used to
+	// date the file, eg "-1h" for a camera whose clock is an hour fast. It is usually set per import,
+	// with the --camera-clock-offset flag, since it depends on the camera.
+	CameraClockOffset time.Duration `mapstructure:"camera_clock_offset"`
+
+	// Timezone, if set, is the IANA name of the time zone, eg "America/Los_Angeles" or "UTC", that imported
+	// files are dated in, so that files don't get date prefixes in different zones, eg if some were taken
+	// while travelling. Files whose EXIF metadata has the time zone offset of their capture time are dated
+	// by that time, and other files by their modification time. Dating them this way needs exiftool.
+	Timezone string `mapstructure:"timezone"`
+	// Location is the time zone of Timezone, or nil if it isn't set. It is set by Validate.
+	Location *time.Location `mapstructure:"-"`
+
+	// Takeout imports a Google Takeout export: each file is dated by the photoTakenTime of its JSON
+	// sidecar, if it has one, instead of by its metadata, and the files of an album dir, which has a
+	// metadata.json, are imported into a dir named for the album, eg for upload.flatten_albums_from_path.
+	Takeout bool `mapstructure:"takeout"`
+
+	// PhotosDest and VideosDest, if set, are the existing dirs that an import moves photos and videos to,
+	// instead of photos_process_queue_root and videos_upload_queue_root, eg to send one shoot's photos to
+	// its project's dir. They are set per import, with the --photos-dest and --videos-dest flags, and are
+	// made absolute by CamflowConfig.Validate.
+	PhotosDest string `mapstructure:"-"`
+	VideosDest string `mapstructure:"-"`
+
+	// HashWorkers is the number of photos whose perceptual hashes are computed concurrently,
+	// while later files are still being copied. Defaults to DefaultHashWorkers.
+	HashWorkers int `mapstructure:"hash_workers"`
+
+	// WriteProtected selects what happens when the files on the card can't be removed after they are
+	// imported, eg because its write-protect switch is on: WriteProtectedError (the default) stops the
+	// import before anything is copied, and WriteProtectedKeep imports the files and keeps them on the card,
+	// as with --keep. Imports that keep the card's files anyway don't check.
+	WriteProtected string `mapstructure:"write_protected"`
+
+	// UnreadableDirs selects what happens when a dir in a media root can't be read, eg on a failing card:
+	// UnreadableDirsError (the default) fails the import, and UnreadableDirsSkip skips the dir with a warning
+	// and imports the files in the rest of the card.
+	UnreadableDirs string `mapstructure:"unreadable_dirs"`
+
+	// MediaRoots are the dirs on the card, relative to its root, that media files are imported from,
+	// eg "PRIVATE/M4ROOT/CLIP" for cameras that don't keep their videos under DCIM. Roots that aren't
+	// on a card are skipped. In a root named DCIM, only the dirs that the DCIM standard names as holding
+	// media are imported from. Defaults to DefaultMediaRoots.
+	MediaRoots []string `mapstructure:"media_roots"`
+}
+
+const (
+	ZeroByteFilesSkip  = "skip"
+	ZeroByteFilesError = "error"
+
+	PhotoFoldersDay      = "day"
+	PhotoFoldersYearDate = "year-date"
+	PhotoFoldersMonth    = "month"
+	PhotoFoldersYear     = "year"
+
+	WriteProtectedError = "error"
+	WriteProtectedKeep  = "keep"
+
+	UnreadableDirsError = "error"
+	UnreadableDirsSkip  = "skip"
+
+	DefaultHashWorkers = 4
+
+	// MaxCopyBufferKiB is the largest CopyBufferKiB, so that the progress is still updated often.
+	MaxCopyBufferKiB = 64 << 10
+)
+
+// DefaultMediaRoots are the media roots that are imported from by default.
+var DefaultMediaRoots = []string{"DCIM"}
+
+func (c *ImportConfig) Validate() error {
+	switch c.ZeroByteFiles {
+	case "":
+		c.ZeroByteFiles = ZeroByteFilesSkip
+	case ZeroByteFilesSkip, ZeroByteFilesError:
+	default:
+		return fmt.Errorf("invalid zero_byte_files %q: must be %q or %q", c.ZeroByteFiles, ZeroByteFilesSkip, ZeroByteFilesError)
+	}
+	switch c.WriteProtected {
+	case "":
+		c.WriteProtected = WriteProtectedError
+	case WriteProtectedError, WriteProtectedKeep:
+	default:
+		return fmt.Errorf("invalid write_protected %q: must be %q or %q", c.WriteProtected, WriteProtectedError, WriteProtectedKeep)
+	}
+	switch c.UnreadableDirs {
+	case "":
+		c.UnreadableDirs = UnreadableDirsError
+	case UnreadableDirsError, UnreadableDirsSkip:
+	default:
+		return fmt.Errorf("invalid unreadable_dirs %q: must be %q or %q", c.UnreadableDirs, UnreadableDirsError, UnreadableDirsSkip)
+	}
+	switch c.PhotoFolders {
+	case "":
+		c.PhotoFolders = PhotoFoldersDay
+	case PhotoFoldersDay, PhotoFoldersYearDate, PhotoFoldersMonth, PhotoFoldersYear:
+	default:
+		return fmt.Errorf("invalid photo_folders %q: must be %q, %q, %q, or %q", c.PhotoFolders, PhotoFoldersDay, PhotoFoldersYearDate, PhotoFoldersMonth, PhotoFoldersYear)
+	}
+	if c.CopyBufferKiB < 0 || c.CopyBufferKiB > MaxCopyBufferKiB {
+		return fmt.Errorf("invalid copy_buffer_kib %d: must be between 0 and %d", c.CopyBufferKiB, MaxCopyBufferKiB)
+	}
+	if c.HashWorkers < 0 {
+		return fmt.Errorf("invalid hash_workers %d: must not be negative", c.HashWorkers)
+	}
+	if c.HashWorkers == 0 {
+		c.HashWorkers = DefaultHashWorkers
+	}
+	if len(c.MediaRoots) == 0 {
+		c.MediaRoots = slices.Clone(DefaultMediaRoots)
+	}
+	for i, root := range c.MediaRoots {
+		if root == "" || filepath.IsAbs(root) || !filepath.IsLocal(root) {
+			return fmt.Errorf("invalid media_roots entry %q: must be a dir relative to the card's root", root)
+		}
+		root = filepath.Clean(root)
+		for _, other := range c.MediaRoots[:i] {
+			if root == other {
+				return fmt.Errorf("invalid media_roots: %q is listed more than once", root)
+			}
+			if rel, err := filepath.Rel(other, root); err == nil && filepath.IsLocal(rel) {
+				return fmt.Errorf("invalid media_roots: %q is inside %q", root, other)
+			}
+			if rel, err := filepath.Rel(root, other); err == nil && filepath.IsLocal(rel) {
+				return fmt.Errorf("invalid media_roots: %q is inside %q", other, root)
+			}
+		}
+		c.MediaRoots[i] = root
+	}
+	c.Location = nil
+	if c.Timezone != "" {
+		location, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+		}
+		c.Location = location
+	}
+	return nil
+}
+
+// UploadConfig defines the configuration for uploading media to Google Photos.
+type UploadConfig struct {
+	// MinRating, if set, is the minimum EXIF/XMP star rating (1-5) of the files to upload.
+	// Files rated below it stay in the upload queue.
+	MinRating int `mapstructure:"min_rating"`
+	// Unrated selects whether files without a rating are uploaded when MinRating is set:
+	// UnratedInclude (the default) or UnratedExclude.
+	Unrated string `mapstructure:"unrated"`
+
+	// IncludeExtensions, if set, are the only file extensions to upload, eg ["jpg", "mp4"], and
+	// ExcludeExtensions are file extensions not to upload, eg ["cr3"]. Extensions are matched ignoring
+	// case and any leading dot. Files that are filtered out stay in the upload queue.
+	IncludeExtensions []string `mapstructure:"include_extensions"`
+	ExcludeExtensions []string `mapstructure:"exclude_extensions"`
+
+	// AlbumAddsPerSecond limits the rate of adding media items to albums, which Google Photos
+	// limits separately from uploads. Defaults to DefaultAlbumAddsPerSecond.
+	AlbumAddsPerSecond float64 `mapstructure:"album_adds_per_second"`
+
+	// UploadMbps is the upload bandwidth of your connection in megabits per second.
+	// It is only used to estimate how long uploads will take.
+	UploadMbps float64 `mapstructure:"upload_mbps"`
+
+	// MoveMode selects how files are moved into the uploaded dir: MoveModeAuto (the default)
+	// renames them when on the same filesystem and otherwise copies them, while MoveModeRename
+	// and MoveModeCopy skip checking the filesystems and always rename or copy.
+	MoveMode string `mapstructure:"move_mode"`
+
+	// KeepQueueStructure moves uploaded files to the same path under the uploaded dir as they had under
+	// the upload queue, eg for a queue organized into folders by hand, instead of to a date path.
+	KeepQueueStructure bool `mapstructure:"keep_queue_structure"`
+
+	// NewOnly only uploads the files in the upload queue that are dated on or after the latest date dir
+	// in the uploaded dir, ie the last uploaded date, and leaves older files in the queue. When nothing
+	// has been uploaded yet, all files are uploaded. It can't be used with KeepQueueStructure.
+	NewOnly bool `mapstructure:"new_only"`
+
+	// FlattenAlbumsFromPath adds each file to an album named for the first N dirs of its path under the
+	// upload queue, joined with " / ": with 1, trip/day1/IMG_0001.JPG is added to "trip", and with 2, to
+	// "trip / day1". Files directly in the upload queue aren't added to such an album. 0 (the default) turns it off.
+	FlattenAlbumsFromPath int `mapstructure:"flatten_albums_from_path"`
+
+	// MaxAlbumsPerItem caps the number of albums that each file is added to, eg for files with many
+	// subjects that each map to an album. The default albums are kept first, then the label, subject,
+	// camera model, and path albums, in that order, and the albums over the cap are skipped with a warning.
+	// 0 (the default) doesn't cap them.
+	MaxAlbumsPerItem int `mapstructure:"max_albums_per_item"`
+
+	// ScanCache saves the listing of the upload queue, and the EXIF metadata of its files, in the cache dir,
+	// so that later uploads only list the dirs that changed, and only read the metadata of new or changed
+	// files. It is for very big queues, and is only used when symlinks aren't followed.
+	ScanCache bool `mapstructure:"scan_cache"`
+
+	// DayIndex keeps an index file in each dir that uploaded files are moved to, eg each day's dir, listing
+	// the names, sizes, and media item IDs of the files, so that the uploaded tree describes itself.
+	DayIndex bool `mapstructure:"day_index"`
+
+	// MediaItemXattrs records the media item ID and album titles of each uploaded file in extended
+	// attributes of the file in the uploaded dir, so that the file links to its media item, eg for
+	// backfill-albums on another computer. Filesystems without extended attributes are skipped.
+	MediaItemXattrs bool `mapstructure:"media_item_xattrs"`
+
+	// DeepValidate checks that each MP4 and MOV file is a well-formed container before uploading it,
+	// and leaves truncated or corrupt ones in the upload queue. It reads the structure of each file.
+	DeepValidate bool `mapstructure:"deep_validate"`
+	// ValidateWorkers is the number of files that DeepValidate checks concurrently.
+	// Defaults to DefaultValidateWorkers.
+	ValidateWorkers int `mapstructure:"validate_workers"`
+
+	// AlbumAddFailure selects what happens when adding an uploaded file to an album fails:
+	// AlbumAddFailureFail (the default) stops the upload, AlbumAddFailureSkipAlbum moves the file
+	// to the uploaded dir anyway, and AlbumAddFailureKeepInQueue leaves it in the upload queue.
+	// Other files are still uploaded with both of the latter.
+	AlbumAddFailure string `mapstructure:"album_add_failure"`
+
+	// NonMedia selects what happens to files in the upload queue that aren't photos or videos that
+	// Google Photos accepts, eg notes or sidecar files: NonMediaSkip (the default) warns and leaves
+	// them in the upload queue, and NonMediaReject moves them to the RejectedDirName dir of the queue.
+	NonMedia string `mapstructure:"non_media"`
+
+	// Oversized selects what happens to files in the upload queue that are larger than Google Photos
+	// accepts, so that they don't fail every upload, including with --keep: OversizedSkip (the default)
+	// reports them and leaves them in the upload queue, and OversizedMove moves them to the
+	// OversizedDirName dir of the queue, eg for compressing them by hand.
+	Oversized string `mapstructure:"oversized"`
+
+	// UploadedDate selects the date of the dir that each uploaded file is moved to, under the uploaded root:
+	// UploadedDateName (the default) uses the date prefix of its name, and UploadedDateExif uses its EXIF
+	// capture date, falling back to the date prefix for files without one, eg if the prefix is wrong.
+	UploadedDate string `mapstructure:"uploaded_date"`
+	// CaptureLocation is import.timezone's Location, that EXIF capture times with a time zone offset are
+	// dated in for UploadedDateExif, as import dates them, or nil. It is set by CamflowConfig.Validate.
+	CaptureLocation *time.Location `mapstructure:"-"`
+
+	// MaxRetries is the number of times to retry uploading a file, and creating its media item,
+	// after the Google Photos API fails with a temporary error, eg a rate limit or a server error,
+	// with exponential backoff between the retries. LoadConfig defaults it to DefaultMaxRetries,
+	// since 0 disables retries.
+	MaxRetries int `mapstructure:"max_retries"`
+
+	// MaxConsecutiveFailures is the number of files in a row whose upload can fail, after retries,
+	// before the upload stops because the API appears to be failing. Files that fail before then
+	// are left in the upload queue. Defaults to 1, which stops at the first failure.
+	MaxConsecutiveFailures int `mapstructure:"max_consecutive_failures"`
+
+	// QuarantineAfter is the number of uploads of a file that can fail, across runs, before the file is
+	// moved to the QuarantineDirName dir of its upload queue, with a note of its last error, so that a
+	// file that always fails, eg a subtly corrupt video, stops being retried. 0 (the default) never
+	// quarantines files.
+	QuarantineAfter int `mapstructure:"quarantine_after"`
+
+	// SkipPreflight skips checking that Google Photos can be called before scanning the upload queue.
+	// Dry runs skip the check too, unless CheckAPI is set.
+	SkipPreflight bool `mapstructure:"skip_preflight"`
+
+	// Safe only moves an uploaded file to the uploaded dir after fetching its media item back from
+	// Google Photos, which costs an API call per file, and after adding it to all of its albums.
+	// Otherwise the file stays in the upload queue, whatever AlbumAddFailure is.
+	Safe bool `mapstructure:"safe"`
+
+	// DeferCommit leaves uploaded files in the upload queue, instead of moving them to the uploaded dir,
+	// until the commit-uploads command moves them, eg after checking the uploads in Google Photos.
+	// Later uploads skip the files that are waiting, unless they changed.
+	DeferCommit bool `mapstructure:"defer_commit"`
+
+	// MoveFailedTo is a dir to move the files that fail to upload to, at the same paths relative to it
+	// as they had in the upload queue, once a run that continued past them, per MaxConsecutiveFailures,
+	// ends. This keeps the upload queue to the files that haven't been tried. It must not be inside an
+	// upload queue.
+	MoveFailedTo string `mapstructure:"move_failed_to"`
+
+	// CheckAPI makes an upload a dry run that also checks the Google Photos API with read-only calls:
+	// it always makes the preflight check, and resolves every album title against the albums listed
+	// online instead of the album cache, without uploading, creating, or moving anything. It is set
+	// by the --check-api flag.
+	CheckAPI bool `mapstructure:"-"`
+
+	// Tag is a free-form label for the uploads of a run, eg a session code like "TRIP-2024-05",
+	// which is recorded with each upload in the upload ledger.
+	Tag string `mapstructure:"tag"`
+	// TagDescription also sets the description of each uploaded media item to Tag.
+	TagDescription bool `mapstructure:"tag_description"`
+
+	// ReplaceExisting replaces the media item of an earlier upload of each file, per the upload ledger,
+	// in the albums that the file is added to. The Google Photos API can't delete media items,
+	// so the earlier ones are left in the library and reported for deleting by hand.
+	ReplaceExisting bool `mapstructure:"replace_existing"`
+
+	// DuplicateAlbums selects what happens when more than one existing album matches an album title,
+	// ignoring case: DuplicateAlbumsWarn (the default) warns and uses the first album listed with the
+	// exact title, and DuplicateAlbumsError stops the upload. AlbumIDs can choose one of the albums.
+	// Titles in the album cache are only checked when the albums are listed, eg to look up another title.
+	DuplicateAlbums string `mapstructure:"duplicate_albums"`
+
+	// OnlyExistingAlbums only adds media items to albums that already exist, and stops the upload instead
+	// of creating any album, eg so that a typo in a subject album mapping can't create stray albums.
+	OnlyExistingAlbums bool `mapstructure:"only_existing_albums"`
+
+	// MaxNewAlbums, if positive, is the most albums that a run creates without asking, so that eg a bad
+	// album mapping can't create a flood of albums. Past it, a run on a terminal asks whether to create
+	// the albums, and other runs stop.
+	MaxNewAlbums int `mapstructure:"max_new_albums"`
+
+	// AlbumIDs pins album titles to the IDs of the albums to add media items to, eg to choose between
+	// albums with the same title. Pinned titles aren't looked up.
+	AlbumIDs []AlbumID `mapstructure:"album_ids"`
+}
+
+// AlbumID pins the album titled Title to the album with ID.
+type AlbumID struct {
+	Title string `mapstructure:"title"`
+	ID    string `mapstructure:"id"`
+}
+
+const (
+	UnratedInclude = "include"
+	UnratedExclude = "exclude"
+
+	DefaultAlbumAddsPerSecond = 2.0
+
+	MoveModeAuto   = "auto"
+	MoveModeRename = "rename"
+	MoveModeCopy   = "copy"
+
+	AlbumAddFailureFail        = "fail"
+	AlbumAddFailureSkipAlbum   = "skip-album"
+	AlbumAddFailureKeepInQueue = "keep-in-queue"
+
+	NonMediaSkip   = "skip"
+	NonMediaReject = "reject"
+
+	// RejectedDirName is the dir of the upload queue that NonMediaReject moves files to.
+	RejectedDirName = "rejected"
+
+	OversizedSkip = "skip"
+	OversizedMove = "move"
+
+	// OversizedDirName is the dir of the upload queue that OversizedMove moves files to.
+	OversizedDirName = "oversized"
+
+	// QuarantineDirName is the dir of the upload queue that files are moved to after QuarantineAfter failures.
+	QuarantineDirName = "quarantine"
+
+	UploadedDateName = "name"
+	UploadedDateExif = "exif"
+
+	DefaultMaxRetries = 3
+
+	DefaultMaxConsecutiveFailures = 1
+
+	DefaultValidateWorkers = 4
+
+	DuplicateAlbumsWarn  = "warn"
+	DuplicateAlbumsError = "error"
+
+	// MaxTagLength is the most characters of a Tag, which is the most that a media item description can have.
+	MaxTagLength = 1000
+)
+
+func (c *UploadConfig) Validate() error {
+	if c.MinRating < 0 || c.MinRating > 5 {
+		return fmt.Errorf("invalid min_rating %d: must be between 0 and 5", c.MinRating)
+	}
+	switch c.Unrated {
+	case "":
+		c.Unrated = UnratedInclude
+	case UnratedInclude, UnratedExclude:
+	default:
+		return fmt.Errorf("invalid unrated %q: must be %q or %q", c.Unrated, UnratedInclude, UnratedExclude)
+	}
+	if c.AlbumAddsPerSecond < 0 {
+		return fmt.Errorf("invalid album_adds_per_second %g: must not be negative", c.AlbumAddsPerSecond)
+	}
+	if c.AlbumAddsPerSecond == 0 {
+		c.AlbumAddsPerSecond = DefaultAlbumAddsPerSecond
+	}
+	if c.UploadMbps < 0 {
+		return fmt.Errorf("invalid upload_mbps %g: must not be negative", c.UploadMbps)
+	}
+	if c.ValidateWorkers < 0 {
+		return fmt.Errorf("invalid validate_workers %d: must not be negative", c.ValidateWorkers)
+	}
+	if c.ValidateWorkers == 0 {
+		c.ValidateWorkers = DefaultValidateWorkers
+	}
+	if n := utf8.RuneCountInString(c.Tag); n > MaxTagLength {
+		return fmt.Errorf("invalid tag: %d characters is more than %d", n, MaxTagLength)
+	}
+	if c.TagDescription && c.Tag == "" {
+		return fmt.Errorf("invalid tag_description: must be set with a tag")
+	}
+	switch c.MoveMode {
+	case "":
+		c.MoveMode = MoveModeAuto
+	case MoveModeAuto, MoveModeRename, MoveModeCopy:
+	default:
+		return fmt.Errorf("invalid move_mode %q: must be %q, %q, or %q", c.MoveMode, MoveModeAuto, MoveModeRename, MoveModeCopy)
+	}
+	switch c.AlbumAddFailure {
+	case "":
+		c.AlbumAddFailure = AlbumAddFailureFail
+	case AlbumAddFailureFail, AlbumAddFailureSkipAlbum, AlbumAddFailureKeepInQueue:
+	default:
+		return fmt.Errorf("invalid album_add_failure %q: must be %q, %q, or %q", c.AlbumAddFailure, AlbumAddFailureFail, AlbumAddFailureSkipAlbum, AlbumAddFailureKeepInQueue)
+	}
+	switch c.NonMedia {
+	case "":
+		c.NonMedia = NonMediaSkip
+	case NonMediaSkip, NonMediaReject:
+	default:
+		return fmt.Errorf("invalid non_media %q: must be %q or %q", c.NonMedia, NonMediaSkip, NonMediaReject)
+	}
+	switch c.Oversized {
+	case "":
+		c.Oversized = OversizedSkip
+	case OversizedSkip, OversizedMove:
+	default:
+		return fmt.Errorf("invalid oversized %q: must be %q or %q", c.Oversized, OversizedSkip, OversizedMove)
+	}
+	switch c.UploadedDate {
+	case "":
+		c.UploadedDate = UploadedDateName
+	case UploadedDateName, UploadedDateExif:
+	default:
+		return fmt.Errorf("invalid uploaded_date %q: must be %q or %q", c.UploadedDate, UploadedDateName, UploadedDateExif)
+	}
+	if c.FlattenAlbumsFromPath < 0 {
+		return fmt.Errorf("invalid flatten_albums_from_path %d: must not be negative", c.FlattenAlbumsFromPath)
+	}
+	if c.MaxAlbumsPerItem < 0 {
+		return fmt.Errorf("invalid max_albums_per_item %d: must not be negative", c.MaxAlbumsPerItem)
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("invalid max_retries %d: must not be negative", c.MaxRetries)
+	}
+	if c.MaxConsecutiveFailures < 0 {
+		return fmt.Errorf("invalid max_consecutive_failures %d: must not be negative", c.MaxConsecutiveFailures)
+	}
+	if c.MaxConsecutiveFailures == 0 {
+		c.MaxConsecutiveFailures = DefaultMaxConsecutiveFailures
+	}
+	if c.QuarantineAfter < 0 {
+		return fmt.Errorf("invalid quarantine_after %d: must not be negative", c.QuarantineAfter)
+	}
+	if c.MaxNewAlbums < 0 {
+		return fmt.Errorf("invalid max_new_albums %d: must not be negative", c.MaxNewAlbums)
+	}
+	switch c.DuplicateAlbums {
+	case "":
+		c.DuplicateAlbums = DuplicateAlbumsWarn
+	case DuplicateAlbumsWarn, DuplicateAlbumsError:
+	default:
+		return fmt.Errorf("invalid duplicate_albums %q: must be %q or %q", c.DuplicateAlbums, DuplicateAlbumsWarn, DuplicateAlbumsError)
+	}
+	pinnedTitles := make(map[string]bool)
+	for _, albumID := range c.AlbumIDs {
+		if albumID.Title == "" || albumID.ID == "" {
+			return fmt.Errorf("invalid album_ids entry %+v: must have a title and an id", albumID)
+		}
+		if pinnedTitles[albumID.Title] {
+			return fmt.Errorf("invalid album_ids: title %q is pinned more than once", albumID.Title)
+		}
+		pinnedTitles[albumID.Title] = true
+	}
+	return nil
+}
+
+// PinnedAlbumIDs returns AlbumIDs as a map from title to ID.
+func (c *UploadConfig) PinnedAlbumIDs() map[string]string {
+	pinned := make(map[string]string, len(c.AlbumIDs))
+	for _, albumID := range c.AlbumIDs {
+		pinned[albumID.Title] = albumID.ID
+	}
+	return pinned
+}
+
+// NotificationsConfig defines the notifications sent when an import or upload finishes, whether or not it failed.
+type NotificationsConfig struct {
+	// Command is run with "sh -c" and given the JSON run report on stdin.
+	Command string `mapstructure:"command"`
+
+	// WebhookURL is sent the JSON run report in a POST request.
+	WebhookURL string `mapstructure:"webhook_url"`
+}
+
+func (c *NotificationsConfig) Validate() error {
+	if c.WebhookURL != "" {
+		u, err := url.Parse(c.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook_url %q: must be an http or https URL", c.WebhookURL)
+		}
+	}
+	return nil
+}
+
 func (c *GooglePhotosConfig) Validate() error {
 	// Check that at least a base set of fields have values.
 	if c.ClientId == "" || c.ClientSecret == "" {
 		return fmt.Errorf("missing google photos client_id or client_secret")
 	}
 	if c.RedirectURI == "" {
-		c.RedirectURI = "http://localhost:8080" // Default redirect URI
+		c.RedirectURI = DefaultRedirectURI
 		fmt.Printf("Warning: google_photos.redirect_uri not set in config, using default: %s\n", c.RedirectURI)
 	}
+	if err := c.SetBaseURL(c.BaseURL); err != nil {
+		return err
+	}
+	if err := c.Photos.Validate(); err != nil {
+		return err
+	}
 	// Allow empty DefaultAlbums, ToFavAlbumName, and KeywordAlbums.
 	return nil
 }
 
+// DefaultRedirectURI is the OAuth redirect URI used when google_photos.redirect_uri isn't set.
+const DefaultRedirectURI = "http://localhost:8080"
+
+// DefaultGooglePhotosBaseURL is the base URL of the Google Photos Library API.
+const DefaultGooglePhotosBaseURL = "https://photoslibrary.googleapis.com/"
+
+// SetBaseURL validates baseURL and sets it as the Google Photos API base URL.
+// An empty baseURL sets the default. A trailing slash is added if it is missing.
+func (c *GooglePhotosConfig) SetBaseURL(baseURL string) error {
+	if baseURL == "" {
+		c.BaseURL = DefaultGooglePhotosBaseURL
+		return nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base_url %q: %w", baseURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid base_url %q: must be an absolute http or https URL", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("invalid base_url %q: must not have a query or fragment", baseURL)
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	c.BaseURL = baseURL
+	return nil
+}
+
 func (c *CamflowConfig) Validate() error {
 	// Check that at least a base set of fields have values.
 	if c.PhotosProcessQueueRoot == "" || c.PhotosUploadQueueDir == "" || c.PhotosUploadedRoot == "" {
@@ -136,12 +883,120 @@ func (c *CamflowConfig) Validate() error {
 		c.VideosUploadedRoot != c.LocalVideos.UploadedRoot {
 		return fmt.Errorf("local_videos config does not match flat fields (%s)", c.path)
 	}
+	if err := CheckQueueAndUploadedRoots(c.PhotosUploadQueueDir, c.PhotosUploadedRoot); err != nil {
+		return fmt.Errorf("invalid photos dirs (%s): %w", c.path, err)
+	}
+	if err := CheckQueueAndUploadedRoots(c.VideosUploadQueueRoot, c.VideosUploadedRoot); err != nil {
+		return fmt.Errorf("invalid videos dirs (%s): %w", c.path, err)
+	}
+	switch c.Symlinks {
+	case "":
+		c.Symlinks = SymlinksSkip
+	case SymlinksSkip, SymlinksFollow, SymlinksFollowWithinRoot:
+	default:
+		return fmt.Errorf("invalid symlinks %q: must be %q, %q, or %q (%s)", c.Symlinks, SymlinksSkip, SymlinksFollow, SymlinksFollowWithinRoot, c.path)
+	}
+	c.LocalPhotos.Symlinks = c.Symlinks
+	c.LocalVideos.Symlinks = c.Symlinks
+	switch c.LongNames {
+	case "":
+		c.LongNames = LongNamesHash
+	case LongNamesHash, LongNamesTruncate:
+	default:
+		return fmt.Errorf("invalid long_names %q: must be %q or %q (%s)", c.LongNames, LongNamesHash, LongNamesTruncate, c.path)
+	}
+	c.LocalPhotos.LongNames = c.LongNames
+	c.LocalVideos.LongNames = c.LongNames
+	if c.MaxOpenFiles < 0 {
+		return fmt.Errorf("invalid max_open_files %d: must not be negative (%s)", c.MaxOpenFiles, c.path)
+	}
+	if c.MaxOpenFiles == 0 {
+		c.MaxOpenFiles = DefaultMaxOpenFiles
+	}
+	if err := c.Import.Validate(); err != nil {
+		return fmt.Errorf("invalid import config (%s): %w", c.path, err)
+	}
+	for _, dest := range []struct {
+		name string
+		dir  *string
+	}{{"photos dest", &c.Import.PhotosDest}, {"videos dest", &c.Import.VideosDest}} {
+		if *dest.dir == "" {
+			continue
+		}
+		dir, err := filepath.Abs(*dest.dir)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path for %s: %w", *dest.dir, err)
+		}
+		if info, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("invalid import %s: %w", dest.name, err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("invalid import %s %s: not a dir", dest.name, dir)
+		}
+		*dest.dir = dir
+	}
+	if c.Import.VideosDest != "" {
+		// Videos are imported into an upload queue, so it mustn't overlap the uploaded dir.
+		if err := CheckQueueAndUploadedRoots(c.Import.VideosDest, c.VideosUploadedRoot); err != nil {
+			return fmt.Errorf("invalid import videos dest (%s): %w", c.path, err)
+		}
+	}
+	if err := c.Upload.Validate(); err != nil {
+		return fmt.Errorf("invalid upload config (%s): %w", c.path, err)
+	}
+	c.Upload.CaptureLocation = c.Import.Location
+	if c.Upload.MoveFailedTo != "" {
+		failedDir, err := filepath.Abs(c.Upload.MoveFailedTo)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path for %s: %w", c.Upload.MoveFailedTo, err)
+		}
+		for _, uploadQueueRoot := range []string{c.PhotosUploadQueueDir, c.VideosUploadQueueRoot} {
+			queue, err := filepath.Abs(uploadQueueRoot)
+			if err != nil {
+				return fmt.Errorf("failed to get absolute path for %s: %w", uploadQueueRoot, err)
+			}
+			if failedDir == queue || isWithinDir(failedDir, queue) {
+				return fmt.Errorf("invalid upload move_failed_to %s: must not be inside upload queue dir %s (%s)", c.Upload.MoveFailedTo, uploadQueueRoot, c.path)
+			}
+		}
+		c.Upload.MoveFailedTo = failedDir
+	}
+	if err := c.Notifications.Validate(); err != nil {
+		return fmt.Errorf("invalid notifications config (%s): %w", c.path, err)
+	}
 	if err := c.GooglePhotos.Validate(); err != nil {
 		return fmt.Errorf("invalid google_photos config (%s): %w", c.path, err)
 	}
 	return nil
 }
 
+// CheckQueueAndUploadedRoots returns an error if the upload queue and uploaded roots are the same dir,
+// or one is inside the other, since moving uploaded files would then move them onto themselves
+// or back into the upload queue.
+func CheckQueueAndUploadedRoots(uploadQueueRoot, uploadedRoot string) error {
+	queue, err := filepath.Abs(uploadQueueRoot)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for %s: %w", uploadQueueRoot, err)
+	}
+	uploaded, err := filepath.Abs(uploadedRoot)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for %s: %w", uploadedRoot, err)
+	}
+	switch {
+	case queue == uploaded:
+		return fmt.Errorf("upload queue dir and uploaded dir must differ, but both are %s", uploadQueueRoot)
+	case isWithinDir(uploaded, queue):
+		return fmt.Errorf("uploaded dir %s must not be inside upload queue dir %s", uploadedRoot, uploadQueueRoot)
+	case isWithinDir(queue, uploaded):
+		return fmt.Errorf("upload queue dir %s must not be inside uploaded dir %s", uploadQueueRoot, uploadedRoot)
+	}
+	return nil
+}
+
+// isWithinDir returns whether path is inside dir. Both must be absolute and clean.
+func isWithinDir(path, dir string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
 // DefaultConfigPath returns the default path for the Camflow config file.
 func DefaultConfigPath() (string, error) {
 	dir, err := os.UserConfigDir()
@@ -180,6 +1035,9 @@ func LoadConfig(configPathFlag string) (CamflowConfig, error) {
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
+	// Options whose zero values aren't their defaults.
+	viper.SetDefault("upload.max_retries", DefaultMaxRetries)
+
 	if err := viper.ReadInConfig(); err != nil {
 		return CamflowConfig{}, fmt.Errorf("error reading (%s): %w", path, err)
 	}
@@ -189,8 +1047,8 @@ func LoadConfig(configPathFlag string) (CamflowConfig, error) {
 	}
 	config.LocalPhotos = LocalPhotosConfig{
 		ProcessQueueRoot: config.PhotosProcessQueueRoot,
-		UploadQueueDir:  config.PhotosUploadQueueDir,
-		UploadedRoot:    config.PhotosUploadedRoot,
+		UploadQueueDir:   config.PhotosUploadQueueDir,
+		UploadedRoot:     config.PhotosUploadedRoot,
 	}
 	config.LocalVideos = LocalVideosConfig{
 		UploadQueueRoot: config.VideosUploadQueueRoot,
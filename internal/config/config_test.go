@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,7 +28,7 @@ client_id = "file-client-id"
 
 	// Verify that without the code change, it likely fails (or we just implement the fix directly)
 	// But here we are writing the test that expects success *after* the change.
-	
+
 	cfg, err := LoadConfig(configPath)
 	require.NoError(t, err)
 
@@ -35,3 +36,349 @@ client_id = "file-client-id"
 	assert.Equal(t, "env-client-id", cfg.GooglePhotos.ClientId, "Environment variable should override config file for nested struct")
 	assert.Equal(t, "/env/photos", cfg.PhotosProcessQueueRoot, "Environment variable should override config file for top level field")
 }
+
+func TestLoadConfig_MaxRetries(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte("photos_process_queue_root = \"/tmp/photos\"\n"), 0644))
+	cfg, err := LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultMaxRetries, cfg.Upload.MaxRetries, "Retries should be on by default")
+
+	// 0 disables retries, rather than selecting the default.
+	require.NoError(t, os.WriteFile(configPath, []byte("[upload]\nmax_retries = 0\n"), 0644))
+	cfg, err = LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cfg.Upload.MaxRetries)
+}
+
+func TestImportConfig_Validate(t *testing.T) {
+	c := ImportConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, ZeroByteFilesSkip, c.ZeroByteFiles, "Zero-byte files should be skipped by default")
+
+	c = ImportConfig{ZeroByteFiles: ZeroByteFilesError}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, ZeroByteFilesError, c.ZeroByteFiles)
+
+	c = ImportConfig{ZeroByteFiles: "ignore"}
+	assert.ErrorContains(t, c.Validate(), "invalid zero_byte_files")
+
+	c = ImportConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, WriteProtectedError, c.WriteProtected, "Imports from write-protected cards should stop by default")
+
+	c = ImportConfig{WriteProtected: "ignore"}
+	assert.ErrorContains(t, c.Validate(), "invalid write_protected")
+
+	c = ImportConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, UnreadableDirsError, c.UnreadableDirs, "Unreadable dirs should fail imports by default")
+
+	c = ImportConfig{UnreadableDirs: "ignore"}
+	assert.ErrorContains(t, c.Validate(), "invalid unreadable_dirs")
+
+	c = ImportConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, PhotoFoldersDay, c.PhotoFolders, "Photos should be imported into day folders by default")
+
+	c = ImportConfig{PhotoFolders: PhotoFoldersYear}
+	require.NoError(t, c.Validate())
+
+	c = ImportConfig{PhotoFolders: "week"}
+	assert.ErrorContains(t, c.Validate(), "invalid photo_folders")
+
+	c = ImportConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, DefaultHashWorkers, c.HashWorkers)
+
+	c = ImportConfig{CopyBufferKiB: -1}
+	assert.ErrorContains(t, c.Validate(), "invalid copy_buffer_kib")
+	c = ImportConfig{CopyBufferKiB: MaxCopyBufferKiB + 1}
+	assert.ErrorContains(t, c.Validate(), "invalid copy_buffer_kib")
+
+	c = ImportConfig{HashWorkers: -1}
+	assert.ErrorContains(t, c.Validate(), "invalid hash_workers")
+
+	c = ImportConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, []string{"DCIM"}, c.MediaRoots, "Media should be imported from DCIM by default")
+
+	c = ImportConfig{MediaRoots: []string{"DCIM", "PRIVATE/M4ROOT/CLIP/"}}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, []string{"DCIM", "PRIVATE/M4ROOT/CLIP"}, c.MediaRoots)
+
+	for _, roots := range [][]string{{""}, {"/DCIM"}, {"../DCIM"}, {"DCIM", "DCIM/"}, {"PRIVATE", "PRIVATE/M4ROOT"}, {"PRIVATE/M4ROOT", "PRIVATE"}} {
+		c = ImportConfig{MediaRoots: roots}
+		assert.ErrorContains(t, c.Validate(), "invalid media_roots", "%q should be invalid", roots)
+	}
+}
+
+func TestUploadConfig_Validate(t *testing.T) {
+	c := UploadConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, UnratedInclude, c.Unrated, "Unrated files should be included by default")
+
+	c = UploadConfig{MinRating: 3, Unrated: UnratedExclude}
+	require.NoError(t, c.Validate())
+
+	c = UploadConfig{MinRating: 6}
+	assert.ErrorContains(t, c.Validate(), "invalid min_rating")
+
+	c = UploadConfig{Unrated: "maybe"}
+	assert.ErrorContains(t, c.Validate(), "invalid unrated")
+
+	c = UploadConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, MoveModeAuto, c.MoveMode, "Moves should detect the filesystems by default")
+
+	c = UploadConfig{MoveMode: "link"}
+	assert.ErrorContains(t, c.Validate(), "invalid move_mode")
+
+	c = UploadConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, AlbumAddFailureFail, c.AlbumAddFailure, "Album add failures should stop the upload by default")
+
+	c = UploadConfig{AlbumAddFailure: "ignore"}
+	assert.ErrorContains(t, c.Validate(), "invalid album_add_failure")
+
+	c = UploadConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, NonMediaSkip, c.NonMedia, "Non-media files should be left in the upload queue by default")
+
+	c = UploadConfig{NonMedia: "delete"}
+	assert.ErrorContains(t, c.Validate(), "invalid non_media")
+
+	c = UploadConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, OversizedSkip, c.Oversized, "Oversized files should be left in the upload queue by default")
+
+	c = UploadConfig{Oversized: "delete"}
+	assert.ErrorContains(t, c.Validate(), "invalid oversized")
+
+	c = UploadConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, UploadedDateName, c.UploadedDate, "Uploaded files should be dated by their names by default")
+
+	c = UploadConfig{UploadedDate: "mtime"}
+	assert.ErrorContains(t, c.Validate(), "invalid uploaded_date")
+
+	c = UploadConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, 0, c.MaxRetries)
+	assert.Equal(t, 1, c.MaxConsecutiveFailures, "Uploads should stop at the first failed file by default")
+
+	c = UploadConfig{FlattenAlbumsFromPath: -1}
+	assert.ErrorContains(t, c.Validate(), "invalid flatten_albums_from_path")
+
+	c = UploadConfig{MaxAlbumsPerItem: -1}
+	assert.ErrorContains(t, c.Validate(), "invalid max_albums_per_item")
+
+	c = UploadConfig{MaxRetries: -1}
+	assert.ErrorContains(t, c.Validate(), "invalid max_retries")
+
+	c = UploadConfig{MaxConsecutiveFailures: -1}
+	assert.ErrorContains(t, c.Validate(), "invalid max_consecutive_failures")
+
+	c = UploadConfig{QuarantineAfter: -1}
+	assert.ErrorContains(t, c.Validate(), "invalid quarantine_after")
+
+	c = UploadConfig{MaxNewAlbums: -1}
+	assert.ErrorContains(t, c.Validate(), "invalid max_new_albums")
+
+	c = UploadConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, DuplicateAlbumsWarn, c.DuplicateAlbums, "Duplicate albums should only be warned about by default")
+
+	c = UploadConfig{DuplicateAlbums: "newest"}
+	assert.ErrorContains(t, c.Validate(), "invalid duplicate_albums")
+
+	c = UploadConfig{AlbumIDs: []AlbumID{{Title: "Family", ID: "id-1"}}}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, map[string]string{"Family": "id-1"}, c.PinnedAlbumIDs())
+
+	c = UploadConfig{AlbumIDs: []AlbumID{{Title: "Family"}}}
+	assert.ErrorContains(t, c.Validate(), "must have a title and an id")
+
+	c = UploadConfig{AlbumIDs: []AlbumID{{Title: "Family", ID: "id-1"}, {Title: "Family", ID: "id-2"}}}
+	assert.ErrorContains(t, c.Validate(), "pinned more than once")
+
+	c = UploadConfig{Tag: strings.Repeat("é", MaxTagLength), TagDescription: true}
+	require.NoError(t, c.Validate(), "The tag length should be counted in characters")
+
+	c = UploadConfig{Tag: strings.Repeat("x", MaxTagLength+1)}
+	assert.ErrorContains(t, c.Validate(), "invalid tag")
+
+	c = UploadConfig{TagDescription: true}
+	assert.ErrorContains(t, c.Validate(), "invalid tag_description")
+}
+
+func TestGPPhotosConfig_Validate(t *testing.T) {
+	c := GPPhotosConfig{}
+	require.NoError(t, c.Validate())
+	assert.Equal(t, RawJpegPairsBoth, c.RawJpegPairs, "Both files of RAW+JPEG pairs should be uploaded by default")
+
+	c = GPPhotosConfig{RawJpegPairs: RawJpegPairsJpegOnly}
+	require.NoError(t, c.Validate())
+
+	c = GPPhotosConfig{RawJpegPairs: "jpeg"}
+	assert.ErrorContains(t, c.Validate(), "invalid raw_jpeg_pairs")
+}
+
+func TestGPPhotosConfig_GetDefaultAlbums(t *testing.T) {
+	c := GPPhotosConfig{}
+	assert.Empty(t, c.GetDefaultAlbums())
+
+	c = GPPhotosConfig{DefaultAlbum: "Camflow: Photos"}
+	assert.Equal(t, []string{"Camflow: Photos"}, c.GetDefaultAlbums(), "A single default_album should still be used")
+
+	c = GPPhotosConfig{DefaultAlbum: "Camflow: Photos", DefaultAlbums: []string{"Family", "", "Camflow: Photos"}}
+	assert.Equal(t, []string{"Camflow: Photos", "Family"}, c.GetDefaultAlbums())
+
+	v := GPVideosConfig{DefaultAlbums: []string{"Camflow: Videos", "Family"}}
+	assert.Equal(t, []string{"Camflow: Videos", "Family"}, v.GetDefaultAlbums())
+}
+
+func TestNotificationsConfig_Validate(t *testing.T) {
+	c := NotificationsConfig{}
+	require.NoError(t, c.Validate())
+
+	c = NotificationsConfig{Command: "say done", WebhookURL: "https://example.com/hook"}
+	require.NoError(t, c.Validate())
+
+	for _, webhookURL := range []string{"example.com/hook", "ftp://example.com/", "https://", "http://%zz/"} {
+		c = NotificationsConfig{WebhookURL: webhookURL}
+		assert.ErrorContains(t, c.Validate(), "invalid webhook_url", webhookURL)
+	}
+}
+
+func TestGooglePhotosConfig_SetBaseURL(t *testing.T) {
+	c := GooglePhotosConfig{}
+	require.NoError(t, c.SetBaseURL(""))
+	assert.Equal(t, DefaultGooglePhotosBaseURL, c.BaseURL)
+
+	require.NoError(t, c.SetBaseURL("http://localhost:8081/photos"))
+	assert.Equal(t, "http://localhost:8081/photos/", c.BaseURL, "A trailing slash should be added")
+
+	for _, baseURL := range []string{"localhost:8081", "ftp://example.com/", "/v1/", "https://example.com/?a=b", "http://%zz/"} {
+		assert.ErrorContains(t, c.SetBaseURL(baseURL), "invalid base_url", baseURL)
+	}
+}
+
+func TestCamflowConfig_Validate_Symlinks(t *testing.T) {
+	newConfig := func(symlinks string) CamflowConfig {
+		c := CamflowConfig{
+			PhotosProcessQueueRoot: "/photos/process",
+			PhotosUploadQueueDir:   "/photos/queue",
+			PhotosUploadedRoot:     "/photos/uploaded",
+			VideosUploadQueueRoot:  "/videos/queue",
+			VideosUploadedRoot:     "/videos/uploaded",
+			Symlinks:               symlinks,
+			GooglePhotos:           GooglePhotosConfig{ClientId: "id", ClientSecret: "secret", RedirectURI: "http://localhost:8080"},
+		}
+		c.LocalPhotos = LocalPhotosConfig{ProcessQueueRoot: c.PhotosProcessQueueRoot, UploadQueueDir: c.PhotosUploadQueueDir, UploadedRoot: c.PhotosUploadedRoot}
+		c.LocalVideos = LocalVideosConfig{UploadQueueRoot: c.VideosUploadQueueRoot, UploadedRoot: c.VideosUploadedRoot}
+		return c
+	}
+
+	c := newConfig("")
+	require.NoError(t, c.Validate())
+	assert.Equal(t, SymlinksSkip, c.Symlinks, "Symlinks should be skipped by default")
+	assert.Equal(t, SymlinksSkip, c.LocalPhotos.GetSymlinks())
+	assert.Equal(t, SymlinksSkip, c.LocalVideos.GetSymlinks())
+
+	c = newConfig(SymlinksFollowWithinRoot)
+	require.NoError(t, c.Validate())
+	assert.Equal(t, SymlinksFollowWithinRoot, c.LocalPhotos.GetSymlinks())
+
+	c = newConfig("always")
+	assert.ErrorContains(t, c.Validate(), "invalid symlinks")
+
+	c = newConfig("")
+	require.NoError(t, c.Validate())
+	assert.Equal(t, LongNamesHash, c.LongNames, "Long names should be hashed by default")
+	assert.Equal(t, LongNamesHash, c.LocalPhotos.GetLongNames())
+	assert.Equal(t, LongNamesHash, c.LocalVideos.GetLongNames())
+
+	c = newConfig("")
+	c.LongNames = "drop"
+	assert.ErrorContains(t, c.Validate(), "invalid long_names")
+
+	c = newConfig("")
+	require.NoError(t, c.Validate())
+	assert.Equal(t, DefaultMaxOpenFiles, c.MaxOpenFiles)
+
+	c = newConfig("")
+	c.MaxOpenFiles = -1
+	assert.ErrorContains(t, c.Validate(), "invalid max_open_files")
+}
+
+func TestCheckQueueAndUploadedRoots(t *testing.T) {
+	assert.NoError(t, CheckQueueAndUploadedRoots("/videos/queue", "/videos/uploaded"))
+	assert.NoError(t, CheckQueueAndUploadedRoots("/videos/queue", "/videos/queue-uploaded"), "A shared name prefix isn't nesting")
+
+	assert.ErrorContains(t, CheckQueueAndUploadedRoots("/videos/queue", "/videos/queue/"), "must differ")
+	assert.ErrorContains(t, CheckQueueAndUploadedRoots("/videos/queue", "/videos/queue/uploaded"), "must not be inside upload queue dir")
+	assert.ErrorContains(t, CheckQueueAndUploadedRoots("/videos/uploaded/queue", "/videos/uploaded"), "must not be inside uploaded dir")
+	assert.ErrorContains(t, CheckQueueAndUploadedRoots("/", "/videos/uploaded"), "must not be inside upload queue dir")
+}
+
+func TestCamflowConfig_Validate_QueueAndUploadedRoots(t *testing.T) {
+	c := CamflowConfig{
+		PhotosProcessQueueRoot: "/photos/process",
+		PhotosUploadQueueDir:   "/photos/queue",
+		PhotosUploadedRoot:     "/photos/queue",
+		VideosUploadQueueRoot:  "/videos/queue",
+		VideosUploadedRoot:     "/videos/uploaded",
+		GooglePhotos:           GooglePhotosConfig{ClientId: "id", ClientSecret: "secret", RedirectURI: "http://localhost:8080"},
+	}
+	c.LocalPhotos = LocalPhotosConfig{ProcessQueueRoot: c.PhotosProcessQueueRoot, UploadQueueDir: c.PhotosUploadQueueDir, UploadedRoot: c.PhotosUploadedRoot}
+	c.LocalVideos = LocalVideosConfig{UploadQueueRoot: c.VideosUploadQueueRoot, UploadedRoot: c.VideosUploadedRoot}
+	assert.ErrorContains(t, c.Validate(), "invalid photos dirs")
+
+	c.PhotosUploadedRoot = "/photos/uploaded"
+	c.LocalPhotos.UploadedRoot = c.PhotosUploadedRoot
+	c.VideosUploadedRoot = "/videos/queue/uploaded"
+	c.LocalVideos.UploadedRoot = c.VideosUploadedRoot
+	assert.ErrorContains(t, c.Validate(), "invalid videos dirs")
+
+	c.VideosUploadedRoot = "/videos/uploaded"
+	c.LocalVideos.UploadedRoot = c.VideosUploadedRoot
+	c.Upload.MoveFailedTo = "/videos/queue/failed"
+	assert.ErrorContains(t, c.Validate(), "invalid upload move_failed_to")
+
+	c.Upload.MoveFailedTo = "/videos/failed"
+	assert.NoError(t, c.Validate())
+}
+
+func TestCamflowConfig_Validate_ImportDests(t *testing.T) {
+	uploaded := t.TempDir()
+	c := CamflowConfig{
+		PhotosProcessQueueRoot: "/photos/process",
+		PhotosUploadQueueDir:   "/photos/queue",
+		PhotosUploadedRoot:     "/photos/uploaded",
+		VideosUploadQueueRoot:  "/videos/queue",
+		VideosUploadedRoot:     uploaded,
+		GooglePhotos:           GooglePhotosConfig{ClientId: "id", ClientSecret: "secret", RedirectURI: "http://localhost:8080"},
+	}
+	c.LocalPhotos = LocalPhotosConfig{ProcessQueueRoot: c.PhotosProcessQueueRoot, UploadQueueDir: c.PhotosUploadQueueDir, UploadedRoot: c.PhotosUploadedRoot}
+	c.LocalVideos = LocalVideosConfig{UploadQueueRoot: c.VideosUploadQueueRoot, UploadedRoot: c.VideosUploadedRoot}
+
+	dest := t.TempDir()
+	c.Import.PhotosDest = dest
+	c.Import.VideosDest = dest
+	require.NoError(t, c.Validate())
+	assert.Equal(t, dest, c.Import.PhotosDest)
+
+	c.Import.PhotosDest = filepath.Join(dest, "missing")
+	assert.ErrorContains(t, c.Validate(), "invalid import photos dest")
+
+	file := filepath.Join(dest, "file")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	c.Import.PhotosDest = file
+	assert.ErrorContains(t, c.Validate(), "not a dir")
+
+	c.Import.PhotosDest = ""
+	require.NoError(t, os.Mkdir(filepath.Join(uploaded, "dest"), 0755))
+	c.Import.VideosDest = filepath.Join(uploaded, "dest")
+	assert.ErrorContains(t, c.Validate(), "invalid import videos dest")
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// jsonSchemaDialect is the JSON Schema version of the schema that JSONSchema returns.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches the durations that time.ParseDuration accepts, eg "-1h" or "1h30m".
+const durationPattern = `^[-+]?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$|^[-+]?0$`
+
+// JSONSchema returns a JSON Schema of the config file, for editors to validate and complete configs.
+// It is generated from the mapstructure tags of CamflowConfig, so that it covers every option.
+// Options tagged `schema:"required"` are required, and the defaults are the values that Validate sets.
+func JSONSchema() ([]byte, error) {
+	schema := structSchema(reflect.TypeOf(CamflowConfig{}), reflect.ValueOf(schemaDefaults()))
+	schema["$schema"] = jsonSchemaDialect
+	schema["title"] = "camflow config"
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config schema: %w", err)
+	}
+	return data, nil
+}
+
+// schemaDefaults returns a config whose options are set to their defaults.
+// The required options are set to placeholders, so that Validate can run, but aren't defaults.
+func schemaDefaults() CamflowConfig {
+	c := CamflowConfig{
+		PhotosProcessQueueRoot: "/photos/process",
+		PhotosUploadQueueDir:   "/photos/queue",
+		PhotosUploadedRoot:     "/photos/uploaded",
+		VideosUploadQueueRoot:  "/videos/queue",
+		VideosUploadedRoot:     "/videos/uploaded",
+		GooglePhotos: GooglePhotosConfig{
+			ClientId:     "client-id",
+			ClientSecret: "client-secret",
+			// Set it to its default, since Validate warns when it isn't set.
+			RedirectURI: DefaultRedirectURI,
+		},
+	}
+	c.LocalPhotos = LocalPhotosConfig{ProcessQueueRoot: c.PhotosProcessQueueRoot, UploadQueueDir: c.PhotosUploadQueueDir, UploadedRoot: c.PhotosUploadedRoot}
+	c.LocalVideos = LocalVideosConfig{UploadQueueRoot: c.VideosUploadQueueRoot, UploadedRoot: c.VideosUploadedRoot}
+	if err := c.Validate(); err != nil {
+		// The placeholders are valid, so this is a bug.
+		panic(fmt.Sprintf("failed to validate default config: %v", err))
+	}
+	c.GooglePhotos.ClientId = ""
+	c.GooglePhotos.ClientSecret = ""
+	// LoadConfig sets it, since 0 disables retries.
+	c.Upload.MaxRetries = DefaultMaxRetries
+	return c
+}
+
+// structSchema returns the schema of an object with the mapstructure-tagged fields of t.
+// defaults is a value of t whose non-zero fields, other than the required ones, are defaults.
+func structSchema(t reflect.Type, defaults reflect.Value) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if !field.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		var fieldSchema map[string]any
+		if field.Type.Kind() == reflect.Struct {
+			fieldSchema = structSchema(field.Type, defaults.Field(i))
+			// A section with required options is itself required.
+			if _, ok := fieldSchema["required"]; ok {
+				required = append(required, key)
+			}
+		} else {
+			fieldSchema = typeSchema(field.Type)
+			if field.Tag.Get("schema") == "required" {
+				required = append(required, key)
+			} else if value := defaults.Field(i); !value.IsZero() {
+				fieldSchema["default"] = defaultValue(value)
+			}
+		}
+		properties[key] = fieldSchema
+	}
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// typeSchema returns the schema of a non-struct option of type t.
+func typeSchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		elem := t.Elem()
+		if elem.Kind() == reflect.Struct {
+			return map[string]any{"type": "array", "items": structSchema(elem, reflect.Zero(elem))}
+		}
+		return map[string]any{"type": "array", "items": typeSchema(elem)}
+	default:
+		// Only reachable if an option of a new kind is added, which this should then handle.
+		panic(fmt.Sprintf("unsupported config option type %s", t))
+	}
+}
+
+// defaultValue returns the default value v as it is written in the config file.
+func defaultValue(v reflect.Value) any {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return v.Interface()
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkSchemaNode checks that node is a well-formed schema of the subset of JSON Schema that
+// JSONSchema uses, and returns the dotted paths of the options that it describes.
+func checkSchemaNode(t *testing.T, path string, node map[string]any) []string {
+	t.Helper()
+	for keyword := range node {
+		assert.Contains(t, []string{"$schema", "title", "type", "properties", "additionalProperties", "required", "items", "default", "pattern"}, keyword, "Unexpected keyword at %q", path)
+	}
+	switch node["type"] {
+	case "object":
+		properties, ok := node["properties"].(map[string]any)
+		require.True(t, ok, "Object at %q should have properties", path)
+		if required, ok := node["required"]; ok {
+			for _, key := range required.([]any) {
+				assert.Contains(t, properties, key, "Required option at %q should be a property", path)
+			}
+		}
+		var paths []string
+		for key, property := range properties {
+			propertyPath := key
+			if path != "" {
+				propertyPath = path + "." + key
+			}
+			paths = append(paths, checkSchemaNode(t, propertyPath, property.(map[string]any))...)
+		}
+		return paths
+	case "array":
+		items, ok := node["items"].(map[string]any)
+		require.True(t, ok, "Array at %q should have items", path)
+		checkSchemaNode(t, path+"[]", items)
+		return []string{path}
+	case "string", "boolean", "integer", "number":
+		return []string{path}
+	default:
+		t.Errorf("Invalid type %v at %q", node["type"], path)
+		return nil
+	}
+}
+
+// configOptionPaths returns the dotted paths of the options of the config struct t.
+func configOptionPaths(t reflect.Type, prefix string) []string {
+	var paths []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if !field.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			paths = append(paths, configOptionPaths(field.Type, prefix+key+".")...)
+		} else {
+			paths = append(paths, prefix+key)
+		}
+	}
+	return paths
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := JSONSchema()
+	require.NoError(t, err)
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(data, &schema))
+	assert.Equal(t, jsonSchemaDialect, schema["$schema"])
+
+	paths := checkSchemaNode(t, "", schema)
+	assert.ElementsMatch(t, configOptionPaths(reflect.TypeOf(CamflowConfig{}), ""), paths, "The schema should cover every config option")
+
+	property := func(path ...string) map[string]any {
+		node := schema
+		for _, key := range path {
+			node = node["properties"].(map[string]any)[key].(map[string]any)
+		}
+		return node
+	}
+	assert.ElementsMatch(t, []any{
+		"photos_process_queue_root", "photos_upload_queue_dir", "photos_uploaded_root",
+		"videos_upload_queue_root", "videos_uploaded_root", "google_photos",
+	}, schema["required"])
+	assert.ElementsMatch(t, []any{"client_id", "client_secret"}, property("google_photos")["required"])
+
+	assert.Equal(t, SymlinksSkip, property("symlinks")["default"])
+	assert.Equal(t, float64(DefaultHashWorkers), property("import", "hash_workers")["default"])
+	assert.Equal(t, MoveModeAuto, property("upload", "move_mode")["default"])
+	assert.Equal(t, DefaultRedirectURI, property("google_photos", "redirect_uri")["default"])
+	assert.NotContains(t, property("google_photos", "client_id"), "default", "Placeholders shouldn't be defaults")
+	assert.NotContains(t, property("photos_uploaded_root"), "default", "Placeholders shouldn't be defaults")
+	assert.Equal(t, "string", property("import", "camera_clock_offset")["type"])
+	assert.Equal(t, "integer", property("upload", "min_rating")["type"])
+	assert.Equal(t, "boolean", property("upload", "safe")["type"])
+}
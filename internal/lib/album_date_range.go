@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// itemDate returns the date of the media item, based on the date prefix of its file name,
+// falling back to its modification time.
+func itemDate(fileInfo itemFileInfo) time.Time {
+	year, month, day, err := parseDatePrefix(filepath.Base(fileInfo.path))
+	if err == nil {
+		if date, err := time.Parse("2006-01-02", year+"-"+month+"-"+day); err == nil {
+			return date
+		}
+	}
+	y, m, d := fileInfo.modTime.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// albumDateRange is the range of the dates of the media items that camflow added to an album,
+// which it appended to the album's title.
+type albumDateRange struct {
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+// newAlbumDateRange returns the range of dates, which must not be empty.
+func newAlbumDateRange(dates []time.Time) albumDateRange {
+	r := albumDateRange{First: dates[0], Last: dates[0]}
+	for _, d := range dates[1:] {
+		if d.Before(r.First) {
+			r.First = d
+		}
+		if d.After(r.Last) {
+			r.Last = d
+		}
+	}
+	return r
+}
+
+// albumTitleWithDateRange returns title with the range of dates appended, eg "Japan (May 3–17)".
+// The year is only included when the range spans years.
+func albumTitleWithDateRange(title string, dates []time.Time) string {
+	if len(dates) == 0 {
+		return title
+	}
+	r := newAlbumDateRange(dates)
+	first, last := r.First, r.Last
+
+	var dateRange string
+	switch {
+	case first.Year() != last.Year():
+		dateRange = first.Format("Jan 2, 2006") + "–" + last.Format("Jan 2, 2006")
+	case first.Month() != last.Month():
+		dateRange = first.Format("Jan 2") + "–" + last.Format("Jan 2")
+	case first.Day() != last.Day():
+		dateRange = first.Format("Jan 2") + "–" + last.Format("2")
+	default:
+		dateRange = first.Format("Jan 2")
+	}
+	return fmt.Sprintf("%s (%s)", title, dateRange)
+}
+
+// renameAlbumsWithDateRange renames each album in albumDates that was created by this process, or that an
+// earlier run renamed, to append the range of the dates of the media items added to it, including those
+// added by earlier runs. The ranges are recorded in cache, under the titles in albumDates, so that later
+// runs find the renamed albums by those titles and extend their ranges.
+// albumDates maps album titles to the dates of the media items that were added to the album.
+// Renaming failures are logged rather than returned, because the media items were already uploaded.
+func renameAlbumsWithDateRange(ctx context.Context, albumsService AppAlbumsService, cache *albumCache, albumDates map[string][]time.Time, albumTitleToIdMap map[string]string, limiter *rate.Limiter, dryRun bool) {
+	titles := make([]string, 0, len(albumDates))
+	for title := range albumDates {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+
+	for _, title := range titles {
+		dates := albumDates[title]
+		prevRange, renamed := cache.dateRange(title)
+		if renamed {
+			dates = append([]time.Time{prevRange.First, prevRange.Last}, dates...)
+		} else if !cache.wasCreated(title) {
+			continue
+		}
+		newTitle := albumTitleWithDateRange(title, dates)
+		if renamed && newTitle == albumTitleWithDateRange(title, []time.Time{prevRange.First, prevRange.Last}) {
+			continue
+		}
+		if dryRun {
+			fmt.Printf("Would rename album '%s' to '%s'\n", title, newTitle)
+			continue
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			logger.Warn("Rate limiter error before renaming album",
+				slog.String("album_title", title),
+				slog.String("error", err.Error()))
+			return
+		}
+		id := albumTitleToIdMap[title]
+		if _, err := albumsService.UpdateTitle(ctx, id, newTitle); err != nil {
+			logger.Warn("Failed to rename album with date range",
+				slog.String("album_title", title),
+				slog.String("new_title", newTitle),
+				slog.String("error", err.Error()))
+			continue
+		}
+		fmt.Printf("Renamed album '%s' to '%s'\n", title, newTitle)
+		if err := cache.recordDateRange(title, id, newAlbumDateRange(dates)); err != nil {
+			logger.Warn("Failed to record date range of renamed album",
+				slog.String("album_title", title),
+				slog.String("error", err.Error()))
+		}
+	}
+}
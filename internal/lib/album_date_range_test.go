@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestAlbumTitleWithDateRange(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		require.NoError(t, err)
+		return d
+	}
+
+	for _, tt := range []struct {
+		name  string
+		dates []string
+		want  string
+	}{
+		{name: "NoDates", dates: nil, want: "Japan"},
+		{name: "SingleDay", dates: []string{"2024-05-03", "2024-05-03"}, want: "Japan (May 3)"},
+		{name: "SameMonth", dates: []string{"2024-05-10", "2024-05-17", "2024-05-03"}, want: "Japan (May 3–17)"},
+		{name: "SpansMonths", dates: []string{"2024-06-02", "2024-05-28"}, want: "Japan (May 28–Jun 2)"},
+		{name: "SpansYears", dates: []string{"2024-01-02", "2023-12-28"}, want: "Japan (Dec 28, 2023–Jan 2, 2024)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var dates []time.Time
+			for _, s := range tt.dates {
+				dates = append(dates, date(s))
+			}
+			assert.Equal(t, tt.want, albumTitleWithDateRange("Japan", dates))
+		})
+	}
+}
+
+func TestItemDate(t *testing.T) {
+	modTime := time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC),
+		itemDate(itemFileInfo{path: "/queue/2024-05-03-IMG_0001.JPG", modTime: modTime}))
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		itemDate(itemFileInfo{path: "/queue/IMG_0001.JPG", modTime: modTime}),
+		"Files without a date prefix should use their modification time")
+}
+
+func TestRenameAlbumsWithDateRange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockAlbums := NewMockAppAlbumsService(ctrl)
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	may := func(day int) time.Time { return time.Date(2024, 5, day, 0, 0, 0, 0, time.UTC) }
+
+	cachePath := filepath.Join(t.TempDir(), "album_cache.json")
+	cache := &albumCache{Albums: map[string]string{"Japan": "id-japan", "Existing": "id-existing"}, path: cachePath}
+	cache.markCreated("Japan")
+	albumDates := map[string][]time.Time{
+		"Japan":    {may(3), may(17)},
+		"Existing": {may(3)},
+	}
+
+	// Only the album created by this process is renamed.
+	mockAlbums.EXPECT().UpdateTitle(gomock.Any(), "id-japan", "Japan (May 3–17)").
+		Return(&albums.Album{ID: "id-japan", Title: "Japan (May 3–17)"}, nil)
+	renameAlbumsWithDateRange(context.Background(), mockAlbums, cache, albumDates, cache.Albums, limiter, false)
+
+	// A later run finds the renamed album by its configured title, and extends its range.
+	cache, err := loadAlbumCache(cachePath)
+	require.NoError(t, err)
+	assert.Equal(t, "id-japan", cache.Albums["Japan"], "Cache should keep the configured title")
+	mockAlbums.EXPECT().UpdateTitle(gomock.Any(), "id-japan", "Japan (May 3–20)").
+		Return(&albums.Album{ID: "id-japan", Title: "Japan (May 3–20)"}, nil)
+	renameAlbumsWithDateRange(context.Background(), mockAlbums, cache, map[string][]time.Time{"Japan": {may(20)}}, cache.Albums, limiter, false)
+
+	// Dates within the range don't rename the album again.
+	renameAlbumsWithDateRange(context.Background(), mockAlbums, cache, map[string][]time.Time{"Japan": {may(10)}}, cache.Albums, limiter, false)
+	assert.Equal(t, albumDateRange{First: may(3), Last: may(20)}, cache.DateRanges["Japan"])
+}
+
+func TestFindListedAlbum_RenamedWithDateRange(t *testing.T) {
+	may := func(day int) time.Time { return time.Date(2024, 5, day, 0, 0, 0, 0, time.UTC) }
+	cache := &albumCache{DateRanges: map[string]albumDateRange{"Japan": {First: may(3), Last: may(17)}}}
+	album, found, err := cache.findListedAlbum("Japan", []albums.Album{{ID: "id-other", Title: "Japan 2023"}, {ID: "id-japan", Title: "Japan (May 3–17)"}})
+	require.NoError(t, err)
+	assert.True(t, found, "An album listed under its renamed title should be found by its configured title")
+	assert.Equal(t, "id-japan", album.ID)
+}
+
+func TestAlbumsServiceWrapperUpdateTitle(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/albums/album-1" {
+			http.Error(w, `{"error": {"code": 404}}`, http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, http.MethodPatch, r.Method)
+		assert.Equal(t, "title", r.URL.Query().Get("updateMask"))
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "Japan (May 3–17)", body["title"])
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": "album-1", "title": body["title"], "isWriteable": true})
+	}))
+	defer server.Close()
+
+	s := &albumsServiceWrapper{httpClient: server.Client(), baseURL: server.URL + "/"}
+	album, err := s.UpdateTitle(context.Background(), "album-1", "Japan (May 3–17)")
+	require.NoError(t, err)
+	assert.Equal(t, &albums.Album{ID: "album-1", Title: "Japan (May 3–17)", IsWriteable: true}, album)
+
+	_, err = s.UpdateTitle(context.Background(), "missing", "x")
+	assert.ErrorContains(t, err, "failed to update album missing")
+}
@@ -0,0 +1,226 @@
+package lib
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// itemAlbums are the albums that a media item is added to.
+type itemAlbums struct {
+	// titles are the titles of all of the albums, in the order that the media item is added to them.
+	titles []string
+	// keywordTitles are the titles of the label, subject, and unmatched albums among titles.
+	keywordTitles []string
+}
+
+// resolveAlbums returns the albums that each of items is added to under the config, by path.
+// exifs is the metadata of items, and uploadQueueRoot is the dir that their paths are under,
+// which path albums are named relative to.
+func resolveAlbums(items []itemFileInfo, exifs []ExifData, uploadQueueRoot string, gpConfig GPConfig, uploadConfig config.UploadConfig) (map[string]itemAlbums, error) {
+	exifsByPath := make(map[string]ExifData, len(exifs))
+	for _, exif := range exifs {
+		exifsByPath[exif.Path] = exif
+	}
+	defaultAlbums := gpConfig.GetDefaultAlbums()
+	labelAlbums := gpConfig.GetLabelAlbums()
+	subjectAlbums := gpConfig.GetSubjectAlbums()
+	unmatchedAlbum := gpConfig.GetUnmatchedAlbum()
+
+	albumsByPath := make(map[string]itemAlbums, len(items))
+	for _, item := range items {
+		exif := exifsByPath[item.path]
+		var albums itemAlbums
+		if len(labelAlbums) != 0 || len(subjectAlbums) != 0 || unmatchedAlbum != "" {
+			albums.keywordTitles = additionalAlbumTitles(exif, labelAlbums, subjectAlbums, unmatchedAlbum)
+		}
+		albums.titles = append(make([]string, 0, len(albums.keywordTitles)+2+len(defaultAlbums)), albums.keywordTitles...)
+		if gpConfig.GetCameraModelAlbums() && exif.Model != "" && !slices.Contains(albums.titles, exif.Model) {
+			albums.titles = append(albums.titles, exif.Model)
+		}
+		pathAlbum, err := pathAlbumTitle(uploadQueueRoot, item.path, uploadConfig.FlattenAlbumsFromPath)
+		if err != nil {
+			return nil, err
+		}
+		if pathAlbum != "" && !slices.Contains(albums.titles, pathAlbum) {
+			albums.titles = append(albums.titles, pathAlbum)
+		}
+		// Media items that matched a label or subject album can skip the default albums.
+		matchedKeywordAlbum := slices.ContainsFunc(albums.keywordTitles, func(albumTitle string) bool { return albumTitle != unmatchedAlbum })
+		if !gpConfig.GetDefaultAlbumOnlyWhenUnmatched() || !matchedKeywordAlbum {
+			for _, albumTitle := range defaultAlbums {
+				if !slices.Contains(albums.titles, albumTitle) {
+					albums.titles = append(albums.titles, albumTitle)
+				}
+			}
+		}
+		if uploadConfig.MaxAlbumsPerItem > 0 && len(albums.titles) > uploadConfig.MaxAlbumsPerItem {
+			var skippedTitles []string
+			albums, skippedTitles = capAlbums(albums, defaultAlbums, uploadConfig.MaxAlbumsPerItem)
+			logger.Warn("Skipping albums over upload.max_albums_per_item",
+				slog.String("path", item.path),
+				slog.Int("max_albums_per_item", uploadConfig.MaxAlbumsPerItem),
+				slog.Any("skipped_albums", skippedTitles))
+		}
+		albumsByPath[item.path] = albums
+	}
+	return albumsByPath, nil
+}
+
+// capAlbums returns albums with only maxAlbums of its titles, and the titles that it skipped.
+// The default albums are kept first, then the other albums in the order that they were added to titles,
+// ie the label album, the subject albums in the order of the subjects, and then the camera model and path
+// albums. The kept titles stay in their order in albums.
+func capAlbums(albums itemAlbums, defaultAlbums []string, maxAlbums int) (itemAlbums, []string) {
+	keep := make(map[string]bool, maxAlbums)
+	for _, albumTitle := range slices.Concat(defaultAlbums, albums.titles) {
+		if len(keep) == maxAlbums {
+			break
+		}
+		if slices.Contains(albums.titles, albumTitle) {
+			keep[albumTitle] = true
+		}
+	}
+
+	var capped itemAlbums
+	var skippedTitles []string
+	for _, albumTitle := range albums.titles {
+		if keep[albumTitle] {
+			capped.titles = append(capped.titles, albumTitle)
+		} else {
+			skippedTitles = append(skippedTitles, albumTitle)
+		}
+	}
+	for _, albumTitle := range albums.keywordTitles {
+		if keep[albumTitle] {
+			capped.keywordTitles = append(capped.keywordTitles, albumTitle)
+		}
+	}
+	return capped, skippedTitles
+}
+
+// AlbumMapping describes the albums that a file is added to under the current config.
+type AlbumMapping struct {
+	Path   string   `json:"path"`
+	Albums []string `json:"albums"`
+	// MediaItemID is the media item that the file was uploaded as, from the upload ledger, if camflow recorded it.
+	MediaItemID string `json:"media_item_id,omitempty"`
+}
+
+// PhotosAlbumMapping returns the albums that each photo in the upload queue, or with uploaded, in the
+// uploaded dir, is added to under the current config, sorted by path. It reads the metadata of the photos,
+// but doesn't call the Google Photos API.
+func PhotosAlbumMapping(ctx context.Context, cfg config.CamflowConfig, cacheDir string, uploaded bool) ([]AlbumMapping, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return albumMapping(ctx, cacheDir, &cfg.LocalPhotos, &cfg.GooglePhotos.Photos, cfg.Upload, uploaded)
+}
+
+// VideosAlbumMapping is as PhotosAlbumMapping, for videos.
+func VideosAlbumMapping(ctx context.Context, cfg config.CamflowConfig, cacheDir string, uploaded bool) ([]AlbumMapping, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return albumMapping(ctx, cacheDir, &cfg.LocalVideos, &cfg.GooglePhotos.Videos, cfg.Upload, uploaded)
+}
+
+func albumMapping(ctx context.Context, cacheDir string, localConfig LocalConfig, gpConfig GPConfig, uploadConfig config.UploadConfig, uploaded bool) ([]AlbumMapping, error) {
+	root := localConfig.GetUploadQueueRoot()
+	if uploaded {
+		root = localConfig.GetUploadedRoot()
+		// Files are moved to date dirs of the uploaded dir, which aren't the dirs they had in the upload queue.
+		if !uploadConfig.KeepQueueStructure {
+			uploadConfig.FlattenAlbumsFromPath = 0
+		}
+	}
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil, nil
+	}
+	items, _, err := scanUploadQueue(root, localConfig.GetSymlinks())
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	paths := make([]string, len(items))
+	for i, item := range items {
+		paths[i] = item.path
+	}
+	exifs, err := getExifMetadata(ctx, paths, nil)
+	if err != nil {
+		return nil, err
+	}
+	albumsByPath, err := resolveAlbums(items, exifs, root, gpConfig, uploadConfig)
+	if err != nil {
+		return nil, err
+	}
+	mediaItemIDs, err := newUploadLedger(getUploadLedgerPath(cacheDir)).mediaItemIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	mappings := make([]AlbumMapping, 0, len(items))
+	for _, path := range paths {
+		mappings = append(mappings, AlbumMapping{
+			Path:        path,
+			Albums:      albumsByPath[path].titles,
+			MediaItemID: mediaItemIDs[filepath.Base(path)],
+		})
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].Path < mappings[j].Path })
+	return mappings, nil
+}
+
+// WriteAlbumMappingCSV writes mappings to w as CSV, with a row for each file and album, and a row
+// without an album for each file that isn't added to any.
+func WriteAlbumMappingCSV(w io.Writer, mappings []AlbumMapping) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"path", "album", "media_item_id"}); err != nil {
+		return fmt.Errorf("failed to write album mapping: %w", err)
+	}
+	for _, mapping := range mappings {
+		albums := mapping.Albums
+		if len(albums) == 0 {
+			albums = []string{""}
+		}
+		for _, album := range albums {
+			if err := cw.Write([]string{mapping.Path, album, mapping.MediaItemID}); err != nil {
+				return fmt.Errorf("failed to write album mapping: %w", err)
+			}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write album mapping: %w", err)
+	}
+	return nil
+}
+
+// WriteAlbumMappingJSON writes mappings to w as a JSON array.
+func WriteAlbumMappingJSON(w io.Writer, mappings []AlbumMapping) error {
+	// Write files without albums, and no files, as empty arrays rather than null.
+	out := make([]AlbumMapping, len(mappings))
+	for i, mapping := range mappings {
+		if mapping.Albums == nil {
+			mapping.Albums = []string{}
+		}
+		out[i] = mapping
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("failed to write album mapping: %w", err)
+	}
+	return nil
+}
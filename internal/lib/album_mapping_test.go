@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhotosAlbumMapping(t *testing.T) {
+	cfg := newTestConfig(t, "Camflow: Photos", "")
+	cfg.GooglePhotos.Photos.LabelAlbums = []config.KeyAlbum{{Key: "Red", Album: "Favorites"}}
+	cfg.GooglePhotos.Photos.CameraModelAlbums = true
+	cfg.Upload.FlattenAlbumsFromPath = 1
+	cacheDir := t.TempDir()
+
+	queuedPath := filepath.Join(cfg.PhotosUploadQueueDir, "trip", "2024-01-28-IMG_0001.JPG")
+	uploadedPath := filepath.Join(cfg.PhotosUploadedRoot, "2024", "01", "27", "2024-01-27-IMG_0002.JPG")
+	for _, path := range []string{queuedPath, uploadedPath} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("content"), 0644))
+	}
+	require.NoError(t, newUploadLedger(getUploadLedgerPath(cacheDir)).record(context.Background(), uploadedPath, 0, "media-id-2", "", nil, time.Now()))
+
+	// Put an exiftool on the PATH that reports the metadata of both files.
+	exifOutput, err := json.Marshal([]map[string]string{
+		{"SourceFile": queuedPath, "Label": "Red", "Model": "Canon EOS R5"},
+		{"SourceFile": uploadedPath},
+	})
+	require.NoError(t, err)
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "exiftool"), []byte("#!/bin/sh\ncat <<'EOF'\n"+string(exifOutput)+"\nEOF\n"), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	mappings, err := PhotosAlbumMapping(context.Background(), cfg, cacheDir, false /* uploaded */)
+	require.NoError(t, err)
+	assert.Equal(t, []AlbumMapping{
+		{Path: queuedPath, Albums: []string{"Favorites", "Canon EOS R5", "trip", "Camflow: Photos"}},
+	}, mappings)
+
+	// The date dirs of the uploaded dir aren't path albums.
+	mappings, err = PhotosAlbumMapping(context.Background(), cfg, cacheDir, true /* uploaded */)
+	require.NoError(t, err)
+	assert.Equal(t, []AlbumMapping{
+		{Path: uploadedPath, Albums: []string{"Camflow: Photos"}, MediaItemID: "media-id-2"},
+	}, mappings)
+}
+
+func TestResolveAlbums_MaxAlbumsPerItem(t *testing.T) {
+	cfg := newTestConfig(t, "Camflow: Photos", "")
+	cfg.GooglePhotos.Photos.LabelAlbums = []config.KeyAlbum{{Key: "Red", Album: "Favorites"}}
+	cfg.GooglePhotos.Photos.SubjectAlbums = []config.KeyAlbum{
+		{Key: "alice", Album: "Alice"},
+		{Key: "bob", Album: "Bob"},
+		{Key: "carol", Album: "Carol"},
+	}
+	cfg.GooglePhotos.Photos.CameraModelAlbums = true
+	cfg.Upload.FlattenAlbumsFromPath = 1
+	root := cfg.PhotosUploadQueueDir
+	manyPath := filepath.Join(root, "trip", "2024-01-28-IMG_0001.JPG")
+	fewPath := filepath.Join(root, "2024-01-28-IMG_0002.JPG")
+	items := []itemFileInfo{{path: manyPath}, {path: fewPath}}
+	exifs := []ExifData{
+		{Path: manyPath, Label: "Red", Subjects: []string{"carol", "alice", "bob"}, Model: "Canon EOS R5"},
+		{Path: fewPath, Subjects: []string{"bob"}},
+	}
+
+	albums, err := resolveAlbums(items, exifs, root, &cfg.GooglePhotos.Photos, cfg.Upload)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Favorites", "Carol", "Alice", "Bob", "Canon EOS R5", "trip", "Camflow: Photos"}, albums[manyPath].titles)
+
+	// The default album is kept first, then the label album and the first subjects.
+	cfg.Upload.MaxAlbumsPerItem = 3
+	albums, err = resolveAlbums(items, exifs, root, &cfg.GooglePhotos.Photos, cfg.Upload)
+	require.NoError(t, err)
+	assert.Equal(t, itemAlbums{
+		titles:        []string{"Favorites", "Carol", "Camflow: Photos"},
+		keywordTitles: []string{"Favorites", "Carol"},
+	}, albums[manyPath])
+	assert.Equal(t, []string{"Bob", "Camflow: Photos"}, albums[fewPath].titles, "Files under the cap should keep all of their albums")
+
+	cfg.Upload.MaxAlbumsPerItem = 1
+	albums, err = resolveAlbums(items, exifs, root, &cfg.GooglePhotos.Photos, cfg.Upload)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Camflow: Photos"}, albums[manyPath].titles)
+	assert.Empty(t, albums[manyPath].keywordTitles)
+}
+
+func TestWriteAlbumMapping(t *testing.T) {
+	mappings := []AlbumMapping{
+		{Path: "/queue/a.jpg", Albums: []string{"Favorites", "Camflow, Photos"}, MediaItemID: "media-id"},
+		{Path: "/queue/b.jpg"},
+	}
+
+	var csvOut bytes.Buffer
+	require.NoError(t, WriteAlbumMappingCSV(&csvOut, mappings))
+	assert.Equal(t, "path,album,media_item_id\n"+
+		"/queue/a.jpg,Favorites,media-id\n"+
+		"/queue/a.jpg,\"Camflow, Photos\",media-id\n"+
+		"/queue/b.jpg,,\n", csvOut.String())
+
+	var jsonOut bytes.Buffer
+	require.NoError(t, WriteAlbumMappingJSON(&jsonOut, mappings))
+	var decoded []map[string]any
+	require.NoError(t, json.Unmarshal(jsonOut.Bytes(), &decoded))
+	require.Len(t, decoded, 2)
+	assert.Equal(t, []any{"Favorites", "Camflow, Photos"}, decoded[0]["albums"])
+	assert.Equal(t, "media-id", decoded[0]["media_item_id"])
+	assert.Equal(t, []any{}, decoded[1]["albums"], "Files without albums should have an empty list")
+	assert.NotContains(t, decoded[1], "media_item_id")
+}
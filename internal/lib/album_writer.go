@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// albumWriter adds media items to, and removes them from, albums. Google Photos limits the rate of album writes
+// separately from uploads and can reject concurrent writes to the same album, so albumWriter
+// serializes the adds to each album and rate limits all adds with its own limiter.
+type albumWriter struct {
+	albumsService AppAlbumsService
+	limiter       *rate.Limiter
+
+	mu         sync.Mutex
+	albumLocks map[string]*sync.Mutex // Album ID -> lock held while adding to the album.
+}
+
+// newAlbumWriter returns an albumWriter that adds at most addsPerSecond times per second.
+func newAlbumWriter(albumsService AppAlbumsService, addsPerSecond float64) *albumWriter {
+	return &albumWriter{
+		albumsService: albumsService,
+		limiter:       rate.NewLimiter(rate.Limit(addsPerSecond), 1),
+		albumLocks:    make(map[string]*sync.Mutex),
+	}
+}
+
+// albumLock returns the lock for albumID.
+func (w *albumWriter) albumLock(albumID string) *sync.Mutex {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	lock, ok := w.albumLocks[albumID]
+	if !ok {
+		lock = &sync.Mutex{}
+		w.albumLocks[albumID] = lock
+	}
+	return lock
+}
+
+// addMediaItems adds the media items to the album albumID.
+func (w *albumWriter) addMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	lock := w.albumLock(albumID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := w.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter error before adding to album %s: %w", albumID, err)
+	}
+	return w.albumsService.AddMediaItems(ctx, albumID, mediaItemIDs)
+}
+
+// removeMediaItems removes the media items from the album albumID. It shares the adds' rate limit.
+func (w *albumWriter) removeMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	lock := w.albumLock(albumID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := w.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter error before removing from album %s: %w", albumID, err)
+	}
+	return w.albumsService.RemoveMediaItems(ctx, albumID, mediaItemIDs)
+}
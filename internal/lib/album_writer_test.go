@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+// concurrencyTrackingAlbums is an AppAlbumsService that records the maximum number of
+// concurrent AddMediaItems calls per album.
+type concurrencyTrackingAlbums struct {
+	mu           sync.Mutex
+	inFlight     map[string]int
+	maxInFlight  map[string]int
+	addedItemIDs map[string][]string
+}
+
+func (a *concurrencyTrackingAlbums) List(ctx context.Context) ([]albums.Album, error) {
+	return nil, nil
+}
+
+func (a *concurrencyTrackingAlbums) ListPage(ctx context.Context, pageSize int) ([]albums.Album, error) {
+	return nil, nil
+}
+
+func (a *concurrencyTrackingAlbums) Create(ctx context.Context, title string) (*albums.Album, error) {
+	return &albums.Album{ID: title, Title: title}, nil
+}
+
+func (a *concurrencyTrackingAlbums) UpdateTitle(ctx context.Context, albumID string, title string) (*albums.Album, error) {
+	return &albums.Album{ID: albumID, Title: title}, nil
+}
+
+func (a *concurrencyTrackingAlbums) RemoveMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	return nil
+}
+
+func (a *concurrencyTrackingAlbums) AddMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	a.mu.Lock()
+	a.inFlight[albumID]++
+	a.maxInFlight[albumID] = max(a.maxInFlight[albumID], a.inFlight[albumID])
+	a.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond) // Give other adds a chance to overlap.
+
+	a.mu.Lock()
+	a.inFlight[albumID]--
+	a.addedItemIDs[albumID] = append(a.addedItemIDs[albumID], mediaItemIDs...)
+	a.mu.Unlock()
+	return nil
+}
+
+func TestAlbumWriterSerializesAddsPerAlbum(t *testing.T) {
+	fake := &concurrencyTrackingAlbums{
+		inFlight:     make(map[string]int),
+		maxInFlight:  make(map[string]int),
+		addedItemIDs: make(map[string][]string),
+	}
+	w := newAlbumWriter(fake, float64(rate.Inf))
+
+	const numAdds = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*numAdds)
+	for i := 0; i < numAdds; i++ {
+		for _, albumID := range []string{"album-a", "album-b"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- w.addMediaItems(context.Background(), albumID, []string{"item"})
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, fake.maxInFlight["album-a"], "Adds to the same album should be serialized")
+	assert.Equal(t, 1, fake.maxInFlight["album-b"], "Adds to the same album should be serialized")
+	assert.Len(t, fake.addedItemIDs["album-a"], numAdds)
+	assert.Len(t, fake.addedItemIDs["album-b"], numAdds)
+}
+
+func TestAlbumWriterRateLimit(t *testing.T) {
+	fake := &concurrencyTrackingAlbums{
+		inFlight:     make(map[string]int),
+		maxInFlight:  make(map[string]int),
+		addedItemIDs: make(map[string][]string),
+	}
+	w := newAlbumWriter(fake, 20) // One add every 50ms after the first.
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.addMediaItems(context.Background(), "album", []string{"item"}))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond, "Adds should be rate limited")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorContains(t, w.addMediaItems(ctx, "album", []string{"item"}), "rate limiter error")
+}
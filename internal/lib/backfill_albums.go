@@ -0,0 +1,239 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"golang.org/x/time/rate"
+)
+
+// maxAlbumAddBatchSize is the maximum number of media items that Google Photos adds to an album per request.
+const maxAlbumAddBatchSize = 50
+
+// BackfillAlbumsResult describes the outcome of BackfillAlbums.
+type BackfillAlbumsResult struct {
+	// AlbumItemCounts is the number of media items added (or, in a dry run, that would have been added)
+	// to each album, sorted by album title.
+	AlbumItemCounts []AlbumItemCount
+	// MissingMediaItemIDs lists the files that belong in an album but were skipped,
+	// because camflow has no record of the media items that they were uploaded as.
+	MissingMediaItemIDs []string
+	// AlreadyInAlbumCount is the number of media items that weren't added to an album because they were
+	// already in it, summed over the albums.
+	AlreadyInAlbumCount int
+	// CreatedAlbums are the titles of the albums that were created, or in a dry run would have been, sorted.
+	CreatedAlbums []string
+}
+
+// BackfillAlbums adds the already-uploaded photos dated from "from" to "to", inclusive, to the label,
+// subject, unmatched, and camera model albums that the current config maps them to, eg after the mappings changed.
+// It finds each photo's media item from the upload ledger, or from the day index in the photo's dir,
+// so photos uploaded before camflow kept either are skipped. Media items that are already in an album
+// aren't added to it again.
+func BackfillAlbums(ctx context.Context, cfg config.CamflowConfig, cacheDir string, from, to time.Time, gphotosClient GPhotosClient, dryRun bool) (BackfillAlbumsResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return BackfillAlbumsResult{}, fmt.Errorf("invalid config: %w", err)
+	}
+
+	uploadedRoot := cfg.LocalPhotos.GetUploadedRoot()
+	if _, err := os.Stat(uploadedRoot); os.IsNotExist(err) {
+		logger.Info("Uploaded directory does not exist, nothing to backfill",
+			slog.String("uploaded_root", uploadedRoot))
+		return BackfillAlbumsResult{}, nil
+	}
+	items, _, err := scanUploadQueue(uploadedRoot, cfg.LocalPhotos.GetSymlinks())
+	if err != nil {
+		return BackfillAlbumsResult{}, err
+	}
+	var paths []string
+	for _, item := range items {
+		date := itemDate(item)
+		if !date.Before(from) && !date.After(to) {
+			paths = append(paths, item.path)
+		}
+	}
+	if len(paths) == 0 {
+		return BackfillAlbumsResult{}, nil
+	}
+
+	exifs, err := getExifMetadata(ctx, paths, nil)
+	if err != nil {
+		return BackfillAlbumsResult{}, err
+	}
+	mediaItemIDs, err := recordedMediaItemIDs(cacheDir, paths)
+	if err != nil {
+		return BackfillAlbumsResult{}, err
+	}
+
+	albumMediaItemIDs, missing := groupMediaItemsByAlbum(exifs, &cfg.GooglePhotos.Photos, mediaItemIDs)
+	result := BackfillAlbumsResult{MissingMediaItemIDs: missing}
+	if len(albumMediaItemIDs) == 0 {
+		return result, nil
+	}
+
+	albumTitles := make([]string, 0, len(albumMediaItemIDs))
+	for albumTitle := range albumMediaItemIDs {
+		albumTitles = append(albumTitles, albumTitle)
+	}
+	sort.Strings(albumTitles)
+
+	albumCache, err := loadAlbumCache(getAlbumCachePath(cacheDir))
+	if err != nil {
+		return result, fmt.Errorf("failed to load album cache: %w", err)
+	}
+	albumCache.pinnedIDs = cfg.Upload.PinnedAlbumIDs()
+	albumCache.duplicateAlbums = cfg.Upload.DuplicateAlbums
+	albumCache.onlyExisting = cfg.Upload.OnlyExistingAlbums
+	albumCache.maxNewAlbums = cfg.Upload.MaxNewAlbums
+	if isTerminal(os.Stdin) {
+		albumCache.confirmCreate = confirmAlbumCreationOnTerminal
+	}
+	limiter := rate.NewLimiter(apiRequestsPerSecond, apiRequestBurst)
+	albumIDs, err := albumCache.getOrFetchAndCreateAlbumIDs(ctx, gphotosClient.Albums(), albumTitles, limiter, dryRun)
+	if err != nil {
+		return result, fmt.Errorf("failed to resolve or create album IDs for titles %v: %w", albumTitles, err)
+	}
+	result.CreatedAlbums = albumCache.createdTitles(albumTitles)
+
+	albumWriter := newAlbumWriter(gphotosClient.Albums(), cfg.Upload.AlbumAddsPerSecond)
+	members := newAlbumMembers(gphotosClient.MediaItems(), limiter)
+	for i, albumTitle := range albumTitles {
+		ids := albumMediaItemIDs[albumTitle]
+		// Albums created by this run are empty, so there's no need to list them.
+		if !albumCache.wasCreated(albumTitle) {
+			missingIDs, err := members.missing(ctx, albumIDs[i], ids)
+			if err != nil {
+				return result, fmt.Errorf("failed to list media items in album %s: %w", albumTitle, err)
+			}
+			result.AlreadyInAlbumCount += len(ids) - len(missingIDs)
+			ids = missingIDs
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if !dryRun {
+			for start := 0; start < len(ids); start += maxAlbumAddBatchSize {
+				batch := ids[start:min(start+maxAlbumAddBatchSize, len(ids))]
+				if err := albumWriter.addMediaItems(ctx, albumIDs[i], batch); err != nil {
+					return result, fmt.Errorf("error adding media items to album %s: %w", albumTitle, err)
+				}
+			}
+		}
+		result.AlbumItemCounts = append(result.AlbumItemCounts, AlbumItemCount{AlbumTitle: albumTitle, ItemCount: len(ids)})
+	}
+	return result, nil
+}
+
+// albumMembers caches the IDs of the media items in each album for a run, so that each album is listed at most once.
+type albumMembers struct {
+	mediaItemsService AppMediaItemsService
+	limiter           *rate.Limiter
+	// members maps album IDs to the set of the IDs of their media items.
+	members map[string]map[string]struct{}
+}
+
+func newAlbumMembers(mediaItemsService AppMediaItemsService, limiter *rate.Limiter) *albumMembers {
+	return &albumMembers{
+		mediaItemsService: mediaItemsService,
+		limiter:           limiter,
+		members:           make(map[string]map[string]struct{}),
+	}
+}
+
+// missing returns the IDs in mediaItemIDs of the media items that aren't in the album albumID, without duplicates,
+// in their order in mediaItemIDs. The album is listed the first time that it is asked about, and the returned media
+// items are then counted as members, since the caller adds them.
+func (m *albumMembers) missing(ctx context.Context, albumID string, mediaItemIDs []string) ([]string, error) {
+	members, ok := m.members[albumID]
+	if !ok {
+		if err := m.limiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("rate limiter error before listing album %s: %w", albumID, err)
+		}
+		mediaItems, err := m.mediaItemsService.ListByAlbum(ctx, albumID)
+		if err != nil {
+			return nil, err
+		}
+		members = make(map[string]struct{}, len(mediaItems))
+		for _, mediaItem := range mediaItems {
+			members[mediaItem.ID] = struct{}{}
+		}
+		m.members[albumID] = members
+	}
+
+	var missing []string
+	for _, id := range mediaItemIDs {
+		if _, ok := members[id]; ok {
+			continue
+		}
+		members[id] = struct{}{}
+		missing = append(missing, id)
+	}
+	return missing, nil
+}
+
+// groupMediaItemsByAlbum returns the map from the title of each album that the files described by exifs
+// are mapped to, to the IDs of the media items to add to it, and the paths of the files that are mapped
+// to an album but have no entry in mediaItemIDs, which maps file basenames to media item IDs.
+func groupMediaItemsByAlbum(exifs []ExifData, gpConfig GPConfig, mediaItemIDs map[string]string) (map[string][]string, []string) {
+	albumMediaItemIDs := make(map[string][]string)
+	var missing []string
+	for _, exif := range exifs {
+		albumTitles := additionalAlbumTitles(exif, gpConfig.GetLabelAlbums(), gpConfig.GetSubjectAlbums(), gpConfig.GetUnmatchedAlbum())
+		if gpConfig.GetCameraModelAlbums() && exif.Model != "" && !slices.Contains(albumTitles, exif.Model) {
+			albumTitles = append(albumTitles, exif.Model)
+		}
+		if len(albumTitles) == 0 {
+			continue
+		}
+		mediaItemID, ok := mediaItemIDs[filepath.Base(exif.Path)]
+		if !ok {
+			logger.Warn("Skipping file without a known media item",
+				slog.String("path", exif.Path))
+			missing = append(missing, exif.Path)
+			continue
+		}
+		for _, albumTitle := range albumTitles {
+			albumMediaItemIDs[albumTitle] = append(albumMediaItemIDs[albumTitle], mediaItemID)
+		}
+	}
+	return albumMediaItemIDs, missing
+}
+
+// recordedMediaItemIDs returns the map from the basenames of the uploaded files to the IDs of the media items
+// that camflow recorded uploading them as. They are read from the upload ledger, and for the files at paths,
+// from their day indexes and extended attributes, which record the files uploaded without the ledger,
+// eg on another computer.
+func recordedMediaItemIDs(cacheDir string, paths []string) (map[string]string, error) {
+	mediaItemIDs, err := newUploadLedger(getUploadLedgerPath(cacheDir)).mediaItemIDs()
+	if err != nil {
+		return nil, err
+	}
+	for file, mediaItemID := range dayIndexMediaItemIDs(paths) {
+		if _, ok := mediaItemIDs[file]; !ok {
+			mediaItemIDs[file] = mediaItemID
+		}
+	}
+	for _, path := range paths {
+		if _, ok := mediaItemIDs[filepath.Base(path)]; ok {
+			continue
+		}
+		mediaItemID, err := mediaItemXattr(path)
+		if err != nil {
+			logger.Warn("Skipping unreadable media item attribute",
+				slog.String("path", path),
+				slog.String("error", err.Error()))
+			continue
+		}
+		if mediaItemID != "" {
+			mediaItemIDs[filepath.Base(path)] = mediaItemID
+		}
+	}
+	return mediaItemIDs, nil
+}
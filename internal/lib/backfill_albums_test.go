@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestGroupMediaItemsByAlbum(t *testing.T) {
+	gpConfig := &config.GPPhotosConfig{
+		DefaultAlbum:   "Default",
+		LabelAlbums:    []config.KeyAlbum{{Key: "Red", Album: "Favorites"}},
+		SubjectAlbums:  []config.KeyAlbum{{Key: "family", Album: "Family"}},
+		UnmatchedAlbum: "Unmatched",
+	}
+	exifs := []ExifData{
+		{Path: "/uploaded/2024/05/03/2024-05-03-a.jpg", Label: "Red", Subjects: []string{"family"}},
+		{Path: "/uploaded/2024/05/03/2024-05-03-b.jpg", Subjects: []string{"family"}},
+		{Path: "/uploaded/2024/05/03/2024-05-03-c.jpg", Subjects: []string{"unmapped"}},
+		{Path: "/uploaded/2024/05/03/2024-05-03-d.jpg"},
+		{Path: "/uploaded/2024/05/03/2024-05-03-e.jpg", Label: "Red"},
+	}
+	mediaItemIDs := map[string]string{
+		"2024-05-03-a.jpg": "id-a",
+		"2024-05-03-b.jpg": "id-b",
+		"2024-05-03-c.jpg": "id-c",
+		"2024-05-03-d.jpg": "id-d",
+	}
+
+	albumMediaItemIDs, missing := groupMediaItemsByAlbum(exifs, gpConfig, mediaItemIDs)
+	assert.Equal(t, map[string][]string{
+		"Favorites": {"id-a"},
+		"Family":    {"id-a", "id-b"},
+		"Unmatched": {"id-c"},
+	}, albumMediaItemIDs, "the default album should be left out, and files without metadata skipped")
+	assert.Equal(t, []string{"/uploaded/2024/05/03/2024-05-03-e.jpg"}, missing)
+}
+
+func TestBackfillAlbums_SkipsAlbumMembers(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	cfg.GooglePhotos.Photos.LabelAlbums = []config.KeyAlbum{{Key: "Red", Album: "Favorites"}}
+	cfg.GooglePhotos.Photos.SubjectAlbums = []config.KeyAlbum{{Key: "family", Album: "Family"}}
+	dayDir := filepath.Join(cfg.PhotosUploadedRoot, "2024", "05", "03")
+	require.NoError(t, os.MkdirAll(dayDir, 0755))
+	var exifOutput []map[string]any
+	for _, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(dayDir, "2024-05-03-"+name+".jpg")
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+		require.NoError(t, recordInDayIndex(path, 1, "id-"+name))
+		exif := map[string]any{"SourceFile": path, "Label": "Red"}
+		if name == "b" {
+			exif["Subject"] = "family"
+		}
+		exifOutput = append(exifOutput, exif)
+	}
+	exifJSON, err := json.Marshal(exifOutput)
+	require.NoError(t, err)
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "exiftool"), []byte("#!/bin/sh\ncat <<'EOF'\n"+string(exifJSON)+"\nEOF\n"), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{{ID: "favorites-id", Title: "Favorites"}}, nil)
+	mockAlbumsSvc.EXPECT().Create(gomock.Any(), "Family").Return(&albums.Album{ID: "family-id", Title: "Family"}, nil)
+
+	// a and c are already in Favorites, so only b is added to it. Family is new, so it isn't listed.
+	mockMediaItemsSvc.EXPECT().ListByAlbum(gomock.Any(), "favorites-id").
+		Return([]*media_items.MediaItem{{ID: "id-a"}, {ID: "id-c"}, {ID: "id-other"}}, nil).Times(1)
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "favorites-id", []string{"id-b"}).Return(nil)
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "family-id", []string{"id-b"}).Return(nil)
+
+	date := time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)
+	res, err := BackfillAlbums(context.Background(), cfg, t.TempDir(), date, date, mockGPhotosClient, false)
+	require.NoError(t, err)
+	assert.Equal(t, []AlbumItemCount{
+		{AlbumTitle: "Family", ItemCount: 1},
+		{AlbumTitle: "Favorites", ItemCount: 1},
+	}, res.AlbumItemCounts)
+	assert.Equal(t, 2, res.AlreadyInAlbumCount)
+}
+
+func TestAlbumMembers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockMediaItemsSvc.EXPECT().ListByAlbum(gomock.Any(), "album-id").Return([]*media_items.MediaItem{{ID: "id-a"}}, nil).Times(1)
+	members := newAlbumMembers(mockMediaItemsSvc, rate.NewLimiter(rate.Inf, 1))
+
+	missing, err := members.missing(context.Background(), "album-id", []string{"id-a", "id-b", "id-b", "id-c"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id-b", "id-c"}, missing, "Members and duplicates should be dropped")
+
+	// The album's membership is cached, including the media items returned as missing.
+	missing, err = members.missing(context.Background(), "album-id", []string{"id-c", "id-d"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id-d"}, missing)
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// CleanupTmpFiles removes the temporary files that copyFile leaves behind when a copy is interrupted,
+// eg by unplugging the sdcard during an import. It scans the roots that camflow copies files into,
+// including the import dests, if set, instead of the queues that they replace.
+// Only files that are named like camflow's temporary files, ie "<YYYY-MM-DD-name>.tmp", are removed.
+// It returns the paths of the removed files (or, in a dry run, the files that would have been removed).
+func CleanupTmpFiles(cfg config.CamflowConfig, dryRun bool) ([]string, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	roots := []string{
+		importPhotosRoot(cfg),
+		cfg.PhotosUploadedRoot,
+		importVideosRoot(cfg),
+		cfg.VideosUploadedRoot,
+	}
+	seen := make(map[string]bool)
+	var removed []string
+	for _, root := range roots {
+		if seen[root] {
+			continue
+		}
+		seen[root] = true
+
+		tmpFiles, err := findTmpFiles(root)
+		if err != nil {
+			return removed, err
+		}
+		for _, path := range tmpFiles {
+			if !dryRun {
+				if err := os.Remove(path); err != nil {
+					return removed, fmt.Errorf("failed to remove temporary file %s: %w", path, err)
+				}
+				logger.Debug("Removed temporary file", slog.String("path", path))
+			}
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
+
+// findTmpFiles returns the paths of camflow's temporary files under root.
+// It returns no files if root doesn't exist.
+func findTmpFiles(root string) ([]string, error) {
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var tmpFiles []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isCopyTmpFileName(d.Name()) {
+			return nil
+		}
+		tmpFiles = append(tmpFiles, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s for temporary files: %w", root, err)
+	}
+	return tmpFiles, nil
+}
+
+// isCopyTmpFileName returns whether name is the name of a temporary file written by copyFile.
+func isCopyTmpFileName(name string) bool {
+	finalName, ok := strings.CutSuffix(name, ".tmp")
+	if !ok {
+		return false
+	}
+	_, _, _, err := parseDatePrefix(finalName)
+	return err == nil
+}
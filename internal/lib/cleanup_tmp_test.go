@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanupTmpFiles(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	createDirStructure(t, cfg.PhotosProcessQueueRoot, map[string]string{
+		"2024/05/01/2024-05-01-IMG_0001.JPG":     "photo",
+		"2024/05/01/2024-05-01-IMG_0002.CR3.tmp": "partial",
+		"2024/05/01/notes.tmp":                   "not ours",
+	})
+	createDirStructure(t, cfg.VideosUploadQueueRoot, map[string]string{
+		"2024-05-01-VID_0001.MP4.tmp": "partial",
+	})
+	createDirStructure(t, cfg.PhotosUploadedRoot, map[string]string{
+		"2024/05/01/2024-05-01-IMG_0003.JPG.tmp": "partial",
+	})
+	wantRemoved := []string{
+		filepath.Join(cfg.PhotosProcessQueueRoot, "2024", "05", "01", "2024-05-01-IMG_0002.CR3.tmp"),
+		filepath.Join(cfg.PhotosUploadedRoot, "2024", "05", "01", "2024-05-01-IMG_0003.JPG.tmp"),
+		filepath.Join(cfg.VideosUploadQueueRoot, "2024-05-01-VID_0001.MP4.tmp"),
+	}
+
+	t.Run("DryRun", func(t *testing.T) {
+		removed, err := CleanupTmpFiles(cfg, true)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, wantRemoved, removed)
+		for _, path := range wantRemoved {
+			_, err := os.Stat(path)
+			assert.NoError(t, err, "Dry run must not remove %s", path)
+		}
+	})
+
+	t.Run("Removes", func(t *testing.T) {
+		removed, err := CleanupTmpFiles(cfg, false)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, wantRemoved, removed)
+		for _, path := range wantRemoved {
+			_, err := os.Stat(path)
+			assert.True(t, os.IsNotExist(err), "Expected %s to be removed", path)
+		}
+
+		// Real media and temporary files that camflow didn't write are untouched.
+		for _, path := range []string{
+			filepath.Join(cfg.PhotosProcessQueueRoot, "2024", "05", "01", "2024-05-01-IMG_0001.JPG"),
+			filepath.Join(cfg.PhotosProcessQueueRoot, "2024", "05", "01", "notes.tmp"),
+		} {
+			_, err := os.Stat(path)
+			assert.NoError(t, err, "Expected %s to remain", path)
+		}
+	})
+}
+
+func TestCleanupTmpFiles_ImportDests(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	cfg.Import.PhotosDest = t.TempDir()
+	cfg.Import.VideosDest = t.TempDir()
+	createDirStructure(t, cfg.Import.PhotosDest, map[string]string{
+		"2024/05/01/2024-05-01-IMG_0001.JPG.tmp": "partial",
+	})
+	createDirStructure(t, cfg.Import.VideosDest, map[string]string{
+		"2024/05/01/2024-05-01-VID_0001.MP4.tmp": "partial",
+	})
+
+	removed, err := CleanupTmpFiles(cfg, true)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(cfg.Import.PhotosDest, "2024", "05", "01", "2024-05-01-IMG_0001.JPG.tmp"),
+		filepath.Join(cfg.Import.VideosDest, "2024", "05", "01", "2024-05-01-VID_0001.MP4.tmp"),
+	}, removed, "The dirs that an import was moving media to should be cleaned up")
+}
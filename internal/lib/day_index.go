@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// dayIndexFileName is the name of the index file that lists the uploaded files in each dir of the uploaded tree.
+const dayIndexFileName = "camflow-index.json"
+
+// dayIndex lists the files that were moved into a dir of the uploaded tree, eg a day's dir,
+// so that the dir describes itself, eg for checking it against Google Photos.
+type dayIndex struct {
+	// Files are sorted by name.
+	Files []dayIndexEntry `json:"files"`
+}
+
+// dayIndexEntry describes a file in a dayIndex.
+type dayIndexEntry struct {
+	File string `json:"file"`
+	Size int64  `json:"size"`
+	// MediaItemID is the media item that the file was uploaded as. It is empty for files that weren't
+	// uploaded by camflow, eg the RAW file of a RAW+JPEG pair, or videos marked as uploaded by hand.
+	MediaItemID string `json:"media_item_id,omitempty"`
+}
+
+// dayIndexMu serializes the updates to the day indexes by this process.
+// Other processes are kept out by locking the dir of the index.
+var dayIndexMu sync.Mutex
+
+// readDayIndex reads the day index in dir. It returns an empty index if there isn't one.
+func readDayIndex(dir string) (dayIndex, error) {
+	path := filepath.Join(dir, dayIndexFileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return dayIndex{}, nil
+	}
+	if err != nil {
+		return dayIndex{}, fmt.Errorf("failed to read day index %s: %w", path, err)
+	}
+	var index dayIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return dayIndex{}, fmt.Errorf("failed to parse day index %s: %w", path, err)
+	}
+	return index, nil
+}
+
+// recordInDayIndex adds the file at path, which was moved into the uploaded tree, to the day index in its dir,
+// replacing any entry for a file with the same name. mediaItemID is as for dayIndexEntry.
+func recordInDayIndex(path string, size int64, mediaItemID string) error {
+	return updateDayIndex(filepath.Dir(path), func(index *dayIndex) {
+		index.add(dayIndexEntry{File: filepath.Base(path), Size: size, MediaItemID: mediaItemID})
+	})
+}
+
+// moveDayIndexEntry moves the entry of the file that was moved from srcPath to destPath, within the uploaded tree,
+// from the day index in the dir of srcPath to the one in the dir of destPath. It does nothing if the file
+// has no entry, eg because it was moved into the uploaded tree by an earlier version of camflow.
+func moveDayIndexEntry(srcPath, destPath string) error {
+	var entry dayIndexEntry
+	found := false
+	err := updateDayIndex(filepath.Dir(srcPath), func(index *dayIndex) {
+		entry, found = index.remove(filepath.Base(srcPath))
+	})
+	if err != nil || !found {
+		return err
+	}
+	entry.File = filepath.Base(destPath)
+	return updateDayIndex(filepath.Dir(destPath), func(index *dayIndex) {
+		index.add(entry)
+	})
+}
+
+// add adds entry to the index, replacing any entry for a file with the same name.
+func (index *dayIndex) add(entry dayIndexEntry) {
+	i := sort.Search(len(index.Files), func(i int) bool { return index.Files[i].File >= entry.File })
+	if i < len(index.Files) && index.Files[i].File == entry.File {
+		index.Files[i] = entry
+		return
+	}
+	index.Files = append(index.Files, dayIndexEntry{})
+	copy(index.Files[i+1:], index.Files[i:])
+	index.Files[i] = entry
+}
+
+// remove removes the entry for the file named file from the index, and returns it.
+// It returns false if the index has no entry for file.
+func (index *dayIndex) remove(file string) (dayIndexEntry, bool) {
+	i := sort.Search(len(index.Files), func(i int) bool { return index.Files[i].File >= file })
+	if i == len(index.Files) || index.Files[i].File != file {
+		return dayIndexEntry{}, false
+	}
+	entry := index.Files[i]
+	index.Files = append(index.Files[:i], index.Files[i+1:]...)
+	return entry, true
+}
+
+// updateDayIndex applies update to the day index in dir, with the index locked, and writes it back.
+// An index that update leaves empty is removed, so that it doesn't keep an otherwise empty dir.
+func updateDayIndex(dir string, update func(index *dayIndex)) error {
+	dayIndexMu.Lock()
+	defer dayIndexMu.Unlock()
+
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open dir %s to lock its day index: %w", dir, err)
+	}
+	defer dirFile.Close()
+	if err := syscall.Flock(int(dirFile.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock day index in %s: %w", dir, err)
+	}
+	defer syscall.Flock(int(dirFile.Fd()), syscall.LOCK_UN)
+
+	index, err := readDayIndex(dir)
+	if err != nil {
+		// The index only describes the dir, so rebuild it rather than fail the upload.
+		logger.Warn("Replacing unreadable day index",
+			slog.String("dir", dir),
+			slog.String("error", err.Error()))
+		index = dayIndex{}
+	}
+	update(&index)
+
+	indexPath := filepath.Join(dir, dayIndexFileName)
+	if len(index.Files) == 0 {
+		if err := os.Remove(indexPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove empty day index %s: %w", indexPath, err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode day index: %w", err)
+	}
+	if err := writeFileAtomic(indexPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write day index: %w", err)
+	}
+	return nil
+}
+
+// dayIndexMediaItemIDs returns the map from the names of the files in the day indexes of the dirs of paths
+// to their media item IDs. Dirs without a readable index are skipped.
+func dayIndexMediaItemIDs(paths []string) map[string]string {
+	ids := make(map[string]string)
+	readDirs := make(map[string]bool)
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if readDirs[dir] {
+			continue
+		}
+		readDirs[dir] = true
+		index, err := readDayIndex(dir)
+		if err != nil {
+			logger.Warn("Skipping unreadable day index",
+				slog.String("dir", dir),
+				slog.String("error", err.Error()))
+			continue
+		}
+		for _, entry := range index.Files {
+			if entry.MediaItemID != "" {
+				ids[entry.File] = entry.MediaItemID
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordInDayIndex(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "2024", "01", "28")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+
+	t.Run("Create", func(t *testing.T) {
+		require.NoError(t, recordInDayIndex(filepath.Join(dir, "2024-01-28-b.jpg"), 2, "media-b"))
+		index, err := readDayIndex(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []dayIndexEntry{{File: "2024-01-28-b.jpg", Size: 2, MediaItemID: "media-b"}}, index.Files)
+	})
+
+	t.Run("IncrementalUpdates", func(t *testing.T) {
+		require.NoError(t, recordInDayIndex(filepath.Join(dir, "2024-01-28-a.cr3"), 10, ""))
+		require.NoError(t, recordInDayIndex(filepath.Join(dir, "2024-01-28-c.jpg"), 3, "media-c"))
+		// Uploading a file with the same name again replaces its entry.
+		require.NoError(t, recordInDayIndex(filepath.Join(dir, "2024-01-28-b.jpg"), 4, "media-b2"))
+
+		index, err := readDayIndex(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []dayIndexEntry{
+			{File: "2024-01-28-a.cr3", Size: 10},
+			{File: "2024-01-28-b.jpg", Size: 4, MediaItemID: "media-b2"},
+			{File: "2024-01-28-c.jpg", Size: 3, MediaItemID: "media-c"},
+		}, index.Files, "Entries should be sorted by file name")
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		concurrentDir := t.TempDir()
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, recordInDayIndex(filepath.Join(concurrentDir, fmt.Sprintf("2024-01-28-%02d.jpg", i)), int64(i), ""))
+			}()
+		}
+		wg.Wait()
+		index, err := readDayIndex(concurrentDir)
+		require.NoError(t, err)
+		assert.Len(t, index.Files, 20, "No update should be lost")
+	})
+
+	t.Run("ReplacesCorruptIndex", func(t *testing.T) {
+		corruptDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(corruptDir, dayIndexFileName), []byte("{"), 0644))
+		require.NoError(t, recordInDayIndex(filepath.Join(corruptDir, "2024-01-28-a.jpg"), 1, "media-a"))
+		index, err := readDayIndex(corruptDir)
+		require.NoError(t, err)
+		assert.Equal(t, []dayIndexEntry{{File: "2024-01-28-a.jpg", Size: 1, MediaItemID: "media-a"}}, index.Files)
+	})
+}
+
+func TestDayIndexMediaItemIDs(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	require.NoError(t, recordInDayIndex(filepath.Join(dirA, "2024-01-28-a.jpg"), 1, "media-a"))
+	require.NoError(t, recordInDayIndex(filepath.Join(dirA, "2024-01-28-a.cr3"), 1, ""))
+	require.NoError(t, os.WriteFile(filepath.Join(dirB, dayIndexFileName), []byte("{"), 0644))
+
+	ids := dayIndexMediaItemIDs([]string{filepath.Join(dirA, "2024-01-28-a.jpg"), filepath.Join(dirB, "2024-01-29-b.jpg")})
+	assert.Equal(t, map[string]string{"2024-01-28-a.jpg": "media-a"}, ids)
+}
+
+func TestUploadVideos_DayIndex(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "")
+	cfg.Upload.DayIndex = true
+	createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{
+		"2024-01-28-video1.mp4": "content1",
+		"2024-01-28-video2.mp4": "content22",
+	})
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{}, nil).AnyTimes()
+	for _, name := range []string{"2024-01-28-video1.mp4", "2024-01-28-video2.mp4"} {
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, name)).Return("token_for_"+name, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + name, Filename: name}).
+			Return(&media_items.MediaItem{ID: "media_id_for_" + name, Filename: name}, nil)
+	}
+
+	_, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+
+	index, err := readDayIndex(filepath.Join(cfg.VideosUploadedRoot, "2024", "01", "28"))
+	require.NoError(t, err)
+	assert.Equal(t, []dayIndexEntry{
+		{File: "2024-01-28-video1.mp4", Size: int64(len("content1")), MediaItemID: "media_id_for_2024-01-28-video1.mp4"},
+		{File: "2024-01-28-video2.mp4", Size: int64(len("content22")), MediaItemID: "media_id_for_2024-01-28-video2.mp4"},
+	}, index.Files)
+}
@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// cardMountDirs returns the dirs that the OS mounts removable volumes, eg cards, in.
+func cardMountDirs() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"/Volumes"}
+	case "linux":
+		username := os.Getenv("USER")
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+		if username == "" {
+			return nil
+		}
+		return []string{filepath.Join("/media", username), filepath.Join("/run/media", username)}
+	default:
+		return nil
+	}
+}
+
+// DetectCard returns the mounted volume that has any of mediaRoots, eg DCIM, as for import.media_roots,
+// for imports that aren't given a card. It returns an error if no volume, or more than one, has one.
+func DetectCard(mediaRoots []string) (string, error) {
+	return detectCard(cardMountDirs(), mediaRoots)
+}
+
+// detectCard returns the volume in mountDirs that has any of mediaRoots, like DetectCard.
+func detectCard(mountDirs []string, mediaRoots []string) (string, error) {
+	if len(mountDirs) == 0 {
+		return "", fmt.Errorf("can't find a card on %s: pass --src", runtime.GOOS)
+	}
+	var cards []string
+	for _, mountDir := range mountDirs {
+		entries, err := os.ReadDir(mountDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", fmt.Errorf("failed to list mounted volumes in %s: %w", mountDir, err)
+		}
+		for _, entry := range entries {
+			// Hidden entries aren't volumes, eg /Volumes/.timemachine.
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			volume := filepath.Join(mountDir, entry.Name())
+			// Volumes can be symlinks, eg the boot volume in /Volumes, so the media roots are found through them.
+			// The roots are found as the import finds them, so that the card found is one it can import from.
+			if _, err := cardMediaRoots(volume, mediaRoots); err == nil {
+				cards = append(cards, volume)
+			}
+		}
+	}
+	switch len(cards) {
+	case 0:
+		return "", fmt.Errorf("found no card: no volume mounted in %s has any of the media roots %q; insert a card or pass --src", strings.Join(mountDirs, " or "), mediaRoots)
+	case 1:
+		return cards[0], nil
+	default:
+		return "", fmt.Errorf("found %d cards, at %s: pass --src to choose one, or repeat it to import from several", len(cards), strings.Join(cards, ", "))
+	}
+}
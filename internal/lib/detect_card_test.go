@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectCard(t *testing.T) {
+	volumes := t.TempDir()
+	missing := filepath.Join(t.TempDir(), "missing")
+	require.NoError(t, os.MkdirAll(filepath.Join(volumes, "Backup", "Documents"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(volumes, "NotADir"), []byte("file"), 0644))
+	// A DCIM file isn't a card's DCIM dir.
+	createDummyFile(t, filepath.Join(volumes, "Odd", "DCIM"), "file", time.Now())
+
+	_, err := detectCard([]string{missing, volumes}, config.DefaultMediaRoots)
+	assert.ErrorContains(t, err, "found no card")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(volumes, "EOS_DIGITAL", "DCIM", "100CANON"), 0755))
+	card, err := detectCard([]string{missing, volumes}, config.DefaultMediaRoots)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(volumes, "EOS_DIGITAL"), card)
+
+	// A card mounted through a symlink is found too, and with two cards, neither is chosen.
+	otherVolumes := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(otherVolumes, ".real", "DCIM"), 0755))
+	require.NoError(t, os.Symlink(filepath.Join(otherVolumes, ".real"), filepath.Join(otherVolumes, "SONY")))
+	_, err = detectCard([]string{volumes, otherVolumes}, config.DefaultMediaRoots)
+	assert.ErrorContains(t, err, "found 2 cards")
+	assert.ErrorContains(t, err, filepath.Join(volumes, "EOS_DIGITAL"))
+	assert.ErrorContains(t, err, filepath.Join(otherVolumes, "SONY"))
+
+	_, err = detectCard(nil, config.DefaultMediaRoots)
+	assert.ErrorContains(t, err, "pass --src")
+}
+
+func TestDetectCard_MediaRoots(t *testing.T) {
+	volumes := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(volumes, "HANDYCAM", "PRIVATE", "M4ROOT", "CLIP"), 0755))
+
+	_, err := detectCard([]string{volumes}, config.DefaultMediaRoots)
+	assert.ErrorContains(t, err, "found no card")
+
+	card, err := detectCard([]string{volumes}, []string{"DCIM", "PRIVATE/M4ROOT/CLIP"})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(volumes, "HANDYCAM"), card)
+}
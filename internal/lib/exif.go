@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
 )
 
 // ExifData holds the extracted metadata for a single file.
@@ -14,11 +18,34 @@ type ExifData struct {
 	Path     string
 	Label    string
 	Subjects []string
+	// Rating is the star rating, or nil if the file isn't rated.
+	Rating *int
+	// Model is the model of the camera that took the photo or video, eg "Canon EOS R5".
+	Model string
+	// CaptureDate is the date of the EXIF DateTimeOriginal, formatted as YYYY-MM-DD, or "" if the file doesn't have one.
+	// It is the date on the camera's clock; see captureDateIn.
+	CaptureDate string
+	// CaptureTime is the time of the EXIF DateTimeOriginal in the time zone of its offset, as for
+	// parseExifCaptureTime, or zero if the file doesn't have both.
+	CaptureTime time.Time
+}
+
+// captureDateIn returns the capture date of the file, formatted as YYYY-MM-DD, in location, as import dates
+// files in import.timezone. If location is nil, or the time zone of the capture time isn't known, it returns
+// CaptureDate.
+func (e ExifData) captureDateIn(location *time.Location) string {
+	if location == nil || e.CaptureTime.IsZero() {
+		return e.CaptureDate
+	}
+	return e.CaptureTime.In(location).Format("2006-01-02")
 }
 
-// getExifMetadata extracts Label and Subject metadata from a list of files using exiftool.
-// TODO: write a test for this.
-func getExifMetadata(ctx context.Context, paths []string) ([]ExifData, error) {
+// exifBatchSize is the number of files that getExifMetadata passes to each run of exiftool.
+const exifBatchSize = 200
+
+// getExifMetadata extracts Label, Subject, Rating, Model, and DateTimeOriginal metadata from a list of files using exiftool.
+// It runs exiftool on batches of files, and adds the number of files in each batch to bar, unless bar is nil.
+func getExifMetadata(ctx context.Context, paths []string, bar *progressbar.ProgressBar) ([]ExifData, error) {
 	if len(paths) == 0 {
 		return nil, nil
 	}
@@ -28,22 +55,43 @@ func getExifMetadata(ctx context.Context, paths []string) ([]ExifData, error) {
 		return nil, fmt.Errorf("exiftool not found in PATH: %w", err)
 	}
 
-	args := []string{"-j", "-Label", "-Subject"}
-	args = append(args, paths...)
+	var exifData []ExifData
+	for start := 0; start < len(paths); start += exifBatchSize {
+		batch := paths[start:min(start+exifBatchSize, len(paths))]
+		args := []string{"-j", "-Label", "-Subject", "-Rating", "-Model", "-DateTimeOriginal", "-OffsetTimeOriginal"}
+		args = append(args, batch...)
 
-	cmd := exec.CommandContext(ctx, exiftoolPath, args...)
-	output, err := cmd.Output()
-	if err != nil {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
+		cmd := exec.CommandContext(ctx, exiftoolPath, args...)
+		output, err := cmd.Output()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("failed to run exiftool: %w", err)
+		}
+		batchData, err := parseExifOutput(output)
+		if err != nil {
+			return nil, err
+		}
+		exifData = append(exifData, batchData...)
+		if bar != nil {
+			_ = bar.Add(len(batch))
 		}
-		return nil, fmt.Errorf("failed to run exiftool: %w", err)
 	}
+	return exifData, nil
+}
 
+// parseExifOutput parses the JSON output of exiftool run by getExifMetadata.
+func parseExifOutput(output []byte) ([]ExifData, error) {
 	var results []struct {
 		SourceFile string `json:"SourceFile"`
 		Label      string `json:"Label,omitempty"`
 		Subject    any    `json:"Subject,omitempty"` // Subject can be a string or []any.
+		Rating     any    `json:"Rating,omitempty"`  // Rating is usually a number, but may be a string.
+		Model      any    `json:"Model,omitempty"`   // Model is a number if it's all digits.
+		// DateTimeOriginal is formatted as "YYYY:MM:DD HH:MM:SS", with optional subseconds and time zone.
+		DateTimeOriginal   any `json:"DateTimeOriginal,omitempty"`
+		OffsetTimeOriginal any `json:"OffsetTimeOriginal,omitempty"`
 	}
 	if err := json.Unmarshal(output, &results); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal exiftool output: %w", err)
@@ -65,18 +113,113 @@ func getExifMetadata(ctx context.Context, paths []string) ([]ExifData, error) {
 				}
 			}
 		}
+		switch rating := r.Rating.(type) {
+		case float64:
+			n := int(rating)
+			data.Rating = &n
+		case string:
+			if n, err := strconv.Atoi(strings.TrimSpace(rating)); err == nil {
+				data.Rating = &n
+			}
+		}
+		if r.Model != nil {
+			data.Model = strings.TrimSpace(fmt.Sprint(r.Model))
+		}
+		if s, ok := r.DateTimeOriginal.(string); ok && len(s) >= len("2006:01:02") {
+			// Unset dates, eg "0000:00:00 00:00:00", don't parse.
+			if date, err := time.Parse("2006:01:02", s[:len("2006:01:02")]); err == nil {
+				data.CaptureDate = date.Format("2006-01-02")
+			}
+			offset, _ := r.OffsetTimeOriginal.(string)
+			if captureTime, ok := parseExifCaptureTime(s, offset); ok {
+				data.CaptureTime = captureTime
+			}
+		}
 		exifData = append(exifData, data)
 	}
 
 	return exifData, nil
 }
 
+// getCaptureTimes returns the map from the paths of the files among paths whose EXIF metadata has both a
+// DateTimeOriginal and the time zone offset of it, to their capture times. It runs exiftool on batches of files.
+func getCaptureTimes(ctx context.Context, paths []string) (map[string]time.Time, error) {
+	captureTimes := make(map[string]time.Time)
+	if len(paths) == 0 {
+		return captureTimes, nil
+	}
+
+	exiftoolPath, err := exec.LookPath("exiftool")
+	if err != nil {
+		return nil, fmt.Errorf("exiftool not found in PATH: %w", err)
+	}
+
+	for start := 0; start < len(paths); start += exifBatchSize {
+		batch := paths[start:min(start+exifBatchSize, len(paths))]
+		args := []string{"-j", "-DateTimeOriginal", "-OffsetTimeOriginal"}
+		args = append(args, batch...)
+
+		cmd := exec.CommandContext(ctx, exiftoolPath, args...)
+		output, err := cmd.Output()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("failed to run exiftool: %w", err)
+		}
+		var results []struct {
+			SourceFile         string `json:"SourceFile"`
+			DateTimeOriginal   any    `json:"DateTimeOriginal,omitempty"`
+			OffsetTimeOriginal any    `json:"OffsetTimeOriginal,omitempty"`
+		}
+		if err := json.Unmarshal(output, &results); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal exiftool output: %w", err)
+		}
+		for _, r := range results {
+			dateTime, _ := r.DateTimeOriginal.(string)
+			offset, _ := r.OffsetTimeOriginal.(string)
+			if captureTime, ok := parseExifCaptureTime(dateTime, offset); ok {
+				captureTimes[r.SourceFile] = captureTime
+			}
+		}
+	}
+	return captureTimes, nil
+}
+
+// parseExifCaptureTime parses dateTime, an EXIF DateTimeOriginal formatted as "YYYY:MM:DD HH:MM:SS" with
+// optional subseconds and time zone offset, in the time zone offset, formatted as "+HH:MM" or "Z".
+// The offset in dateTime is used if offset is empty. It returns false if either can't be parsed.
+func parseExifCaptureTime(dateTime, offset string) (time.Time, bool) {
+	const layout = "2006:01:02 15:04:05"
+	dateTime = strings.TrimSpace(dateTime)
+	if len(dateTime) < len(layout) {
+		return time.Time{}, false
+	}
+	wallTime, rest := dateTime[:len(layout)], dateTime[len(layout):]
+	if offset == "" {
+		// Skip any subseconds, eg ".123", to the offset.
+		if strings.HasPrefix(rest, ".") {
+			rest = strings.TrimLeft(rest[1:], "0123456789")
+		}
+		offset = rest
+	}
+	offset = strings.TrimSpace(offset)
+	if offset == "Z" {
+		offset = "+00:00"
+	}
+	captureTime, err := time.Parse(layout+"-07:00", wallTime+offset)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return captureTime, true
+}
+
 func printNameIfMatch(ctx context.Context, path, label, subject string) error {
 	if label == "" && subject == "" {
 		return nil
 	}
 
-	results, err := getExifMetadata(ctx, []string{path})
+	results, err := getExifMetadata(ctx, []string{path}, nil)
 	if err != nil {
 		return fmt.Errorf("failed to get exif metadata for %s: %w", path, err)
 	}
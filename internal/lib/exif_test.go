@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExifOutput(t *testing.T) {
+	output := []byte(`[
+		{"SourceFile": "/q/a.JPG", "Label": "Red", "Subject": "share-family", "Rating": 4, "Model": "Canon EOS R5", "DateTimeOriginal": "2024:01:28 10:30:00.12+01:00"},
+		{"SourceFile": "/q/b.JPG", "Subject": ["one", "two"], "Rating": "2", "Model": 1100, "DateTimeOriginal": "0000:00:00 00:00:00"},
+		{"SourceFile": "/q/c.JPG"},
+		{"SourceFile": "/q/d.JPG", "DateTimeOriginal": "2024:05:01 23:30:00", "OffsetTimeOriginal": "-07:00"}
+	]`)
+
+	got, err := parseExifOutput(output)
+	require.NoError(t, err)
+	require.Len(t, got, 4)
+
+	assert.Equal(t, "Red", got[0].Label)
+	assert.Equal(t, []string{"share-family"}, got[0].Subjects)
+	require.NotNil(t, got[0].Rating)
+	assert.Equal(t, 4, *got[0].Rating)
+	assert.Equal(t, "Canon EOS R5", got[0].Model)
+	assert.Equal(t, "2024-01-28", got[0].CaptureDate)
+
+	assert.Equal(t, []string{"one", "two"}, got[1].Subjects)
+	require.NotNil(t, got[1].Rating)
+	assert.Equal(t, 2, *got[1].Rating)
+	assert.Equal(t, "1100", got[1].Model, "An all-digit model should be read as a string")
+	assert.Empty(t, got[1].CaptureDate, "An unset date should be ignored")
+
+	assert.Nil(t, got[2].Rating, "Unrated file should have a nil rating")
+	assert.Empty(t, got[2].Model)
+	assert.Empty(t, got[2].CaptureDate)
+	assert.True(t, got[2].CaptureTime.IsZero())
+
+	// The capture date is in import.timezone when the time zone of the capture time is known.
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-01", got[3].CaptureDate)
+	assert.Equal(t, "2024-05-01", got[3].captureDateIn(nil))
+	assert.Equal(t, "2024-05-02", got[3].captureDateIn(tokyo))
+	assert.Equal(t, "2024-01-28", got[0].captureDateIn(tokyo), "The offset in DateTimeOriginal should be used")
+	assert.Equal(t, "2024-05-01", ExifData{CaptureDate: "2024-05-01"}.captureDateIn(tokyo), "A date without a known time zone should be kept")
+
+	_, err = parseExifOutput([]byte("not json"))
+	assert.ErrorContains(t, err, "failed to unmarshal exiftool output")
+}
+
+func TestParseExifCaptureTime(t *testing.T) {
+	for _, tt := range []struct {
+		dateTime, offset string
+		want             string
+	}{
+		{"2024:05:01 23:30:00", "-07:00", "2024-05-02T06:30:00Z"},
+		{"2024:05:02 08:15:00.25", "+02:00", "2024-05-02T06:15:00Z"},
+		{"2024:05:02 08:15:00.25+02:00", "", "2024-05-02T06:15:00Z"},
+		{"2024:05:02 06:15:00", "Z", "2024-05-02T06:15:00Z"},
+		{"2024:05:02 08:15:00", "", ""},
+		{"0000:00:00 00:00:00", "+02:00", ""},
+		{"", "+02:00", ""},
+	} {
+		captureTime, ok := parseExifCaptureTime(tt.dateTime, tt.offset)
+		if tt.want == "" {
+			assert.False(t, ok, "%q %q shouldn't parse", tt.dateTime, tt.offset)
+			continue
+		}
+		require.True(t, ok, "%q %q should parse", tt.dateTime, tt.offset)
+		assert.Equal(t, tt.want, captureTime.UTC().Format(time.RFC3339))
+	}
+}
+
+func TestGetExifMetadata_Batches(t *testing.T) {
+	// Put an exiftool on the PATH that reports the label of each file it is passed, and records each run.
+	binDir := t.TempDir()
+	runsPath := filepath.Join(binDir, "runs")
+	script := `#!/bin/sh
+echo run >> "` + runsPath + `"
+sep="["
+for arg in "$@"; do
+	case "$arg" in -*) continue ;; esac
+	printf '%s{"SourceFile": "%s", "Label": "Red"}' "$sep" "$arg"
+	sep=","
+done
+echo "]"
+`
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "exiftool"), []byte(script), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var paths []string
+	for i := range 2*exifBatchSize + 1 {
+		paths = append(paths, fmt.Sprintf("/q/IMG_%04d.JPG", i))
+	}
+	bar := progressbar.NewOptions(len(paths), progressbar.OptionSetWriter(io.Discard))
+
+	exifs, err := getExifMetadata(context.Background(), paths, bar)
+	require.NoError(t, err)
+	require.Len(t, exifs, len(paths))
+	for i, exif := range exifs {
+		assert.Equal(t, paths[i], exif.Path)
+		assert.Equal(t, "Red", exif.Label)
+	}
+	assert.Equal(t, float64(1), bar.State().CurrentPercent, "The bar should count every file")
+
+	runs, err := os.ReadFile(runsPath)
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(runs), "run"), "exiftool should be run once per batch")
+}
@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+)
+
+// errXattrsUnsupported is returned for setting an extended attribute on a filesystem or platform
+// that doesn't support them.
+var errXattrsUnsupported = errors.New("extended attributes are not supported")
+
+// copyFileMetadata copies the mode bits and the access and modification times of src to dst,
+// and its extended attributes where the platform and filesystems support them.
+// Failures to copy extended attributes are logged rather than returned.
+func copyFileMetadata(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+
+	if err := copyXattrs(src, dst); err != nil {
+		logger.Warn("Failed to copy extended attributes",
+			slog.String("src", src),
+			slog.String("dst", dst),
+			slog.String("error", err.Error()))
+	}
+
+	mode := info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	if err := os.Chmod(dst, mode); err != nil {
+		return fmt.Errorf("failed to set mode of %s: %w", dst, err)
+	}
+	// Set the times last, in case setting the other metadata changed them.
+	if err := os.Chtimes(dst, fileAccessTime(info), info.ModTime()); err != nil {
+		return fmt.Errorf("failed to set times of %s: %w", dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// errNoXattr is the error for getting an extended attribute that a file doesn't have.
+const errNoXattr = unix.ENOATTR
+
+// fileAccessTime returns the access time of the file with info, falling back to its modification time.
+func fileAccessTime(info os.FileInfo) time.Time {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(stat.Atimespec.Sec, stat.Atimespec.Nsec)
+	}
+	return info.ModTime()
+}
+
+// isFATFilesystem returns whether path is on a FAT or exFAT filesystem, eg a camera card.
+func isFATFilesystem(path string) (bool, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return false, fmt.Errorf("failed to get filesystem stats for %s: %w", path, err)
+	}
+	fsType := unix.ByteSliceToString(stat.Fstypename[:])
+	return fsType == "msdos" || fsType == "exfat", nil
+}
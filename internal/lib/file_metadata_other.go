@@ -0,0 +1,35 @@
+//go:build !linux && !darwin
+
+package lib
+
+import (
+	"os"
+	"time"
+)
+
+// fileAccessTime returns the modification time of the file with info,
+// because the access time isn't available on this platform.
+func fileAccessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// copyXattrs does nothing, because extended attributes aren't supported on this platform.
+func copyXattrs(src, dst string) error {
+	return nil
+}
+
+// setXattr returns errXattrsUnsupported, because extended attributes aren't supported on this platform.
+func setXattr(path, name string, value []byte) error {
+	return errXattrsUnsupported
+}
+
+// lookupXattr returns that path doesn't have the extended attribute, because extended attributes
+// aren't supported on this platform.
+func lookupXattr(path, name string) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+// isFATFilesystem returns false, because the filesystem type isn't available on this platform.
+func isFATFilesystem(path string) (bool, error) {
+	return false, nil
+}
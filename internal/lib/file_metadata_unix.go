@@ -0,0 +1,95 @@
+//go:build linux || darwin
+
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyXattrs copies the extended attributes of src to dst.
+// It returns nil if the source's filesystem doesn't support extended attributes.
+func copyXattrs(src, dst string) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+		return fmt.Errorf("failed to list extended attributes of %s: %w", src, err)
+	}
+
+	var errs []error
+	for _, name := range names {
+		value, err := getXattr(src, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get extended attribute %s of %s: %w", name, src, err))
+			continue
+		}
+		if err := unix.Setxattr(dst, name, value, 0); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set extended attribute %s of %s: %w", name, dst, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setXattr sets the extended attribute name of path to value.
+// It returns errXattrsUnsupported if the filesystem doesn't support extended attributes.
+func setXattr(path, name string, value []byte) error {
+	if err := unix.Setxattr(path, name, value, 0); err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return errXattrsUnsupported
+		}
+		return fmt.Errorf("failed to set extended attribute %s of %s: %w", name, path, err)
+	}
+	return nil
+}
+
+// lookupXattr returns the value of the extended attribute name of path, and whether path has it.
+// A filesystem that doesn't support extended attributes has none.
+func lookupXattr(path, name string) ([]byte, bool, error) {
+	value, err := getXattr(path, name)
+	if err != nil {
+		if errors.Is(err, errNoXattr) || errors.Is(err, unix.ENOTSUP) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to get extended attribute %s of %s: %w", name, path, err)
+	}
+	return value, true, nil
+}
+
+// listXattrs returns the names of the extended attributes of path.
+func listXattrs(path string) ([]string, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+// getXattr returns the value of the extended attribute name of path.
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	value := make([]byte, size)
+	size, err = unix.Getxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
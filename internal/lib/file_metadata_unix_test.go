@@ -0,0 +1,10 @@
+//go:build linux || darwin
+
+package lib
+
+import "golang.org/x/sys/unix"
+
+// setTestXattr sets the extended attribute name of path to value.
+func setTestXattr(path, name, value string) error {
+	return unix.Setxattr(path, name, []byte(value), 0)
+}
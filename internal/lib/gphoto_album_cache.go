@@ -1,21 +1,62 @@
 package lib
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/schollz/progressbar/v3"
 	"golang.org/x/time/rate"
 )
 
+// albumCacheVersion is the version of the album cache file format. Increment it when the format changes
+// incompatibly, and migrate the older versions in loadAlbumCache.
+const albumCacheVersion = 1
+
 // albumCache stores the mapping from album titles to album IDs.
 type albumCache struct {
-	Albums map[string]string `json:"albums"` // Title -> ID
-	mu     sync.RWMutex
-	path   string
+	// Version is the albumCacheVersion the cache file was saved with, or 0 for files from before it was added.
+	Version int               `json:"version"`
+	Albums  map[string]string `json:"albums"` // Title -> ID
+	// DateRanges are the date ranges that were appended to the titles of albums, by the titles that
+	// they are cached under, per append_date_range_to_album_titles.
+	DateRanges map[string]albumDateRange `json:"date_ranges,omitempty"`
+	mu         sync.RWMutex
+	path       string
+
+	// readOnly is set when the cache file was saved by a newer version of camflow,
+	// so that this version doesn't overwrite it.
+	readOnly bool
+
+	// created holds the titles of the albums created (or, in a dry run, that would have been created)
+	// by this process.
+	created map[string]struct{}
+
+	// pinnedIDs are the album IDs to use for their titles, in place of the cache and the API.
+	pinnedIDs map[string]string
+	// duplicateAlbums is the config.DuplicateAlbums value for titles that match more than one listed album.
+	duplicateAlbums string
+	// onlyExisting refuses to create albums, so that eg a typo in an album mapping can't create stray albums.
+	onlyExisting bool
+	// maxNewAlbums, if positive, is the most albums that this process creates before it asks confirmCreate,
+	// per upload.max_new_albums.
+	maxNewAlbums int
+	// confirmCreate asks whether to create the albums titled titles, past maxNewAlbums.
+	// If it is nil, eg because there is no terminal to ask on, they aren't created.
+	confirmCreate func(titles []string) (bool, error)
+	// checkOnline resolves the titles against the albums listed online, instead of the cached IDs,
+	// warns about cached IDs that don't match, and doesn't save the cache, for upload.check_api.
+	checkOnline bool
 }
 
 // getAlbumCachePath constructs the path to the album cache file.
@@ -24,10 +65,13 @@ func getAlbumCachePath(cacheDir string) string {
 }
 
 // loadAlbumCache loads the album cache from disk.
+// A cache from before the file was versioned is migrated. A cache saved by a newer version of camflow,
+// whose format this version may not understand, is ignored, and isn't overwritten.
 func loadAlbumCache(path string) (*albumCache, error) {
 	cache := &albumCache{
-		Albums: make(map[string]string),
-		path:   path,
+		Version: albumCacheVersion,
+		Albums:  make(map[string]string),
+		path:    path,
 	}
 	f, err := os.Open(path)
 	if err != nil {
@@ -37,9 +81,35 @@ func loadAlbumCache(path string) (*albumCache, error) {
 		return nil, fmt.Errorf("failed to open album cache file %s: %w", path, err)
 	}
 	defer f.Close()
-	if err := json.NewDecoder(f).Decode(&cache); err != nil {
+	// Decode the version first, so that a newer format doesn't fail to decode.
+	var data json.RawMessage
+	if err := json.NewDecoder(f).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode album cache file %s: %w", path, err)
+	}
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("failed to decode album cache file %s: %w", path, err)
+	}
+	switch {
+	case header.Version > albumCacheVersion:
+		logger.Warn("Album cache file is from a newer version of camflow, starting with an empty cache and leaving the file as is",
+			slog.String("path", path),
+			slog.Int("version", header.Version),
+			slog.Int("supported_version", albumCacheVersion))
+		cache.readOnly = true
+		return cache, nil
+	case header.Version == 0:
+		// Version 1 only added the version field, so an unversioned cache needs no other changes.
+		logger.Info("Migrating unversioned album cache file",
+			slog.String("path", path),
+			slog.Int("version", albumCacheVersion))
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
 		return nil, fmt.Errorf("failed to decode album cache file %s: %w", path, err)
 	}
+	cache.Version = albumCacheVersion
 	// Successfully decoded. Check if cache.Albums is nil (e.g. due to "albums": null in JSON)
 	// This can happen if the JSON file explicitly sets the 'albums' key to null.
 	if cache.Albums == nil {
@@ -52,6 +122,15 @@ func loadAlbumCache(path string) (*albumCache, error) {
 // save saves the album cache to disk.
 // The caller (getOrFetchAndCreateAlbumIDs) is expected to hold c.mu.Lock().
 func (c *albumCache) save() error {
+	if c.readOnly {
+		logger.Debug("Not saving album cache over a cache file from a newer version of camflow",
+			slog.String("path", c.path))
+		return nil
+	}
+	c.Version = albumCacheVersion
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for album cache file %s: %w", c.path, err)
+	}
 	f, err := os.OpenFile(c.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open album cache file %s for writing: %w", c.path, err)
@@ -67,6 +146,7 @@ func (c *albumCache) save() error {
 
 // getOrFetchAndCreateAlbumIDs retrieves album IDs for the given titles,
 // using the cache, fetching from the API, or creating them if necessary.
+// It lists the albums at most once, matching all titles in memory, and then creates only the missing albums.
 // It uses a rate limiter for API calls and preserves the order of IDs.
 func (c *albumCache) getOrFetchAndCreateAlbumIDs(
 	ctx context.Context,
@@ -80,13 +160,18 @@ func (c *albumCache) getOrFetchAndCreateAlbumIDs(
 
 	finalIDs := make([]string, len(titles))
 	titlesToProcessMap := make(map[string]int) // title -> original index
+	var cachedTitles []string
 	processedCount := 0
 
-	// 1. Check cache first and prepare for processing
+	// 1. Check pinned IDs and the cache first and prepare for processing
 	for i, title := range titles {
-		if id, found := c.Albums[title]; found {
+		if id, found := c.pinnedIDs[title]; found {
 			finalIDs[i] = id
 			processedCount++
+		} else if id, found := c.Albums[title]; found && !c.checkOnline {
+			finalIDs[i] = id
+			cachedTitles = append(cachedTitles, title)
+			processedCount++
 		} else {
 			titlesToProcessMap[title] = i // Store original index for later placement
 		}
@@ -95,8 +180,10 @@ func (c *albumCache) getOrFetchAndCreateAlbumIDs(
 	if processedCount == len(titles) {
 		return finalIDs, nil // All found in cache and correctly ordered
 	}
+	numCached := processedCount
 
-	fmt.Printf("Cache miss for some albums. Titles needing processing: %v. Fetching from Google Photos...\n", getKeys(titlesToProcessMap))
+	fmt.Printf("Resolving %d album(s) not in the cache...\n", len(titlesToProcessMap))
+	logger.Debug("Cache miss for albums", slog.Any("album_titles", getKeys(titlesToProcessMap)))
 	needsSave := false
 
 	// 2. Fetch all albums from Google Photos API to find existing ones among titlesToProcessMap
@@ -107,47 +194,123 @@ func (c *albumCache) getOrFetchAndCreateAlbumIDs(
 	if err != nil {
 		return nil, fmt.Errorf("failed to list albums from Google Photos API: %w", err)
 	}
+	// The cached titles aren't looked up, but check them for duplicates while the albums are listed anyway.
+	sort.Strings(cachedTitles)
+	for _, title := range cachedTitles {
+		if err := c.checkDuplicateAlbums(title, fetchedAlbums); err != nil {
+			return nil, err
+		}
+	}
 
-	for _, album := range fetchedAlbums { // Iterate directly over the slice
-		if originalIndex, needed := titlesToProcessMap[album.Title]; needed {
-			fmt.Printf("Found album online: '%s' (ID: %s)\n", album.Title, album.ID)
-			c.Albums[album.Title] = album.ID // Update cache
-			finalIDs[originalIndex] = album.ID
-			delete(titlesToProcessMap, album.Title) // Mark as processed
-			needsSave = true
-			processedCount++
+	numFound := 0
+	titlesToFind := getKeys(titlesToProcessMap)
+	sort.Strings(titlesToFind)
+	for _, title := range titlesToFind {
+		album, found, err := c.findListedAlbum(title, fetchedAlbums)
+		if err != nil {
+			return nil, err
 		}
+		if cachedID, ok := c.Albums[title]; ok && c.checkOnline && cachedID != album.ID {
+			if found {
+				logger.Warn("Cached album ID doesn't match the album found online",
+					slog.String("album_title", title),
+					slog.String("cached_album_id", cachedID),
+					slog.String("album_id", album.ID))
+			} else {
+				logger.Warn("Cached album wasn't found online",
+					slog.String("album_title", title),
+					slog.String("cached_album_id", cachedID))
+			}
+		}
+		if !found {
+			continue
+		}
+		logger.Debug("Found album online",
+			slog.String("album_title", album.Title),
+			slog.String("album_id", album.ID))
+		c.Albums[album.Title] = album.ID // Update cache
+		finalIDs[titlesToProcessMap[title]] = album.ID
+		delete(titlesToProcessMap, title) // Mark as processed
+		needsSave = true
+		processedCount++
+		numFound++
 	}
 
 	// 3. Create albums that are still in titlesToProcessMap (i.e., not cached, not found online)
-	for titleToCreate, originalIndex := range titlesToProcessMap {
+	// Create them in a stable order, so that runs are reproducible.
+	titlesToCreate := getKeys(titlesToProcessMap)
+	sort.Strings(titlesToCreate)
+	if c.onlyExisting && len(titlesToCreate) > 0 {
+		if needsSave && !c.checkOnline {
+			if err := c.save(); err != nil {
+				return nil, fmt.Errorf("error saving updated album cache: %w", err)
+			}
+		}
+		return nil, fmt.Errorf("refusing to create %d album(s) that don't exist, because upload.only_existing_albums is set: %q; check the album mappings for typos, or pass --allow-create-albums to create them", len(titlesToCreate), titlesToCreate)
+	}
+	if !dryRun && c.maxNewAlbums > 0 && len(c.created)+len(titlesToCreate) > c.maxNewAlbums {
+		confirmed := false
+		if c.confirmCreate != nil {
+			if confirmed, err = c.confirmCreate(titlesToCreate); err != nil {
+				return nil, fmt.Errorf("failed to confirm creating albums: %w", err)
+			}
+		}
+		if !confirmed {
+			if needsSave && !c.checkOnline {
+				if err := c.save(); err != nil {
+					return nil, fmt.Errorf("error saving updated album cache: %w", err)
+				}
+			}
+			return nil, fmt.Errorf("refusing to create %d album(s), which would make %d this run, more than upload.max_new_albums (%d): %q; check the album mappings, or raise upload.max_new_albums or pass --allow-create-albums to create them", len(titlesToCreate), len(c.created)+len(titlesToCreate), c.maxNewAlbums, titlesToCreate)
+		}
+	}
+	var bar *progressbar.ProgressBar
+	if !dryRun && len(titlesToCreate) > 0 {
+		bar = NewCountProgressBar(len(titlesToCreate), "creating albums")
+	}
+	for _, titleToCreate := range titlesToCreate {
+		originalIndex := titlesToProcessMap[titleToCreate]
 		if dryRun {
 			fmt.Printf("Would create album '%s'\n", titleToCreate)
 			finalIDs[originalIndex] = fmt.Sprintf("dry-run-id-%s", titleToCreate)
+			c.markCreated(titleToCreate)
 			processedCount++
 			continue
 		}
 
-		fmt.Printf("Album '%s' not found in cache or online. Creating...\n", titleToCreate)
 		if err := limiter.Wait(ctx); err != nil {
+			_ = bar.Exit()
 			return nil, fmt.Errorf("rate limiter error before creating album '%s': %w", titleToCreate, err)
 		}
 		newAlbum, err := albumsService.Create(ctx, titleToCreate) // Removed options ...albums.CreateOption
 		if err != nil {
+			_ = bar.Exit()
 			// If creation fails, this is a significant issue for the intended operation.
 			return nil, fmt.Errorf("failed to create album '%s': %w", titleToCreate, err)
 		}
-		fmt.Printf("Successfully created and cached album: '%s' (ID: %s)\n", newAlbum.Title, newAlbum.ID)
+		logger.Debug("Created album",
+			slog.String("album_title", newAlbum.Title),
+			slog.String("album_id", newAlbum.ID))
 		c.Albums[newAlbum.Title] = newAlbum.ID
 		finalIDs[originalIndex] = newAlbum.ID
-		// No need to delete from titlesToProcessMap here as we are iterating over it
+		c.markCreated(titleToCreate)
 		needsSave = true
 		processedCount++
+		_ = bar.Add(1)
 	}
+	if bar != nil {
+		_ = bar.Finish()
+	}
+
+	createdVerb := "created"
+	if dryRun {
+		createdVerb = "would create"
+	}
+	fmt.Printf("Albums: %d reused (%d cached, %d found online), %d %s\n",
+		numCached+numFound, numCached, numFound, len(titlesToCreate), createdVerb)
 
 	// 4. Save cache if any changes were made
-	if needsSave {
-		fmt.Println("Saving updated album cache...")
+	if needsSave && !c.checkOnline {
 		if err := c.save(); err != nil {
 			return nil, fmt.Errorf("error saving updated album cache: %w", err)
 		}
@@ -169,6 +332,123 @@ func (c *albumCache) getOrFetchAndCreateAlbumIDs(
 	return finalIDs, nil
 }
 
+// findListedAlbum returns the first album in listed with the exact title, if any.
+// It checks title for duplicates with checkDuplicateAlbums first.
+func (c *albumCache) findListedAlbum(title string, listed []albums.Album) (albums.Album, bool, error) {
+	if err := c.checkDuplicateAlbums(title, listed); err != nil {
+		return albums.Album{}, false, err
+	}
+	var found *albums.Album
+	for i, album := range listed {
+		if album.Title == title {
+			found = &listed[i]
+			break
+		}
+	}
+	if found == nil {
+		// An album that was renamed to append its date range is listed under its new title.
+		if dateRange, ok := c.DateRanges[title]; ok {
+			renamedTitle := albumTitleWithDateRange(title, []time.Time{dateRange.First, dateRange.Last})
+			for i, album := range listed {
+				if album.Title == renamedTitle {
+					return listed[i], true, nil
+				}
+			}
+		}
+		return albums.Album{}, false, nil
+	}
+	return *found, true, nil
+}
+
+// checkDuplicateAlbums warns, or with config.DuplicateAlbumsError returns an error, when more than one
+// album in listed matches title ignoring case, since Google Photos allows more than one album with a title.
+func (c *albumCache) checkDuplicateAlbums(title string, listed []albums.Album) error {
+	var matchingIDs []string
+	for _, album := range listed {
+		if strings.EqualFold(album.Title, title) {
+			matchingIDs = append(matchingIDs, album.ID)
+		}
+	}
+	if len(matchingIDs) <= 1 {
+		return nil
+	}
+	if c.duplicateAlbums == config.DuplicateAlbumsError {
+		return fmt.Errorf("found %d albums titled %q, ignoring case, with ids %v: set upload.album_ids to choose one", len(matchingIDs), title, matchingIDs)
+	}
+	logger.Warn("Found more than one album with the title, ignoring case (set upload.album_ids to choose one)",
+		slog.String("album_title", title),
+		slog.Any("album_ids", matchingIDs))
+	return nil
+}
+
+// markCreated records that this process created the album titled title.
+// The caller is expected to hold c.mu.Lock().
+func (c *albumCache) markCreated(title string) {
+	if c.created == nil {
+		c.created = make(map[string]struct{})
+	}
+	c.created[title] = struct{}{}
+}
+
+// createdTitles returns the titles of the albums among titles that this process created, sorted.
+func (c *albumCache) createdTitles(titles []string) []string {
+	var created []string
+	for _, title := range titles {
+		if c.wasCreated(title) {
+			created = append(created, title)
+		}
+	}
+	sort.Strings(created)
+	return created
+}
+
+// confirmAlbumCreationOnTerminal asks on the terminal whether to create the albums titled titles.
+func confirmAlbumCreationOnTerminal(titles []string) (bool, error) {
+	fmt.Printf("About to create %d album(s), more than upload.max_new_albums allows:\n", len(titles))
+	for _, title := range titles {
+		fmt.Printf("\t%s\n", title)
+	}
+	fmt.Print("Create them? [y/N]: ")
+	response, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes", nil
+}
+
+// dateRange returns the date range that was appended to the title of the album cached as title, if any.
+func (c *albumCache) dateRange(title string) (albumDateRange, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r, ok := c.DateRanges[title]
+	return r, ok
+}
+
+// recordDateRange records that the album with id was renamed to append dateRange to title, and saves the cache.
+// The album stays cached under title, so that later runs find it by title rather than create another.
+func (c *albumCache) recordDateRange(title, id string, dateRange albumDateRange) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Albums[title] = id
+	if c.DateRanges == nil {
+		c.DateRanges = make(map[string]albumDateRange)
+	}
+	c.DateRanges[title] = dateRange
+	if c.checkOnline {
+		return nil
+	}
+	return c.save()
+}
+
+// wasCreated returns whether this process created the album titled title.
+func (c *albumCache) wasCreated(title string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.created[title]
+	return ok
+}
+
 // Helper function to get keys from a map for printing (order not guaranteed)
 func getKeys(m map[string]int) []string {
 	keys := make([]string, 0, len(m))
@@ -0,0 +1,274 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestGetOrFetchAndCreateAlbumIDs_SingleList(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockAlbums := NewMockAppAlbumsService(ctrl)
+	limiter := rate.NewLimiter(rate.Inf, 1)
+
+	cache, err := loadAlbumCache(filepath.Join(t.TempDir(), "album_cache.json"))
+	require.NoError(t, err)
+	cache.Albums["Cached"] = "id-cached"
+
+	// All uncached titles are matched against a single List, and only the missing ones are created.
+	mockAlbums.EXPECT().List(gomock.Any()).Return([]albums.Album{
+		{ID: "id-online", Title: "Online"},
+		{ID: "id-unrelated", Title: "Unrelated"},
+	}, nil).Times(1)
+	mockAlbums.EXPECT().Create(gomock.Any(), "New A").Return(&albums.Album{ID: "id-new-a", Title: "New A"}, nil).Times(1)
+	mockAlbums.EXPECT().Create(gomock.Any(), "New B").Return(&albums.Album{ID: "id-new-b", Title: "New B"}, nil).Times(1)
+
+	titles := []string{"New B", "Online", "Cached", "New A"}
+	ids, err := cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, titles, limiter, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id-new-b", "id-online", "id-cached", "id-new-a"}, ids, "IDs should be in the order of the titles")
+
+	assert.True(t, cache.wasCreated("New A"))
+	assert.True(t, cache.wasCreated("New B"))
+	assert.False(t, cache.wasCreated("Online"))
+
+	// The resolved albums were saved, so a new run neither lists nor creates albums.
+	reloaded, err := loadAlbumCache(cache.path)
+	require.NoError(t, err)
+	ids, err = reloaded.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, titles, limiter, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id-new-b", "id-online", "id-cached", "id-new-a"}, ids)
+}
+
+func TestGetOrFetchAndCreateAlbumIDs_OnlyExisting(t *testing.T) {
+	ctx := context.Background()
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	listed := []albums.Album{{ID: "id-japan", Title: "Japan"}}
+
+	t.Run("RefusesToCreate", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockAlbums := NewMockAppAlbumsService(ctrl)
+		cache, err := loadAlbumCache(filepath.Join(t.TempDir(), "album_cache.json"))
+		require.NoError(t, err)
+		cache.onlyExisting = true
+
+		// Create isn't expected, so calling it fails the test.
+		mockAlbums.EXPECT().List(gomock.Any()).Return(listed, nil)
+		_, err = cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"Japan", "Jpaan"}, limiter, false)
+		assert.ErrorContains(t, err, "refusing to create 1 album(s)")
+		assert.ErrorContains(t, err, `"Jpaan"`)
+		assert.ErrorContains(t, err, "--allow-create-albums")
+
+		// The existing album that was found is still cached.
+		reloaded, err := loadAlbumCache(cache.path)
+		require.NoError(t, err)
+		assert.Equal(t, "id-japan", reloaded.Albums["Japan"])
+
+		// Existing albums are still used.
+		ids, err := reloaded.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"Japan"}, limiter, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"id-japan"}, ids)
+	})
+
+	t.Run("AllowsCreate", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockAlbums := NewMockAppAlbumsService(ctrl)
+		cache, err := loadAlbumCache(filepath.Join(t.TempDir(), "album_cache.json"))
+		require.NoError(t, err)
+		cache.onlyExisting = false
+
+		mockAlbums.EXPECT().List(gomock.Any()).Return(listed, nil)
+		mockAlbums.EXPECT().Create(gomock.Any(), "Jpaan").Return(&albums.Album{ID: "id-jpaan", Title: "Jpaan"}, nil)
+		ids, err := cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"Japan", "Jpaan"}, limiter, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"id-japan", "id-jpaan"}, ids)
+	})
+}
+
+func TestGetOrFetchAndCreateAlbumIDs_MaxNewAlbums(t *testing.T) {
+	ctx := context.Background()
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	listed := []albums.Album{{ID: "id-japan", Title: "Japan"}}
+	newCache := func(t *testing.T) *albumCache {
+		cache, err := loadAlbumCache(filepath.Join(t.TempDir(), "album_cache.json"))
+		require.NoError(t, err)
+		cache.maxNewAlbums = 2
+		return cache
+	}
+	expectCreate := func(mockAlbums *MockAppAlbumsService, title string) {
+		mockAlbums.EXPECT().Create(gomock.Any(), title).Return(&albums.Album{ID: "id-" + title, Title: title}, nil)
+	}
+
+	t.Run("UnderCap", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockAlbums := NewMockAppAlbumsService(ctrl)
+		cache := newCache(t)
+		cache.confirmCreate = func([]string) (bool, error) {
+			t.Error("Creating albums within the cap shouldn't ask")
+			return false, nil
+		}
+
+		mockAlbums.EXPECT().List(gomock.Any()).Return(listed, nil)
+		expectCreate(mockAlbums, "a")
+		expectCreate(mockAlbums, "b")
+		_, err := cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"Japan", "a", "b"}, limiter, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, cache.createdTitles([]string{"b", "Japan", "a"}))
+	})
+
+	t.Run("NonInteractive", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockAlbums := NewMockAppAlbumsService(ctrl)
+		cache := newCache(t)
+
+		// The albums created earlier in the run count towards the cap.
+		mockAlbums.EXPECT().List(gomock.Any()).Return(listed, nil).Times(2)
+		expectCreate(mockAlbums, "a")
+		_, err := cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"a"}, limiter, false)
+		require.NoError(t, err)
+		// Create isn't expected again, so calling it fails the test.
+		_, err = cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"Japan", "b", "c"}, limiter, false)
+		assert.ErrorContains(t, err, "refusing to create 2 album(s), which would make 3 this run, more than upload.max_new_albums (2)")
+		assert.ErrorContains(t, err, `"b" "c"`)
+		assert.Equal(t, "id-japan", cache.Albums["Japan"], "The existing album should still be cached")
+
+		// A dry run doesn't create albums, so it isn't capped.
+		mockAlbums.EXPECT().List(gomock.Any()).Return(listed, nil)
+		_, err = cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"b", "c"}, limiter, true)
+		require.NoError(t, err)
+	})
+
+	t.Run("Interactive", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockAlbums := NewMockAppAlbumsService(ctrl)
+		cache := newCache(t)
+		var asked [][]string
+		confirm := false
+		cache.confirmCreate = func(titles []string) (bool, error) {
+			asked = append(asked, titles)
+			return confirm, nil
+		}
+
+		mockAlbums.EXPECT().List(gomock.Any()).Return(listed, nil).Times(2)
+		_, err := cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"a", "b", "c"}, limiter, false)
+		assert.ErrorContains(t, err, "refusing to create 3 album(s)")
+
+		confirm = true
+		expectCreate(mockAlbums, "a")
+		expectCreate(mockAlbums, "b")
+		expectCreate(mockAlbums, "c")
+		ids, err := cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"a", "b", "c"}, limiter, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"id-a", "id-b", "id-c"}, ids)
+		assert.Equal(t, [][]string{{"a", "b", "c"}, {"a", "b", "c"}}, asked)
+	})
+
+	t.Run("ConfirmFails", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockAlbums := NewMockAppAlbumsService(ctrl)
+		cache := newCache(t)
+		cache.confirmCreate = func([]string) (bool, error) { return false, errors.New("EOF") }
+
+		mockAlbums.EXPECT().List(gomock.Any()).Return(listed, nil)
+		_, err := cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"a", "b", "c"}, limiter, false)
+		assert.ErrorContains(t, err, "failed to confirm creating albums: EOF")
+	})
+}
+
+func TestGetOrFetchAndCreateAlbumIDs_DuplicateTitles(t *testing.T) {
+	ctx := context.Background()
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	listed := []albums.Album{
+		{ID: "id-family-lower", Title: "family"},
+		{ID: "id-family-1", Title: "Family"},
+		{ID: "id-family-2", Title: "Family"},
+		{ID: "id-trip", Title: "Trip"},
+	}
+
+	var logs bytes.Buffer
+	origLogger := logger
+	logger = slog.New(slog.NewTextHandler(&logs, nil))
+	defer func() { logger = origLogger }()
+
+	ctrl := gomock.NewController(t)
+	mockAlbums := NewMockAppAlbumsService(ctrl)
+	mockAlbums.EXPECT().List(gomock.Any()).Return(listed, nil).Times(1)
+	cache, err := loadAlbumCache(filepath.Join(t.TempDir(), "album_cache.json"))
+	require.NoError(t, err)
+	ids, err := cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"Family", "Trip"}, limiter, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id-family-1", "id-trip"}, ids, "The first album with the exact title should be used")
+	assert.Contains(t, logs.String(), "Found more than one album with the title")
+	assert.Contains(t, logs.String(), "id-family-lower")
+	assert.NotContains(t, logs.String(), "album_title=Trip")
+
+	// With duplicate_albums = "error", the upload stops instead.
+	mockAlbums.EXPECT().List(gomock.Any()).Return(listed, nil).Times(1)
+	cache, err = loadAlbumCache(filepath.Join(t.TempDir(), "album_cache.json"))
+	require.NoError(t, err)
+	cache.duplicateAlbums = config.DuplicateAlbumsError
+	_, err = cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"Family"}, limiter, false)
+	assert.ErrorContains(t, err, `found 3 albums titled "Family"`)
+
+	// Cached titles are checked too when the albums are listed for another title.
+	mockAlbums.EXPECT().List(gomock.Any()).Return(listed, nil).Times(1)
+	cache, err = loadAlbumCache(filepath.Join(t.TempDir(), "album_cache.json"))
+	require.NoError(t, err)
+	cache.duplicateAlbums = config.DuplicateAlbumsError
+	cache.Albums["Family"] = "id-family-1"
+	_, err = cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"Family", "Trip"}, limiter, false)
+	assert.ErrorContains(t, err, `found 3 albums titled "Family"`)
+
+	// A pinned ID is used without looking up the title.
+	cache, err = loadAlbumCache(filepath.Join(t.TempDir(), "album_cache.json"))
+	require.NoError(t, err)
+	cache.duplicateAlbums = config.DuplicateAlbumsError
+	cache.pinnedIDs = map[string]string{"Family": "id-family-2"}
+	ids, err = cache.getOrFetchAndCreateAlbumIDs(ctx, mockAlbums, []string{"Family"}, limiter, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id-family-2"}, ids)
+}
+
+func TestLoadAlbumCache_Versions(t *testing.T) {
+	t.Run("Legacy", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "album_cache.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"albums": {"Family": "id-family"}}`), 0644))
+
+		cache, err := loadAlbumCache(path)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"Family": "id-family"}, cache.Albums, "An unversioned cache should be migrated")
+
+		require.NoError(t, cache.save())
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"version": 1`, "The current version should be written on save")
+	})
+
+	t.Run("Future", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "album_cache.json")
+		future := `{"version": 99, "albums": [{"title": "Family", "id": "id-family"}]}`
+		require.NoError(t, os.WriteFile(path, []byte(future), 0644))
+
+		cache, err := loadAlbumCache(path)
+		require.NoError(t, err)
+		assert.Empty(t, cache.Albums, "A cache from a newer version should be ignored")
+
+		cache.Albums["Trip"] = "id-trip"
+		require.NoError(t, cache.save())
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, future, string(data), "A cache from a newer version shouldn't be overwritten")
+	})
+}
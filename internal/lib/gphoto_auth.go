@@ -2,8 +2,11 @@ package lib
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
@@ -11,12 +14,19 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/ccfrost/camflow/internal/config"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 )
 
+// ErrInsufficientScope is returned when the saved OAuth token lacks a permission (scope) that an API call needs,
+// eg because the token was saved by a version of camflow that requested fewer scopes.
+var ErrInsufficientScope = errors.New("google photos token is missing required permissions")
+
 // --- OAuth2 & Client Setup ---
 
 // GetAuthenticatedGooglePhotosClient creates an authenticated HTTP client using OAuth2 credentials.
@@ -27,6 +37,66 @@ func GetAuthenticatedGooglePhotosClient(ctx context.Context, cfg config.CamflowC
 		return nil, fmt.Errorf("google Photos ClientId or ClientSecret not configured")
 	}
 
+	conf := newOAuthConfig(cfg)
+	tokenFilePath := getTokenFilePath(cacheDir)
+	token, err := loadToken(tokenFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh an expired access token, rather than asking the user to authorize camflow again.
+	if token != nil && !token.Valid() && token.RefreshToken != "" {
+		refreshed, err := tokenWithRetries(ctx, conf.TokenSource(ctx, token))
+		switch {
+		case err == nil:
+			token = refreshed
+			if err := saveToken(tokenFilePath, token); err != nil {
+				fmt.Printf("Warning: Failed to save refreshed token to %s: %v\n", tokenFilePath, err)
+			}
+		case isRevokedTokenError(err):
+			fmt.Printf("OAuth token was revoked or expired: %v\n", err)
+		default:
+			return nil, fmt.Errorf("failed to refresh oauth token: %w", err)
+		}
+	}
+
+	if token == nil || !token.Valid() {
+		if token == nil {
+			fmt.Println("No existing OAuth token found, starting auth flow...")
+		} else {
+			fmt.Println("OAuth token is invalid (eg, expired), starting auth flow...")
+		}
+		newToken, err := getTokenFromWeb(ctx, conf)
+		if err != nil {
+			return nil, err
+		}
+		token = newToken
+		if err := saveToken(tokenFilePath, token); err != nil {
+			// Log error but continue, maybe token is still usable in memory
+			fmt.Printf("Warning: Failed to save token to %s: %v\n", tokenFilePath, err)
+		}
+		fmt.Printf("Token obtained and saved successfully to %s\n", tokenFilePath)
+	}
+
+	// The gphotosuploader library expects an http.Client, which oauth2.Config provides.
+	return conf.Client(ctx, token), nil
+}
+
+// oauthScopes are the OAuth scopes that camflow asks for. The openid and email scopes let
+// Login report which account camflow is authorized for.
+var oauthScopes = []string{
+	"https://www.googleapis.com/auth/photoslibrary.readonly.appcreateddata",
+	"https://www.googleapis.com/auth/photoslibrary.appendonly",
+	"https://www.googleapis.com/auth/photoslibrary.edit.appcreateddata",
+	"openid",
+	"email",
+}
+
+// oauthEndpoint is the OAuth endpoint to authorize camflow with. It is a variable so that tests can fake it.
+var oauthEndpoint = google.Endpoint
+
+// newOAuthConfig returns the OAuth config to authorize camflow with the client in cfg.
+func newOAuthConfig(cfg config.CamflowConfig) *oauth2.Config {
 	// Use http://localhost:0 for auto-selected port if RedirectURI is empty,
 	// otherwise use the configured one.
 	redirectURI := cfg.GooglePhotos.RedirectURI
@@ -40,56 +110,164 @@ func GetAuthenticatedGooglePhotosClient(ctx context.Context, cfg config.CamflowC
 		}
 	}
 
-	conf := &oauth2.Config{
+	return &oauth2.Config{
 		ClientID:     cfg.GooglePhotos.ClientId,
 		ClientSecret: cfg.GooglePhotos.ClientSecret,
 		RedirectURL:  redirectURI,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/photoslibrary.readonly.appcreateddata",
-			"https://www.googleapis.com/auth/photoslibrary.appendonly",
-			"https://www.googleapis.com/auth/photoslibrary.edit.appcreateddata",
-		},
-		Endpoint: google.Endpoint,
+		Scopes:       oauthScopes,
+		Endpoint:     oauthEndpoint,
 	}
+}
 
-	tokenFilePath := getTokenFilePath(cacheDir)
-
-	token := &oauth2.Token{}
+// loadToken returns the OAuth token saved at tokenFilePath, or nil if there isn't a readable one.
+func loadToken(tokenFilePath string) (*oauth2.Token, error) {
 	tokenFile, err := os.Open(tokenFilePath)
-	if err == nil {
-		err = json.NewDecoder(tokenFile).Decode(token)
-		tokenFile.Close()
-		if err != nil {
-			fmt.Printf("Error reading token file (%s), requesting new token: %v\n", tokenFilePath, err)
-			token = nil // Force getting a new token
-		}
-	} else if !os.IsNotExist(err) {
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to open token file %s: %w", tokenFilePath, err)
-	} else {
-		// File does not exist, need to get token
-		token = nil
 	}
+	defer tokenFile.Close()
+	token := &oauth2.Token{}
+	if err := json.NewDecoder(tokenFile).Decode(token); err != nil {
+		fmt.Printf("Error reading token file (%s), requesting new token: %v\n", tokenFilePath, err)
+		return nil, nil
+	}
+	return token, nil
+}
 
-	if token == nil || !token.Valid() {
-		if token == nil {
-			fmt.Println("No existing OAuth token found, starting auth flow...")
-		} else {
-			fmt.Println("OAuth token is invalid (eg, expired), starting auth flow...")
+// Login runs the OAuth flow to authorize camflow to use Google Photos, and saves the token for later
+// commands, replacing any saved token. It returns the email address of the authorized account,
+// or "" if it isn't known.
+func Login(ctx context.Context, cfg config.CamflowConfig, cacheDir string) (string, error) {
+	if cfg.GooglePhotos.ClientId == "" || cfg.GooglePhotos.ClientSecret == "" {
+		return "", fmt.Errorf("google Photos ClientId or ClientSecret not configured")
+	}
+	token, err := getTokenFromWeb(ctx, newOAuthConfig(cfg))
+	if err != nil {
+		return "", err
+	}
+	tokenFilePath := getTokenFilePath(cacheDir)
+	if err := saveToken(tokenFilePath, token); err != nil {
+		return "", fmt.Errorf("failed to save token to %s: %w", tokenFilePath, err)
+	}
+	return tokenEmail(token), nil
+}
+
+// tokenEmail returns the email address in the ID token that came with token, or "" if there isn't one.
+// The ID token isn't verified, because it came straight from the token endpoint and is only reported.
+func tokenEmail(token *oauth2.Token) string {
+	idToken, _ := token.Extra("id_token").(string)
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.Email
+}
+
+// authRetries is the number of times that getting an OAuth token is retried after a transient failure.
+const authRetries = 3
+
+// authRetryDelay is the delay before the first retry of getting an OAuth token, which doubles for each
+// later retry. It is a variable so that tests don't wait.
+var authRetryDelay = time.Second
+
+// tokenWithRetries gets a token from ts, eg refreshing an expired token with the token endpoint.
+// It retries transient failures, like network errors and server errors, with backoff, so that
+// a brief network blip doesn't fail the command. Other errors, eg invalid credentials, are returned at once.
+func tokenWithRetries(ctx context.Context, ts oauth2.TokenSource) (*oauth2.Token, error) {
+	delay := authRetryDelay
+	for attempt := 0; ; attempt++ {
+		token, err := ts.Token()
+		if err == nil {
+			return token, nil
 		}
-		newToken, err := getTokenFromWeb(ctx, conf)
-		if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt >= authRetries || !isRetryableAuthError(err) {
 			return nil, err
 		}
-		token = newToken
-		if err := saveToken(tokenFilePath, token); err != nil {
-			// Log error but continue, maybe token is still usable in memory
-			fmt.Printf("Warning: Failed to save token to %s: %v\n", tokenFilePath, err)
+		logger.Warn("Failed to get OAuth token, retrying",
+			slog.Int("retry", attempt+1),
+			slog.Int("max_retries", authRetries),
+			slog.Duration("delay", delay),
+			slog.String("error", err.Error()))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
 		}
-		fmt.Printf("Token obtained and saved successfully to %s\n", tokenFilePath)
+		delay *= 2
 	}
+}
 
-	// The gphotosuploader library expects an http.Client, which oauth2.Config provides.
-	return conf.Client(ctx, token), nil
+// isRetryableAuthError returns whether err, from getting an OAuth token, may succeed if retried.
+// The token endpoint rejecting the request, eg for invalid credentials, isn't retryable,
+// except for rate limiting and server errors.
+func isRetryableAuthError(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		if retrieveErr.Response == nil {
+			return false
+		}
+		code := retrieveErr.Response.StatusCode
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isRevokedTokenError returns whether err, from refreshing an OAuth token, means that the refresh token
+// is no longer valid, eg because the user revoked it, so that the user needs to authorize camflow again.
+func isRevokedTokenError(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant"
+}
+
+// Logout deletes the saved OAuth token, so that the next command that uses Google Photos re-authenticates.
+// It returns whether there was a saved token.
+func Logout(cacheDir string) (bool, error) {
+	tokenFilePath := getTokenFilePath(cacheDir)
+	if err := os.Remove(tokenFilePath); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to remove token file %s: %w", tokenFilePath, err)
+	}
+	return true, nil
+}
+
+// checkScopeError returns an actionable error wrapping ErrInsufficientScope if err is
+// an insufficient-scope response from the API. Otherwise, it returns err unchanged.
+func checkScopeError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return err
+	}
+	insufficientScope := strings.Contains(apiErr.Header.Get("WWW-Authenticate"), "insufficient_scope") ||
+		strings.Contains(strings.ToLower(apiErr.Message), "scope") ||
+		strings.Contains(apiErr.Body, "ACCESS_TOKEN_SCOPE_INSUFFICIENT")
+	if !insufficientScope {
+		return err
+	}
+	return fmt.Errorf("%w: run `camflow logout` and then rerun this command to re-authenticate: %v", ErrInsufficientScope, err)
 }
 
 // getTokenFilePath determines where to store the token file.
@@ -97,14 +275,20 @@ func getTokenFilePath(cacheDir string) string {
 	return filepath.Join(cacheDir, "google_photos_token.json")
 }
 
-// saveToken saves the OAuth2 token to the specified file path.
+// saveToken saves the OAuth2 token to the specified file path, readable only by the user.
+// It is written with writeFileAtomic, so that a failed save leaves any earlier token intact.
 func saveToken(path string, token *oauth2.Token) error {
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create dir for oauth token: %w", err)
+	}
+	data, err := json.Marshal(token)
 	if err != nil {
+		return fmt.Errorf("unable to encode oauth token: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0600); err != nil {
 		return fmt.Errorf("unable to cache oauth token: %w", err)
 	}
-	defer f.Close()
-	return json.NewEncoder(f).Encode(token)
+	return nil
 }
 
 // getTokenFromWeb guides the user through the web-based OAuth2 flow via a local server.
@@ -155,7 +339,7 @@ func getTokenFromWeb(ctx context.Context, conf *oauth2.Config) (*oauth2.Token, e
 	authURL := conf.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
 	fmt.Printf("Opening browser to complete authentication:\n%s\n", authURL)
 
-	go openBrowser(authURL)
+	go openBrowserFunc(authURL)
 
 	fmt.Println("Waiting for authentication callback...")
 
@@ -176,6 +360,9 @@ func getTokenFromWeb(ctx context.Context, conf *oauth2.Config) (*oauth2.Token, e
 	}
 }
 
+// openBrowserFunc opens the auth URL for the user. It is a variable so that tests can fake the user.
+var openBrowserFunc = openBrowser
+
 // openBrowser attempts to open the specified URL in the default browser.
 func openBrowser(url string) {
 	var err error
@@ -0,0 +1,223 @@
+package lib
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestCheckScopeError(t *testing.T) {
+	t.Run("InsufficientScopeFromAPI", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="https://accounts.google.com/", error="insufficient_scope"`)
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error": {"code": 403, "message": "Request had insufficient authentication scopes.", "status": "PERMISSION_DENIED",
+				"details": [{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "ACCESS_TOKEN_SCOPE_INSUFFICIENT"}]}}`))
+		}))
+		defer server.Close()
+
+		albumsService, err := albums.New(albums.Config{Client: server.Client(), BaseURL: server.URL + "/"})
+		require.NoError(t, err)
+		s := &albumsServiceWrapper{AlbumsService: albumsService, httpClient: server.Client(), baseURL: server.URL + "/"}
+
+		_, err = s.Create(context.Background(), "Camflow: Photos")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrInsufficientScope)
+		assert.ErrorContains(t, err, "run `camflow logout` and then rerun this command to re-authenticate")
+
+		_, err = s.UpdateTitle(context.Background(), "album-1", "Camflow: Photos (May 3)")
+		assert.ErrorIs(t, err, ErrInsufficientScope)
+	})
+
+	t.Run("OtherForbiddenUnchanged", func(t *testing.T) {
+		err := &googleapi.Error{Code: http.StatusForbidden, Message: "The caller does not have permission"}
+		assert.Same(t, err, checkScopeError(err))
+	})
+
+	t.Run("NilAndOtherErrors", func(t *testing.T) {
+		assert.NoError(t, checkScopeError(nil))
+		err := errors.New("boom")
+		assert.Equal(t, err, checkScopeError(err))
+	})
+}
+
+func TestLogout(t *testing.T) {
+	cacheDir := t.TempDir()
+	require.NoError(t, os.WriteFile(getTokenFilePath(cacheDir), []byte(`{}`), 0600))
+
+	hadToken, err := Logout(cacheDir)
+	require.NoError(t, err)
+	assert.True(t, hadToken)
+	_, err = os.Stat(getTokenFilePath(cacheDir))
+	assert.True(t, os.IsNotExist(err), "Token file should be removed")
+
+	hadToken, err = Logout(cacheDir)
+	require.NoError(t, err)
+	assert.False(t, hadToken)
+}
+
+// flakyTokenSource is a token source that returns each of errs in turn, and then a token.
+type flakyTokenSource struct {
+	errs  []error
+	calls int
+}
+
+func (s *flakyTokenSource) Token() (*oauth2.Token, error) {
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return nil, s.errs[s.calls-1]
+	}
+	return &oauth2.Token{AccessToken: "access-token"}, nil
+}
+
+func TestTokenWithRetries(t *testing.T) {
+	oldDelay := authRetryDelay
+	authRetryDelay = time.Millisecond
+	t.Cleanup(func() { authRetryDelay = oldDelay })
+
+	dnsErr := &url.Error{Op: "Post", URL: "https://oauth2.googleapis.com/token", Err: &net.DNSError{Err: "no such host", Name: "oauth2.googleapis.com", IsTemporary: true}}
+	serverErr := &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}}
+	invalidClientErr := &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusUnauthorized}, ErrorCode: "invalid_client"}
+
+	t.Run("TransientFailures", func(t *testing.T) {
+		ts := &flakyTokenSource{errs: []error{dnsErr, serverErr}}
+		token, err := tokenWithRetries(context.Background(), ts)
+		require.NoError(t, err)
+		assert.Equal(t, "access-token", token.AccessToken)
+		assert.Equal(t, 3, ts.calls)
+	})
+
+	t.Run("SustainedFailures", func(t *testing.T) {
+		ts := &flakyTokenSource{errs: slices.Repeat([]error{serverErr}, authRetries+1)}
+		_, err := tokenWithRetries(context.Background(), ts)
+		assert.ErrorIs(t, err, serverErr)
+		assert.Equal(t, authRetries+1, ts.calls)
+	})
+
+	t.Run("InvalidCredentialsFailFast", func(t *testing.T) {
+		ts := &flakyTokenSource{errs: []error{invalidClientErr}}
+		_, err := tokenWithRetries(context.Background(), ts)
+		assert.ErrorIs(t, err, invalidClientErr)
+		assert.Equal(t, 1, ts.calls, "Invalid credentials should not be retried")
+		assert.False(t, isRevokedTokenError(err))
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		ts := &flakyTokenSource{errs: []error{dnsErr}}
+		_, err := tokenWithRetries(ctx, ts)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, ts.calls)
+	})
+
+	t.Run("RevokedToken", func(t *testing.T) {
+		revokedErr := &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadRequest}, ErrorCode: "invalid_grant"}
+		ts := &flakyTokenSource{errs: []error{revokedErr}}
+		_, err := tokenWithRetries(context.Background(), ts)
+		assert.True(t, isRevokedTokenError(err))
+		assert.Equal(t, 1, ts.calls)
+	})
+}
+
+func TestSaveToken(t *testing.T) {
+	tokenFilePath := getTokenFilePath(filepath.Join(t.TempDir(), "cache"))
+
+	require.NoError(t, saveToken(tokenFilePath, &oauth2.Token{AccessToken: "first", RefreshToken: "refresh"}))
+	info, err := os.Stat(tokenFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Only the user should be able to read the token")
+	token, err := loadToken(tokenFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, "first", token.AccessToken)
+	assert.Equal(t, "refresh", token.RefreshToken)
+
+	require.NoError(t, saveToken(tokenFilePath, &oauth2.Token{AccessToken: "second"}))
+	token, err = loadToken(tokenFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, "second", token.AccessToken)
+
+	// A failed save leaves the saved token intact.
+	tmpPath := filepath.Join(filepath.Dir(tokenFilePath), "."+filepath.Base(tokenFilePath)+".tmp")
+	require.NoError(t, os.Mkdir(tmpPath, 0700))
+	assert.Error(t, saveToken(tokenFilePath, &oauth2.Token{AccessToken: "third"}))
+	token, err = loadToken(tokenFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, "second", token.AccessToken)
+}
+
+func TestLogin(t *testing.T) {
+	idTokenPayload := base64.RawURLEncoding.EncodeToString([]byte(`{"email":"me@example.com"}`))
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "auth-code", r.PostForm.Get("code"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token": "access-token", "refresh_token": "refresh-token", "token_type": "Bearer",
+			"expires_in": 3600, "id_token": "header.` + idTokenPayload + `.signature"}`))
+	}))
+	defer tokenServer.Close()
+	oldEndpoint, oldOpenBrowser := oauthEndpoint, openBrowserFunc
+	t.Cleanup(func() { oauthEndpoint, openBrowserFunc = oldEndpoint, oldOpenBrowser })
+	oauthEndpoint = oauth2.Endpoint{AuthURL: tokenServer.URL + "/auth", TokenURL: tokenServer.URL + "/token"}
+
+	// Pick a free port for the redirect back from the browser.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	redirectURI := "http://" + l.Addr().String()
+	require.NoError(t, l.Close())
+	// The user approves camflow in the browser, which redirects back with the auth code.
+	openBrowserFunc = func(authURL string) {
+		resp, err := http.Get(redirectURI + "/?code=auth-code&state=state-token")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	cfg := newTestConfig(t, "", "")
+	cfg.GooglePhotos.ClientId = "client-id"
+	cfg.GooglePhotos.ClientSecret = "client-secret"
+	cfg.GooglePhotos.RedirectURI = redirectURI
+	cacheDir := t.TempDir()
+	require.NoError(t, saveToken(getTokenFilePath(cacheDir), &oauth2.Token{AccessToken: "old-token"}))
+
+	email, err := Login(context.Background(), cfg, cacheDir)
+	require.NoError(t, err)
+	assert.Equal(t, "me@example.com", email)
+	token, err := loadToken(getTokenFilePath(cacheDir))
+	require.NoError(t, err)
+	assert.Equal(t, "access-token", token.AccessToken, "Login should replace the saved token")
+	assert.Equal(t, "refresh-token", token.RefreshToken)
+}
+
+func TestLogin_NoClientConfigured(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	cfg.GooglePhotos.ClientId = ""
+	_, err := Login(context.Background(), cfg, t.TempDir())
+	assert.ErrorContains(t, err, "ClientId or ClientSecret not configured")
+}
+
+func TestTokenEmail(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"email":"me@example.com"}`))
+	token := (&oauth2.Token{}).WithExtra(map[string]any{"id_token": "header." + payload + ".signature"})
+	assert.Equal(t, "me@example.com", tokenEmail(token))
+
+	assert.Empty(t, tokenEmail(&oauth2.Token{}), "A token without an ID token has no email")
+	token = (&oauth2.Token{}).WithExtra(map[string]any{"id_token": "not-a-jwt"})
+	assert.Empty(t, tokenEmail(token))
+}
@@ -4,11 +4,20 @@
 package lib
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	gphotosUploader "github.com/gphotosuploader/google-photos-api-client-go/v3"
 	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
 	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/uploader"
+	"google.golang.org/api/googleapi"
 )
 
 // GPhotosClient defines the interface for Google Photos client operations
@@ -20,40 +29,459 @@ type GPhotosClient interface {
 }
 
 // gphotosClientWrapper wraps gphotos.Client to satisfy the GPhotosClient interface.
+// The wrapped services translate insufficient-scope errors into ErrInsufficientScope.
 type gphotosClientWrapper struct {
 	*gphotosUploader.Client
+	albums     *albumsServiceWrapper
+	mediaItems *mediaItemsServiceWrapper
+	uploader   *uploaderWrapper
 }
 
 // Albums returns an AppAlbumsService.
 func (w *gphotosClientWrapper) Albums() AppAlbumsService {
-	return w.Client.Albums
+	return w.albums
 }
 
 // MediaItems returns an AppMediaItemsService.
 func (w *gphotosClientWrapper) MediaItems() AppMediaItemsService {
-	return w.Client.MediaItems
+	return w.mediaItems
 }
 
 // Uploader returns a MediaUploader.
 func (w *gphotosClientWrapper) Uploader() gphotosUploader.MediaUploader {
-	return w.Client.Uploader
+	return w.uploader
+}
+
+// NewGPhotosClient creates a GPhotosClient that sends all of its requests,
+// including media uploads, to the Google Photos API at baseURL.
+// baseURL must end with a slash, eg config.DefaultGooglePhotosBaseURL.
+func NewGPhotosClient(httpClient *http.Client, baseURL string) (GPhotosClient, error) {
+	// Uploads are sent with the content types of their files.
+	uploadHTTPClient := *httpClient
+	uploadHTTPClient.Transport = &uploadContentTypeTransport{base: httpClient.Transport}
+	client, err := gphotosUploader.NewClientWithBaseURL(&uploadHTTPClient, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Photos client: %w", err)
+	}
+	if simpleUploader, ok := client.Uploader.(*uploader.SimpleUploader); ok {
+		simpleUploader.BaseURL = baseURL + "v1/uploads"
+	}
+	return NewGPhotosClientWrapper(client, httpClient, baseURL), nil
 }
 
 // NewGPhotosClientWrapper creates a new GPhotosClient that wraps the gphotos.Client.
-func NewGPhotosClientWrapper(client *gphotosUploader.Client) GPhotosClient {
-	return &gphotosClientWrapper{Client: client}
+// httpClient must be the authenticated client that the gphotos.Client was created with,
+// and baseURL the API base URL it was created with; they are used for the API calls
+// that gphotos.Client doesn't support.
+func NewGPhotosClientWrapper(client *gphotosUploader.Client, httpClient *http.Client, baseURL string) GPhotosClient {
+	return &gphotosClientWrapper{
+		Client: client,
+		albums: &albumsServiceWrapper{
+			AlbumsService: client.Albums,
+			httpClient:    httpClient,
+			baseURL:       baseURL,
+		},
+		mediaItems: &mediaItemsServiceWrapper{
+			MediaItemsService: client.MediaItems,
+			httpClient:        httpClient,
+			baseURL:           baseURL,
+		},
+		uploader: &uploaderWrapper{MediaUploader: client.Uploader},
+	}
 }
 
 // AppAlbumsService defines the interface for album-related operations we use.
 type AppAlbumsService interface {
 	List(ctx context.Context) ([]albums.Album, error)
+	ListPage(ctx context.Context, pageSize int) ([]albums.Album, error)
 	Create(ctx context.Context, title string) (*albums.Album, error)
 	AddMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error
+	RemoveMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error
+	UpdateTitle(ctx context.Context, albumID string, title string) (*albums.Album, error)
+}
+
+// albumsServiceWrapper adds the album operations that gphotos.AlbumsService lacks.
+type albumsServiceWrapper struct {
+	gphotosUploader.AlbumsService
+	httpClient *http.Client
+	baseURL    string
+}
+
+// List lists the albums.
+func (s *albumsServiceWrapper) List(ctx context.Context) ([]albums.Album, error) {
+	res, err := s.AlbumsService.List(ctx)
+	return res, checkScopeError(err)
+}
+
+// ListPage lists only the first pageSize albums, which is cheap enough to check that the API can be called.
+func (s *albumsServiceWrapper) ListPage(ctx context.Context, pageSize int) ([]albums.Album, error) {
+	endpoint := s.baseURL + "v1/albums?pageSize=" + strconv.Itoa(pageSize)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create album list request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list albums: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, fmt.Errorf("failed to list albums: %w", checkScopeError(err))
+	}
+
+	var page struct {
+		Albums []struct {
+			ID          string `json:"id"`
+			Title       string `json:"title"`
+			ProductURL  string `json:"productUrl"`
+			IsWriteable bool   `json:"isWriteable"`
+		} `json:"albums"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to decode albums: %w", err)
+	}
+	res := make([]albums.Album, 0, len(page.Albums))
+	for _, album := range page.Albums {
+		res = append(res, albums.Album{
+			ID:          album.ID,
+			Title:       album.Title,
+			ProductURL:  album.ProductURL,
+			IsWriteable: album.IsWriteable,
+		})
+	}
+	return res, nil
+}
+
+// Create creates an album titled title.
+func (s *albumsServiceWrapper) Create(ctx context.Context, title string) (*albums.Album, error) {
+	res, err := s.AlbumsService.Create(ctx, title)
+	return res, checkScopeError(err)
+}
+
+// AddMediaItems adds the media items to the album albumID.
+func (s *albumsServiceWrapper) AddMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	return checkScopeError(s.AlbumsService.AddMediaItems(ctx, albumID, mediaItemIDs))
+}
+
+// RemoveMediaItems removes the media items from the album albumID.
+// Only media items and albums created by this app can be removed from.
+func (s *albumsServiceWrapper) RemoveMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	body, err := json.Marshal(map[string][]string{"mediaItemIds": mediaItemIDs})
+	if err != nil {
+		return fmt.Errorf("failed to encode album media item removal: %w", err)
+	}
+	endpoint := s.baseURL + "v1/albums/" + url.PathEscape(albumID) + ":batchRemoveMediaItems"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create album media item removal request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to remove media items from album %s: %w", albumID, err)
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return fmt.Errorf("failed to remove media items from album %s: %w", albumID, checkScopeError(err))
+	}
+	return nil
+}
+
+// UpdateTitle renames the album albumID to title.
+// Only albums created by this app can be renamed.
+func (s *albumsServiceWrapper) UpdateTitle(ctx context.Context, albumID string, title string) (*albums.Album, error) {
+	body, err := json.Marshal(map[string]string{"title": title})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode album update: %w", err)
+	}
+	endpoint := s.baseURL + "v1/albums/" + url.PathEscape(albumID) + "?updateMask=title"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create album update request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update album %s: %w", albumID, err)
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, fmt.Errorf("failed to update album %s: %w", albumID, checkScopeError(err))
+	}
+
+	var updated struct {
+		ID          string `json:"id"`
+		Title       string `json:"title"`
+		ProductURL  string `json:"productUrl"`
+		IsWriteable bool   `json:"isWriteable"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
+		return nil, fmt.Errorf("failed to decode updated album %s: %w", albumID, err)
+	}
+	return &albums.Album{
+		ID:          updated.ID,
+		Title:       updated.Title,
+		ProductURL:  updated.ProductURL,
+		IsWriteable: updated.IsWriteable,
+	}, nil
+}
+
+// mediaItemsServiceWrapper wraps gphotos.MediaItemsService to translate insufficient-scope errors,
+// and to report the media items that batchCreate fails to create.
+type mediaItemsServiceWrapper struct {
+	gphotosUploader.MediaItemsService
+	httpClient *http.Client
+	baseURL    string
+}
+
+// mediaItemCreateError is the status of a media item that batchCreate failed to create.
+// batchCreate reports it for each item in an otherwise successful response.
+type mediaItemCreateError struct {
+	// Code is a google.rpc.Code.
+	Code    int
+	Message string
+	// NoID is set when the result had a media item, but without an ID, whatever its status.
+	NoID bool
+}
+
+func (e *mediaItemCreateError) Error() string {
+	if e.NoID {
+		return "media item has no ID"
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("media item wasn't created (status code %d)", e.Code)
+	}
+	return fmt.Sprintf("media item wasn't created: %s (status code %d)", e.Message, e.Code)
+}
+
+// retryable returns whether creating the media item again from its upload token may succeed,
+// ie whether the status is a temporary failure rather than eg an invalid upload token.
+func (e *mediaItemCreateError) retryable() bool {
+	switch e.Code {
+	case 4, // DEADLINE_EXCEEDED
+		8,  // RESOURCE_EXHAUSTED
+		10, // ABORTED
+		13, // INTERNAL
+		14: // UNAVAILABLE
+		return true
+	}
+	return false
+}
+
+// Create creates a media item from an uploaded file. If the media item isn't created, the error is
+// a *mediaItemCreateError with its status.
+// gphotos.MediaItemsService.Create drops the status, and returns neither a media item nor an error.
+func (s *mediaItemsServiceWrapper) Create(ctx context.Context, item media_items.SimpleMediaItem) (*media_items.MediaItem, error) {
+	return s.CreateWithDescription(ctx, item, "")
+}
+
+// CreateWithDescription is like Create, but also sets the description of the media item,
+// which media_items.SimpleMediaItem has no field for.
+func (s *mediaItemsServiceWrapper) CreateWithDescription(ctx context.Context, item media_items.SimpleMediaItem, description string) (*media_items.MediaItem, error) {
+	type simpleMediaItem struct {
+		UploadToken string `json:"uploadToken"`
+		FileName    string `json:"fileName,omitempty"`
+	}
+	type newMediaItem struct {
+		Description     string          `json:"description,omitempty"`
+		SimpleMediaItem simpleMediaItem `json:"simpleMediaItem"`
+	}
+	body, err := json.Marshal(map[string][]newMediaItem{
+		"newMediaItems": {{Description: description, SimpleMediaItem: simpleMediaItem{UploadToken: item.UploadToken, FileName: item.Filename}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode media item creation: %w", err)
+	}
+	endpoint := s.baseURL + "v1/mediaItems:batchCreate"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create media item creation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create media item: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, fmt.Errorf("failed to create media item: %w", checkScopeError(err))
+	}
+
+	var created struct {
+		NewMediaItemResults []struct {
+			Status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"status"`
+			MediaItem *apiMediaItem `json:"mediaItem"`
+		} `json:"newMediaItemResults"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return nil, fmt.Errorf("failed to decode created media item: %w", err)
+	}
+	if len(created.NewMediaItemResults) != 1 {
+		return nil, fmt.Errorf("failed to create media item: got %d results, want 1", len(created.NewMediaItemResults))
+	}
+	result := created.NewMediaItemResults[0]
+	// The status message of a created media item varies, eg "Success", "OK", or none, so the outcome
+	// is decided by whether the media item has an ID. A media item that has one exists, whatever
+	// its status, and failing it would upload the file again.
+	if result.MediaItem == nil {
+		return nil, &mediaItemCreateError{Code: result.Status.Code, Message: result.Status.Message}
+	}
+	if result.MediaItem.ID == "" {
+		return nil, &mediaItemCreateError{Code: result.Status.Code, Message: result.Status.Message, NoID: true}
+	}
+	return result.MediaItem.mediaItem(), nil
+}
+
+// apiMediaItem is a media item as the API encodes it.
+type apiMediaItem struct {
+	ID            string `json:"id"`
+	Description   string `json:"description"`
+	ProductURL    string `json:"productUrl"`
+	BaseURL       string `json:"baseUrl"`
+	MimeType      string `json:"mimeType"`
+	Filename      string `json:"filename"`
+	MediaMetadata struct {
+		CreationTime string `json:"creationTime"`
+		Width        int64  `json:"width,string"`
+		Height       int64  `json:"height,string"`
+	} `json:"mediaMetadata"`
+}
+
+func (m *apiMediaItem) mediaItem() *media_items.MediaItem {
+	return &media_items.MediaItem{
+		ID:          m.ID,
+		Description: m.Description,
+		ProductURL:  m.ProductURL,
+		BaseURL:     m.BaseURL,
+		MimeType:    m.MimeType,
+		Filename:    m.Filename,
+		MediaMetadata: media_items.MediaMetadata{
+			CreationTime: m.MediaMetadata.CreationTime,
+			Width:        m.MediaMetadata.Width,
+			Height:       m.MediaMetadata.Height,
+		},
+	}
+}
+
+// searchPageSize is the number of media items that Search asks for per page, the most that the API returns.
+const searchPageSize = 100
+
+// apiDate is a date as the API encodes it.
+type apiDate struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day"`
+}
+
+func newAPIDate(t time.Time) apiDate {
+	return apiDate{Year: t.Year(), Month: int(t.Month()), Day: t.Day()}
+}
+
+// Search returns the media items whose creation dates are from "from" to "to", inclusive. With the
+// app-created data scope, these are only the media items that camflow created. gphotos.MediaItemsService
+// can't search by date.
+func (s *mediaItemsServiceWrapper) Search(ctx context.Context, from, to time.Time) ([]*media_items.MediaItem, error) {
+	type dateRange struct {
+		StartDate apiDate `json:"startDate"`
+		EndDate   apiDate `json:"endDate"`
+	}
+	type searchRequest struct {
+		PageSize  int    `json:"pageSize"`
+		PageToken string `json:"pageToken,omitempty"`
+		Filters   struct {
+			DateFilter struct {
+				Ranges []dateRange `json:"ranges"`
+			} `json:"dateFilter"`
+		} `json:"filters"`
+	}
+	request := searchRequest{PageSize: searchPageSize}
+	request.Filters.DateFilter.Ranges = []dateRange{{StartDate: newAPIDate(from), EndDate: newAPIDate(to)}}
+
+	var mediaItems []*media_items.MediaItem
+	for {
+		body, err := json.Marshal(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode media item search: %w", err)
+		}
+		endpoint := s.baseURL + "v1/mediaItems:search"
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create media item search request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search media items: %w", err)
+		}
+		var page struct {
+			MediaItems    []apiMediaItem `json:"mediaItems"`
+			NextPageToken string         `json:"nextPageToken"`
+		}
+		err = googleapi.CheckResponse(resp)
+		if err == nil {
+			if decodeErr := json.NewDecoder(resp.Body).Decode(&page); decodeErr != nil {
+				err = fmt.Errorf("failed to decode media item search results: %w", decodeErr)
+			}
+		} else {
+			err = fmt.Errorf("failed to search media items: %w", checkScopeError(err))
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for i := range page.MediaItems {
+			mediaItems = append(mediaItems, page.MediaItems[i].mediaItem())
+		}
+		if page.NextPageToken == "" {
+			return mediaItems, nil
+		}
+		request.PageToken = page.NextPageToken
+	}
+}
+
+// Get returns the media item mediaItemID.
+func (s *mediaItemsServiceWrapper) Get(ctx context.Context, mediaItemID string) (*media_items.MediaItem, error) {
+	res, err := s.MediaItemsService.Get(ctx, mediaItemID)
+	return res, checkScopeError(err)
+}
+
+// ListByAlbum lists the media items in the album albumID.
+func (s *mediaItemsServiceWrapper) ListByAlbum(ctx context.Context, albumID string) ([]*media_items.MediaItem, error) {
+	res, err := s.MediaItemsService.ListByAlbum(ctx, albumID)
+	return res, checkScopeError(err)
+}
+
+// uploaderWrapper wraps gphotos.MediaUploader to translate insufficient-scope errors.
+type uploaderWrapper struct {
+	gphotosUploader.MediaUploader
+}
+
+// UploadFile uploads the file at filePath, as the MIME type of its content, and returns its upload token.
+func (u *uploaderWrapper) UploadFile(ctx context.Context, filePath string) (string, error) {
+	if contentType := uploadContentType(filePath); contentType != "" {
+		ctx = withUploadContentType(ctx, contentType)
+	}
+	release := openFiles.acquire(1)
+	token, err := u.MediaUploader.UploadFile(ctx, filePath)
+	release()
+	return token, checkScopeError(err)
 }
 
 // AppMediaItemsService defines the interface for media item-related operations we use.
 type AppMediaItemsService interface {
 	Create(ctx context.Context, item media_items.SimpleMediaItem) (*media_items.MediaItem, error)
+	CreateWithDescription(ctx context.Context, item media_items.SimpleMediaItem, description string) (*media_items.MediaItem, error)
+	Get(ctx context.Context, mediaItemID string) (*media_items.MediaItem, error)
+	ListByAlbum(ctx context.Context, albumID string) ([]*media_items.MediaItem, error)
+	Search(ctx context.Context, from, to time.Time) ([]*media_items.MediaItem, error)
 }
 
 // The following interfaces are for types returned by the services,
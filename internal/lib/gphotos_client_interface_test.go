@@ -0,0 +1,289 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestNewGPhotosClientUsesBaseURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/albums", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"albums": []map[string]any{{"id": "album-1", "title": "Camflow: Photos"}},
+		})
+	})
+	mux.HandleFunc("POST /api/v1/uploads", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "photo", string(body))
+		_, _ = w.Write([]byte("upload-token-1"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewGPhotosClient(server.Client(), server.URL+"/api/")
+	require.NoError(t, err)
+
+	albumList, err := client.Albums().List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, albumList, 1)
+	assert.Equal(t, "album-1", albumList[0].ID)
+
+	path := filepath.Join(t.TempDir(), "2024-05-01-IMG_0001.JPG")
+	require.NoError(t, os.WriteFile(path, []byte("photo"), 0644))
+	token, err := client.Uploader().UploadFile(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, "upload-token-1", token, "Uploads should also go to the base URL")
+}
+
+func TestUploadFileContentType(t *testing.T) {
+	var mu sync.Mutex
+	contentTypes := make(map[string]string)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/uploads", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		contentTypes[r.Header.Get("X-Goog-Upload-File-Name")] = r.Header.Get("X-Goog-Upload-Content-Type")
+		mu.Unlock()
+		_, _ = w.Write([]byte("upload-token"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client, err := NewGPhotosClient(server.Client(), server.URL+"/")
+	require.NoError(t, err)
+
+	jpeg := "\xff\xd8\xff\xe0\x00\x10JFIF\x00"
+	mp4 := "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"
+	quickTime := "\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00qt  "
+	dir := t.TempDir()
+	for name, want := range map[string]struct{ content, contentType string }{
+		"IMG_0001.JPG": {jpeg, "image/jpeg"},
+		"MVI_0002.MP4": {mp4, "video/mp4"},
+		"MVI_0003.MOV": {quickTime, "video/quicktime"},
+		// The content is trusted over the extension.
+		"IMG_0004.MOV":  {jpeg, "image/jpeg"},
+		"IMG_0005.HEIC": {"\x00\x00\x00\x18ftypheic", "image/heic"},
+		// RAW photos have no MIME type, so they keep the uploader's default.
+		"IMG_0006.CR3": {"\x00\x00\x00\x18ftypcrx ", "application/octet-stream"},
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(want.content), 0644))
+		_, err := client.Uploader().UploadFile(context.Background(), path)
+		require.NoError(t, err)
+		assert.Equal(t, want.contentType, contentTypes[name], "Content type of %s", name)
+	}
+}
+
+func TestAlbumsListPage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/albums", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.URL.Query().Get("pageSize"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"albums":        []map[string]any{{"id": "album-1", "title": "Camflow: Photos"}},
+			"nextPageToken": "more",
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewGPhotosClient(server.Client(), server.URL+"/")
+	require.NoError(t, err)
+	albumList, err := client.Albums().ListPage(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, albumList, 1, "Only the first page should be listed")
+	assert.Equal(t, "album-1", albumList[0].ID)
+
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"code": 401, "message": "invalid credentials"}}`, http.StatusUnauthorized)
+	}))
+	defer unauthorized.Close()
+	client, err = NewGPhotosClient(unauthorized.Client(), unauthorized.URL+"/")
+	require.NoError(t, err)
+	_, err = client.Albums().ListPage(context.Background(), 1)
+	assert.ErrorContains(t, err, "invalid credentials")
+}
+
+func TestAlbumsRemoveMediaItems(t *testing.T) {
+	var got struct {
+		MediaItemIDs []string `json:"mediaItemIds"`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/albums/{albumAction}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "album-1:batchRemoveMediaItems", r.PathValue("albumAction"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		_, _ = w.Write([]byte("{}"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewGPhotosClient(server.Client(), server.URL+"/")
+	require.NoError(t, err)
+	require.NoError(t, client.Albums().RemoveMediaItems(context.Background(), "album-1", []string{"item-1"}))
+	assert.Equal(t, []string{"item-1"}, got.MediaItemIDs)
+
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"code": 400, "message": "Request must contain a valid media item that was created by this app"}}`, http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+	client, err = NewGPhotosClient(rejecting.Client(), rejecting.URL+"/")
+	require.NoError(t, err)
+	err = client.Albums().RemoveMediaItems(context.Background(), "album-1", []string{"other-app-item"})
+	assert.ErrorContains(t, err, "created by this app")
+}
+
+func TestMediaItemsCreate(t *testing.T) {
+	attempts := make(map[string]int)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/mediaItems:batchCreate", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			NewMediaItems []struct {
+				Description     string `json:"description"`
+				SimpleMediaItem struct {
+					UploadToken string `json:"uploadToken"`
+					FileName    string `json:"fileName"`
+				} `json:"simpleMediaItem"`
+			} `json:"newMediaItems"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Len(t, req.NewMediaItems, 1)
+		token := req.NewMediaItems[0].SimpleMediaItem.UploadToken
+		attempts[token]++
+		if token == "tagged-token" {
+			assert.Equal(t, "TRIP-2024-05", req.NewMediaItems[0].Description)
+		} else {
+			assert.Empty(t, req.NewMediaItems[0].Description)
+		}
+
+		result := map[string]any{"uploadToken": token}
+		createdMediaItem := map[string]any{
+			"id":            "media-for-" + token,
+			"filename":      req.NewMediaItems[0].SimpleMediaItem.FileName,
+			"mediaMetadata": map[string]any{"width": "4032", "height": "3024"},
+		}
+		switch {
+		case token == "flaky-token" && attempts[token] == 1:
+			result["status"] = map[string]any{"code": 14, "message": "Temporarily unavailable"}
+		case token == "bad-token":
+			result["status"] = map[string]any{"code": 3, "message": "Invalid upload token"}
+		case token == "no-id-token":
+			result["status"] = map[string]any{"message": "Success"}
+			result["mediaItem"] = map[string]any{"filename": req.NewMediaItems[0].SimpleMediaItem.FileName}
+		case token == "ok-message-token":
+			result["status"] = map[string]any{"message": "OK"}
+			result["mediaItem"] = createdMediaItem
+		case token == "no-status-token":
+			// The status is left out.
+			result["mediaItem"] = createdMediaItem
+		default:
+			result["status"] = map[string]any{"message": "Success"}
+			result["mediaItem"] = createdMediaItem
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"newMediaItemResults": []any{result}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewGPhotosClient(server.Client(), server.URL+"/")
+	require.NoError(t, err)
+	ctx := context.Background()
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	create := func(token string) (*media_items.MediaItem, error) {
+		return callWithRetries(ctx, 2, limiter, func() (*media_items.MediaItem, error) {
+			return client.MediaItems().Create(ctx, media_items.SimpleMediaItem{UploadToken: token, Filename: "2024-05-01-IMG_0001.JPG"})
+		})
+	}
+
+	item, err := create("ok-token")
+	require.NoError(t, err)
+	assert.Equal(t, "media-for-ok-token", item.ID)
+	assert.Equal(t, "2024-05-01-IMG_0001.JPG", item.Filename)
+	assert.Equal(t, int64(4032), item.MediaMetadata.Width)
+	assert.Equal(t, 1, attempts["ok-token"])
+
+	// The status message doesn't decide whether the media item was created.
+	for _, token := range []string{"ok-message-token", "no-status-token"} {
+		item, err = create(token)
+		require.NoError(t, err, token)
+		assert.Equal(t, "media-for-"+token, item.ID)
+	}
+
+	_, err = create("no-id-token")
+	var noIDErr *mediaItemCreateError
+	require.ErrorAs(t, err, &noIDErr, "A media item without an ID wasn't created")
+	assert.Equal(t, "media item has no ID", noIDErr.Error())
+	assert.Equal(t, 1, attempts["no-id-token"])
+
+	item, err = create("flaky-token")
+	require.NoError(t, err, "A retryable status should be retried")
+	assert.Equal(t, "media-for-flaky-token", item.ID)
+	assert.Equal(t, 2, attempts["flaky-token"])
+
+	_, err = create("bad-token")
+	var createErr *mediaItemCreateError
+	require.ErrorAs(t, err, &createErr)
+	assert.Equal(t, 3, createErr.Code)
+	var apiErr *uploadAPIError
+	assert.ErrorAs(t, err, &apiErr, "The failure should count toward the circuit breaker")
+	assert.Equal(t, 1, attempts["bad-token"], "A status that isn't retryable shouldn't be retried")
+
+	_, err = client.MediaItems().CreateWithDescription(ctx, media_items.SimpleMediaItem{UploadToken: "tagged-token"}, "TRIP-2024-05")
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempts["tagged-token"])
+}
+
+func TestMediaItemsSearch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/mediaItems:search", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			PageToken string `json:"pageToken"`
+			Filters   struct {
+				DateFilter struct {
+					Ranges []struct {
+						StartDate apiDate `json:"startDate"`
+						EndDate   apiDate `json:"endDate"`
+					} `json:"ranges"`
+				} `json:"dateFilter"`
+			} `json:"filters"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Len(t, req.Filters.DateFilter.Ranges, 1)
+		assert.Equal(t, apiDate{Year: 2024, Month: 5, Day: 1}, req.Filters.DateFilter.Ranges[0].StartDate)
+		assert.Equal(t, apiDate{Year: 2024, Month: 5, Day: 31}, req.Filters.DateFilter.Ranges[0].EndDate)
+
+		page := map[string]any{}
+		if req.PageToken == "" {
+			page["mediaItems"] = []any{map[string]any{"id": "media-1", "filename": "2024-05-01-IMG_0001.JPG"}}
+			page["nextPageToken"] = "page-2"
+		} else {
+			assert.Equal(t, "page-2", req.PageToken)
+			page["mediaItems"] = []any{map[string]any{"id": "media-2", "filename": "2024-05-02-IMG_0002.JPG"}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(page)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewGPhotosClient(server.Client(), server.URL+"/")
+	require.NoError(t, err)
+	items, err := client.MediaItems().Search(context.Background(), time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, items, 2, "Search should return the media items of every page")
+	assert.Equal(t, "media-1", items[0].ID)
+	assert.Equal(t, "2024-05-02-IMG_0002.JPG", items[1].Filename)
+}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"syscall"
@@ -17,7 +20,7 @@ import (
 
 	"github.com/ccfrost/camflow/internal/config"
 	"github.com/schollz/progressbar/v3"
-	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
 )
 
 // ItemType represents the type of media item being processed.
@@ -40,6 +43,16 @@ type ImportDstDirEntry struct {
 	PhotoCount  int
 }
 
+// ImportDateEntry counts the files imported with a capture date, which is their modification time.
+type ImportDateEntry struct {
+	// Date is the capture date, formatted as YYYY-MM-DD.
+	Date       string
+	PhotoCount int
+	VideoCount int
+	PhotoSize  int64
+	VideoSize  int64
+}
+
 // ImportedFile represents a file that was imported with its metadata
 type ImportedFile struct {
 	SrcPath  string
@@ -48,27 +61,110 @@ type ImportedFile struct {
 	ItemType ItemType
 }
 
+// SkipReason is the reason that a file wasn't imported.
+type SkipReason string
+
+const (
+	// SkipReasonUnsupported is for files that aren't of a supported media type.
+	SkipReasonUnsupported SkipReason = "unsupported"
+	// SkipReasonNoExtension is for files without an extension, when import.sniff_extensionless isn't set.
+	SkipReasonNoExtension SkipReason = "no-extension"
+	// SkipReasonIgnoredDir is for dirs in DCIM that the DCIM standard doesn't name as holding media,
+	// eg CANONMSC. The dir is skipped as a whole.
+	SkipReasonIgnoredDir SkipReason = "ignored-dir"
+	// SkipReasonZeroByte is for zero-byte media files, eg from a failed write.
+	SkipReasonZeroByte SkipReason = "zero-byte"
+	// SkipReasonCollision is for files whose target path was already taken by a file from another card.
+	SkipReasonCollision SkipReason = "collision"
+	// SkipReasonVerifyFailed is for files whose copy didn't match the source, with import.verify.
+	// The copy is removed and the source is kept.
+	SkipReasonVerifyFailed SkipReason = "verify-failed"
+	// SkipReasonUnreadableDir is for dirs in a media root that couldn't be read, with
+	// import.unreadable_dirs = "skip". The dir is skipped as a whole.
+	SkipReasonUnreadableDir SkipReason = "unreadable-dir"
+)
+
+// SkippedFile is a file, or for SkipReasonIgnoredDir and SkipReasonUnreadableDir a dir, that wasn't imported.
+type SkippedFile struct {
+	Path   string     `json:"path"`
+	Reason SkipReason `json:"reason"`
+}
+
 type ImportResult struct {
-	SrcEntries    []ImportSrcDirEntry
-	DstEntries    []ImportDstDirEntry
+	SrcEntries []ImportSrcDirEntry
+	DstEntries []ImportDstDirEntry
+	// DateEntries group the imported files by capture date, sorted by date.
+	DateEntries   []ImportDateEntry
 	ImportedFiles []ImportedFile
+	// ZeroByteFiles are the source paths of zero-byte media files that were skipped.
+	ZeroByteFiles []string
+	// SkippedFiles are the files that weren't imported, with the reasons, in the order they were found.
+	SkippedFiles []SkippedFile
 }
 
-// Import moves the DCIM/ files to the photo to process dir and the upload queue video dir.
+// VerifyFailedFiles returns the source paths of the files whose copies didn't match them, with import.verify.
+// They were kept on the source.
+func (r ImportResult) VerifyFailedFiles() []string {
+	var paths []string
+	for _, f := range r.SkippedFiles {
+		if f.Reason == SkipReasonVerifyFailed {
+			paths = append(paths, f.Path)
+		}
+	}
+	return paths
+}
+
+// Import moves the files in the media roots of the card, eg DCIM/, to the photo to process dir and the upload queue video dir.
+// With import.perceptual_hash, it records the hashes of the photos in the index in cacheDir.
 // It returns the relative target directory for the photos and any error.
-func Import(cfg config.CamflowConfig, sdcardDir string, keepSrc bool, now time.Time, dryRun bool) (result ImportResult, retErr error) {
+func Import(cfg config.CamflowConfig, cacheDir string, sdcardDir string, keepSrc bool, now time.Time, dryRun bool) (ImportResult, error) {
 	if err := cfg.Validate(); err != nil {
 		return ImportResult{}, fmt.Errorf("invalid config: %w", err)
 	}
+	return importCard(context.Background(), cfg, cacheDir, sdcardDir, keepSrc, now, nil, "", dryRun)
+}
 
-	// Only look at files in $srcDir/DCIM/. Eg, ignore $srcDir/MISC/.
-	srcDir := filepath.Join(sdcardDir, "DCIM")
+// importCard imports the files from the card at sdcardDir, like Import. It stops between files when ctx is canceled.
+// If targets isn't nil, it is shared with the imports from other cards. cardName, if not empty, labels the
+// progress bar, to tell the cards apart.
+func importCard(ctx context.Context, cfg config.CamflowConfig, cacheDir string, sdcardDir string, keepSrc bool, now time.Time, targets *importTargets, cardName string, dryRun bool) (result ImportResult, retErr error) {
+	// Only look at files in the media roots, eg $sdcardDir/DCIM/. Eg, ignore $sdcardDir/MISC/.
+	roots, err := cardMediaRoots(sdcardDir, cfg.Import.MediaRoots)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	for i := range roots {
+		roots[i].skipUnreadable = cfg.Import.UnreadableDirs == config.UnreadableDirsSkip
+	}
 
 	// TODO: Create todo “Process photos: <date> @ Photos” (which section?)
 
-	files, totalSize, err := getFilesAndSize(srcDir)
-	if err != nil {
-		return ImportResult{}, fmt.Errorf("failed to list import files: %w", err)
+	var files, zeroByteFiles []string
+	var totalSize int64
+	for _, root := range roots {
+		rootFiles, rootSize, rootZeroByteFiles, err := getMediaRootFilesAndSize(root, cfg.Import.SniffExtensionless, cfg.Symlinks)
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("failed to list import files: %w", err)
+		}
+		files = append(files, rootFiles...)
+		zeroByteFiles = append(zeroByteFiles, rootZeroByteFiles...)
+		totalSize += rootSize
+	}
+	if len(zeroByteFiles) > 0 && cfg.Import.ZeroByteFiles == config.ZeroByteFilesError {
+		return ImportResult{}, fmt.Errorf("found %d zero-byte media file(s), eg %s", len(zeroByteFiles), zeroByteFiles[0])
+	}
+
+	// Check that the files can be removed from the card before copying any, rather than failing after the copies.
+	if !keepSrc {
+		if dir := firstReadOnlyDir(files); dir != "" {
+			if cfg.Import.WriteProtected != config.WriteProtectedKeep {
+				return ImportResult{}, fmt.Errorf("card is write-protected: can't remove files from %s; unlock the card, pass --keep, or set import.write_protected = %q", dir, config.WriteProtectedKeep)
+			}
+			logger.Warn("Card is write-protected, so keeping the imported files on it",
+				slog.String("dir", dir))
+			fmt.Printf("Card %s is write-protected, so the imported files are kept on it\n", sdcardDir)
+			keepSrc = true
+		}
 	}
 
 	// Check that there is sufficient space to move the files.
@@ -76,16 +172,8 @@ func Import(cfg config.CamflowConfig, sdcardDir string, keepSrc bool, now time.T
 	// and check apppropriately.
 	// TODO: when we move from upload queue to uploaded, we should check that there is enough space?
 	// TODO: or just remove this, and let the OS handle it?
-	targetAvailable, err := getAvailableSpace(cfg.PhotosProcessQueueRoot)
-	if err != nil {
-		return ImportResult{}, fmt.Errorf("failed to get available space: %w", err)
-	}
-
-	if uint64(totalSize) > targetAvailable {
-		const GiB = 1 << 30
-		return ImportResult{}, fmt.Errorf(
-			"not enough space in %s: need %d GiB more: %d GiB needed, %d GiB available",
-			cfg.PhotosProcessQueueRoot, totalSize/GiB, targetAvailable/GiB, (uint64(totalSize)-targetAvailable)/GiB)
+	if err := checkAvailableSpace(cfg, totalSize); err != nil {
+		return ImportResult{}, err
 	}
 
 	// Move the files into the target dirs.
@@ -93,27 +181,44 @@ func Import(cfg config.CamflowConfig, sdcardDir string, keepSrc bool, now time.T
 	if dryRun {
 		desc = "simulating"
 	}
+	if cardName != "" {
+		desc += " " + cardName
+	}
 	bar := NewProgressBar(totalSize, desc)
 	defer func() {
 		if retErr != nil && bar != nil {
 			_ = bar.Exit()
 		}
 	}()
-	importRes, err := moveFiles(cfg, srcDir, keepSrc, bar, dryRun)
+	// Hash the imported photos while the later files are copied.
+	var phashes *phashPool
+	if cfg.Import.PerceptualHash && !dryRun {
+		phashes = newPHashPool(ctx, dctHasher{}, cfg.Import.HashWorkers)
+	}
+	importRes, err := importFiles(ctx, cfg, visitMediaRoots(roots, cfg.Symlinks), keepSrc, targets, phashes, bar, dryRun)
+	hashes := phashes.wait()
 	if err != nil {
-		return ImportResult{}, fmt.Errorf("failed to move files: %w", err)
+		return importRes, fmt.Errorf("failed to move files: %w", err)
 	}
 	_ = bar.Finish()
 	bar = nil
 
 	// Check Image Stabilization for CR3 files
 	if !dryRun {
-		ctx := context.Background()
 		if err := CheckISEnabled(ctx, importRes.ImportedFiles); err != nil {
 			return ImportResult{}, fmt.Errorf("failed to check Image Stabilization: %w", err)
 		}
 	}
 
+	if phashes != nil {
+		if err := ctx.Err(); err != nil {
+			return ImportResult{}, err
+		}
+		if err := updatePHashIndex(getPHashIndexPath(cacheDir), hashes); err != nil {
+			return ImportResult{}, fmt.Errorf("failed to record perceptual hashes: %w", err)
+		}
+	}
+
 	if !keepSrc && !dryRun {
 		// Delete any leaf dirs that we moved files out of and are now empty, so that the
 		// camera will restart the names of dirs that it writes files into.
@@ -145,33 +250,156 @@ func Import(cfg config.CamflowConfig, sdcardDir string, keepSrc bool, now time.T
 	return importRes, nil
 }
 
-// getFilesAndSize returns the list of all files in dir and sum of their sizes.
-func getFilesAndSize(dir string) ([]string, int64, error) {
-	var files []string
-	var totalSize int64
-	err := filepath.WalkDir(dir, func(path string, dirEnt fs.DirEntry, err error) error {
+// mediaRoot is a dir on a card that media files are imported from.
+type mediaRoot struct {
+	dir string
+	// dcim is whether dir is a DCIM dir, in which only the dirs that the DCIM standard names
+	// as holding camera media files are imported from.
+	dcim bool
+	// skipUnreadable is whether the dirs in dir that can't be read are skipped, rather than failing the walk.
+	skipUnreadable bool
+}
+
+// cardMediaRoots returns the media roots of the card at sdcardDir, out of the dirs names, which are
+// relative to sdcardDir. Roots that aren't on the card are skipped, but at least one must be.
+func cardMediaRoots(sdcardDir string, names []string) ([]mediaRoot, error) {
+	var roots []mediaRoot
+	for _, name := range names {
+		dir := filepath.Join(sdcardDir, name)
+		info, err := os.Stat(dir)
+		if os.IsNotExist(err) {
+			logger.Debug("Skipping media root that isn't on the card",
+				slog.String("dir", dir))
+			continue
+		}
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to stat media root %s: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("media root %s is not a directory", dir)
+		}
+		roots = append(roots, mediaRoot{dir: dir, dcim: strings.EqualFold(filepath.Base(dir), "DCIM")})
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("found none of the media roots %q in %s", names, sdcardDir)
+	}
+	return roots, nil
+}
+
+// walkMediaRoot walks the media files of root, calling fn with the path and dir entry of each file.
+// Symlinks are handled as selected by symlinks, a config.Symlinks value.
+// If skip isn't nil, it is called for each dir that is skipped, and unreadable dirs that are skipped are warned about.
+func walkMediaRoot(root mediaRoot, symlinks string, fn func(path string, dirEnt fs.DirEntry) error, skip func(SkippedFile)) error {
+	return walkDirSymlinks(root.dir, symlinks, func(path string, dirEnt fs.DirEntry, err error) error {
+		if err != nil {
+			// The root itself must be readable, or there is nothing to import.
+			if !root.skipUnreadable || path == root.dir || dirEnt == nil || !dirEnt.IsDir() {
+				return err
+			}
+			// Walks without skip, eg to list the files before the import, leave warning to the walk that reports it.
+			if skip != nil {
+				logger.Warn("Skipping unreadable dir",
+					slog.String("path", path),
+					slog.String("error", err.Error()))
+				skip(SkippedFile{Path: path, Reason: SkipReasonUnreadableDir})
+			}
+			return filepath.SkipDir
 		}
 		if dirEnt.IsDir() {
-			if filepath.Dir(path) == dir && !isDcimMediaDir(dirEnt.Name()) {
+			if root.dcim && filepath.Dir(path) == root.dir && !isDcimMediaDir(dirEnt.Name()) {
+				if skip != nil {
+					skip(SkippedFile{Path: path, Reason: SkipReasonIgnoredDir})
+				}
 				return filepath.SkipDir
 			}
 			return nil
 		}
-		switch filepath.Ext(dirEnt.Name()) {
-		case ".CR3", ".cr3", ".JPG", ".jpg", ".MP4", ".mp4":
-			files = append(files, path)
-			info, err := dirEnt.Info()
+		return fn(path, dirEnt)
+	})
+}
+
+// visitMediaRoots returns a visitSrcFiles func for importFiles that visits the files of each of roots.
+func visitMediaRoots(roots []mediaRoot, symlinks string) visitSrcFilesFunc {
+	return func(visit func(path string, info fs.FileInfo) error, skip func(SkippedFile)) error {
+		for _, root := range roots {
+			err := walkMediaRoot(root, symlinks, func(path string, dirEnt fs.DirEntry) error {
+				info, err := dirEnt.Info()
+				if err != nil {
+					return fmt.Errorf("failed to Info() %s: %w", path, err)
+				}
+				return visit(path, info)
+			}, skip)
 			if err != nil {
-				return fmt.Errorf("failed to Info() %s: %w", path, err)
+				return err
 			}
-			totalSize += info.Size()
 		}
 		return nil
-	})
+	}
+}
 
-	return files, totalSize, err
+// getMediaRootFilesAndSize returns the list of all non-empty media files in root, and sum of their sizes,
+// and separately the list of zero-byte media files.
+// If sniffExtensionless, files without an extension are included if their content is a supported type.
+func getMediaRootFilesAndSize(root mediaRoot, sniffExtensionless bool, symlinks string) ([]string, int64, []string, error) {
+	var files, zeroByteFiles []string
+	var totalSize int64
+	err := walkMediaRoot(root, symlinks, func(path string, dirEnt fs.DirEntry) error {
+		itemType, _, err := importItemType(path, sniffExtensionless)
+		if err != nil {
+			return err
+		}
+		if itemType == ItemTypeUnknown {
+			return nil
+		}
+		info, err := dirEnt.Info()
+		if err != nil {
+			return fmt.Errorf("failed to Info() %s: %w", path, err)
+		}
+		if info.Size() == 0 {
+			zeroByteFiles = append(zeroByteFiles, path)
+			return nil
+		}
+		files = append(files, path)
+		totalSize += info.Size()
+		return nil
+	}, nil)
+
+	return files, totalSize, zeroByteFiles, err
+}
+
+// checkAvailableSpace returns an error if there isn't totalSize bytes of space available to import into.
+func checkAvailableSpace(cfg config.CamflowConfig, totalSize int64) error {
+	targetRoot := importPhotosRoot(cfg)
+	targetAvailable, err := getAvailableSpace(targetRoot)
+	if err != nil {
+		return fmt.Errorf("failed to get available space: %w", err)
+	}
+
+	if uint64(totalSize) > targetAvailable {
+		const GiB = 1 << 30
+		return fmt.Errorf(
+			"not enough space in %s: need %d GiB more: %d GiB needed, %d GiB available",
+			targetRoot, totalSize/GiB, targetAvailable/GiB, (uint64(totalSize)-targetAvailable)/GiB)
+	}
+	return nil
+}
+
+// importPhotosRoot returns the dir that an import moves photos to: import.PhotosDest, if set,
+// and otherwise the photo process queue.
+func importPhotosRoot(cfg config.CamflowConfig) string {
+	if cfg.Import.PhotosDest != "" {
+		return cfg.Import.PhotosDest
+	}
+	return cfg.PhotosProcessQueueRoot
+}
+
+// importVideosRoot returns the dir that an import moves videos to: import.VideosDest, if set,
+// and otherwise the video upload queue.
+func importVideosRoot(cfg config.CamflowConfig) string {
+	if cfg.Import.VideosDest != "" {
+		return cfg.Import.VideosDest
+	}
+	return cfg.VideosUploadQueueRoot
 }
 
 // getAvailableSpace returns the available space in bytes on the filesystem
@@ -198,9 +426,84 @@ func getAvailableSpace(dir string) (uint64, error) {
 	return availableBytes, nil
 }
 
-// moveFiles moves files from srcDir into the photo/video dirs for the date of each file.
-// It preserves the modification times.
-func moveFiles(cfg config.CamflowConfig, srcDir string, keepSrc bool, bar *progressbar.ProgressBar, dryRun bool) (ImportResult, error) {
+// firstReadOnlyDir returns the first of the dirs of files that files can't be removed from, eg because
+// the card they are on is write-protected or the dir isn't writable, or "" if there isn't one.
+func firstReadOnlyDir(files []string) string {
+	checked := make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if checked[dir] {
+			continue
+		}
+		checked[dir] = true
+		// The mode is checked too, since root can write to a dir without write permission.
+		info, err := os.Stat(dir)
+		if err != nil || info.Mode().Perm()&0222 == 0 || unix.Access(dir, unix.W_OK) != nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// photoFolderLayout returns the time layout of the dirs that photos are imported into
+// for photoFolders, a config.PhotoFolders value.
+func photoFolderLayout(photoFolders string) string {
+	switch photoFolders {
+	case config.PhotoFoldersYearDate:
+		return "2006/2006-01-02"
+	case config.PhotoFoldersMonth:
+		return "2006/01"
+	case config.PhotoFoldersYear:
+		return "2006"
+	default:
+		return "2006/01/02"
+	}
+}
+
+// importCaptureTimes returns the capture times of the media files that visitSrcFiles visits, as for
+// getCaptureTimes. It warns if they were captured in different time zones, whose files would otherwise
+// have had their date prefixes in different zones.
+func importCaptureTimes(ctx context.Context, visitSrcFiles visitSrcFilesFunc) (map[string]time.Time, error) {
+	var paths []string
+	err := visitSrcFiles(func(path string, info fs.FileInfo) error {
+		// Files without a known extension are left to the import itself, which reports them.
+		if itemType, _, err := importItemType(path, false); err == nil && itemType != ItemTypeUnknown && info.Size() > 0 {
+			paths = append(paths, path)
+		}
+		return nil
+	}, func(SkippedFile) {})
+	if err != nil {
+		return nil, err
+	}
+	captureTimes, err := getCaptureTimes(ctx, paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture times: %w", err)
+	}
+
+	var offsets []string
+	for _, captureTime := range captureTimes {
+		offset := captureTime.Format("-07:00")
+		if !slices.Contains(offsets, offset) {
+			offsets = append(offsets, offset)
+		}
+	}
+	if len(offsets) > 1 {
+		sort.Strings(offsets)
+		logger.Warn("Files were captured in different time zones, dating them in import.timezone",
+			slog.Any("offsets", offsets))
+	}
+	return captureTimes, nil
+}
+
+// visitSrcFilesFunc calls visit for each source file of an import, and stops at the first error that visit
+// returns. It calls skip for each source file that it skips itself, eg the files in an ignored dir.
+type visitSrcFilesFunc func(visit func(path string, info fs.FileInfo) error, skip func(SkippedFile)) error
+
+// importFiles moves the files that visitSrcFiles visits into the photo/video dirs for the date of each file.
+// It preserves the modification times. It stops between files when ctx is canceled.
+// If targets isn't nil, the target path of each file is claimed in it before the file is moved.
+// If phashes isn't nil, each imported photo is queued in it to be hashed.
+func importFiles(ctx context.Context, cfg config.CamflowConfig, visitSrcFiles visitSrcFilesFunc, keepSrc bool, targets *importTargets, phashes *phashPool, bar *progressbar.ProgressBar, dryRun bool) (ImportResult, error) {
 	// itemTypeString returns the string representation of ItemType for better debugging.
 	itemTypeString := func(it ItemType) string {
 		switch it {
@@ -219,61 +522,106 @@ func moveFiles(cfg config.CamflowConfig, srcDir string, keepSrc bool, bar *progr
 	}
 	srcDirCounts := make(map[string]PhotoVideoCount)
 	photoDstDirCounts := make(map[string]PhotoVideoCount)
+	dateEntries := make(map[string]ImportDateEntry)
 	var importedFiles []ImportedFile
+	var zeroByteFiles []string
+	var skippedFiles []SkippedFile
+	skip := func(skipped SkippedFile) {
+		skippedFiles = append(skippedFiles, skipped)
+	}
+	warnedLinkFallback := false
+	// With import.takeout, files are dated by their sidecars, and imported into dirs named for their albums.
+	takeoutAlbums := make(takeoutAlbumDirs)
+
+	// With import.timezone, files are dated by their capture times where their metadata has them.
+	var captureTimes map[string]time.Time
+	if cfg.Import.Location != nil {
+		var err error
+		if captureTimes, err = importCaptureTimes(ctx, visitSrcFiles); err != nil {
+			return ImportResult{}, err
+		}
+	}
 
-	err := filepath.WalkDir(srcDir, func(path string, dirEnt fs.DirEntry, err error) error {
-		if err != nil {
+	err := visitSrcFiles(func(path string, info fs.FileInfo) error {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if dirEnt.IsDir() {
-			if filepath.Dir(path) == srcDir && !isDcimMediaDir(dirEnt.Name()) {
-				return filepath.SkipDir
-			}
-			return nil
-		}
 
 		// Determine photo vs video based on file extension.
+		itemType, sniffedExt, err := importItemType(path, cfg.Import.SniffExtensionless)
+		if err != nil {
+			return err
+		}
 		var targetRoot string
-		var itemType ItemType
-		switch filepath.Ext(dirEnt.Name()) {
-		case ".CR3", ".cr3", ".JPG", ".jpg":
-			targetRoot = cfg.PhotosProcessQueueRoot
-			itemType = ItemTypePhoto
-		case ".MP4", ".mp4":
-			targetRoot = cfg.VideosUploadQueueRoot
-			itemType = ItemTypeVideo
+		switch itemType {
+		case ItemTypePhoto:
+			targetRoot = importPhotosRoot(cfg)
+		case ItemTypeVideo:
+			targetRoot = importVideosRoot(cfg)
 		default:
 			// Skip unsupported file types.
-			fmt.Printf("Skipping unsupported file: %s\n", path)
+			if filepath.Ext(path) == "" && !cfg.Import.SniffExtensionless {
+				fmt.Printf("Skipping file without an extension: %s (set import.sniff_extensionless to detect its type)\n", path)
+				skip(SkippedFile{Path: path, Reason: SkipReasonNoExtension})
+			} else {
+				fmt.Printf("Skipping unsupported file: %s\n", path)
+				skip(SkippedFile{Path: path, Reason: SkipReasonUnsupported})
+			}
 			return nil
 		}
+		// Give sniffed files an extension, so that later steps recognize them.
+		targetName := filepath.Base(path) + sniffedExt
 
 		// Compute target filename and update counts.
-		info, err := dirEnt.Info()
-		if err != nil {
-			return fmt.Errorf("failed to Info() %s: %w", path, err)
+		if info.Size() == 0 {
+			// Likely a failed write by the camera, so there's nothing worth keeping.
+			logger.Warn("Skipping zero-byte file", slog.String("path", path))
+			zeroByteFiles = append(zeroByteFiles, path)
+			skip(SkippedFile{Path: path, Reason: SkipReasonZeroByte})
+			return nil
 		}
 		var targetPath string
-		dirEntPrefix := info.ModTime().Format("2006-01-02-")
-		srcEntry := srcDirCounts[filepath.Dir(path)]
+		// The date of the file is by the camera's clock, corrected by the configured offset,
+		// unless its takeout sidecar has the time it was taken.
+		var fileTime, takenTime time.Time
+		var fromTakeout bool
+		var albumDir string
+		if cfg.Import.Takeout {
+			takenTime, fromTakeout = takeoutTakenTime(path)
+			albumDir = takeoutAlbums.takeoutAlbumDir(filepath.Dir(path))
+		}
+		if fromTakeout {
+			fileTime = takenTime
+		} else {
+			fileTime = info.ModTime()
+			if captureTime, ok := captureTimes[path]; ok {
+				fileTime = captureTime
+			}
+			fileTime = fileTime.Add(cfg.Import.CameraClockOffset)
+		}
+		if cfg.Import.Location != nil {
+			fileTime = fileTime.In(cfg.Import.Location)
+		}
+		dirEntPrefix := fileTime.Format("2006-01-02-")
+		var relativeDir string
 		switch itemType {
 		case ItemTypePhoto:
-			relativeDir := info.ModTime().Format("2006/01/02")
-			targetPath = filepath.Join(targetRoot, relativeDir, dirEntPrefix+dirEnt.Name())
-
-			srcEntry.Photos++
-
-			dstEntry := photoDstDirCounts[relativeDir]
-			dstEntry.Photos++
-			photoDstDirCounts[relativeDir] = dstEntry
+			relativeDir = filepath.Join(albumDir, fileTime.Format(photoFolderLayout(cfg.Import.PhotoFolders)))
+			targetPath = filepath.Join(targetRoot, relativeDir, dirEntPrefix+targetName)
 		case ItemTypeVideo:
-			targetPath = filepath.Join(targetRoot, dirEntPrefix+dirEnt.Name())
-
-			srcEntry.Videos++
+			targetPath = filepath.Join(targetRoot, albumDir, dirEntPrefix+targetName)
 		default:
 			return fmt.Errorf("unexpected item type %s for file %s", itemTypeString(itemType), path)
 		}
-		srcDirCounts[filepath.Dir(path)] = srcEntry
+		// The date prefix can make a long name, or a path in deep date dirs, too long for the filesystem.
+		if targetPath, err = fitPath(targetPath, cfg.LongNames); err != nil {
+			return err
+		}
+		if err := targets.claim(targetPath, path); err != nil {
+			// The file is left on its card, and the rest of the card isn't imported.
+			skip(SkippedFile{Path: path, Reason: SkipReasonCollision})
+			return err
+		}
 
 		// Note: this assumes that there are no duplicate camera file names created on the same day.
 		// That could happen, eg if the camera's counter is reset or if enough photos are taken in that day,
@@ -282,29 +630,94 @@ func moveFiles(cfg config.CamflowConfig, srcDir string, keepSrc bool, bar *progr
 			// In dry run, we don't actually move or delete files.
 			// However, we still collect the imported file info to return correct stats.
 		} else {
-			if err := copyFile(path, targetPath, info.Size(), info.ModTime(), bar); err != nil {
+			// A previous import may have stopped after copying the file, but before deleting the source.
+			alreadyCopied, err := isAlreadyCopied(path, targetPath, info, cfg.Import.CompareContent)
+			if err != nil {
 				return err
 			}
+			// A hard link is the source itself, so there is nothing to verify.
+			linked := false
+			if alreadyCopied {
+				logger.Debug("File is already at its destination, skipping copying it",
+					slog.String("path", path),
+					slog.String("target_path", targetPath))
+				if bar != nil {
+					bar.Add64(info.Size())
+				}
+			} else {
+				copied := true
+				if cfg.Import.Hardlink {
+					if linked, err = linkOrCopyFile(os.Link, path, targetPath, info.Size(), info.ModTime(), cfg.Import.CopyBufferKiB<<10, bar); err != nil {
+						return err
+					}
+					if !linked && !warnedLinkFallback {
+						logger.Warn("Hard links are not supported between the source and destination, copying instead",
+							slog.String("path", path),
+							slog.String("target_path", targetPath))
+						warnedLinkFallback = true
+					}
+					copied = !linked
+				} else if err := importCopyFile(path, targetPath, info.Size(), info.ModTime(), cfg.Import.CopyBufferKiB<<10, bar); err != nil {
+					return err
+				}
+				// A hard link already shares all of the source's metadata.
+				if copied && cfg.Import.PreserveMetadata {
+					if err := copyFileMetadata(path, targetPath); err != nil {
+						return err
+					}
+				}
+			}
 
 			if !keepSrc {
+				if cfg.Import.Verify && !linked {
+					verified, err := verifyImportedFile(path, targetPath)
+					if err != nil {
+						return err
+					}
+					if !verified {
+						skip(SkippedFile{Path: path, Reason: SkipReasonVerifyFailed})
+						return nil
+					}
+				}
 				if err := os.Remove(path); err != nil {
 					return fmt.Errorf("failed to delete source file %s: %w", path, err)
 				}
 			}
 		}
 
+		srcEntry := srcDirCounts[filepath.Dir(path)]
+		date := fileTime.Format("2006-01-02")
+		dateEntry := dateEntries[date]
+		dateEntry.Date = date
+		if itemType == ItemTypePhoto {
+			srcEntry.Photos++
+			dstEntry := photoDstDirCounts[relativeDir]
+			dstEntry.Photos++
+			photoDstDirCounts[relativeDir] = dstEntry
+			dateEntry.PhotoCount++
+			dateEntry.PhotoSize += info.Size()
+		} else {
+			srcEntry.Videos++
+			dateEntry.VideoCount++
+			dateEntry.VideoSize += info.Size()
+		}
+		srcDirCounts[filepath.Dir(path)] = srcEntry
+		dateEntries[date] = dateEntry
+
 		// Collect imported file information
-		importedFiles = append(importedFiles, ImportedFile{
+		importedFile := ImportedFile{
 			SrcPath:  path,
 			DstPath:  targetPath,
 			ModTime:  info.ModTime(),
 			ItemType: itemType,
-		})
+		}
+		importedFiles = append(importedFiles, importedFile)
 
-		return nil
-	})
+		return phashes.add(ctx, importedFile)
+	}, skip)
 	if err != nil {
-		return ImportResult{}, err
+		// Report the files that were imported or skipped before the error.
+		return ImportResult{ImportedFiles: importedFiles, ZeroByteFiles: zeroByteFiles, SkippedFiles: skippedFiles}, err
 	}
 
 	var result ImportResult
@@ -330,10 +743,102 @@ func moveFiles(cfg config.CamflowConfig, srcDir string, keepSrc bool, bar *progr
 		return result.DstEntries[i].RelativeDir < result.DstEntries[j].RelativeDir
 	})
 
+	for _, entry := range dateEntries {
+		result.DateEntries = append(result.DateEntries, entry)
+	}
+	sort.Slice(result.DateEntries, func(i, j int) bool {
+		return result.DateEntries[i].Date < result.DateEntries[j].Date
+	})
+
 	result.ImportedFiles = importedFiles
+	result.ZeroByteFiles = zeroByteFiles
+	result.SkippedFiles = skippedFiles
 	return result, nil
 }
 
+// importCopyFile copies the files that importFiles imports. Tests replace it to corrupt copies.
+var importCopyFile = copyFile
+
+// verifyImportedFile re-reads the copy at targetPath of the file at path, and returns whether it matches.
+// A copy that doesn't match is removed, so that the file is copied again by the next import.
+func verifyImportedFile(path, targetPath string) (bool, error) {
+	same, err := sameFileContent(path, targetPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to verify %s against %s: %w", targetPath, path, err)
+	}
+	if same {
+		return true, nil
+	}
+	logger.Warn("Copy doesn't match the source, keeping the source and removing the copy",
+		slog.String("path", path),
+		slog.String("target_path", targetPath))
+	if err := os.Remove(targetPath); err != nil {
+		return false, fmt.Errorf("failed to remove bad copy %s: %w", targetPath, err)
+	}
+	return false, nil
+}
+
+// importItemType returns the type of the media file at path based on its extension,
+// or ItemTypeUnknown if it isn't a supported media file.
+// If sniffExtensionless, the type of a file without an extension is detected from its content,
+// and the returned extension is the one to give the imported file.
+func importItemType(path string, sniffExtensionless bool) (ItemType, string, error) {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		if sniffExtensionless {
+			return sniffItemType(path)
+		}
+		return ItemTypeUnknown, "", nil
+	}
+	// Cameras write extensions in one case, so mixed case extensions aren't recognized.
+	lowerExt := strings.ToLower(ext)
+	if itemType, ok := importExtensions[lowerExt]; ok && (ext == lowerExt || ext == strings.ToUpper(ext)) {
+		return itemType, "", nil
+	}
+	return ItemTypeUnknown, "", nil
+}
+
+// importExtensions maps the lowercase extensions of the files that import recognizes to their types.
+var importExtensions = map[string]ItemType{
+	".cr3": ItemTypePhoto,
+	".jpg": ItemTypePhoto,
+	".mp4": ItemTypeVideo,
+}
+
+// sniffItemType returns the type of the media file at path based on its content,
+// and the extension for that type.
+func sniffItemType(path string) (ItemType, string, error) {
+	contentType, err := sniffContentType(path)
+	if err != nil {
+		return ItemTypeUnknown, "", err
+	}
+	switch contentType {
+	case "image/jpeg":
+		return ItemTypePhoto, ".JPG", nil
+	case "video/mp4":
+		return ItemTypeVideo, ".MP4", nil
+	}
+	return ItemTypeUnknown, "", nil
+}
+
+// sniffContentType returns the MIME type of the file at path based on its content, per http.DetectContentType.
+func sniffContentType(path string) (string, error) {
+	defer openFiles.acquire(1)()
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	// DetectContentType considers at most the first 512 bytes.
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return http.DetectContentType(header[:n]), nil
+}
+
 // isDcimMediaDir returns whether the DCIM standard says that name
 // can contain camera media files. This function expects that name
 // is the name of a directory in DCIM/.
@@ -426,22 +931,16 @@ func CheckISEnabled(ctx context.Context, importedFiles []ImportedFile) (retErr e
 
 	// Process batches in parallel
 	batchResults := make([][]ImageStabilizationResult, len(batches))
-	g, gctx := errgroup.WithContext(ctx)
-	g.SetLimit(runtime.NumCPU())
-
-	for i, batch := range batches {
-		g.Go(func() error {
-			results, err := checkImageStabilizationBatch(gctx, batch)
-			if err != nil {
-				return fmt.Errorf("failed to check IS for batch %d: %w", i, err)
-			}
-			batchResults[i] = results
-			bar.Add(len(batch))
-			return nil
-		})
-	}
-
-	if err := g.Wait(); err != nil {
+	err := forEachConcurrently(ctx, len(batches), runtime.NumCPU(), func(ctx context.Context, i int) error {
+		results, err := checkImageStabilizationBatch(ctx, batches[i])
+		if err != nil {
+			return fmt.Errorf("failed to check IS for batch %d: %w", i, err)
+		}
+		batchResults[i] = results
+		bar.Add(len(batches[i]))
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 	_ = bar.Finish()
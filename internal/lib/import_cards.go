@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// MaxParallelCards caps the number of cards that ImportCards imports at a time.
+const MaxParallelCards = 8
+
+// ImportCards imports the files from each of the cards at sdcardDirs, like Import, with up to parallel cards
+// imported at a time. An error importing one card doesn't stop the imports of the others; the errors are
+// returned together. It stops between files when ctx is canceled.
+// It returns the combined result of the imports, including the files imported before any error.
+func ImportCards(ctx context.Context, cfg config.CamflowConfig, cacheDir string, sdcardDirs []string, keepSrc bool, now time.Time, parallel int, dryRun bool) (ImportResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return ImportResult{}, fmt.Errorf("invalid config: %w", err)
+	}
+	if parallel < 1 {
+		return ImportResult{}, fmt.Errorf("invalid number of parallel cards %d: must be at least 1", parallel)
+	}
+	parallel = min(parallel, MaxParallelCards)
+
+	// Each card writes its result and error to its own slot, so that they are combined in the order of the cards.
+	results := make([]ImportResult, len(sdcardDirs))
+	errs := make([]error, len(sdcardDirs))
+	targets := newImportTargets()
+	// The cards' errors aren't returned to forEachConcurrently, so that one card's failure doesn't stop the others.
+	err := forEachConcurrently(ctx, len(sdcardDirs), parallel, func(_ context.Context, i int) error {
+		sdcardDir := sdcardDirs[i]
+		cardName := ""
+		if len(sdcardDirs) > 1 {
+			cardName = filepath.Base(filepath.Clean(sdcardDir))
+		}
+		res, err := importCard(ctx, cfg, cacheDir, sdcardDir, keepSrc, now, targets, cardName, dryRun)
+		results[i] = res
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to import %s: %w", sdcardDir, err)
+		}
+		return nil
+	})
+	importErr := errors.Join(errs...)
+	// Cards that weren't started because ctx was canceled have no error of their own.
+	if err != nil && !errors.Is(importErr, err) {
+		importErr = errors.Join(importErr, err)
+	}
+	return mergeImportResults(results), importErr
+}
+
+// mergeImportResults combines the results of importing from several cards.
+func mergeImportResults(results []ImportResult) ImportResult {
+	var merged ImportResult
+	dstEntries := make(map[string]ImportDstDirEntry)
+	dateEntries := make(map[string]ImportDateEntry)
+	for _, res := range results {
+		merged.SrcEntries = append(merged.SrcEntries, res.SrcEntries...)
+		merged.ImportedFiles = append(merged.ImportedFiles, res.ImportedFiles...)
+		merged.ZeroByteFiles = append(merged.ZeroByteFiles, res.ZeroByteFiles...)
+		merged.SkippedFiles = append(merged.SkippedFiles, res.SkippedFiles...)
+		for _, entry := range res.DstEntries {
+			dstEntry := dstEntries[entry.RelativeDir]
+			dstEntry.RelativeDir = entry.RelativeDir
+			dstEntry.PhotoCount += entry.PhotoCount
+			dstEntries[entry.RelativeDir] = dstEntry
+		}
+		for _, entry := range res.DateEntries {
+			dateEntry := dateEntries[entry.Date]
+			dateEntry.Date = entry.Date
+			dateEntry.PhotoCount += entry.PhotoCount
+			dateEntry.VideoCount += entry.VideoCount
+			dateEntry.PhotoSize += entry.PhotoSize
+			dateEntry.VideoSize += entry.VideoSize
+			dateEntries[entry.Date] = dateEntry
+		}
+	}
+	sort.Slice(merged.SrcEntries, func(i, j int) bool {
+		return merged.SrcEntries[i].RelativeDir < merged.SrcEntries[j].RelativeDir
+	})
+	for _, entry := range dstEntries {
+		merged.DstEntries = append(merged.DstEntries, entry)
+	}
+	sort.Slice(merged.DstEntries, func(i, j int) bool {
+		return merged.DstEntries[i].RelativeDir < merged.DstEntries[j].RelativeDir
+	})
+	for _, entry := range dateEntries {
+		merged.DateEntries = append(merged.DateEntries, entry)
+	}
+	sort.Slice(merged.DateEntries, func(i, j int) bool {
+		return merged.DateEntries[i].Date < merged.DateEntries[j].Date
+	})
+	return merged
+}
+
+// importTargets records the target paths of the files imported from several cards, so that files with
+// the same target path, eg from two cameras that named files alike on the same day, aren't written over
+// each other. It is safe for concurrent use.
+type importTargets struct {
+	mu sync.Mutex
+	// srcPaths maps each claimed target path to the source path of its file.
+	srcPaths map[string]string
+}
+
+func newImportTargets() *importTargets {
+	return &importTargets{srcPaths: make(map[string]string)}
+}
+
+// claim records that srcPath is imported to targetPath. It returns an error if another file already was.
+// Claiming with a nil importTargets always succeeds.
+func (t *importTargets) claim(targetPath, srcPath string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if otherSrcPath, ok := t.srcPaths[targetPath]; ok && otherSrcPath != srcPath {
+		return fmt.Errorf("%s has the same target path %s as %s", srcPath, targetPath, otherSrcPath)
+	}
+	t.srcPaths[targetPath] = srcPath
+	return nil
+}
@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportCards_Parallel(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	cardA := t.TempDir()
+	cardB := t.TempDir()
+	createDummyFile(t, filepath.Join(cardA, "DCIM/100CANON/IMG_0001.JPG"), "a1", day)
+	createDummyFile(t, filepath.Join(cardA, "DCIM/100CANON/MVI_0002.MP4"), "a2", day)
+	createDummyFile(t, filepath.Join(cardB, "DCIM/100NIKON/DSC_0001.JPG"), "b1", day)
+	createDummyFile(t, filepath.Join(cardB, "DCIM/100NIKON/DSC_0002.JPG"), "b2", day.AddDate(0, 0, 1))
+
+	result, err := ImportCards(context.Background(), cfg, t.TempDir(), []string{cardA, cardB}, false, time.Now(), 2, false)
+	require.NoError(t, err)
+
+	assert.Len(t, result.ImportedFiles, 4)
+	assert.ElementsMatch(t, []ImportSrcDirEntry{
+		{RelativeDir: filepath.Join(cardA, "DCIM/100CANON"), PhotoCount: 1, VideoCount: 1},
+		{RelativeDir: filepath.Join(cardB, "DCIM/100NIKON"), PhotoCount: 2},
+	}, result.SrcEntries)
+	assert.Equal(t, []ImportDstDirEntry{
+		{RelativeDir: "2024/05/01", PhotoCount: 2},
+		{RelativeDir: "2024/05/02", PhotoCount: 1},
+	}, result.DstEntries, "Photos from both cards in the same dir should be counted together")
+	for _, name := range []string{"2024/05/01/2024-05-01-IMG_0001.JPG", "2024/05/01/2024-05-01-DSC_0001.JPG", "2024/05/02/2024-05-02-DSC_0002.JPG"} {
+		_, err := os.Stat(filepath.Join(cfg.PhotosProcessQueueRoot, name))
+		assert.NoError(t, err, "Expected %s to be imported", name)
+	}
+	_, err = os.Stat(filepath.Join(cfg.VideosUploadQueueRoot, "2024-05-01-MVI_0002.MP4"))
+	assert.NoError(t, err)
+}
+
+func TestImportCards_SameTargetPath(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	cardA := t.TempDir()
+	cardB := t.TempDir()
+	createDummyFile(t, filepath.Join(cardA, "DCIM/100CANON/IMG_0001.JPG"), "from card a", day)
+	createDummyFile(t, filepath.Join(cardB, "DCIM/100CANON/IMG_0001.JPG"), "from card b", day)
+
+	result, err := ImportCards(context.Background(), cfg, t.TempDir(), []string{cardA, cardB}, false, time.Now(), 2, false)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "has the same target path")
+
+	// The card that claimed the target path first imported its file, and the other left its file in place.
+	require.Len(t, result.ImportedFiles, 1)
+	imported := result.ImportedFiles[0]
+	content, err := os.ReadFile(imported.DstPath)
+	require.NoError(t, err)
+	leftPath := filepath.Join(cardA, "DCIM/100CANON/IMG_0001.JPG")
+	if imported.SrcPath == filepath.Join(cardA, "DCIM/100CANON/IMG_0001.JPG") {
+		assert.Equal(t, "from card a", string(content))
+		leftPath = filepath.Join(cardB, "DCIM/100CANON/IMG_0001.JPG")
+	} else {
+		assert.Equal(t, "from card b", string(content))
+	}
+	assert.FileExists(t, leftPath)
+	assert.Equal(t, []SkippedFile{{Path: leftPath, Reason: SkipReasonCollision}}, result.SkippedFiles)
+}
+
+func TestImportCards_DryRun(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	card := t.TempDir()
+	srcPaths := []string{
+		filepath.Join(card, "DCIM/100CANON/IMG_0001.JPG"),
+		filepath.Join(card, "DCIM/100CANON/MVI_0002.MP4"),
+	}
+	createDummyFile(t, srcPaths[0], "photo", day)
+	createDummyFile(t, srcPaths[1], "video", day)
+
+	result, err := ImportCards(context.Background(), cfg, t.TempDir(), []string{card}, false /* keepSrc */, time.Now(), 1, true /* dryRun */)
+	require.NoError(t, err)
+	dryRunDstPaths := make(map[string]string)
+	for _, imported := range result.ImportedFiles {
+		dryRunDstPaths[imported.SrcPath] = imported.DstPath
+	}
+	assert.Equal(t, []ImportDstDirEntry{{RelativeDir: "2024/05/01", PhotoCount: 1}}, result.DstEntries)
+	for _, path := range srcPaths {
+		assert.FileExists(t, path, "A dry run shouldn't remove the source files")
+	}
+	for _, root := range []string{cfg.PhotosProcessQueueRoot, cfg.VideosUploadQueueRoot} {
+		entries, err := os.ReadDir(root)
+		require.NoError(t, err)
+		assert.Empty(t, entries, "A dry run shouldn't copy anything")
+	}
+
+	// The files would be imported to the same paths as by a real run.
+	result, err = ImportCards(context.Background(), cfg, t.TempDir(), []string{card}, false /* keepSrc */, time.Now(), 1, false)
+	require.NoError(t, err)
+	require.Len(t, result.ImportedFiles, len(srcPaths))
+	for _, imported := range result.ImportedFiles {
+		assert.Equal(t, imported.DstPath, dryRunDstPaths[imported.SrcPath])
+	}
+
+	// Collisions between cards are found by a dry run too.
+	cardA := t.TempDir()
+	cardB := t.TempDir()
+	createDummyFile(t, filepath.Join(cardA, "DCIM/100CANON/IMG_0003.JPG"), "from card a", day)
+	createDummyFile(t, filepath.Join(cardB, "DCIM/100CANON/IMG_0003.JPG"), "from card b", day)
+	result, err = ImportCards(context.Background(), cfg, t.TempDir(), []string{cardA, cardB}, false, time.Now(), 1, true)
+	assert.ErrorContains(t, err, "has the same target path")
+	assert.Equal(t, []SkippedFile{{Path: filepath.Join(cardB, "DCIM/100CANON/IMG_0003.JPG"), Reason: SkipReasonCollision}}, result.SkippedFiles)
+}
+
+func TestImportCards_Canceled(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	card := t.TempDir()
+	srcPath := filepath.Join(card, "DCIM/100CANON/IMG_0001.JPG")
+	createDummyFile(t, srcPath, "content", time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := ImportCards(ctx, cfg, t.TempDir(), []string{card}, false, time.Now(), 1, false)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, result.ImportedFiles)
+	assert.FileExists(t, srcPath, "No files should be moved after the import is canceled")
+
+	_, err = ImportCards(context.Background(), cfg, t.TempDir(), []string{card}, false, time.Now(), 0, false)
+	assert.ErrorContains(t, err, "invalid number of parallel cards")
+}
@@ -0,0 +1,142 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// ReadFileList reads a newline-delimited list of file paths from r, eg the output of find or fd.
+// Blank lines are skipped, and each path is cleaned and made absolute. Repeated paths are only
+// returned once, in the order they were first read.
+func ReadFileList(r io.Reader) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		path, err := filepath.Abs(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %q: %w", line, err)
+		}
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		paths = append(paths, path)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+	return paths, nil
+}
+
+// ImportFiles moves exactly the files at paths into the photo to process dir and the upload
+// queue video dir, like Import does for the files on a card. It doesn't remove empty dirs or
+// eject anything afterwards. Each path must be an existing regular file of a supported type.
+func ImportFiles(ctx context.Context, cfg config.CamflowConfig, cacheDir string, paths []string, keepSrc bool, dryRun bool) (result ImportResult, retErr error) {
+	if err := cfg.Validate(); err != nil {
+		return ImportResult{}, fmt.Errorf("invalid config: %w", err)
+	}
+
+	infos, totalSize, zeroByteFiles, err := statFileList(paths, cfg.Import.SniffExtensionless)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	if len(zeroByteFiles) > 0 && cfg.Import.ZeroByteFiles == config.ZeroByteFilesError {
+		return ImportResult{}, fmt.Errorf("found %d zero-byte media file(s), eg %s", len(zeroByteFiles), zeroByteFiles[0])
+	}
+	if err := checkAvailableSpace(cfg, totalSize); err != nil {
+		return ImportResult{}, err
+	}
+
+	desc := "moving"
+	if dryRun {
+		desc = "simulating"
+	}
+	bar := NewProgressBar(totalSize, desc)
+	defer func() {
+		if retErr != nil && bar != nil {
+			_ = bar.Exit()
+		}
+	}()
+	var phashes *phashPool
+	if cfg.Import.PerceptualHash && !dryRun {
+		phashes = newPHashPool(ctx, dctHasher{}, cfg.Import.HashWorkers)
+	}
+	visitPaths := func(visit func(path string, info fs.FileInfo) error, skip func(SkippedFile)) error {
+		for i, path := range paths {
+			if err := visit(path, infos[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	importRes, err := importFiles(ctx, cfg, visitPaths, keepSrc, newImportTargets(), phashes, bar, dryRun)
+	hashes := phashes.wait()
+	if err != nil {
+		return importRes, fmt.Errorf("failed to move files: %w", err)
+	}
+	_ = bar.Finish()
+	bar = nil
+
+	if !dryRun {
+		if err := CheckISEnabled(ctx, importRes.ImportedFiles); err != nil {
+			return ImportResult{}, fmt.Errorf("failed to check Image Stabilization: %w", err)
+		}
+	}
+
+	if phashes != nil {
+		if err := ctx.Err(); err != nil {
+			return ImportResult{}, err
+		}
+		if err := updatePHashIndex(getPHashIndexPath(cacheDir), hashes); err != nil {
+			return ImportResult{}, fmt.Errorf("failed to record perceptual hashes: %w", err)
+		}
+	}
+
+	return importRes, nil
+}
+
+// statFileList returns the file info for each of paths, the sum of the sizes of the non-empty files,
+// and the list of zero-byte files. It returns an error for the first path that doesn't exist, isn't
+// a regular file, or isn't a supported media type.
+func statFileList(paths []string, sniffExtensionless bool) ([]fs.FileInfo, int64, []string, error) {
+	infos := make([]fs.FileInfo, len(paths))
+	var zeroByteFiles []string
+	var totalSize int64
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, 0, nil, fmt.Errorf("not a regular file: %s", path)
+		}
+		itemType, _, err := importItemType(path, sniffExtensionless)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if itemType == ItemTypeUnknown {
+			return nil, 0, nil, fmt.Errorf("not a supported media file: %s", path)
+		}
+		infos[i] = info
+		if info.Size() == 0 {
+			zeroByteFiles = append(zeroByteFiles, path)
+			continue
+		}
+		totalSize += info.Size()
+	}
+	return infos, totalSize, zeroByteFiles, nil
+}
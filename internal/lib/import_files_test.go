@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFileList(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.JPG")
+	b := filepath.Join(dir, "b c.MP4")
+
+	paths, err := ReadFileList(strings.NewReader(a + "\n\n" + b + "\r\n  \n" + a + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{a, b}, paths, "Blank lines and repeats should be skipped, and spaces in paths kept")
+}
+
+func TestImportFiles_FromPipe(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	srcDir := t.TempDir()
+	photo := filepath.Join(srcDir, "picked/IMG_0001.JPG")
+	video := filepath.Join(srcDir, "other/MVI_0002.MP4")
+	notPicked := filepath.Join(srcDir, "picked/IMG_0003.JPG")
+	createDummyFile(t, photo, "photo", day)
+	createDummyFile(t, video, "video", day)
+	createDummyFile(t, notPicked, "not picked", day)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	go func() {
+		defer w.Close()
+		_, _ = w.WriteString(photo + "\n" + video + "\n")
+	}()
+	paths, err := ReadFileList(r)
+	require.NoError(t, err)
+
+	result, err := ImportFiles(context.Background(), cfg, t.TempDir(), paths, false, false)
+	require.NoError(t, err)
+
+	require.Len(t, result.ImportedFiles, 2)
+	assert.ElementsMatch(t, []ImportSrcDirEntry{
+		{RelativeDir: filepath.Dir(photo), PhotoCount: 1},
+		{RelativeDir: filepath.Dir(video), VideoCount: 1},
+	}, result.SrcEntries)
+	_, err = os.Stat(filepath.Join(cfg.PhotosProcessQueueRoot, "2024/05/01/2024-05-01-IMG_0001.JPG"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(cfg.VideosUploadQueueRoot, "2024-05-01-MVI_0002.MP4"))
+	assert.NoError(t, err)
+	_, err = os.Stat(photo)
+	assert.True(t, os.IsNotExist(err), "The imported source should be removed")
+	_, err = os.Stat(notPicked)
+	assert.NoError(t, err, "Files that weren't listed should be left alone")
+}
+
+func TestImportFiles_InvalidPaths(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	srcDir := t.TempDir()
+	photo := filepath.Join(srcDir, "IMG_0001.JPG")
+	unsupported := filepath.Join(srcDir, "notes.txt")
+	createDummyFile(t, photo, "photo", day)
+	createDummyFile(t, unsupported, "notes", day)
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{"Missing", filepath.Join(srcDir, "IMG_9999.JPG"), "failed to stat"},
+		{"Dir", srcDir, "not a regular file"},
+		{"Unsupported", unsupported, "not a supported media file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ImportFiles(context.Background(), cfg, t.TempDir(), []string{photo, tt.path}, false, false)
+			require.Error(t, err)
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.ErrorContains(t, err, tt.path)
+			_, err = os.Stat(photo)
+			assert.NoError(t, err, "No file should be imported when any path is invalid")
+		})
+	}
+}
@@ -3,10 +3,12 @@ package lib
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -56,8 +58,13 @@ func TestGetFilesAndSize(t *testing.T) {
 		make([]byte, 350),
 		0644))
 
-	gotFiles, gotSize, err := getFilesAndSize(tmpDir)
+	// Create a zero-byte file, eg from a failed write, which should be reported separately.
+	zeroBytePath := filepath.Join(subDirInclude, "sub3.JPG")
+	require.NoError(t, os.WriteFile(zeroBytePath, nil, 0644))
+
+	gotFiles, gotSize, gotZeroByteFiles, err := getMediaRootFilesAndSize(mediaRoot{dir: tmpDir, dcim: true}, false, config.SymlinksSkip)
 	require.NoError(t, err)
+	assert.Equal(t, []string{zeroBytePath}, gotZeroByteFiles)
 
 	// Calculate expected total size (only supported extensions)
 	var expectedSize int64
@@ -81,6 +88,32 @@ func TestGetFilesAndSize(t *testing.T) {
 	assert.Equal(t, expectedCount, len(gotFiles), gotFiles)
 }
 
+// Minimal headers that http.DetectContentType recognizes.
+var (
+	jpegHeader = []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00}
+	mp4Header  = []byte{0x00, 0x00, 0x00, 0x18, 'f', 't', 'y', 'p', 'i', 's', 'o', 'm', 0x00, 0x00, 0x02, 0x00, 'i', 's', 'o', 'm', 'm', 'p', '4', '1'}
+)
+
+func TestGetFilesAndSize_Extensionless(t *testing.T) {
+	dir := t.TempDir()
+	jpegPath := filepath.Join(dir, "IMG_0001")
+	mp4Path := filepath.Join(dir, "MVI_0002")
+	textPath := filepath.Join(dir, "README")
+	require.NoError(t, os.WriteFile(jpegPath, jpegHeader, 0644))
+	require.NoError(t, os.WriteFile(mp4Path, mp4Header, 0644))
+	require.NoError(t, os.WriteFile(textPath, []byte("not media"), 0644))
+
+	gotFiles, gotSize, _, err := getMediaRootFilesAndSize(mediaRoot{dir: dir, dcim: true}, false, config.SymlinksSkip)
+	require.NoError(t, err)
+	assert.Empty(t, gotFiles, "Extensionless files should be ignored unless sniffing")
+	assert.Zero(t, gotSize)
+
+	gotFiles, gotSize, _, err = getMediaRootFilesAndSize(mediaRoot{dir: dir, dcim: true}, true, config.SymlinksSkip)
+	require.NoError(t, err)
+	assert.Equal(t, []string{jpegPath, mp4Path}, gotFiles)
+	assert.Equal(t, int64(len(jpegHeader)+len(mp4Header)), gotSize)
+}
+
 func TestGetAvailableSpace(t *testing.T) {
 	// Create a temporary directory for testing
 	tmpDir, err := os.MkdirTemp("", "camflow-test-*")
@@ -106,7 +139,7 @@ func TestGetAvailableSpace(t *testing.T) {
 	assert.Greater(t, space, uint64(0), "Available space should be greater than 0 for files too")
 }
 
-// createDummyFile creates dummy files for testing moveFiles.
+// createDummyFile creates dummy files for testing importDCIMDir.
 func createDummyFile(t *testing.T, path string, content string, modTime time.Time) {
 	t.Helper()
 	err := os.MkdirAll(filepath.Dir(path), 0755)
@@ -117,8 +150,14 @@ func createDummyFile(t *testing.T, path string, content string, modTime time.Tim
 	require.NoError(t, err, "Failed to set mod time for dummy file: %s", path)
 }
 
-// setupMoveFilesTest sets up directories and config for moveFiles tests.
-func setupMoveFilesTest(t *testing.T) (cfg config.CamflowConfig, srcRoot, photosProcessQueueRoot, videosUploadQueueRoot string, cleanup func()) {
+// importDCIMDir imports the files of srcDir, a DCIM dir, into the photo/video dirs, as Import does for a card.
+func importDCIMDir(ctx context.Context, cfg config.CamflowConfig, srcDir string, keepSrc bool, bar *progressbar.ProgressBar, dryRun bool) (ImportResult, error) {
+	roots := []mediaRoot{{dir: srcDir, dcim: true, skipUnreadable: cfg.Import.UnreadableDirs == config.UnreadableDirsSkip}}
+	return importFiles(ctx, cfg, visitMediaRoots(roots, cfg.Symlinks), keepSrc, nil, nil, bar, dryRun)
+}
+
+// setupImportDCIMDirTest sets up directories and config for importDCIMDir tests.
+func setupImportDCIMDirTest(t *testing.T) (cfg config.CamflowConfig, srcRoot, photosProcessQueueRoot, videosUploadQueueRoot string, cleanup func()) {
 	t.Helper()
 	sdcardRoot := t.TempDir()
 	mediaRoot := t.TempDir()
@@ -139,7 +178,7 @@ func setupMoveFilesTest(t *testing.T) (cfg config.CamflowConfig, srcRoot, photos
 	cfg = config.CamflowConfig{
 		PhotosProcessQueueRoot: photosProcessQueueRoot,
 		VideosUploadQueueRoot:  videosUploadQueueRoot,
-		// Other config fields can be default/zero if not used by moveFiles directly
+		// Other config fields can be default/zero if not used by importDCIMDir directly
 	}
 
 	cleanup = func() {
@@ -178,12 +217,13 @@ func calculateExpectedTargetPath(tc testFileCase, photoDir, videoDir string) str
 	}
 }
 
-func TestMoveFiles(t *testing.T) {
+func TestImportDCIMDir(t *testing.T) {
+	ctx := context.Background()
 	bar := progressbar.DefaultBytesSilent(-1, "moving:")
 
 	// --- Test Case: Success, keepSrc=false ---
 	t.Run("SuccessKeepSrcFalse", func(t *testing.T) {
-		cfg, srcDir, photoTargetRoot, videoTargetRoot, cleanup := setupMoveFilesTest(t)
+		cfg, srcDir, photoTargetRoot, videoTargetRoot, cleanup := setupImportDCIMDirTest(t)
 		defer cleanup()
 
 		// Define test file scenarios declaratively
@@ -208,8 +248,8 @@ func TestMoveFiles(t *testing.T) {
 			createDummyFile(t, fullSrcPath, tc.content, tc.modTime)
 		}
 
-		// Run moveFiles
-		result, err := moveFiles(cfg, srcDir, false, bar, false) // keepSrc = false, dryRun = false
+		// Run importDCIMDir
+		result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false) // keepSrc = false, dryRun = false
 		require.NoError(t, err)
 
 		// Verification: Check targets and source deletion
@@ -273,7 +313,7 @@ func TestMoveFiles(t *testing.T) {
 
 	// --- Test Case: Success, keepSrc=true ---
 	t.Run("SuccessKeepSrcTrue", func(t *testing.T) {
-		cfg, srcDir, photoTargetRoot, videoTargetRoot, cleanup := setupMoveFilesTest(t)
+		cfg, srcDir, photoTargetRoot, videoTargetRoot, cleanup := setupImportDCIMDirTest(t)
 		defer cleanup()
 
 		// Define test file scenarios
@@ -294,8 +334,8 @@ func TestMoveFiles(t *testing.T) {
 			createDummyFile(t, fullSrcPath, tc.content, tc.modTime)
 		}
 
-		// Run moveFiles
-		result, err := moveFiles(cfg, srcDir, true, bar, false) // keepSrc = true, dryRun = false
+		// Run importDCIMDir
+		result, err := importDCIMDir(ctx, cfg, srcDir, true, bar, false) // keepSrc = true, dryRun = false
 		require.NoError(t, err)
 
 		// Verification: Check targets and source *retention*
@@ -358,35 +398,362 @@ func TestMoveFiles(t *testing.T) {
 
 	// --- Test Case: Empty Source Directory ---
 	t.Run("EmptySourceDir", func(t *testing.T) {
-		cfg, srcDir, _, _, cleanup := setupMoveFilesTest(t)
+		cfg, srcDir, _, _, cleanup := setupImportDCIMDirTest(t)
 		defer cleanup()
 
-		// Run moveFiles on an empty directory
-		result, err := moveFiles(cfg, srcDir, false, bar, false)
+		// Run importDCIMDir on an empty directory
+		result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false)
 		require.NoError(t, err)
 
 		// Verify ImportResult is empty
 		assert.Empty(t, result.SrcEntries)
 	})
 
+	// --- Test Case: Zero-byte file among valid files ---
+	t.Run("SkipsZeroByteFile", func(t *testing.T) {
+		cfg, srcDir, photoTargetRoot, _, cleanup := setupImportDCIMDirTest(t)
+		defer cleanup()
+
+		time1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		validTC := testFileCase{srcRelPath: "100CANON/IMG_0001.JPG", content: "jpeg_content_1", modTime: time1, fileType: "photo"}
+		zeroTC := testFileCase{srcRelPath: "100CANON/IMG_0002.JPG", content: "", modTime: time1, fileType: "photo"}
+		for _, tc := range []testFileCase{validTC, zeroTC} {
+			createDummyFile(t, filepath.Join(srcDir, tc.srcRelPath), tc.content, tc.modTime)
+		}
+
+		result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false)
+		require.NoError(t, err)
+
+		zeroSrcPath := filepath.Join(srcDir, zeroTC.srcRelPath)
+		assert.Equal(t, []string{zeroSrcPath}, result.ZeroByteFiles, "Zero-byte file should be reported")
+		require.Len(t, result.ImportedFiles, 1)
+		assert.Equal(t, filepath.Join(srcDir, validTC.srcRelPath), result.ImportedFiles[0].SrcPath)
+		assert.Equal(t, []ImportSrcDirEntry{{RelativeDir: filepath.Join(srcDir, "100CANON"), PhotoCount: 1}}, result.SrcEntries)
+
+		_, err = os.Stat(calculateExpectedTargetPath(validTC, photoTargetRoot, ""))
+		assert.NoError(t, err, "Valid file should be imported")
+		_, err = os.Stat(calculateExpectedTargetPath(zeroTC, photoTargetRoot, ""))
+		assert.True(t, os.IsNotExist(err), "Zero-byte file should not be imported")
+		_, err = os.Stat(zeroSrcPath)
+		assert.NoError(t, err, "Zero-byte source file should be left on the card")
+	})
+
+	t.Run("VerifyMatch", func(t *testing.T) {
+		cfg, srcDir, photoTargetRoot, _, cleanup := setupImportDCIMDirTest(t)
+		defer cleanup()
+		cfg.Import.Verify = true
+
+		tc := testFileCase{srcRelPath: "100CANON/IMG_0001.JPG", content: "jpeg_content_1", modTime: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), fileType: "photo"}
+		srcPath := filepath.Join(srcDir, tc.srcRelPath)
+		createDummyFile(t, srcPath, tc.content, tc.modTime)
+
+		result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false)
+		require.NoError(t, err)
+		require.Len(t, result.ImportedFiles, 1)
+		assert.Empty(t, result.SkippedFiles)
+		content, err := os.ReadFile(calculateExpectedTargetPath(tc, photoTargetRoot, ""))
+		require.NoError(t, err)
+		assert.Equal(t, tc.content, string(content))
+		_, err = os.Stat(srcPath)
+		assert.True(t, os.IsNotExist(err), "Verified source file should be deleted")
+	})
+
+	t.Run("VerifyMismatch", func(t *testing.T) {
+		cfg, srcDir, photoTargetRoot, _, cleanup := setupImportDCIMDirTest(t)
+		defer cleanup()
+		cfg.Import.Verify = true
+
+		// Corrupt the copy of the first file.
+		origCopyFile := importCopyFile
+		t.Cleanup(func() { importCopyFile = origCopyFile })
+		importCopyFile = func(src, dst string, size int64, modTime time.Time, bufferSize int, bar *progressbar.ProgressBar) error {
+			if err := origCopyFile(src, dst, size, modTime, bufferSize, bar); err != nil {
+				return err
+			}
+			if filepath.Base(src) != "IMG_0001.JPG" {
+				return nil
+			}
+			return os.WriteFile(dst, []byte("corrupted_conte"), 0644)
+		}
+
+		day := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		badTC := testFileCase{srcRelPath: "100CANON/IMG_0001.JPG", content: "jpeg_content_1", modTime: day, fileType: "photo"}
+		goodTC := testFileCase{srcRelPath: "100CANON/IMG_0002.JPG", content: "jpeg_content_2", modTime: day, fileType: "photo"}
+		for _, tc := range []testFileCase{badTC, goodTC} {
+			createDummyFile(t, filepath.Join(srcDir, tc.srcRelPath), tc.content, tc.modTime)
+		}
+
+		result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false)
+		require.NoError(t, err)
+		badSrcPath := filepath.Join(srcDir, badTC.srcRelPath)
+		assert.Equal(t, []SkippedFile{{Path: badSrcPath, Reason: SkipReasonVerifyFailed}}, result.SkippedFiles)
+		assert.Equal(t, []string{badSrcPath}, result.VerifyFailedFiles())
+		require.Len(t, result.ImportedFiles, 1)
+		assert.Equal(t, filepath.Join(srcDir, goodTC.srcRelPath), result.ImportedFiles[0].SrcPath)
+		assert.Equal(t, []ImportSrcDirEntry{{RelativeDir: filepath.Join(srcDir, "100CANON"), PhotoCount: 1}}, result.SrcEntries,
+			"The file that failed verification shouldn't be counted")
+
+		content, err := os.ReadFile(badSrcPath)
+		require.NoError(t, err, "Source file should be kept when its copy doesn't match")
+		assert.Equal(t, badTC.content, string(content))
+		_, err = os.Stat(calculateExpectedTargetPath(badTC, photoTargetRoot, ""))
+		assert.True(t, os.IsNotExist(err), "Bad copy should be removed")
+		_, err = os.Stat(filepath.Join(srcDir, goodTC.srcRelPath))
+		assert.True(t, os.IsNotExist(err), "Verified source file should be deleted")
+	})
+
+	t.Run("GroupsByCaptureDate", func(t *testing.T) {
+		cfg, srcDir, _, _, cleanup := setupImportDCIMDirTest(t)
+		defer cleanup()
+
+		day1 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+		day2 := time.Date(2024, 5, 2, 12, 0, 0, 0, time.Local)
+		for _, tc := range []testFileCase{
+			{srcRelPath: "100CANON/IMG_0001.JPG", content: "12345", modTime: day1},
+			{srcRelPath: "101CANON/IMG_0002.JPG", content: "123", modTime: day1},
+			{srcRelPath: "100CANON/MVI_0003.MP4", content: "1234567", modTime: day1},
+			{srcRelPath: "100CANON/IMG_0004.CR3", content: "12", modTime: day2},
+		} {
+			createDummyFile(t, filepath.Join(srcDir, tc.srcRelPath), tc.content, tc.modTime)
+		}
+
+		result, err := importDCIMDir(ctx, cfg, srcDir, true, bar, true)
+		require.NoError(t, err)
+		assert.Equal(t, []ImportDateEntry{
+			{Date: "2024-05-01", PhotoCount: 2, VideoCount: 1, PhotoSize: 8, VideoSize: 7},
+			{Date: "2024-05-02", PhotoCount: 1, PhotoSize: 2},
+		}, result.DateEntries, "Files from different source dirs should be grouped by their date")
+	})
+
+	t.Run("CameraClockOffset", func(t *testing.T) {
+		for _, tt := range []struct {
+			name      string
+			offset    time.Duration
+			modTime   time.Time
+			wantPhoto string
+			wantVideo string
+		}{
+			{
+				name:      "Positive",
+				offset:    2 * time.Hour,
+				modTime:   time.Date(2024, 5, 1, 23, 0, 0, 0, time.Local),
+				wantPhoto: "2024/05/02/2024-05-02-IMG_0001.JPG",
+				wantVideo: "2024-05-02-MVI_0002.MP4",
+			},
+			{
+				name:      "Negative",
+				offset:    -15 * time.Minute,
+				modTime:   time.Date(2024, 6, 1, 0, 10, 0, 0, time.Local),
+				wantPhoto: "2024/05/31/2024-05-31-IMG_0001.JPG",
+				wantVideo: "2024-05-31-MVI_0002.MP4",
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg, srcDir, photoTargetRoot, videoTargetRoot, cleanup := setupImportDCIMDirTest(t)
+				defer cleanup()
+				cfg.Import.CameraClockOffset = tt.offset
+				createDummyFile(t, filepath.Join(srcDir, "100CANON/IMG_0001.JPG"), "photo", tt.modTime)
+				createDummyFile(t, filepath.Join(srcDir, "100CANON/MVI_0002.MP4"), "video", tt.modTime)
+
+				result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false)
+				require.NoError(t, err)
+
+				photoPath := filepath.Join(photoTargetRoot, filepath.FromSlash(tt.wantPhoto))
+				videoPath := filepath.Join(videoTargetRoot, tt.wantVideo)
+				assert.FileExists(t, photoPath, "The photo should be dated by the corrected time")
+				assert.FileExists(t, videoPath, "The video should be dated by the same corrected time")
+				require.Len(t, result.DateEntries, 1)
+				assert.Equal(t, tt.modTime.Add(tt.offset).Format("2006-01-02"), result.DateEntries[0].Date)
+
+				info, err := os.Stat(photoPath)
+				require.NoError(t, err)
+				assert.True(t, info.ModTime().Equal(tt.modTime), "The file's modification time should be kept")
+			})
+		}
+	})
+
+	t.Run("LongName", func(t *testing.T) {
+		cfg, srcDir, _, videoTargetRoot, cleanup := setupImportDCIMDirTest(t)
+		defer cleanup()
+		// The name fits on the card, but not with the date prefix.
+		longName := strings.Repeat("a", maxNameBytes-len(".MP4")) + ".MP4"
+		modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+		createDummyFile(t, filepath.Join(srcDir, "100CANON", longName), "video", modTime)
+
+		result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false)
+		require.NoError(t, err)
+		require.Len(t, result.ImportedFiles, 1)
+		importedName := filepath.Base(result.ImportedFiles[0].DstPath)
+		assert.Len(t, importedName, maxNameBytes-tmpSuffixLen)
+		assert.True(t, strings.HasPrefix(importedName, "2024-05-01-aaa"), "The date prefix should be kept: %s", importedName)
+		assert.True(t, strings.HasSuffix(importedName, ".MP4"), "The extension should be kept: %s", importedName)
+		assert.FileExists(t, filepath.Join(videoTargetRoot, importedName))
+	})
+
+	t.Run("PhotoFolders", func(t *testing.T) {
+		for _, tt := range []struct {
+			photoFolders string
+			wantDirs     []string
+		}{
+			{photoFolders: config.PhotoFoldersDay, wantDirs: []string{"2024/05/01", "2024/05/02", "2024/06/01"}},
+			{photoFolders: config.PhotoFoldersYearDate, wantDirs: []string{"2024/2024-05-01", "2024/2024-05-02", "2024/2024-06-01"}},
+			{photoFolders: config.PhotoFoldersMonth, wantDirs: []string{"2024/05", "2024/05", "2024/06"}},
+			{photoFolders: config.PhotoFoldersYear, wantDirs: []string{"2024", "2024", "2024"}},
+		} {
+			t.Run(tt.photoFolders, func(t *testing.T) {
+				cfg, srcDir, photoTargetRoot, videoTargetRoot, cleanup := setupImportDCIMDirTest(t)
+				defer cleanup()
+				cfg.Import.PhotoFolders = tt.photoFolders
+
+				// The camera reused the file name, so the files only differ by their date prefix
+				// when they share a month or year folder.
+				tcs := []testFileCase{
+					{srcRelPath: "100CANON/IMG_0001.JPG", content: "may 1", modTime: time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local), fileType: "photo"},
+					{srcRelPath: "101CANON/IMG_0001.JPG", content: "may 2", modTime: time.Date(2024, 5, 2, 12, 0, 0, 0, time.Local), fileType: "photo"},
+					{srcRelPath: "102CANON/IMG_0001.JPG", content: "june 1", modTime: time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local), fileType: "photo"},
+				}
+				video := testFileCase{srcRelPath: "100CANON/MVI_0002.MP4", content: "video", modTime: tcs[0].modTime, fileType: "video"}
+				for _, tc := range append(tcs, video) {
+					createDummyFile(t, filepath.Join(srcDir, tc.srcRelPath), tc.content, tc.modTime)
+				}
+
+				result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false)
+				require.NoError(t, err)
+				require.Len(t, result.ImportedFiles, 4)
+
+				for i, tc := range tcs {
+					targetPath := filepath.Join(photoTargetRoot, filepath.FromSlash(tt.wantDirs[i]), tc.modTime.Format("2006-01-02-")+"IMG_0001.JPG")
+					content, err := os.ReadFile(targetPath)
+					require.NoError(t, err, "Expected %s to be imported to %s", tc.srcRelPath, targetPath)
+					assert.Equal(t, tc.content, string(content), "Files with the same name shouldn't overwrite each other")
+				}
+				_, err = os.Stat(calculateExpectedTargetPath(video, photoTargetRoot, videoTargetRoot))
+				assert.NoError(t, err, "Videos should still be imported into one dir")
+			})
+		}
+	})
+
+	t.Run("ResumesWhenDestinationExists", func(t *testing.T) {
+		modTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		for _, tt := range []struct {
+			name           string
+			dstContent     string
+			dstModTime     time.Time
+			compareContent bool
+			wantCopied     bool
+		}{
+			{name: "SameSizeAndModTime", dstContent: "photo_content", dstModTime: modTime, wantCopied: false},
+			// Without comparing the content, a file of the same size and time is taken as the copy.
+			{name: "DifferentContentNotCompared", dstContent: "PHOTO_CONTENT", dstModTime: modTime, wantCopied: false},
+			{name: "DifferentContentCompared", dstContent: "PHOTO_CONTENT", dstModTime: modTime, compareContent: true, wantCopied: true},
+			{name: "SameContentCompared", dstContent: "photo_content", dstModTime: modTime, compareContent: true, wantCopied: false},
+			{name: "DifferentSize", dstContent: "photo", dstModTime: modTime, wantCopied: true},
+			{name: "DifferentModTime", dstContent: "photo_content", dstModTime: modTime.Add(time.Hour), wantCopied: true},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg, srcDir, photoTargetRoot, _, cleanup := setupImportDCIMDirTest(t)
+				defer cleanup()
+				cfg.Import.CompareContent = tt.compareContent
+
+				tc := testFileCase{srcRelPath: "100CANON/IMG_0001.JPG", content: "photo_content", modTime: modTime, fileType: "photo"}
+				srcPath := filepath.Join(srcDir, tc.srcRelPath)
+				dstPath := calculateExpectedTargetPath(tc, photoTargetRoot, "")
+				createDummyFile(t, srcPath, tc.content, tc.modTime)
+				createDummyFile(t, dstPath, tt.dstContent, tt.dstModTime)
+
+				result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false)
+				require.NoError(t, err)
+				require.Len(t, result.ImportedFiles, 1)
+
+				_, err = os.Stat(srcPath)
+				assert.True(t, os.IsNotExist(err), "The source should be removed either way")
+				content, err := os.ReadFile(dstPath)
+				require.NoError(t, err)
+				if tt.wantCopied {
+					assert.Equal(t, tc.content, string(content), "The destination should be replaced by a copy of the source")
+				} else {
+					assert.Equal(t, tt.dstContent, string(content), "The destination should be taken as the copy")
+				}
+			})
+		}
+	})
+
+	t.Run("SuccessHardlinkKeepSrc", func(t *testing.T) {
+		cfg, srcDir, photoTargetRoot, videoTargetRoot, cleanup := setupImportDCIMDirTest(t)
+		defer cleanup()
+		cfg.Import.Hardlink = true
+
+		time1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		testCases := []testFileCase{
+			{srcRelPath: "100CANON/IMG_0001.JPG", content: "jpeg_content_1", modTime: time1, fileType: "photo"},
+			{srcRelPath: "100CANON/VID_0002.MP4", content: "video_content_2", modTime: time1, fileType: "video"},
+		}
+		for _, tc := range testCases {
+			createDummyFile(t, filepath.Join(srcDir, tc.srcRelPath), tc.content, tc.modTime)
+		}
+
+		result, err := importDCIMDir(ctx, cfg, srcDir, true, bar, false)
+		require.NoError(t, err)
+		require.Len(t, result.ImportedFiles, 2)
+
+		for _, tc := range testCases {
+			srcInfo, err := os.Stat(filepath.Join(srcDir, tc.srcRelPath))
+			require.NoError(t, err, "Source file should be kept")
+			dstInfo, err := os.Stat(calculateExpectedTargetPath(tc, photoTargetRoot, videoTargetRoot))
+			require.NoError(t, err)
+			assert.True(t, os.SameFile(srcInfo, dstInfo), "%s should be hard linked", tc.srcRelPath)
+		}
+	})
+
+	t.Run("SniffsExtensionlessFiles", func(t *testing.T) {
+		cfg, srcDir, photoTargetRoot, videoTargetRoot, cleanup := setupImportDCIMDirTest(t)
+		defer cleanup()
+
+		time1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		createDummyFile(t, filepath.Join(srcDir, "100CANON", "IMG_0001"), string(jpegHeader), time1)
+		createDummyFile(t, filepath.Join(srcDir, "100CANON", "MVI_0002"), string(mp4Header), time1)
+
+		// Without sniffing, extensionless files stay on the card.
+		result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false)
+		require.NoError(t, err)
+		assert.Empty(t, result.ImportedFiles)
+
+		cfg.Import.SniffExtensionless = true
+		result, err = importDCIMDir(ctx, cfg, srcDir, false, bar, false)
+		require.NoError(t, err)
+		require.Len(t, result.ImportedFiles, 2)
+
+		// The imported files are given the extension for their type.
+		photoPath := filepath.Join(photoTargetRoot, "2024", "05", "01", "2024-05-01-IMG_0001.JPG")
+		videoPath := filepath.Join(videoTargetRoot, "2024-05-01-MVI_0002.MP4")
+		assert.Equal(t, photoPath, result.ImportedFiles[0].DstPath)
+		assert.Equal(t, ItemTypePhoto, result.ImportedFiles[0].ItemType)
+		assert.Equal(t, videoPath, result.ImportedFiles[1].DstPath)
+		assert.Equal(t, ItemTypeVideo, result.ImportedFiles[1].ItemType)
+		for _, path := range []string{photoPath, videoPath} {
+			_, err := os.Stat(path)
+			assert.NoError(t, err, "Expected %s to be imported", path)
+		}
+	})
+
 	// --- Test Case: Copy Error (Destination Not Writable) ---
 	t.Run("ErrorCopyCannotWriteDest", func(t *testing.T) {
-		cfg, srcDir, photoTargetRoot, _, cleanup := setupMoveFilesTest(t)
+		cfg, srcDir, photoTargetRoot, _, cleanup := setupImportDCIMDirTest(t)
 		defer cleanup()
 
 		time1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
 		srcPhoto1Path := filepath.Join(srcDir, "100CANON", "IMG_COPY_ERR.JPG")
 		createDummyFile(t, srcPhoto1Path, "copy_error_content", time1)
 
-		// Make the photo target dir root read-only BEFORE calling moveFiles
+		// Make the photo target dir root read-only BEFORE calling importDCIMDir
 		err := os.Chmod(photoTargetRoot, 0555)
 		require.NoError(t, err)
 		// Attempt to restore permissions during cleanup, might fail if test fails early
 		defer os.Chmod(photoTargetRoot, 0755)
 
-		// Run moveFiles - expect failure during copyFile's MkdirAll or Create
-		result, err := moveFiles(cfg, srcDir, false, bar, false)
-		require.Error(t, err, "moveFiles should fail when destination is not writable")
+		// Run importDCIMDir - expect failure during copyFile's MkdirAll or Create
+		result, err := importDCIMDir(ctx, cfg, srcDir, false, bar, false)
+		require.Error(t, err, "importDCIMDir should fail when destination is not writable")
 
 		// Check the error message indicates a permission or creation issue
 		assert.ErrorContains(t, err, "failed to create dir") // copyFile should fail here
@@ -426,6 +793,185 @@ func TestIsDcimMediaDir(t *testing.T) {
 	}
 }
 
+func TestImport_MediaRoots(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	newCard := func(t *testing.T) string {
+		card := t.TempDir()
+		createDummyFile(t, filepath.Join(card, "DCIM/100CANON/IMG_0001.JPG"), "photo", day)
+		createDummyFile(t, filepath.Join(card, "DCIM/CANONMSC/IMG_0002.JPG"), "not media", day)
+		createDummyFile(t, filepath.Join(card, "PRIVATE/M4ROOT/CLIP/C0001.MP4"), "clip", day)
+		createDummyFile(t, filepath.Join(card, "MISC/IMG_0003.JPG"), "misc", day)
+		return card
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		card := newCard(t)
+		result, err := Import(cfg, t.TempDir(), card, true, time.Now(), false)
+		require.NoError(t, err)
+		require.Len(t, result.ImportedFiles, 1, "Only DCIM should be imported from by default")
+		assert.Equal(t, filepath.Join(card, "DCIM/100CANON/IMG_0001.JPG"), result.ImportedFiles[0].SrcPath)
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		cfg.Import.MediaRoots = []string{"DCIM", "PRIVATE/M4ROOT/CLIP", "AVCHD"}
+		card := newCard(t)
+		result, err := Import(cfg, t.TempDir(), card, true, time.Now(), false)
+		require.NoError(t, err)
+		var srcPaths []string
+		for _, imported := range result.ImportedFiles {
+			srcPaths = append(srcPaths, imported.SrcPath)
+		}
+		assert.ElementsMatch(t, []string{
+			filepath.Join(card, "DCIM/100CANON/IMG_0001.JPG"),
+			filepath.Join(card, "PRIVATE/M4ROOT/CLIP/C0001.MP4"),
+		}, srcPaths, "Roots that aren't on the card should be skipped, and DCIM should still skip its non-media dirs")
+		_, err = os.Stat(filepath.Join(cfg.VideosUploadQueueRoot, "2024-05-01-C0001.MP4"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("NoRootOnCard", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		cfg.Import.MediaRoots = []string{"AVCHD"}
+		_, err := Import(cfg, t.TempDir(), newCard(t), true, time.Now(), false)
+		assert.ErrorContains(t, err, "found none of the media roots")
+	})
+}
+
+func TestImport_Dests(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	cfg := newTestConfig(t, "", "")
+	cfg.Import.PhotosDest = t.TempDir()
+	cfg.Import.VideosDest = t.TempDir()
+	card := t.TempDir()
+	createDummyFile(t, filepath.Join(card, "DCIM/100CANON/IMG_0001.JPG"), "photo", day)
+	createDummyFile(t, filepath.Join(card, "DCIM/100CANON/MVI_0002.MP4"), "video", day)
+
+	result, err := Import(cfg, t.TempDir(), card, true, time.Now(), false)
+	require.NoError(t, err)
+	require.Len(t, result.ImportedFiles, 2)
+	dstPaths := make(map[string]string)
+	for _, imported := range result.ImportedFiles {
+		dstPaths[filepath.Base(imported.SrcPath)] = imported.DstPath
+	}
+	assert.Equal(t, filepath.Join(cfg.Import.PhotosDest, "2024/05/01/2024-05-01-IMG_0001.JPG"), dstPaths["IMG_0001.JPG"])
+	assert.Equal(t, filepath.Join(cfg.Import.VideosDest, "2024-05-01-MVI_0002.MP4"), dstPaths["MVI_0002.MP4"])
+	assert.FileExists(t, dstPaths["IMG_0001.JPG"])
+	assert.FileExists(t, dstPaths["MVI_0002.MP4"])
+	assertDirNotExists(t, filepath.Join(cfg.PhotosProcessQueueRoot, "2024"), "Nothing should be moved to the configured dirs")
+	entries, err := os.ReadDir(cfg.VideosUploadQueueRoot)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	cfg = newTestConfig(t, "", "")
+	cfg.Import.VideosDest = filepath.Join(t.TempDir(), "missing")
+	_, err = Import(cfg, t.TempDir(), card, true, time.Now(), false)
+	assert.ErrorContains(t, err, "invalid import videos dest")
+}
+
+func TestImport_SkippedFiles(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	card := t.TempDir()
+	dcim := filepath.Join(card, "DCIM")
+	createDummyFile(t, filepath.Join(dcim, "100CANON/IMG_0001.JPG"), "photo", day)
+	createDummyFile(t, filepath.Join(dcim, "100CANON/IMG_0002.JPG"), "", day)
+	createDummyFile(t, filepath.Join(dcim, "100CANON/IMG_0003.THM"), "thumbnail", day)
+	createDummyFile(t, filepath.Join(dcim, "100CANON/IMG_0004"), "no extension", day)
+	createDummyFile(t, filepath.Join(dcim, "CANONMSC/M0100.CTG"), "catalog", day)
+
+	result, err := Import(cfg, t.TempDir(), card, true, time.Now(), false)
+	require.NoError(t, err)
+	require.Len(t, result.ImportedFiles, 1)
+	assert.ElementsMatch(t, []SkippedFile{
+		{Path: filepath.Join(dcim, "100CANON/IMG_0002.JPG"), Reason: SkipReasonZeroByte},
+		{Path: filepath.Join(dcim, "100CANON/IMG_0003.THM"), Reason: SkipReasonUnsupported},
+		{Path: filepath.Join(dcim, "100CANON/IMG_0004"), Reason: SkipReasonNoExtension},
+		{Path: filepath.Join(dcim, "CANONMSC"), Reason: SkipReasonIgnoredDir},
+	}, result.SkippedFiles)
+}
+
+func TestImport_WriteProtected(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	// A read-only dir stands in for a write-protected card.
+	newCard := func(t *testing.T) (string, string) {
+		card := t.TempDir()
+		srcPath := filepath.Join(card, "DCIM/100CANON/IMG_0001.JPG")
+		createDummyFile(t, srcPath, "photo", day)
+		require.NoError(t, os.Chmod(filepath.Dir(srcPath), 0555))
+		t.Cleanup(func() { os.Chmod(filepath.Dir(srcPath), 0755) })
+		return card, srcPath
+	}
+	targetPath := func(cfg config.CamflowConfig) string {
+		return filepath.Join(cfg.PhotosProcessQueueRoot, "2024/05/01/2024-05-01-IMG_0001.JPG")
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		card, srcPath := newCard(t)
+		_, err := Import(cfg, t.TempDir(), card, false, time.Now(), false)
+		assert.ErrorContains(t, err, "card is write-protected")
+		assert.FileExists(t, srcPath)
+		assert.NoFileExists(t, targetPath(cfg), "Nothing should be copied from a write-protected card")
+	})
+
+	t.Run("Keep", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		cfg.Import.WriteProtected = config.WriteProtectedKeep
+		card, srcPath := newCard(t)
+		result, err := Import(cfg, t.TempDir(), card, false, time.Now(), false)
+		require.NoError(t, err)
+		require.Len(t, result.ImportedFiles, 1)
+		assert.FileExists(t, srcPath, "The file should be kept on a write-protected card")
+		assert.FileExists(t, targetPath(cfg))
+	})
+
+	t.Run("KeepSrc", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		card, srcPath := newCard(t)
+		_, err := Import(cfg, t.TempDir(), card, true, time.Now(), false)
+		require.NoError(t, err, "Imports that keep the card's files shouldn't need to remove them")
+		assert.FileExists(t, srcPath)
+	})
+}
+
+func TestImport_UnreadableDirs(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read dirs without read permission")
+	}
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	newCard := func(t *testing.T) (string, string) {
+		card := t.TempDir()
+		createDummyFile(t, filepath.Join(card, "DCIM/100CANON/IMG_0001.JPG"), "photo 1", day)
+		createDummyFile(t, filepath.Join(card, "DCIM/102CANON/IMG_0003.JPG"), "photo 3", day)
+		unreadableDir := filepath.Join(card, "DCIM/101CANON")
+		createDummyFile(t, filepath.Join(unreadableDir, "IMG_0002.JPG"), "photo 2", day)
+		require.NoError(t, os.Chmod(unreadableDir, 0))
+		t.Cleanup(func() { os.Chmod(unreadableDir, 0755) })
+		return card, unreadableDir
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		card, _ := newCard(t)
+		_, err := Import(cfg, t.TempDir(), card, false, time.Now(), false)
+		assert.ErrorContains(t, err, "permission denied")
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		cfg.Import.UnreadableDirs = config.UnreadableDirsSkip
+		card, unreadableDir := newCard(t)
+		result, err := Import(cfg, t.TempDir(), card, false, time.Now(), false)
+		require.NoError(t, err)
+		assert.Len(t, result.ImportedFiles, 2, "The files in the readable dirs should be imported")
+		assert.FileExists(t, filepath.Join(cfg.PhotosProcessQueueRoot, "2024/05/01/2024-05-01-IMG_0001.JPG"))
+		assert.FileExists(t, filepath.Join(cfg.PhotosProcessQueueRoot, "2024/05/01/2024-05-01-IMG_0003.JPG"))
+		assert.Equal(t, []SkippedFile{{Path: unreadableDir, Reason: SkipReasonUnreadableDir}}, result.SkippedFiles)
+	})
+}
+
 func TestDeleteEmptyDirs(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "camflow-test-*")
 	require.NoError(t, err, "Failed to create temp directory")
@@ -554,3 +1100,46 @@ func TestPrintISWarningIfNeeded(t *testing.T) {
 		assert.NotContains(t, output, "Image Stabilization Warning")
 	})
 }
+
+func TestImport_Timezone(t *testing.T) {
+	// a and b were taken minutes apart, on either side of midnight in the zones of their cameras' clocks,
+	// and c has no capture time in its metadata. a's modification time is its camera's wall clock read as UTC.
+	card := t.TempDir()
+	pathA := filepath.Join(card, "DCIM/100CANON/IMG_0001.JPG")
+	pathB := filepath.Join(card, "DCIM/100CANON/IMG_0002.JPG")
+	pathC := filepath.Join(card, "DCIM/100CANON/IMG_0003.JPG")
+	createDummyFile(t, pathA, "a", time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC))
+	createDummyFile(t, pathB, "b", time.Date(2024, 5, 2, 6, 15, 0, 0, time.UTC))
+	createDummyFile(t, pathC, "c", time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC))
+
+	exifOutput, err := json.Marshal([]map[string]string{
+		{"SourceFile": pathA, "DateTimeOriginal": "2024:05:01 23:30:00", "OffsetTimeOriginal": "-07:00"},
+		{"SourceFile": pathB, "DateTimeOriginal": "2024:05:02 08:15:00", "OffsetTimeOriginal": "+02:00"},
+		{"SourceFile": pathC},
+	})
+	require.NoError(t, err)
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "exiftool"), []byte("#!/bin/sh\ncat <<'EOF'\n"+string(exifOutput)+"\nEOF\n"), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for _, timezone := range []string{"UTC", "Asia/Tokyo"} {
+		t.Run(timezone, func(t *testing.T) {
+			cfg := newTestConfig(t, "", "")
+			cfg.Import.Timezone = timezone
+			result, err := Import(cfg, t.TempDir(), card, true, time.Now(), true)
+			require.NoError(t, err)
+			require.Len(t, result.ImportedFiles, 3)
+			for _, imported := range result.ImportedFiles {
+				assert.Equal(t, filepath.Join(cfg.PhotosProcessQueueRoot, "2024", "05", "02", "2024-05-02-"+filepath.Base(imported.SrcPath)), imported.DstPath,
+					"Every file should be dated in %s", timezone)
+			}
+		})
+	}
+
+	t.Run("InvalidTimezone", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		cfg.Import.Timezone = "Mars/Olympus_Mons"
+		_, err := Import(cfg, t.TempDir(), card, true, time.Now(), true)
+		assert.ErrorContains(t, err, "invalid timezone")
+	})
+}
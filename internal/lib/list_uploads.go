@@ -0,0 +1,189 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// LedgerUpload is an upload recorded in the upload ledger.
+type LedgerUpload struct {
+	File string `json:"file"`
+	// Path and Size are the path of the file in the upload queue when it was uploaded, and its size.
+	// They are empty for uploads recorded by earlier versions of camflow.
+	Path        string `json:"path,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	MediaItemID string `json:"media_item_id"`
+	// Albums are the titles of the albums that the media item was to be added to.
+	Albums     []string  `json:"albums"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	Tag        string    `json:"tag,omitempty"`
+}
+
+// ListUploads returns the uploads recorded in the upload ledger in cacheDir, in the order that they
+// were recorded. If from or to isn't zero, only the uploads on or after from, or on or before to,
+// by their local upload date, are returned. If album isn't empty, only the uploads to be added to
+// the album of that title are returned.
+func ListUploads(cacheDir string, from, to time.Time, album string) ([]LedgerUpload, error) {
+	uploads := []LedgerUpload{}
+	err := newUploadLedger(getUploadLedgerPath(cacheDir)).forEach(func(entry uploadLedgerEntry) {
+		if entry.MediaItemID == "" {
+			return
+		}
+		uploadedAt := entry.UploadedAt.Local()
+		date := time.Date(uploadedAt.Year(), uploadedAt.Month(), uploadedAt.Day(), 0, 0, 0, 0, time.UTC)
+		if (!from.IsZero() && date.Before(from)) || (!to.IsZero() && date.After(to)) {
+			return
+		}
+		if album != "" && !slices.Contains(entry.Albums, album) {
+			return
+		}
+		albums := entry.Albums
+		if albums == nil {
+			albums = []string{}
+		}
+		uploads = append(uploads, LedgerUpload{
+			File:        entry.File,
+			Path:        entry.Path,
+			Size:        entry.Size,
+			MediaItemID: entry.MediaItemID,
+			Albums:      albums,
+			UploadedAt:  entry.UploadedAt,
+			Tag:         entry.Tag,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+// WriteUploadsJSON writes uploads to w as indented JSON.
+func WriteUploadsJSON(w io.Writer, uploads []LedgerUpload) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(uploads); err != nil {
+		return fmt.Errorf("failed to write uploads: %w", err)
+	}
+	return nil
+}
+
+// PruneUploadLedger drops the entries of the upload ledger in cacheDir for the files that are no longer
+// in the photo or video upload queues or uploaded dirs, eg because they were deleted after uploading.
+// Files are matched by basename, which is unique because of their date prefixes. It returns the sorted
+// basenames of the files whose entries were (or would be) dropped.
+// It refuses to prune if a queue or uploaded dir is on a drive that isn't mounted. Unless allowEmptyRoots,
+// it also refuses if a queue or uploaded dir doesn't exist, or if both the queue and uploaded dir of photos
+// or videos are empty while entries of files uploaded from that queue would be dropped, since that would
+// drop the entries of all of their files, eg because the dirs were moved.
+func PruneUploadLedger(cfg config.CamflowConfig, cacheDir string, allowEmptyRoots, dryRun bool) ([]string, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	existing := make(map[string]bool)
+	// The queue roots whose queue and uploaded dirs have no files.
+	var emptyQueueRoots []string
+	for _, localConfig := range []LocalConfig{&cfg.LocalPhotos, &cfg.LocalVideos} {
+		fileCount := 0
+		for _, root := range []struct{ path, desc string }{
+			{localConfig.GetUploadQueueRoot(), "upload queue dir"},
+			{localConfig.GetUploadedRoot(), "uploaded dir"},
+		} {
+			if _, err := os.Stat(root.path); err != nil {
+				if !os.IsNotExist(err) {
+					return nil, fmt.Errorf("failed to check %s %s: %w", root.desc, root.path, err)
+				}
+				if err := checkMissingDirMounted(root.path, root.desc); err != nil {
+					return nil, err
+				}
+				if !allowEmptyRoots {
+					return nil, fmt.Errorf("%s %s doesn't exist, so pruning would drop the entries of all of its files; pass --allow-empty-roots if that is intended", root.desc, root.path)
+				}
+				continue
+			}
+			if root.desc == "uploaded dir" {
+				if err := checkUploadedRoot(root.path, true /* dryRun */); err != nil {
+					return nil, err
+				}
+			}
+			items, _, err := scanUploadQueue(root.path, localConfig.GetSymlinks())
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				existing[filepath.Base(item.path)] = true
+			}
+			fileCount += len(items)
+		}
+		if fileCount == 0 {
+			emptyQueueRoots = append(emptyQueueRoots, localConfig.GetUploadQueueRoot())
+		}
+	}
+
+	ledger := newUploadLedger(getUploadLedgerPath(cacheDir))
+	var kept []uploadLedgerEntry
+	droppedFiles := make(map[string]bool)
+	var emptyRootErr error
+	err := ledger.forEach(func(entry uploadLedgerEntry) {
+		if existing[entry.File] {
+			kept = append(kept, entry)
+			return
+		}
+		droppedFiles[entry.File] = true
+		for _, queueRoot := range emptyQueueRoots {
+			if !allowEmptyRoots && emptyRootErr == nil && isWithinDir(queueRoot, entry.Path) {
+				emptyRootErr = fmt.Errorf("upload queue dir %s and its uploaded dir are empty, so pruning would drop the entries of all of their files; pass --allow-empty-roots if that is intended", queueRoot)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if emptyRootErr != nil {
+		return nil, emptyRootErr
+	}
+	dropped := make([]string, 0, len(droppedFiles))
+	for file := range droppedFiles {
+		dropped = append(dropped, file)
+	}
+	sort.Strings(dropped)
+	if dryRun || len(dropped) == 0 {
+		return dropped, nil
+	}
+	if err := ledger.rewrite(kept); err != nil {
+		return nil, err
+	}
+	for _, file := range dropped {
+		logger.Debug("Pruned upload ledger entries of missing file", slog.String("file", file))
+	}
+	return dropped, nil
+}
+
+// rewrite replaces the entries of the ledger with entries. The ledger is written with writeFileAtomic,
+// so that an interrupted rewrite doesn't lose entries.
+func (l *uploadLedger) rewrite(entries []uploadLedgerEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("failed to encode upload ledger entry: %w", err)
+		}
+	}
+	if err := writeFileAtomic(l.path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to rewrite upload ledger: %w", err)
+	}
+	return nil
+}
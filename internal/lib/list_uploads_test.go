@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListUploads(t *testing.T) {
+	cacheDir := t.TempDir()
+	ledger := newUploadLedger(getUploadLedgerPath(cacheDir))
+	may3 := time.Date(2024, 5, 3, 12, 0, 0, 0, time.Local)
+	may5 := time.Date(2024, 5, 5, 12, 0, 0, 0, time.Local)
+	require.NoError(t, ledger.record(context.Background(), "/queue/2024-05-03-a.jpg", 10, "id-a", "TRIP", []string{"Trips", "Camera"}, may3))
+	require.NoError(t, ledger.recordFailure(context.Background(), "/queue/2024-05-03-b.jpg", errors.New("upload rejected"), may3))
+	require.NoError(t, ledger.record(context.Background(), "/queue/2024-05-05-c.jpg", 20, "id-c", "", []string{"Camera"}, may5))
+	// Entries recorded by earlier versions only have the basename.
+	require.NoError(t, ledger.append(context.Background(), uploadLedgerEntry{File: "2024-05-01-old.jpg", MediaItemID: "id-old", UploadedAt: may3.UTC()}))
+
+	uploads, err := ListUploads(cacheDir, time.Time{}, time.Time{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []LedgerUpload{
+		{File: "2024-05-03-a.jpg", Path: "/queue/2024-05-03-a.jpg", Size: 10, MediaItemID: "id-a", Albums: []string{"Trips", "Camera"}, UploadedAt: may3.UTC(), Tag: "TRIP"},
+		{File: "2024-05-05-c.jpg", Path: "/queue/2024-05-05-c.jpg", Size: 20, MediaItemID: "id-c", Albums: []string{"Camera"}, UploadedAt: may5.UTC()},
+		{File: "2024-05-01-old.jpg", MediaItemID: "id-old", Albums: []string{}, UploadedAt: may3.UTC()},
+	}, uploads, "Failures shouldn't be listed")
+
+	date := func(day int) time.Time { return time.Date(2024, 5, day, 0, 0, 0, 0, time.UTC) }
+	uploads, err = ListUploads(cacheDir, date(4), time.Time{}, "")
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	assert.Equal(t, "id-c", uploads[0].MediaItemID)
+
+	uploads, err = ListUploads(cacheDir, date(3), date(3), "Camera")
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	assert.Equal(t, "id-a", uploads[0].MediaItemID)
+
+	uploads, err = ListUploads(cacheDir, time.Time{}, time.Time{}, "Missing")
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+
+	uploads, err = ListUploads(cacheDir, time.Time{}, time.Time{}, "Trips")
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, WriteUploadsJSON(&out, uploads))
+	var decoded []LedgerUpload
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, uploads, decoded)
+}
+
+func TestListUploads_NoLedger(t *testing.T) {
+	uploads, err := ListUploads(t.TempDir(), time.Time{}, time.Time{}, "")
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+	assert.NotNil(t, uploads, "The JSON output should be an empty list")
+}
+
+func TestPruneUploadLedger(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	cacheDir := t.TempDir()
+	ledger := newUploadLedger(getUploadLedgerPath(cacheDir))
+	now := time.Now()
+	uploadedPath := filepath.Join(cfg.PhotosUploadedRoot, "2024", "05", "03", "2024-05-03-uploaded.jpg")
+	createDummyFile(t, uploadedPath, "uploaded", now)
+	queuedPath := filepath.Join(cfg.VideosUploadQueueRoot, "2024-05-03-kept.mp4")
+	createDummyFile(t, queuedPath, "kept", now)
+	require.NoError(t, ledger.record(context.Background(), filepath.Join(cfg.LocalPhotos.GetUploadQueueRoot(), "2024-05-03-uploaded.jpg"), 8, "id-uploaded", "", nil, now))
+	require.NoError(t, ledger.record(context.Background(), queuedPath, 4, "id-kept", "", nil, now))
+	require.NoError(t, ledger.record(context.Background(), "/queue/2024-05-03-deleted.jpg", 7, "id-deleted", "", nil, now))
+	require.NoError(t, ledger.recordFailure(context.Background(), "/queue/2024-05-03-deleted.jpg", errors.New("upload rejected"), now))
+
+	pruned, err := PruneUploadLedger(cfg, cacheDir, false /* allowEmptyRoots */, true /* dryRun */)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2024-05-03-deleted.jpg"}, pruned)
+	uploads, err := ListUploads(cacheDir, time.Time{}, time.Time{}, "")
+	require.NoError(t, err)
+	assert.Len(t, uploads, 3, "A dry run shouldn't change the ledger")
+
+	pruned, err = PruneUploadLedger(cfg, cacheDir, false /* allowEmptyRoots */, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2024-05-03-deleted.jpg"}, pruned)
+	uploads, err = ListUploads(cacheDir, time.Time{}, time.Time{}, "")
+	require.NoError(t, err)
+	require.Len(t, uploads, 2)
+	assert.Equal(t, "id-uploaded", uploads[0].MediaItemID)
+	assert.Equal(t, "id-kept", uploads[1].MediaItemID)
+	failures, err := ledger.failures()
+	require.NoError(t, err)
+	assert.Empty(t, failures, "The failures of pruned files should be dropped too")
+
+	pruned, err = PruneUploadLedger(cfg, cacheDir, false /* allowEmptyRoots */, false)
+	require.NoError(t, err)
+	assert.Empty(t, pruned)
+}
+
+func TestPruneUploadLedger_MissingOrEmptyRoots(t *testing.T) {
+	now := time.Now()
+	newConfig := func(t *testing.T) (cfg config.CamflowConfig, cacheDir string) {
+		cfg = newTestConfig(t, "", "")
+		cacheDir = t.TempDir()
+		ledger := newUploadLedger(getUploadLedgerPath(cacheDir))
+		require.NoError(t, ledger.record(context.Background(), filepath.Join(cfg.LocalPhotos.GetUploadQueueRoot(), "2024-05-03-a.jpg"), 1, "id-a", "", nil, now))
+		require.NoError(t, ledger.record(context.Background(), filepath.Join(cfg.VideosUploadQueueRoot, "2024-05-03-b.mp4"), 1, "id-b", "", nil, now))
+		createDummyFile(t, filepath.Join(cfg.VideosUploadedRoot, "2024", "05", "03", "2024-05-03-b.mp4"), "b", now)
+		return cfg, cacheDir
+	}
+	ledgerFiles := func(t *testing.T, cacheDir string) []string {
+		uploads, err := ListUploads(cacheDir, time.Time{}, time.Time{}, "")
+		require.NoError(t, err)
+		var files []string
+		for _, upload := range uploads {
+			files = append(files, upload.File)
+		}
+		return files
+	}
+
+	t.Run("unmounted drive", func(t *testing.T) {
+		mountParentDir := t.TempDir()
+		origMountParentDirs := mountParentDirs
+		mountParentDirs = []string{mountParentDir}
+		defer func() { mountParentDirs = origMountParentDirs }()
+		cfg, cacheDir := newConfig(t)
+		cfg.PhotosUploadedRoot = filepath.Join(mountParentDir, "Photos Drive", "Uploaded")
+		cfg.LocalPhotos.UploadedRoot = cfg.PhotosUploadedRoot
+
+		_, err := PruneUploadLedger(cfg, cacheDir, true /* allowEmptyRoots */, false)
+		assert.ErrorContains(t, err, "is the drive connected?", "An unmounted drive should be refused even with allowEmptyRoots")
+		assert.Len(t, ledgerFiles(t, cacheDir), 2)
+	})
+
+	t.Run("missing root", func(t *testing.T) {
+		cfg, cacheDir := newConfig(t)
+		require.NoError(t, os.RemoveAll(cfg.PhotosUploadedRoot))
+
+		_, err := PruneUploadLedger(cfg, cacheDir, false /* allowEmptyRoots */, false)
+		assert.ErrorContains(t, err, "--allow-empty-roots")
+		assert.Len(t, ledgerFiles(t, cacheDir), 2)
+
+		pruned, err := PruneUploadLedger(cfg, cacheDir, true /* allowEmptyRoots */, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2024-05-03-a.jpg"}, pruned)
+		assert.Equal(t, []string{"2024-05-03-b.mp4"}, ledgerFiles(t, cacheDir))
+	})
+
+	t.Run("empty roots", func(t *testing.T) {
+		cfg, cacheDir := newConfig(t)
+
+		_, err := PruneUploadLedger(cfg, cacheDir, false /* allowEmptyRoots */, false)
+		assert.ErrorContains(t, err, "are empty")
+		assert.Len(t, ledgerFiles(t, cacheDir), 2)
+
+		pruned, err := PruneUploadLedger(cfg, cacheDir, true /* allowEmptyRoots */, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2024-05-03-a.jpg"}, pruned)
+	})
+}
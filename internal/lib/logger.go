@@ -1,12 +1,19 @@
 package lib
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 )
 
 var logger *slog.Logger
 
+// stderrHandler is the handler of the default logger, which writes to stderr.
+var stderrHandler slog.Handler
+
 func init() {
 	level := slog.LevelInfo
 	if os.Getenv("DEBUG") != "" {
@@ -16,5 +23,69 @@ func init() {
 	opts := &slog.HandlerOptions{
 		Level: level,
 	}
-	logger = slog.New(slog.NewTextHandler(os.Stderr, opts))
+	stderrHandler = slog.NewTextHandler(os.Stderr, opts)
+	logger = slog.New(stderrHandler)
+}
+
+// DebugLogPath returns the path of the debug log file in cacheDir.
+func DebugLogPath(cacheDir string) string {
+	return filepath.Join(cacheDir, "logs", "camflow-debug.log")
+}
+
+// EnableDebugLogFile makes the logger also write debug logs to the file at path, while stderr keeps
+// its level. The file is rotated when it would grow beyond maxSize bytes, keeping up to keep rotated files,
+// which are gzipped if compress.
+func EnableDebugLogFile(path string, maxSize int64, keep int, compress bool) error {
+	file, err := openRotatingFile(path, maxSize, keep, compress)
+	if err != nil {
+		return err
+	}
+	fileHandler := slog.NewTextHandler(file, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logger = slog.New(teeHandler{stderrHandler, fileHandler})
+	return nil
+}
+
+// SetLogAccountLabel adds label, which names the account that the run targets, to every later log record.
+func SetLogAccountLabel(label string) {
+	logger = logger.With(slog.String("account", label))
+}
+
+// teeHandler passes each record to each of its handlers that is enabled for the record's level.
+type teeHandler []slog.Handler
+
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, record.Level) {
+			if err := handler.Handle(ctx, record.Clone()); err != nil {
+				errs = append(errs, fmt.Errorf("failed to write log record: %w", err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
 }
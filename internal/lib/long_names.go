@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// maxNameBytes is the longest file name that common filesystems allow, eg APFS, ext4, and NTFS.
+const maxNameBytes = 255
+
+// maxPathBytes is the longest path that camflow creates. It is PATH_MAX on macOS, which is the lowest
+// of the OSes that camflow runs on.
+const maxPathBytes = 1024
+
+// tmpSuffixLen is the length of the ".tmp" suffix of the temporary files that files are copied to first,
+// which fitPath leaves room for.
+const tmpSuffixLen = len(".tmp")
+
+// nameHashLen is the number of hex digits of the hash of the full name that config.LongNamesHash
+// appends to shortened names.
+const nameHashLen = 12
+
+// fitPath returns path, with its file name shortened if the name or path is too long for the filesystem,
+// eg because of deep date dirs, a long original name, and the date prefix. The date prefix and extension
+// of the name are kept, and longNames selects how the rest of it is shortened: by config.LongNamesTruncate,
+// or otherwise by config.LongNamesHash.
+func fitPath(path, longNames string) (string, error) {
+	dir, name := filepath.Split(path)
+	maxLen := min(maxNameBytes, maxPathBytes-len(dir)) - tmpSuffixLen
+	if len(name) <= maxLen {
+		return path, nil
+	}
+
+	var prefix string
+	if len(name) >= len("2006-01-02-") {
+		if _, err := time.Parse("2006-01-02-", name[:len("2006-01-02-")]); err == nil {
+			prefix = name[:len("2006-01-02-")]
+		}
+	}
+	ext := filepath.Ext(name)
+	rest := name[len(prefix) : len(name)-len(ext)]
+	var suffix string
+	if longNames != config.LongNamesTruncate {
+		sum := sha256.Sum256([]byte(name))
+		suffix = "-" + hex.EncodeToString(sum[:])[:nameHashLen]
+	}
+	restLen := maxLen - len(prefix) - len(ext) - len(suffix)
+	if restLen < 1 {
+		return "", fmt.Errorf("path %s is too long for the filesystem, even with a shortened file name", path)
+	}
+	shortened := prefix + truncateUTF8(rest, restLen) + suffix + ext
+	logger.Warn("Shortened a file name that is too long for the filesystem",
+		slog.String("name", name),
+		slog.String("shortened_name", shortened),
+		slog.String("dir", dir))
+	return dir + shortened, nil
+}
+
+// truncateUTF8 returns the longest prefix of s that is at most n bytes, without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
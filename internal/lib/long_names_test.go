@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFitPath(t *testing.T) {
+	dir := filepath.Join("/photos", "2024", "05", "01")
+	longName := "2024-05-01-" + strings.Repeat("x", 300) + ".JPG"
+
+	t.Run("ShortUnchanged", func(t *testing.T) {
+		path := filepath.Join(dir, "2024-05-01-IMG_0001.JPG")
+		got, err := fitPath(path, config.LongNamesHash)
+		require.NoError(t, err)
+		assert.Equal(t, path, got)
+	})
+
+	t.Run("Hash", func(t *testing.T) {
+		got, err := fitPath(filepath.Join(dir, longName), config.LongNamesHash)
+		require.NoError(t, err)
+		assert.Equal(t, dir, filepath.Dir(got))
+		name := filepath.Base(got)
+		assert.Len(t, name, maxNameBytes-tmpSuffixLen, "There should be room for the temporary file's suffix")
+		assert.True(t, strings.HasPrefix(name, "2024-05-01-xxx"), name)
+		assert.Regexp(t, `-[0-9a-f]{12}\.JPG$`, name)
+
+		// Names that only differ after the truncation point stay different.
+		other, err := fitPath(filepath.Join(dir, "2024-05-01-"+strings.Repeat("x", 299)+"y.JPG"), config.LongNamesHash)
+		require.NoError(t, err)
+		assert.NotEqual(t, got, other)
+
+		// Shortened names fit, so they aren't shortened again.
+		again, err := fitPath(got, config.LongNamesHash)
+		require.NoError(t, err)
+		assert.Equal(t, got, again)
+	})
+
+	t.Run("Truncate", func(t *testing.T) {
+		got, err := fitPath(filepath.Join(dir, longName), config.LongNamesTruncate)
+		require.NoError(t, err)
+		assert.Equal(t, "2024-05-01-"+strings.Repeat("x", maxNameBytes-tmpSuffixLen-len("2024-05-01-.JPG"))+".JPG", filepath.Base(got))
+	})
+
+	t.Run("LongPath", func(t *testing.T) {
+		deepDir := "/" + strings.Repeat(strings.Repeat("d", 100)+"/", 9) + strings.Repeat("d", 60) + "/"
+		got, err := fitPath(deepDir+"2024-05-01-IMG_0001_with_a_long_description_of_the_shot.JPG", config.LongNamesHash)
+		require.NoError(t, err)
+		assert.Len(t, got, maxPathBytes-tmpSuffixLen)
+		assert.True(t, strings.HasPrefix(filepath.Base(got), "2024-05-01-"), got)
+	})
+
+	t.Run("DirTooLong", func(t *testing.T) {
+		deepDir := "/" + strings.Repeat(strings.Repeat("d", 100)+"/", 10)
+		_, err := fitPath(deepDir+"2024-05-01-IMG_0001.JPG", config.LongNamesHash)
+		assert.ErrorContains(t, err, "too long")
+	})
+
+	t.Run("MultibyteCharacters", func(t *testing.T) {
+		got, err := fitPath(filepath.Join(dir, "2024-05-01-"+strings.Repeat("é", 200)+".JPG"), config.LongNamesTruncate)
+		require.NoError(t, err)
+		assert.True(t, utf8.ValidString(got), "Characters shouldn't be split")
+		assert.LessOrEqual(t, len(filepath.Base(got)), maxNameBytes-tmpSuffixLen)
+	})
+}
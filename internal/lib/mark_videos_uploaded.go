@@ -20,13 +20,19 @@ func MarkVideosUploaded(ctx context.Context, cfg config.CamflowConfig, dryRun bo
 
 	uploadQueueDir := cfg.LocalVideos.GetUploadQueueRoot()
 	if _, err := os.Stat(uploadQueueDir); os.IsNotExist(err) {
+		if err := checkUploadQueueMounted(uploadQueueDir); err != nil {
+			return err
+		}
 		logger.Info("Upload queue directory does not exist, nothing to move",
 			slog.String("upload_queue_dir", uploadQueueDir))
 		return nil
 	}
+	if err := checkUploadedRoot(cfg.LocalVideos.GetUploadedRoot(), dryRun); err != nil {
+		return err
+	}
 
 	// List all files in upload queue, store path and size, calculate total size
-	itemsToMove, totalSize, err := scanUploadQueue(uploadQueueDir)
+	itemsToMove, totalSize, err := scanUploadQueue(uploadQueueDir, cfg.LocalVideos.GetSymlinks())
 	if err != nil {
 		return err
 	}
@@ -49,9 +55,15 @@ func MarkVideosUploaded(ctx context.Context, cfg config.CamflowConfig, dryRun bo
 	}()
 
 	for _, fileInfo := range itemsToMove {
-		if _, err := moveToUploaded(&cfg.LocalVideos, fileInfo, dryRun); err != nil {
+		destPath, err := moveToUploaded(&cfg.LocalVideos, fileInfo, cfg.Upload.MoveMode, cfg.Upload.KeepQueueStructure, dryRun)
+		if err != nil {
 			return fmt.Errorf("failed to move media item %s: %w", fileInfo.path, err)
 		}
+		if cfg.Upload.DayIndex && !dryRun {
+			if err := recordInDayIndex(destPath, fileInfo.size, ""); err != nil {
+				return err
+			}
+		}
 		bar.Add64(fileInfo.size)
 	}
 	_ = bar.Finish()
@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+const (
+	// mediaItemIDXattr is the extended attribute that records the media item that a file was uploaded as.
+	mediaItemIDXattr = "user.camflow.media_item_id"
+	// albumsXattr is the extended attribute that records the titles of the albums that the media item
+	// of a file was added to, as a JSON array.
+	albumsXattr = "user.camflow.albums"
+)
+
+// tagMediaItemXattrs records mediaItemID and albumTitles in extended attributes of the uploaded file
+// at path, so that the file links to its media item without the upload ledger. Filesystems without
+// extended attributes are skipped.
+func tagMediaItemXattrs(path, mediaItemID string, albumTitles []string) error {
+	if albumTitles == nil {
+		albumTitles = []string{}
+	}
+	albums, err := json.Marshal(albumTitles)
+	if err != nil {
+		return fmt.Errorf("failed to encode album titles of %s: %w", path, err)
+	}
+	for _, xattr := range []struct {
+		name  string
+		value []byte
+	}{
+		{mediaItemIDXattr, []byte(mediaItemID)},
+		{albumsXattr, albums},
+	} {
+		if err := setXattr(path, xattr.name, xattr.value); err != nil {
+			if errors.Is(err, errXattrsUnsupported) {
+				logger.Debug("Skipping tagging file with its media item, because its filesystem doesn't support extended attributes",
+					slog.String("path", path))
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// mediaItemXattr returns the media item ID recorded by tagMediaItemXattrs for the file at path,
+// or "" if there isn't one.
+func mediaItemXattr(path string) (string, error) {
+	value, ok, err := lookupXattr(path, mediaItemIDXattr)
+	if err != nil || !ok {
+		return "", err
+	}
+	return string(value), nil
+}
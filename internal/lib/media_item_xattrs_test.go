@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// skipWithoutXattrs skips the test if the filesystem of dir doesn't support extended attributes.
+func skipWithoutXattrs(t *testing.T, dir string) {
+	t.Helper()
+	probe := filepath.Join(dir, ".xattr-probe")
+	require.NoError(t, os.WriteFile(probe, nil, 0644))
+	defer os.Remove(probe)
+	if err := setXattr(probe, "user.camflow.probe", []byte("probe")); errors.Is(err, errXattrsUnsupported) {
+		t.Skip("Extended attributes are not supported here")
+	} else {
+		require.NoError(t, err)
+	}
+}
+
+func TestTagMediaItemXattrs(t *testing.T) {
+	dir := t.TempDir()
+	skipWithoutXattrs(t, dir)
+	path := filepath.Join(dir, "2024-01-28-photo.jpg")
+	require.NoError(t, os.WriteFile(path, []byte("photo"), 0644))
+
+	mediaItemID, err := mediaItemXattr(path)
+	require.NoError(t, err)
+	assert.Empty(t, mediaItemID, "An untagged file should have no media item")
+
+	require.NoError(t, tagMediaItemXattrs(path, "media-1", []string{"Trip", "Family"}))
+	mediaItemID, err = mediaItemXattr(path)
+	require.NoError(t, err)
+	assert.Equal(t, "media-1", mediaItemID)
+	albums, err := getXattr(path, albumsXattr)
+	require.NoError(t, err)
+	assert.JSONEq(t, `["Trip", "Family"]`, string(albums))
+
+	// Tagging again replaces the attributes.
+	require.NoError(t, tagMediaItemXattrs(path, "media-2", nil))
+	mediaItemID, err = mediaItemXattr(path)
+	require.NoError(t, err)
+	assert.Equal(t, "media-2", mediaItemID)
+	albums, err = getXattr(path, albumsXattr)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(albums))
+}
+
+func TestUploadVideos_MediaItemXattrs(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "Videos")
+	skipWithoutXattrs(t, cfg.VideosUploadedRoot)
+	cfg.Upload.MediaItemXattrs = true
+	createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{
+		"2024-01-28-video.mp4": "content",
+	})
+	name := "2024-01-28-video.mp4"
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{{ID: "album-id", Title: "Videos"}}, nil).AnyTimes()
+	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, name)).Return("token", nil)
+	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token", Filename: name}).
+		Return(&media_items.MediaItem{ID: "media-id", Filename: name}, nil)
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "album-id", []string{"media-id"}).Return(nil)
+
+	_, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+
+	uploadedPath := filepath.Join(cfg.VideosUploadedRoot, "2024", "01", "28", name)
+	mediaItemID, err := mediaItemXattr(uploadedPath)
+	require.NoError(t, err)
+	assert.Equal(t, "media-id", mediaItemID)
+	albums, err := getXattr(uploadedPath, albumsXattr)
+	require.NoError(t, err)
+	assert.JSONEq(t, `["Videos"]`, string(albums))
+}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// lastUploadedDate returns the latest date, as YYYY-MM-DD, of the YYYY/MM/DD dirs under uploadedRoot
+// that contain files, or "" if there are none, eg because nothing has been uploaded yet.
+func lastUploadedDate(uploadedRoot string) (string, error) {
+	years, err := datedSubdirs(uploadedRoot, 4)
+	if err != nil {
+		return "", err
+	}
+	// Check the dirs newest first, so that usually only the last day dir is read.
+	for _, year := range years {
+		months, err := datedSubdirs(filepath.Join(uploadedRoot, year), 2)
+		if err != nil {
+			return "", err
+		}
+		for _, month := range months {
+			days, err := datedSubdirs(filepath.Join(uploadedRoot, year, month), 2)
+			if err != nil {
+				return "", err
+			}
+			for _, day := range days {
+				entries, err := os.ReadDir(filepath.Join(uploadedRoot, year, month, day))
+				if err != nil {
+					return "", fmt.Errorf("failed to read uploaded dir: %w", err)
+				}
+				if len(entries) > 0 {
+					return year + "-" + month + "-" + day, nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// datedSubdirs returns the names of the subdirs of dir that are numbers of numDigits digits, newest first.
+// It returns nil if dir doesn't exist.
+func datedSubdirs(dir string, numDigits int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read uploaded dir: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() || len(entry.Name()) != numDigits {
+			continue
+		}
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// filterNewOnly returns the items whose date prefix is on or after lastDate, a YYYY-MM-DD date,
+// and the number of items that were filtered out. Files from lastDate are kept, because that day's
+// upload may have been partial. Items without a date prefix can't be compared, so they are filtered out.
+func filterNewOnly(items []itemFileInfo, lastDate string) ([]itemFileInfo, int) {
+	var keptItems []itemFileInfo
+	for _, item := range items {
+		year, month, day, err := parseDatePrefix(filepath.Base(item.path))
+		if err != nil {
+			logger.Debug("Skipping file without a date prefix", slog.String("path", item.path))
+			continue
+		}
+		if year+"-"+month+"-"+day < lastDate {
+			logger.Debug("Skipping file dated before the last uploaded date",
+				slog.String("path", item.path),
+				slog.String("last_uploaded_date", lastDate))
+			continue
+		}
+		keptItems = append(keptItems, item)
+	}
+	return keptItems, len(items) - len(keptItems)
+}
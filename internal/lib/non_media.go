@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// mediaExtensions maps the lowercase extensions of the photo and video files that Google Photos accepts to their types.
+var mediaExtensions = map[string]ItemType{
+	// Photos.
+	".jpg": ItemTypePhoto, ".jpeg": ItemTypePhoto, ".png": ItemTypePhoto, ".gif": ItemTypePhoto, ".webp": ItemTypePhoto,
+	".heic": ItemTypePhoto, ".heif": ItemTypePhoto, ".avif": ItemTypePhoto, ".bmp": ItemTypePhoto, ".tif": ItemTypePhoto,
+	".tiff": ItemTypePhoto, ".ico": ItemTypePhoto,
+	// RAW photos.
+	".cr2": ItemTypePhoto, ".cr3": ItemTypePhoto, ".crw": ItemTypePhoto, ".nef": ItemTypePhoto, ".nrw": ItemTypePhoto,
+	".arw": ItemTypePhoto, ".srf": ItemTypePhoto, ".sr2": ItemTypePhoto, ".dng": ItemTypePhoto, ".orf": ItemTypePhoto,
+	".raf": ItemTypePhoto, ".rw2": ItemTypePhoto, ".pef": ItemTypePhoto, ".srw": ItemTypePhoto, ".x3f": ItemTypePhoto,
+	".rwl": ItemTypePhoto, ".3fr": ItemTypePhoto, ".erf": ItemTypePhoto, ".kdc": ItemTypePhoto, ".mef": ItemTypePhoto,
+	".mos": ItemTypePhoto, ".mrw": ItemTypePhoto, ".raw": ItemTypePhoto,
+	// Videos.
+	".3gp": ItemTypeVideo, ".3g2": ItemTypeVideo, ".asf": ItemTypeVideo, ".avi": ItemTypeVideo, ".divx": ItemTypeVideo,
+	".m2t": ItemTypeVideo, ".m2ts": ItemTypeVideo, ".m4v": ItemTypeVideo, ".mkv": ItemTypeVideo, ".mmv": ItemTypeVideo,
+	".mod": ItemTypeVideo, ".mov": ItemTypeVideo, ".mp4": ItemTypeVideo, ".mpg": ItemTypeVideo, ".mpeg": ItemTypeVideo,
+	".mts": ItemTypeVideo, ".tod": ItemTypeVideo, ".wmv": ItemTypeVideo,
+}
+
+// isMediaFile returns whether the file at path has the extension of a photo or video that Google Photos accepts.
+func isMediaFile(path string) bool {
+	_, ok := mediaExtensions[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// splitNonMedia returns the items that are media files and, separately, the items that aren't.
+// Items in the rejected, oversized, and quarantine dirs of uploadQueueRoot are in neither.
+func splitNonMedia(items []itemFileInfo, uploadQueueRoot string) (media, nonMedia []itemFileInfo) {
+	rejectedDir := filepath.Join(uploadQueueRoot, config.RejectedDirName) + string(filepath.Separator)
+	oversizedDir := filepath.Join(uploadQueueRoot, config.OversizedDirName) + string(filepath.Separator)
+	quarantineDir := filepath.Join(uploadQueueRoot, config.QuarantineDirName) + string(filepath.Separator)
+	for _, item := range items {
+		switch {
+		case strings.HasPrefix(item.path, rejectedDir), strings.HasPrefix(item.path, oversizedDir), strings.HasPrefix(item.path, quarantineDir):
+		case isMediaFile(item.path):
+			media = append(media, item)
+		default:
+			nonMedia = append(nonMedia, item)
+		}
+	}
+	return media, nonMedia
+}
+
+// handleNonMedia warns about the non-media items and, with config.NonMediaReject, moves them to the
+// rejected dir of uploadQueueRoot, at the same path relative to it as they had in the upload queue.
+// moveMode is as for moveFile.
+func handleNonMedia(nonMedia []itemFileInfo, uploadQueueRoot, nonMediaMode, moveMode string, dryRun bool) error {
+	for _, item := range nonMedia {
+		logger.Warn("Skipping file that isn't a photo or video",
+			slog.String("path", item.path))
+	}
+	if nonMediaMode != config.NonMediaReject {
+		fmt.Printf("Leaving %d file(s) that aren't photos or videos in the upload queue\n", len(nonMedia))
+		return nil
+	}
+
+	rejectedDir := filepath.Join(uploadQueueRoot, config.RejectedDirName)
+	for _, item := range nonMedia {
+		relPath, err := filepath.Rel(uploadQueueRoot, item.path)
+		if err != nil {
+			return fmt.Errorf("failed to find the path of %s in the upload queue: %w", item.path, err)
+		}
+		destPath := filepath.Join(rejectedDir, relPath)
+		if dryRun {
+			logger.Debug("Would reject file",
+				slog.String("from", item.path),
+				slog.String("to", destPath))
+			continue
+		}
+		if err := moveFile(item.path, destPath, item.size, item.modTime, moveMode); err != nil {
+			return fmt.Errorf("failed to reject %s: %w", item.path, err)
+		}
+	}
+	actionVerb := "Moved"
+	if dryRun {
+		actionVerb = "Would have moved"
+	}
+	fmt.Printf("%s %d file(s) that aren't photos or videos to %s\n", actionVerb, len(nonMedia), rejectedDir)
+	return nil
+}
+
+// maxUploadSizes are the largest photo and video files, in bytes, that Google Photos accepts.
+var maxUploadSizes = map[ItemType]int64{
+	ItemTypePhoto: 200 << 20,
+	ItemTypeVideo: 20 << 30,
+}
+
+// splitOversized returns the items that Google Photos accepts the size of and, separately, the items
+// that are too large. Items must be media files.
+func splitOversized(items []itemFileInfo) (kept, oversized []itemFileInfo) {
+	for _, item := range items {
+		if maxSize, ok := maxUploadSizes[mediaExtensions[strings.ToLower(filepath.Ext(item.path))]]; ok && item.size > maxSize {
+			oversized = append(oversized, item)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept, oversized
+}
+
+// handleOversized reports the oversized items and, with config.OversizedMove, moves them to the oversized
+// dir of uploadQueueRoot, at the same path relative to it as they had in the upload queue.
+// moveMode is as for moveFile.
+func handleOversized(oversized []itemFileInfo, uploadQueueRoot, oversizedMode, moveMode string, dryRun bool) error {
+	for _, item := range oversized {
+		logger.Warn("Skipping file that is larger than Google Photos accepts",
+			slog.String("path", item.path),
+			slog.Int64("size", item.size))
+	}
+	if oversizedMode != config.OversizedMove {
+		fmt.Printf("Leaving %d file(s) larger than Google Photos accepts in the upload queue:\n", len(oversized))
+		for _, item := range oversized {
+			fmt.Printf("\t%s (%.1f GiB)\n", item.path, float64(item.size)/(1<<30))
+		}
+		return nil
+	}
+
+	oversizedDir := filepath.Join(uploadQueueRoot, config.OversizedDirName)
+	for _, item := range oversized {
+		relPath, err := filepath.Rel(uploadQueueRoot, item.path)
+		if err != nil {
+			return fmt.Errorf("failed to find the path of %s in the upload queue: %w", item.path, err)
+		}
+		destPath := filepath.Join(oversizedDir, relPath)
+		if dryRun {
+			logger.Debug("Would move oversized file",
+				slog.String("from", item.path),
+				slog.String("to", destPath))
+			continue
+		}
+		if err := moveFile(item.path, destPath, item.size, item.modTime, moveMode); err != nil {
+			return fmt.Errorf("failed to move oversized file %s: %w", item.path, err)
+		}
+	}
+	actionVerb := "Moved"
+	if dryRun {
+		actionVerb = "Would have moved"
+	}
+	fmt.Printf("%s %d file(s) larger than Google Photos accepts to %s\n", actionVerb, len(oversized), oversizedDir)
+	return nil
+}
@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitNonMedia(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "trip"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, config.RejectedDirName), 0755))
+	createTestFiles(t, root, map[string]string{
+		"2024-01-28-photo.JPG":        "photo",
+		"2024-01-28-photo.heic":       "heic",
+		"trip/2024-01-28-video.MOV":   "video",
+		"notes.txt":                   "notes",
+		".DS_Store":                   "finder",
+		"trip/2024-01-28-photo.xyz":   "unexpected",
+		"rejected/notes.txt":          "rejected earlier",
+		"rejected/2024-01-28-old.JPG": "rejected earlier",
+	})
+
+	items, _, err := scanUploadQueue(root, config.SymlinksSkip)
+	require.NoError(t, err)
+	media, nonMedia := splitNonMedia(items, root)
+
+	var mediaPaths, nonMediaPaths []string
+	for _, item := range media {
+		mediaPaths = append(mediaPaths, item.path)
+	}
+	for _, item := range nonMedia {
+		nonMediaPaths = append(nonMediaPaths, item.path)
+	}
+	assert.ElementsMatch(t, []string{
+		filepath.Join(root, "2024-01-28-photo.JPG"),
+		filepath.Join(root, "2024-01-28-photo.heic"),
+		filepath.Join(root, "trip/2024-01-28-video.MOV"),
+	}, mediaPaths)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(root, "notes.txt"),
+		filepath.Join(root, "trip/2024-01-28-photo.xyz"),
+	}, nonMediaPaths, ".DS_Store and the rejected dir should be ignored")
+}
+
+func TestUploadVideos_NonMedia(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		nonMedia  string
+		wantMoved bool
+	}{
+		{"Skip", config.NonMediaSkip, false},
+		{"Reject", config.NonMediaReject, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := newTestConfig(t, "", "")
+			cfg.Upload.NonMedia = tt.nonMedia
+			queue := cfg.VideosUploadQueueRoot
+			require.NoError(t, os.MkdirAll(filepath.Join(queue, "trip"), 0755))
+			createTestFiles(t, queue, map[string]string{
+				"2024-01-28-video.mp4":   "video",
+				"notes.txt":              "notes",
+				".DS_Store":              "finder",
+				"trip/2024-01-28-clip.x": "unexpected",
+			})
+			videoPath := filepath.Join(queue, "2024-01-28-video.mp4")
+
+			ctrl := gomock.NewController(t)
+			mockGPhotosClient := NewMockGPhotosClient(ctrl)
+			mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+			mockUploaderSvc := NewMockMediaUploader(ctrl)
+			mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+			mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+			mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+			mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+			mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{}, nil).AnyTimes()
+
+			// Only the video is uploaded.
+			mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), videoPath).Return("token", nil)
+			mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token", Filename: "2024-01-28-video.mp4"}).
+				Return(&media_items.MediaItem{ID: "media_id", Filename: "2024-01-28-video.mp4"}, nil)
+
+			report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+			require.NoError(t, err)
+			require.Len(t, report.UploadedItems, 1)
+			assert.Equal(t, videoPath, report.UploadedItems[0].Path)
+
+			_, err = os.Stat(filepath.Join(queue, ".DS_Store"))
+			assert.NoError(t, err, ".DS_Store should be left alone")
+			for _, relPath := range []string{"notes.txt", "trip/2024-01-28-clip.x"} {
+				_, queuedErr := os.Stat(filepath.Join(queue, relPath))
+				_, rejectedErr := os.Stat(filepath.Join(queue, config.RejectedDirName, relPath))
+				if tt.wantMoved {
+					assert.True(t, os.IsNotExist(queuedErr), "%s should be moved out of the upload queue", relPath)
+					assert.NoError(t, rejectedErr, "%s should be moved to the rejected dir", relPath)
+				} else {
+					assert.NoError(t, queuedErr, "%s should stay in the upload queue", relPath)
+					assert.True(t, os.IsNotExist(rejectedErr), "%s shouldn't be rejected", relPath)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadVideos_Oversized(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		oversized string
+		wantMoved bool
+	}{
+		{"Skip", config.OversizedSkip, false},
+		{"Move", config.OversizedMove, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := newTestConfig(t, "", "")
+			cfg.Upload.Oversized = tt.oversized
+			queue := cfg.VideosUploadQueueRoot
+			require.NoError(t, os.MkdirAll(filepath.Join(queue, "trip"), 0755))
+			createTestFiles(t, queue, map[string]string{"2024-01-28-video.mp4": "video"})
+			// The oversized video is sparse, so it doesn't take up its size on disk.
+			oversizedRelPath := "trip/2024-01-28-long.mp4"
+			require.NoError(t, os.WriteFile(filepath.Join(queue, oversizedRelPath), nil, 0644))
+			require.NoError(t, os.Truncate(filepath.Join(queue, oversizedRelPath), maxUploadSizes[ItemTypeVideo]+1))
+			videoPath := filepath.Join(queue, "2024-01-28-video.mp4")
+
+			ctrl := gomock.NewController(t)
+			mockGPhotosClient := NewMockGPhotosClient(ctrl)
+			mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+			mockUploaderSvc := NewMockMediaUploader(ctrl)
+			mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+			mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+			mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+			mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+			mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{}, nil).AnyTimes()
+
+			// Only the video that fits is uploaded, and the run doesn't stop at the oversized one.
+			mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), videoPath).Return("token", nil)
+			mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token", Filename: "2024-01-28-video.mp4"}).
+				Return(&media_items.MediaItem{ID: "media_id", Filename: "2024-01-28-video.mp4"}, nil)
+
+			report, err := UploadVideos(ctx, cfg, t.TempDir(), true /* keepQueued */, mockGPhotosClient, false)
+			require.NoError(t, err)
+			require.Len(t, report.UploadedItems, 1)
+			assert.Equal(t, videoPath, report.UploadedItems[0].Path)
+
+			_, queuedErr := os.Stat(filepath.Join(queue, oversizedRelPath))
+			_, movedErr := os.Stat(filepath.Join(queue, config.OversizedDirName, oversizedRelPath))
+			if tt.wantMoved {
+				assert.True(t, os.IsNotExist(queuedErr), "The oversized video should be moved out of the upload queue")
+				assert.NoError(t, movedErr, "The oversized video should be moved to the oversized dir")
+			} else {
+				assert.NoError(t, queuedErr, "The oversized video should stay in the upload queue")
+				assert.True(t, os.IsNotExist(movedErr))
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+//go:generate go run github.com/golang/mock/mockgen -source=${GOFILE} -destination=zz_generated_notify_mocks_test.go -package=lib Notifier
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// notifyTimeout limits how long each notification can take, so that a hung target doesn't hold up the run.
+const notifyTimeout = 30 * time.Second
+
+// Notifier sends a notification that a run finished.
+type Notifier interface {
+	Notify(ctx context.Context, report RunReport) error
+}
+
+// NewNotifiers returns the notifiers configured by cfg.
+func NewNotifiers(cfg config.NotificationsConfig) []Notifier {
+	var notifiers []Notifier
+	if cfg.Command != "" {
+		notifiers = append(notifiers, &commandNotifier{command: cfg.Command})
+	}
+	if cfg.WebhookURL != "" {
+		notifiers = append(notifiers, &webhookNotifier{url: cfg.WebhookURL, client: http.DefaultClient})
+	}
+	return notifiers
+}
+
+// Notify sends report to each of notifiers. A failing notifier doesn't stop the others; the errors are
+// returned together.
+func Notify(ctx context.Context, notifiers []Notifier, report RunReport) error {
+	var errs []error
+	for _, notifier := range notifiers {
+		notifyCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		if err := notifier.Notify(notifyCtx, report); err != nil {
+			errs = append(errs, err)
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// commandNotifier runs a shell command, with the JSON run report on its stdin.
+// The command's environment also has CAMFLOW_RUN_STATUS set to "success" or "failure".
+type commandNotifier struct {
+	command string
+}
+
+func (n *commandNotifier) Notify(ctx context.Context, report RunReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode run report: %w", err)
+	}
+	status := "success"
+	if report.Error != "" {
+		status = "failure"
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", n.command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(), "CAMFLOW_RUN_STATUS="+status)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notification command %q failed: %s: %w", n.command, bytes.TrimSpace(output), err)
+	}
+	return nil
+}
+
+// webhookNotifier POSTs the JSON run report to a URL.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, report RunReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode run report: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request to %s: %w", n.url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification to %s: %w", n.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("notification webhook %s returned %s: %s", n.url, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRunReport(err error) RunReport {
+	startedAt := time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC)
+	return NewUploadRunReport("upload-photos", startedAt, startedAt.Add(time.Hour), false,
+		UploadReport{UploadedItems: []UploadedItem{{Path: "/queue/2024-05-01-IMG_0001.JPG", AlbumTitles: []string{"Camflow"}}}}, err)
+}
+
+func TestNewNotifiers(t *testing.T) {
+	assert.Empty(t, NewNotifiers(config.NotificationsConfig{}))
+	assert.Len(t, NewNotifiers(config.NotificationsConfig{Command: "true", WebhookURL: "https://example.com/"}), 2)
+}
+
+func TestNotify_AllNotifiersAreCalled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	report := testRunReport(nil)
+	failing := NewMockNotifier(ctrl)
+	failing.EXPECT().Notify(gomock.Any(), report).Return(errors.New("simulated failure"))
+	ok := NewMockNotifier(ctrl)
+	ok.EXPECT().Notify(gomock.Any(), report).Return(nil)
+
+	err := Notify(context.Background(), []Notifier{failing, ok}, report)
+	assert.ErrorContains(t, err, "simulated failure", "A failing notifier shouldn't stop the others")
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got RunReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer server.Close()
+
+	notifier := &webhookNotifier{url: server.URL, client: server.Client()}
+	require.NoError(t, notifier.Notify(context.Background(), testRunReport(errors.New("upload failed"))))
+	assert.Equal(t, "upload-photos", got.Command)
+	assert.Equal(t, "upload failed", got.Error)
+	require.NotNil(t, got.Upload)
+	assert.Equal(t, 1, got.Upload.UploadedCount)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such hook", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	notifier = &webhookNotifier{url: failing.URL, client: failing.Client()}
+	assert.ErrorContains(t, notifier.Notify(context.Background(), testRunReport(nil)), "404 Not Found: no such hook")
+}
+
+func TestCommandNotifier(t *testing.T) {
+	dir := t.TempDir()
+	reportPath := filepath.Join(dir, "report.json")
+	statusPath := filepath.Join(dir, "status")
+	notifier := &commandNotifier{command: `cat > "` + reportPath + `"; printf %s "$CAMFLOW_RUN_STATUS" > "` + statusPath + `"`}
+
+	require.NoError(t, notifier.Notify(context.Background(), testRunReport(errors.New("upload failed"))))
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	var got RunReport
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "upload failed", got.Error)
+	status, err := os.ReadFile(statusPath)
+	require.NoError(t, err)
+	assert.Equal(t, "failure", string(status))
+
+	notifier = &commandNotifier{command: "echo oops >&2; exit 3"}
+	assert.ErrorContains(t, notifier.Notify(context.Background(), testRunReport(nil)), "oops")
+}
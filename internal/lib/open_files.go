@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"golang.org/x/sync/semaphore"
+)
+
+// openFileLimiter bounds the number of files that concurrent work has open at once.
+type openFileLimiter struct {
+	max   int64
+	sem   *semaphore.Weighted
+	inUse atomic.Int64
+}
+
+// newOpenFileLimiter returns a limiter of max open files.
+func newOpenFileLimiter(max int) *openFileLimiter {
+	return &openFileLimiter{max: int64(max), sem: semaphore.NewWeighted(int64(max))}
+}
+
+// acquire blocks until n more files can be opened, and returns a func that releases them.
+// More files than the limit are counted as the limit, so that they can still be opened one at a time.
+func (l *openFileLimiter) acquire(n int) func() {
+	weight := min(int64(n), l.max)
+	// Acquire only fails if its context is done.
+	_ = l.sem.Acquire(context.Background(), weight)
+	l.inUse.Add(weight)
+	return func() {
+		l.inUse.Add(-weight)
+		l.sem.Release(weight)
+	}
+}
+
+// openFiles bounds the files that copies, hashing, validation, and uploads have open, across all of them.
+var openFiles = newOpenFileLimiter(config.DefaultMaxOpenFiles)
+
+// SetMaxOpenFiles sets the most files that camflow's concurrent work opens at once, per max_open_files.
+// It must be called before any of that work starts.
+func SetMaxOpenFiles(max int) error {
+	if max < 1 {
+		return fmt.Errorf("invalid max open files %d: must be at least 1", max)
+	}
+	openFiles = newOpenFileLimiter(max)
+	return nil
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenFileLimiter(t *testing.T) {
+	oldOpenFiles := openFiles
+	t.Cleanup(func() { openFiles = oldOpenFiles })
+	const maxOpen = 4
+	require.NoError(t, SetMaxOpenFiles(maxOpen))
+	assert.Error(t, SetMaxOpenFiles(0))
+
+	// Watch the open files while many copies and hashes run at once.
+	var maxInUse atomic.Int64
+	done := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		for {
+			if inUse := openFiles.inUse.Load(); inUse > maxInUse.Load() {
+				maxInUse.Store(inUse)
+			}
+			select {
+			case <-done:
+				return
+			default:
+				time.Sleep(10 * time.Microsecond)
+			}
+		}
+	}()
+
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := range 50 {
+		src := filepath.Join(dir, fmt.Sprintf("src-%d", i))
+		content := fmt.Sprintf("content %d", i)
+		require.NoError(t, os.WriteFile(src, []byte(content), 0644))
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- copyFile(src, filepath.Join(dir, fmt.Sprintf("dst-%d", i)), int64(len(content)), time.Now(), 0, nil)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := sameFileContent(src, src)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-watched
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.LessOrEqual(t, maxInUse.Load(), int64(maxOpen))
+	assert.Zero(t, openFiles.inUse.Load(), "All of the files should be released")
+
+	// Operations that need more files than the limit still run.
+	require.NoError(t, SetMaxOpenFiles(1))
+	require.NoError(t, copyFile(filepath.Join(dir, "src-0"), filepath.Join(dir, "dst-big"), int64(len("content 0")), time.Now(), 0, nil))
+}
@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// pathAlbumSeparator joins the dirs of a file's path in the upload queue into an album title.
+const pathAlbumSeparator = " / "
+
+// pathAlbumTitle returns the title of the album for the file at filePath, from the first depth dirs
+// of its path under uploadQueueRoot, joined with pathAlbumSeparator, eg "trip / day1".
+// Files in fewer dirs use the dirs they are in. It returns "" if depth is 0
+// or the file is directly in uploadQueueRoot.
+func pathAlbumTitle(uploadQueueRoot, filePath string, depth int) (string, error) {
+	if depth <= 0 {
+		return "", nil
+	}
+	relPath, err := filepath.Rel(uploadQueueRoot, filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get path of %s relative to upload queue dir %s: %w", filePath, uploadQueueRoot, err)
+	}
+	relDir := filepath.Dir(relPath)
+	if relDir == "." {
+		return "", nil
+	}
+	dirs := strings.Split(relDir, string(filepath.Separator))
+	return strings.Join(dirs[:min(depth, len(dirs))], pathAlbumSeparator), nil
+}
@@ -0,0 +1,34 @@
+package lib
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathAlbumTitle(t *testing.T) {
+	queueRoot := filepath.Join("queue", "videos")
+	nestedPath := filepath.Join(queueRoot, "trip", "day1", "morning", "clip.mp4")
+
+	for _, tt := range []struct {
+		name     string
+		filePath string
+		depth    int
+		want     string
+	}{
+		{name: "Off", filePath: nestedPath, depth: 0, want: ""},
+		{name: "FirstDir", filePath: nestedPath, depth: 1, want: "trip"},
+		{name: "FirstTwoDirs", filePath: nestedPath, depth: 2, want: "trip / day1"},
+		{name: "AllDirs", filePath: nestedPath, depth: 3, want: "trip / day1 / morning"},
+		{name: "DeeperThanPath", filePath: filepath.Join(queueRoot, "trip", "clip.mp4"), depth: 3, want: "trip"},
+		{name: "QueueRoot", filePath: filepath.Join(queueRoot, "clip.mp4"), depth: 2, want: ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pathAlbumTitle(queueRoot, tt.filePath, tt.depth)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// pendingCommitFile is a file in the upload queue, with its size and modification time when it was uploaded,
+// so that a file that changed since can be told apart.
+type pendingCommitFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// pendingCommit is a file that was uploaded with upload.defer_commit, which is left in the upload queue
+// until commit-uploads moves it to the uploaded dir.
+type pendingCommit struct {
+	pendingCommitFile
+	MediaItemID string `json:"media_item_id"`
+	// AlbumTitles are the albums that the media item was added to.
+	AlbumTitles []string `json:"album_titles,omitempty"`
+	// UploadedDate is as for itemFileInfo.
+	UploadedDate string `json:"uploaded_date,omitempty"`
+	// Companions are as for itemFileInfo.
+	Companions []pendingCommitFile `json:"companions,omitempty"`
+}
+
+// itemFileInfo returns the file of c as it was uploaded.
+func (c pendingCommit) itemFileInfo() itemFileInfo {
+	item := c.pendingCommitFile.itemFileInfo()
+	item.uploadedDate = c.UploadedDate
+	for _, companion := range c.Companions {
+		item.companions = append(item.companions, companion.itemFileInfo())
+	}
+	return item
+}
+
+func (f pendingCommitFile) itemFileInfo() itemFileInfo {
+	return itemFileInfo{path: f.Path, size: f.Size, modTime: f.ModTime}
+}
+
+// unchanged returns whether the file still has the size and modification time that it was uploaded with.
+func (f pendingCommitFile) unchanged() (bool, error) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return false, err
+	}
+	return info.Size() == f.Size && info.ModTime().Equal(f.ModTime), nil
+}
+
+// pendingCommits records the uploaded files that are waiting for commit-uploads.
+// It is saved after each change, so that an interrupted upload doesn't lose track of the files it uploaded.
+type pendingCommits struct {
+	path string
+	mu   sync.Mutex
+	// Queues maps the root of each upload queue to the pending files in it.
+	Queues map[string][]pendingCommit `json:"queues"`
+}
+
+// getPendingCommitsPath constructs the path to the pending commits file.
+func getPendingCommitsPath(cacheDir string) string {
+	return filepath.Join(cacheDir, "pending_commits.json")
+}
+
+// loadPendingCommits loads the pending commits at path. It returns an empty record if the file doesn't exist.
+func loadPendingCommits(path string) (*pendingCommits, error) {
+	pending := &pendingCommits{path: path, Queues: make(map[string][]pendingCommit)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return pending, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending commits %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, pending); err != nil {
+		return nil, fmt.Errorf("failed to parse pending commits %s: %w", path, err)
+	}
+	if pending.Queues == nil {
+		pending.Queues = make(map[string][]pendingCommit)
+	}
+	return pending, nil
+}
+
+// save writes the pending commits to their file. The caller must hold p.mu.
+// It is written with writeFileAtomic, so that an interrupted save doesn't leave a partial file.
+func (p *pendingCommits) save() error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode pending commits: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for pending commits %s: %w", p.path, err)
+	}
+	if err := writeFileAtomic(p.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to save pending commits: %w", err)
+	}
+	return nil
+}
+
+// add records that the file of fileInfo, in the upload queue at queueRoot, was uploaded as mediaItemID
+// and added to albumTitles, replacing any earlier record of the file.
+func (p *pendingCommits) add(queueRoot string, fileInfo itemFileInfo, mediaItemID string, albumTitles []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry := pendingCommit{
+		pendingCommitFile: pendingCommitFile{Path: fileInfo.path, Size: fileInfo.size, ModTime: fileInfo.modTime},
+		MediaItemID:       mediaItemID,
+		AlbumTitles:       albumTitles,
+		UploadedDate:      fileInfo.uploadedDate,
+	}
+	for _, companion := range fileInfo.companions {
+		entry.Companions = append(entry.Companions, pendingCommitFile{Path: companion.path, Size: companion.size, ModTime: companion.modTime})
+	}
+	entries := p.Queues[queueRoot]
+	for i := range entries {
+		if entries[i].Path == entry.Path {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	p.Queues[queueRoot] = append(entries, entry)
+	return p.save()
+}
+
+// filterPending returns the items that aren't waiting for commit-uploads in the upload queue at queueRoot,
+// and the number of items that are. Items that changed since they were uploaded aren't waiting.
+func (p *pendingCommits) filterPending(queueRoot string, items []itemFileInfo) ([]itemFileInfo, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pendingFiles := make(map[string]pendingCommitFile, len(p.Queues[queueRoot]))
+	for _, entry := range p.Queues[queueRoot] {
+		pendingFiles[entry.Path] = entry.pendingCommitFile
+	}
+	var keptItems []itemFileInfo
+	for _, item := range items {
+		if f, ok := pendingFiles[item.path]; ok && f.Size == item.size && f.ModTime.Equal(item.modTime) {
+			logger.Debug("Skipping file waiting for commit-uploads", slog.String("path", item.path))
+			continue
+		}
+		keptItems = append(keptItems, item)
+	}
+	return keptItems, len(items) - len(keptItems)
+}
+
+// CommitUploadsResult describes the outcome of CommitUploads.
+type CommitUploadsResult struct {
+	// CommittedPaths are the files that were (or, in a dry run, would have been) moved to the uploaded dirs.
+	CommittedPaths []string
+	// DroppedPaths are the files, including companions, that were removed or changed since they were uploaded,
+	// and so were dropped from the pending commits. Changed files stay in the upload queue to be uploaded again.
+	DroppedPaths []string
+}
+
+// CommitUploads moves the files that were uploaded with upload.defer_commit, and so left in the upload queues,
+// to the uploaded dirs, as uploading them would have without upload.defer_commit. It is meant to be run
+// after checking the uploads in Google Photos.
+func CommitUploads(cfg config.CamflowConfig, cacheDir string, dryRun bool) (CommitUploadsResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return CommitUploadsResult{}, fmt.Errorf("invalid config: %w", err)
+	}
+	pending, err := loadPendingCommits(getPendingCommitsPath(cacheDir))
+	if err != nil {
+		return CommitUploadsResult{}, err
+	}
+
+	var result CommitUploadsResult
+	for _, localConfig := range []LocalConfig{&cfg.LocalPhotos, &cfg.LocalVideos} {
+		if err := commitQueueUploads(pending, localConfig, cfg.Upload, &result, dryRun); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// commitQueueUploads moves the pending files of the upload queue of localConfig to its uploaded dir,
+// and adds them to result. Each file is removed from pending once it is handled.
+func commitQueueUploads(pending *pendingCommits, localConfig LocalConfig, uploadConfig config.UploadConfig, result *CommitUploadsResult, dryRun bool) error {
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+
+	queueRoot := localConfig.GetUploadQueueRoot()
+	entries := pending.Queues[queueRoot]
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := checkUploadedRoot(localConfig.GetUploadedRoot(), dryRun); err != nil {
+		return err
+	}
+	for len(entries) > 0 {
+		entry := entries[0]
+		unchanged, err := entry.unchanged()
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to check %s: %w", entry.Path, err)
+		}
+		if !unchanged {
+			logger.Warn("Dropping file that was removed or changed since it was uploaded",
+				slog.String("path", entry.Path))
+			result.DroppedPaths = append(result.DroppedPaths, entry.Path)
+		} else {
+			// The companions weren't uploaded, so a changed one is left in the queue without holding back the rest.
+			var companions []pendingCommitFile
+			for _, companion := range entry.Companions {
+				unchanged, err := companion.unchanged()
+				if err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("failed to check %s: %w", companion.Path, err)
+				}
+				if !unchanged {
+					logger.Warn("Dropping companion file that was removed or changed since its file was uploaded",
+						slog.String("path", companion.Path),
+						slog.String("uploaded_path", entry.Path))
+					result.DroppedPaths = append(result.DroppedPaths, companion.Path)
+					continue
+				}
+				companions = append(companions, companion)
+			}
+			entry.Companions = companions
+			if err := moveUploadedFiles(localConfig, uploadConfig, entry.itemFileInfo(), entry.MediaItemID, entry.AlbumTitles, dryRun); err != nil {
+				return err
+			}
+			result.CommittedPaths = append(result.CommittedPaths, entry.Path)
+		}
+		entries = entries[1:]
+		if dryRun {
+			continue
+		}
+		if len(entries) == 0 {
+			delete(pending.Queues, queueRoot)
+		} else {
+			pending.Queues[queueRoot] = entries
+		}
+		if err := pending.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
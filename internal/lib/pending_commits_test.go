@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadVideos_DeferCommit(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "")
+	cfg.Upload.DeferCommit = true
+	cfg.Upload.DayIndex = true
+	cacheDir := t.TempDir()
+	names := []string{"2024-01-28-video1.mp4", "2024-01-28-video2.mp4"}
+	createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{
+		names[0]: "content1",
+		names[1]: "content2",
+	})
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{}, nil).AnyTimes()
+	// Each file is only uploaded once, by the first upload.
+	for _, name := range names {
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, name)).Return("token_for_"+name, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + name, Filename: name}).
+			Return(&media_items.MediaItem{ID: "media_id_for_" + name, Filename: name}, nil)
+	}
+
+	report, err := UploadVideos(ctx, cfg, cacheDir, false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	assert.Len(t, report.UploadedItems, 2)
+	for _, name := range names {
+		assert.FileExists(t, filepath.Join(cfg.VideosUploadQueueRoot, name), "Uploaded files should wait in the upload queue")
+	}
+
+	// The files that are waiting aren't uploaded again.
+	report, err = UploadVideos(ctx, cfg, cacheDir, false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	assert.Empty(t, report.UploadedItems)
+
+	// A file that changed after it was uploaded is dropped, and stays in the queue to be uploaded again.
+	changedPath := filepath.Join(cfg.VideosUploadQueueRoot, names[1])
+	require.NoError(t, os.WriteFile(changedPath, []byte("content2, edited"), 0644))
+
+	res, err := CommitUploads(cfg, cacheDir, true /* dryRun */)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(cfg.VideosUploadQueueRoot, names[0])}, res.CommittedPaths)
+	assert.FileExists(t, filepath.Join(cfg.VideosUploadQueueRoot, names[0]), "A dry run shouldn't move files")
+
+	res, err = CommitUploads(cfg, cacheDir, false)
+	require.NoError(t, err)
+	assert.Equal(t, CommitUploadsResult{
+		CommittedPaths: []string{filepath.Join(cfg.VideosUploadQueueRoot, names[0])},
+		DroppedPaths:   []string{changedPath},
+	}, res)
+	assert.NoFileExists(t, filepath.Join(cfg.VideosUploadQueueRoot, names[0]))
+	assert.FileExists(t, changedPath)
+	index, err := readDayIndex(filepath.Join(cfg.VideosUploadedRoot, "2024", "01", "28"))
+	require.NoError(t, err)
+	assert.Equal(t, []dayIndexEntry{
+		{File: names[0], Size: int64(len("content1")), MediaItemID: "media_id_for_" + names[0]},
+	}, index.Files)
+
+	// Nothing is left to commit.
+	res, err = CommitUploads(cfg, cacheDir, false)
+	require.NoError(t, err)
+	assert.Empty(t, res.CommittedPaths)
+	assert.Empty(t, res.DroppedPaths)
+}
+
+func TestCommitUploads_Companions(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	cacheDir := t.TempDir()
+	queueRoot := cfg.LocalPhotos.GetUploadQueueRoot()
+	createTestFiles(t, queueRoot, map[string]string{
+		"2024-01-28-IMG_0001.JPG": "jpeg",
+		"2024-01-28-IMG_0001.CR3": "raw",
+		"2024-01-28-IMG_0001.XMP": "sidecar",
+	})
+	fileInfo := func(name string) itemFileInfo {
+		path := filepath.Join(queueRoot, name)
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		return itemFileInfo{path: path, size: info.Size(), modTime: info.ModTime()}
+	}
+	item := fileInfo("2024-01-28-IMG_0001.JPG")
+	item.companions = []itemFileInfo{fileInfo("2024-01-28-IMG_0001.CR3"), fileInfo("2024-01-28-IMG_0001.XMP")}
+	pending, err := loadPendingCommits(getPendingCommitsPath(cacheDir))
+	require.NoError(t, err)
+	require.NoError(t, pending.add(queueRoot, item, "media-1", nil))
+
+	// A companion that was removed after the upload doesn't hold back the file and its other companions.
+	removedPath := filepath.Join(queueRoot, "2024-01-28-IMG_0001.XMP")
+	require.NoError(t, os.Remove(removedPath))
+
+	res, err := CommitUploads(cfg, cacheDir, false)
+	require.NoError(t, err)
+	assert.Equal(t, CommitUploadsResult{
+		CommittedPaths: []string{item.path},
+		DroppedPaths:   []string{removedPath},
+	}, res)
+	uploadedDir := filepath.Join(cfg.PhotosUploadedRoot, "2024", "01", "28")
+	assert.FileExists(t, filepath.Join(uploadedDir, "2024-01-28-IMG_0001.JPG"))
+	assert.FileExists(t, filepath.Join(uploadedDir, "2024-01-28-IMG_0001.CR3"))
+}
@@ -0,0 +1,332 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Register the JPEG decoder for image.Decode.
+	"log/slog"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errUnsupportedHashFormat is returned by a PerceptualHasher for files it can't decode.
+var errUnsupportedHashFormat = errors.New("unsupported format for perceptual hashing")
+
+// PerceptualHasher computes a perceptual hash of an image file.
+// Similar looking images have hashes with a small Hamming distance.
+type PerceptualHasher interface {
+	Hash(path string) (uint64, error)
+}
+
+// dctHasher is a PerceptualHasher implementing the DCT-based pHash algorithm.
+// It supports the formats that the image package can decode (ie, JPEG).
+type dctHasher struct{}
+
+const (
+	phashSampleSize = 32 // Images are reduced to phashSampleSize x phashSampleSize before the DCT.
+	phashLowFreq    = 8  // The hash uses the phashLowFreq x phashLowFreq lowest frequencies after the first.
+)
+
+// Hash returns the pHash of the image at path.
+func (dctHasher) Hash(path string) (uint64, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+	default:
+		return 0, errUnsupportedHashFormat
+	}
+
+	defer openFiles.acquire(1)()
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return phashImage(img), nil
+}
+
+// phashImage computes the pHash of img.
+func phashImage(img image.Image) uint64 {
+	// Reduce to a small grayscale image by averaging the pixels in each cell.
+	var gray [phashSampleSize][phashSampleSize]float64
+	var counts [phashSampleSize][phashSampleSize]int
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return 0
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cy := (y - b.Min.Y) * phashSampleSize / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cx := (x - b.Min.X) * phashSampleSize / b.Dx()
+			r, g, bl, _ := img.At(x, y).RGBA()
+			gray[cy][cx] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+			counts[cy][cx]++
+		}
+	}
+	for y := range gray {
+		for x := range gray[y] {
+			if counts[y][x] > 0 {
+				gray[y][x] /= float64(counts[y][x])
+			}
+		}
+	}
+
+	// Take the low frequencies of the 2D DCT-II, skipping the first row and column, as pHash does.
+	// They include the DC term, which only reflects the overall brightness.
+	var cosines [phashLowFreq + 1][phashSampleSize]float64
+	for u := 0; u <= phashLowFreq; u++ {
+		for x := 0; x < phashSampleSize; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSampleSize))
+		}
+	}
+	var coeffs []float64
+	for v := 1; v <= phashLowFreq; v++ {
+		for u := 1; u <= phashLowFreq; u++ {
+			var sum float64
+			for y := 0; y < phashSampleSize; y++ {
+				for x := 0; x < phashSampleSize; x++ {
+					sum += gray[y][x] * cosines[u][x] * cosines[v][y]
+				}
+			}
+			coeffs = append(coeffs, sum)
+		}
+	}
+
+	// Set a bit for each coefficient above the median.
+	sorted := append([]float64(nil), coeffs...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	var hash uint64
+	for i, c := range coeffs {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// hammingDistance returns the number of bits that differ between a and b.
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// PHashEntry is the perceptual hash of one imported photo.
+type PHashEntry struct {
+	// File is the name of the photo, which stays the same as it moves from the process queue to the upload
+	// queue and uploaded dir, and is unique because of its date prefix.
+	File string `json:"file"`
+	Hash uint64 `json:"hash"`
+}
+
+// phashIndex stores the perceptual hashes of imported photos, keyed by the names they were imported as.
+type phashIndex struct {
+	Hashes map[string]uint64 `json:"hashes"`
+	path   string
+}
+
+// getPHashIndexPath returns the path of the perceptual hash index in cacheDir.
+func getPHashIndexPath(cacheDir string) string {
+	return filepath.Join(cacheDir, "phash_index.json")
+}
+
+// loadPHashIndex loads the perceptual hash index from disk.
+// It returns an empty index if the file doesn't exist.
+func loadPHashIndex(path string) (*phashIndex, error) {
+	index := &phashIndex{
+		Hashes: make(map[string]uint64),
+		path:   path,
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, fmt.Errorf("failed to read perceptual hash index %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to decode perceptual hash index %s: %w", path, err)
+	}
+	if index.Hashes == nil {
+		index.Hashes = make(map[string]uint64)
+	}
+	return index, nil
+}
+
+// save writes the index to disk, with writeFileAtomic so that an interrupted save doesn't leave a truncated index.
+func (idx *phashIndex) save() error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode perceptual hash index: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for perceptual hash index %s: %w", idx.path, err)
+	}
+	if err := writeFileAtomic(idx.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write perceptual hash index: %w", err)
+	}
+	return nil
+}
+
+// phashIndexMu serializes the updates to the perceptual hash index, eg by cards imported in parallel,
+// so that none of them loses the hashes that another added.
+var phashIndexMu sync.Mutex
+
+// updatePHashIndex adds hashes, keyed by the paths the photos were imported to, to the index at indexPath.
+func updatePHashIndex(indexPath string, hashes map[string]uint64) error {
+	phashIndexMu.Lock()
+	defer phashIndexMu.Unlock()
+
+	idx, err := loadPHashIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	for path, hash := range hashes {
+		idx.Hashes[filepath.Base(path)] = hash
+	}
+	return idx.save()
+}
+
+// phashPool computes the perceptual hashes of imported photos with a pool of workers, so that photos
+// can be hashed while later files are still being copied. At most as many photos as there are workers
+// wait to be hashed, so memory stays bounded however many files are imported.
+type phashPool struct {
+	hasher PerceptualHasher
+	paths  chan string
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	hashes map[string]uint64
+}
+
+// newPHashPool starts workers that hash photos with hasher, until ctx is done.
+// The caller must call wait to stop them.
+func newPHashPool(ctx context.Context, hasher PerceptualHasher, workers int) *phashPool {
+	workers = max(workers, 1)
+	p := &phashPool{
+		hasher: hasher,
+		paths:  make(chan string, workers),
+		hashes: make(map[string]uint64),
+	}
+	p.wg.Add(workers)
+	for range workers {
+		go p.work(ctx)
+	}
+	return p
+}
+
+// work hashes the queued photos. Once ctx is done, it drains the queue without hashing.
+// Files that hasher doesn't support are skipped; other hashing failures are logged and skipped.
+func (p *phashPool) work(ctx context.Context) {
+	defer p.wg.Done()
+	for path := range p.paths {
+		if ctx.Err() != nil {
+			continue
+		}
+		hash, err := p.hasher.Hash(path)
+		if err != nil {
+			if !errors.Is(err, errUnsupportedHashFormat) {
+				logger.Warn("Failed to compute perceptual hash, skipping",
+					slog.String("path", path),
+					slog.String("error", err.Error()))
+			}
+			continue
+		}
+		p.mu.Lock()
+		p.hashes[path] = hash
+		p.mu.Unlock()
+	}
+}
+
+// add queues f to be hashed if it is a photo, blocking while the queue is full.
+// It does nothing if p is nil, ie perceptual hashing is disabled.
+func (p *phashPool) add(ctx context.Context, f ImportedFile) error {
+	if p == nil || f.ItemType != ItemTypePhoto {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case p.paths <- f.DstPath:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait waits for the workers to finish the queued photos, and returns their hashes, keyed by path.
+// It returns nil if p is nil.
+func (p *phashPool) wait() map[string]uint64 {
+	if p == nil {
+		return nil
+	}
+	close(p.paths)
+	p.wg.Wait()
+	return p.hashes
+}
+
+// FindDuplicates returns groups of photos in the perceptual hash index in cacheDir whose hashes are
+// within maxDistance bits of another photo in the group.
+// Groups, and the photos in each group, are sorted by name.
+func FindDuplicates(cacheDir string, maxDistance int) ([][]PHashEntry, error) {
+	idx, err := loadPHashIndex(getPHashIndexPath(cacheDir))
+	if err != nil {
+		return nil, err
+	}
+	return groupDuplicates(idx.Hashes, maxDistance), nil
+}
+
+// groupDuplicates groups the hashes, keyed by name, into sets of near-duplicates, omitting photos
+// without any near-duplicate.
+func groupDuplicates(hashes map[string]uint64, maxDistance int) [][]PHashEntry {
+	entries := make([]PHashEntry, 0, len(hashes))
+	for file, hash := range hashes {
+		entries = append(entries, PHashEntry{File: file, Hash: hash})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].File < entries[j].File })
+
+	// Union-find over all pairs within maxDistance.
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range entries {
+		for j := i + 1; j < len(entries); j++ {
+			if hammingDistance(entries[i].Hash, entries[j].Hash) <= maxDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groupsByRoot := make(map[int][]PHashEntry)
+	for i, e := range entries {
+		root := find(i)
+		groupsByRoot[root] = append(groupsByRoot[root], e)
+	}
+	var groups [][]PHashEntry
+	for _, group := range groupsByRoot {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0].File < groups[j][0].File })
+	return groups
+}
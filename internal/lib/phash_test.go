@@ -0,0 +1,235 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestJPEG writes a 256x192 JPEG whose pixels are given by pixel.
+func writeTestJPEG(t *testing.T, path string, quality int, pixel func(x, y int) uint8) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 256, 192))
+	for y := 0; y < 192; y++ {
+		for x := 0; x < 256; x++ {
+			img.SetGray(x, y, color.Gray{Y: pixel(x, y)})
+		}
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: quality}))
+}
+
+func TestDCTHasher(t *testing.T) {
+	dir := t.TempDir()
+	// A smooth but structured scene, with energy across the low frequencies.
+	scene := func(x, y int) uint8 {
+		v := 128 + 60*math.Sin(float64(x)/28) + 50*math.Cos(float64(y)/20) + 15*math.Sin(float64(x+y)/12)
+		return uint8(math.Max(0, math.Min(255, v)))
+	}
+	checker := func(x, y int) uint8 {
+		if (x/32+y/32)%2 == 0 {
+			return 230
+		}
+		return 20
+	}
+
+	original := filepath.Join(dir, "original.jpg")
+	reencoded := filepath.Join(dir, "reencoded.JPG")
+	different := filepath.Join(dir, "different.jpg")
+	writeTestJPEG(t, original, 95, scene)
+	writeTestJPEG(t, reencoded, 40, scene)
+	writeTestJPEG(t, different, 95, checker)
+
+	hasher := dctHasher{}
+	originalHash, err := hasher.Hash(original)
+	require.NoError(t, err)
+	reencodedHash, err := hasher.Hash(reencoded)
+	require.NoError(t, err)
+	differentHash, err := hasher.Hash(different)
+	require.NoError(t, err)
+
+	assert.LessOrEqual(t, hammingDistance(originalHash, reencodedHash), 4, "Re-encoded image should hash nearly the same")
+	assert.Greater(t, hammingDistance(originalHash, differentHash), 16, "Different image should hash differently")
+
+	_, err = hasher.Hash(filepath.Join(dir, "IMG_0001.CR3"))
+	assert.ErrorIs(t, err, errUnsupportedHashFormat)
+}
+
+// fakeHasher is a PerceptualHasher that returns preset hashes.
+type fakeHasher map[string]uint64
+
+func (h fakeHasher) Hash(path string) (uint64, error) {
+	hash, ok := h[path]
+	if !ok {
+		return 0, fmt.Errorf("no hash for %s: %w", path, errUnsupportedHashFormat)
+	}
+	return hash, nil
+}
+
+// hashWithPool hashes the imported files with a pool of workers workers.
+func hashWithPool(ctx context.Context, hasher PerceptualHasher, importedFiles []ImportedFile, workers int) (map[string]uint64, error) {
+	pool := newPHashPool(ctx, hasher, workers)
+	for _, f := range importedFiles {
+		if err := pool.add(ctx, f); err != nil {
+			pool.wait()
+			return nil, err
+		}
+	}
+	return pool.wait(), nil
+}
+
+func TestUpdatePHashIndex(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "index.json")
+	hasher := fakeHasher{
+		"/photos/a.JPG": 0b1111,
+		"/photos/b.JPG": 0b0111,
+	}
+
+	hashes, err := hashWithPool(context.Background(), hasher, []ImportedFile{
+		{DstPath: "/photos/a.JPG", ItemType: ItemTypePhoto},
+		{DstPath: "/photos/a.CR3", ItemType: ItemTypePhoto}, // Unsupported, so skipped.
+		{DstPath: "/videos/v.MP4", ItemType: ItemTypeVideo},
+	}, 2)
+	require.NoError(t, err)
+	require.NoError(t, updatePHashIndex(indexPath, hashes))
+	// A later import adds to the index.
+	hashes, err = hashWithPool(context.Background(), hasher, []ImportedFile{
+		{DstPath: "/photos/b.JPG", ItemType: ItemTypePhoto},
+	}, 2)
+	require.NoError(t, err)
+	require.NoError(t, updatePHashIndex(indexPath, hashes))
+
+	idx, err := loadPHashIndex(indexPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"a.JPG": 0b1111, "b.JPG": 0b0111}, idx.Hashes, "Hashes should be keyed by name")
+}
+
+func TestUpdatePHashIndex_Concurrent(t *testing.T) {
+	// Cards imported in parallel each add their hashes to the index.
+	indexPath := filepath.Join(t.TempDir(), "index.json")
+	want := make(map[string]uint64)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		path := fmt.Sprintf("/photos/card%d.JPG", i)
+		want[filepath.Base(path)] = uint64(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, updatePHashIndex(indexPath, map[string]uint64{path: uint64(i)}))
+		}()
+	}
+	wg.Wait()
+
+	idx, err := loadPHashIndex(indexPath)
+	require.NoError(t, err)
+	assert.Equal(t, want, idx.Hashes)
+}
+
+// writeTestPhotos writes n distinct JPEGs into dir and returns them as imported photos.
+func writeTestPhotos(tb testing.TB, dir string, n int) []ImportedFile {
+	tb.Helper()
+	var files []ImportedFile
+	for i := range n {
+		path := filepath.Join(dir, fmt.Sprintf("IMG_%04d.JPG", i))
+		img := image.NewGray(image.Rect(0, 0, 256, 192))
+		for y := 0; y < 192; y++ {
+			for x := 0; x < 256; x++ {
+				img.SetGray(x, y, color.Gray{Y: uint8(128 + 100*math.Sin(float64(x*(i+1)+y)/40))})
+			}
+		}
+		f, err := os.Create(path)
+		require.NoError(tb, err)
+		require.NoError(tb, jpeg.Encode(f, img, nil))
+		require.NoError(tb, f.Close())
+		files = append(files, ImportedFile{DstPath: path, ItemType: ItemTypePhoto})
+	}
+	return files
+}
+
+func TestPHashPool_MatchesSingleWorker(t *testing.T) {
+	files := writeTestPhotos(t, t.TempDir(), 12)
+	files = append(files, ImportedFile{DstPath: "/videos/v.MP4", ItemType: ItemTypeVideo})
+
+	want, err := hashWithPool(context.Background(), dctHasher{}, files, 1)
+	require.NoError(t, err)
+	require.Len(t, want, 12)
+	got, err := hashWithPool(context.Background(), dctHasher{}, files, 4)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestPHashPool_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool := newPHashPool(ctx, fakeHasher{"/photos/a.JPG": 1}, 1)
+	err := pool.add(ctx, ImportedFile{DstPath: "/photos/a.JPG", ItemType: ItemTypePhoto})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, pool.wait(), "Photos shouldn't be hashed after ctx is done")
+}
+
+func BenchmarkPHashPool(b *testing.B) {
+	files := writeTestPhotos(b, b.TempDir(), 16)
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				if _, err := hashWithPool(context.Background(), dctHasher{}, files, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupDuplicates(t *testing.T) {
+	hashes := map[string]uint64{
+		"a1.JPG": 0x0000_0000_0000_0000,
+		"a2.JPG": 0x0000_0000_0000_0003, // 2 bits from a1.
+		"a3.JPG": 0x0000_0000_0000_000f, // 2 bits from a2, 4 from a1: joins through a2.
+		"b1.JPG": 0xffff_0000_ffff_0000,
+		"b2.JPG": 0xffff_0000_ffff_0001,
+		"c1.JPG": 0x0f0f_0f0f_0f0f_0f0f, // No near-duplicates.
+	}
+
+	groups := groupDuplicates(hashes, 2)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []PHashEntry{
+		{File: "a1.JPG", Hash: hashes["a1.JPG"]},
+		{File: "a2.JPG", Hash: hashes["a2.JPG"]},
+		{File: "a3.JPG", Hash: hashes["a3.JPG"]},
+	}, groups[0])
+	assert.Equal(t, []PHashEntry{
+		{File: "b1.JPG", Hash: hashes["b1.JPG"]},
+		{File: "b2.JPG", Hash: hashes["b2.JPG"]},
+	}, groups[1])
+
+	assert.Empty(t, groupDuplicates(hashes, 0))
+}
+
+func TestFindDuplicates(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	cacheDir := t.TempDir()
+	require.NoError(t, updatePHashIndex(getPHashIndexPath(cacheDir), map[string]uint64{
+		filepath.Join(cfg.PhotosProcessQueueRoot, "2024-05-03", "2024-05-03-IMG_0001.JPG"): 0b0000,
+		filepath.Join(cfg.PhotosProcessQueueRoot, "2024-05-04", "2024-05-04-IMG_0002.JPG"): 0b0001,
+		filepath.Join(cfg.PhotosProcessQueueRoot, "2024-05-04", "2024-05-04-IMG_0003.JPG"): 0xffff,
+	}))
+
+	groups, err := FindDuplicates(cacheDir, 2)
+	require.NoError(t, err)
+	assert.Equal(t, [][]PHashEntry{{
+		{File: "2024-05-03-IMG_0001.JPG", Hash: 0b0000},
+		{File: "2024-05-04-IMG_0002.JPG", Hash: 0b0001},
+	}}, groups)
+}
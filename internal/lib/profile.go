@@ -0,0 +1,20 @@
+package lib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ProfileCacheDir returns the dir under cacheDir that holds the cache files of profile, eg the
+// Google Photos token, album cache, and upload ledger, so that profiles for different accounts
+// don't share state. An empty profile uses cacheDir itself.
+func ProfileCacheDir(cacheDir, profile string) (string, error) {
+	if profile == "" {
+		return cacheDir, nil
+	}
+	if profile == "." || profile == ".." || strings.ContainsAny(profile, `/\`) {
+		return "", fmt.Errorf("invalid profile %q: must be a plain name", profile)
+	}
+	return filepath.Join(cacheDir, profile), nil
+}
@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileCacheDir(t *testing.T) {
+	dir, err := ProfileCacheDir("/cache", "")
+	require.NoError(t, err)
+	assert.Equal(t, "/cache", dir, "No profile should use the cache dir itself")
+
+	dir, err = ProfileCacheDir("/cache", "work")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/cache", "work"), dir)
+
+	for _, profile := range []string{".", "..", "a/b", `a\b`} {
+		_, err := ProfileCacheDir("/cache", profile)
+		assert.ErrorContains(t, err, "invalid profile", profile)
+	}
+}
+
+func TestProfileCacheDir_Isolation(t *testing.T) {
+	cacheDir := t.TempDir()
+	personalDir, err := ProfileCacheDir(cacheDir, "personal")
+	require.NoError(t, err)
+	workDir, err := ProfileCacheDir(cacheDir, "work")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, getTokenFilePath(personalDir), getTokenFilePath(workDir))
+
+	// Albums and uploads recorded for one profile aren't seen by the other.
+	personalCache, err := loadAlbumCache(getAlbumCachePath(personalDir))
+	require.NoError(t, err)
+	personalCache.Albums["Favorites"] = "id-personal"
+	require.NoError(t, personalCache.save())
+	require.NoError(t, newUploadLedger(getUploadLedgerPath(personalDir)).record(context.Background(), "2024-05-03-a.jpg", 0, "id-a", "", nil, time.Now()))
+
+	workCache, err := loadAlbumCache(getAlbumCachePath(workDir))
+	require.NoError(t, err)
+	assert.Empty(t, workCache.Albums)
+	workIDs, err := newUploadLedger(getUploadLedgerPath(workDir)).mediaItemIDs()
+	require.NoError(t, err)
+	assert.Empty(t, workIDs)
+
+	reloaded, err := loadAlbumCache(getAlbumCachePath(personalDir))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Favorites": "id-personal"}, reloaded.Albums)
+}
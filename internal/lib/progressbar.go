@@ -2,31 +2,188 @@ package lib
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/schollz/progressbar/v3"
 )
 
+// Progress styles, for SetProgressStyle.
+const (
+	// ProgressStyleBar redraws an animated bar in place.
+	ProgressStyleBar = "bar"
+	// ProgressStylePlain prints a line with the progress every plainProgressInterval, eg for logs.
+	ProgressStylePlain = "plain"
+	// ProgressStyleNone doesn't show progress.
+	ProgressStyleNone = "none"
+)
+
+// plainProgressInterval is how often a progress bar in ProgressStylePlain prints its progress.
+const plainProgressInterval = 10 * time.Second
+
+// progressStyle is the style of the progress bars, or "" to pick one by whether stdout is a terminal.
+var progressStyle string
+
+// SetProgressStyle sets the style of the progress bars of imports and uploads: ProgressStyleBar,
+// ProgressStylePlain, or ProgressStyleNone. An empty style shows a bar if stdout is a terminal,
+// and plain lines otherwise.
+func SetProgressStyle(style string) error {
+	switch style {
+	case "", ProgressStyleBar, ProgressStylePlain, ProgressStyleNone:
+	default:
+		return fmt.Errorf("invalid progress style %q: must be %q, %q, or %q", style, ProgressStyleBar, ProgressStylePlain, ProgressStyleNone)
+	}
+	progressStyle = style
+	return nil
+}
+
+// currentProgressStyle returns the style set by SetProgressStyle, or the style for stdout if none was set.
+func currentProgressStyle() string {
+	if progressStyle != "" {
+		return progressStyle
+	}
+	if isTerminal(os.Stdout) {
+		return ProgressStyleBar
+	}
+	return ProgressStylePlain
+}
+
 func NewProgressBar(size int64, description string) *progressbar.ProgressBar {
-	return progressbar.NewOptions64(size,
-		progressbar.OptionSetDescription(description+":"),
-		progressbar.OptionSetWidth(20), // Fit in an 80-column terminal.
+	return newStyledProgressBar(os.Stdout, currentProgressStyle(), size, description,
 		progressbar.OptionShowBytes(true),
 		progressbar.OptionUseIECUnits(true),
 		progressbar.OptionShowCount(), // Show number of bytes moved.
-		progressbar.OptionSetPredictTime(true),
 		progressbar.OptionShowTotalBytes(true),
-		progressbar.OptionShowElapsedTimeOnFinish(),
-		progressbar.OptionOnCompletion(func() { fmt.Println() }),
 	)
 }
 
 func NewCountProgressBar(total int, description string) *progressbar.ProgressBar {
-	return progressbar.NewOptions(total,
-		progressbar.OptionSetDescription(description+":"),
-		progressbar.OptionSetWidth(20), // Fit in an 80-column terminal.
+	return newStyledProgressBar(os.Stdout, currentProgressStyle(), int64(total), description,
 		progressbar.OptionShowCount(),
+	)
+}
+
+// newStyledProgressBar returns a progress bar of max with description, which writes to w in style.
+// options select what the bar shows besides its description and percentage.
+func newStyledProgressBar(w io.Writer, style string, max int64, description string, options ...progressbar.Option) *progressbar.ProgressBar {
+	options = append(options,
+		progressbar.OptionSetDescription(description+":"),
 		progressbar.OptionSetPredictTime(true),
 		progressbar.OptionShowElapsedTimeOnFinish(),
-		progressbar.OptionOnCompletion(func() { fmt.Println() }),
 	)
+	switch style {
+	case ProgressStyleNone:
+		options = append(options, progressbar.OptionSetVisibility(false))
+	case ProgressStylePlain:
+		// Without a bar, the line only has the description, percentage, and what options add.
+		options = append(options,
+			progressbar.OptionSetWriter(&plainProgressWriter{w: w}),
+			progressbar.OptionSetWidth(0),
+			progressbar.OptionSetTheme(progressbar.Theme{}),
+			progressbar.OptionThrottle(plainProgressInterval),
+		)
+	default:
+		options = append(options,
+			progressbar.OptionSetWriter(w),
+			progressbar.OptionSetWidth(20), // Fit in an 80-column terminal.
+			progressbar.OptionOnCompletion(func() { fmt.Fprintln(w) }),
+		)
+	}
+	return progressbar.NewOptions64(max, options...)
+}
+
+// plainProgressWriter turns the output of a progress bar, which redraws the bar in place with carriage
+// returns, into a line for each time that the bar is drawn, without control characters.
+type plainProgressWriter struct {
+	w    io.Writer
+	last string
+}
+
+func (p *plainProgressWriter) Write(b []byte) (int, error) {
+	// Each draw is preceded by a carriage return, and clearing the bar only writes spaces between them.
+	for _, draw := range strings.Split(string(b), "\r") {
+		line := strings.Join(strings.Fields(draw), " ")
+		if line == "" || line == p.last {
+			continue
+		}
+		p.last = line
+		if _, err := fmt.Fprintln(p.w, line); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// isTerminal returns whether f is a terminal, rather than eg a pipe or a file,
+// where a progress bar would only add noise.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressFlushInterval is how often a progressAggregator passes the bytes added to it on to its bar.
+const progressFlushInterval = 100 * time.Millisecond
+
+// progressAggregator coalesces the bytes that any number of goroutines add into one progress bar,
+// so that eg parallel uploads share a bar, and it is redrawn at most once per interval however often
+// bytes are added. A nil progressAggregator, or one without a bar, only counts the bytes.
+type progressAggregator struct {
+	bar      *progressbar.ProgressBar
+	interval time.Duration
+
+	mu        sync.Mutex
+	done      int64
+	pending   int64
+	lastFlush time.Time
+}
+
+// newProgressAggregator returns a progressAggregator that adds to bar at most once per interval.
+func newProgressAggregator(bar *progressbar.ProgressBar, interval time.Duration) *progressAggregator {
+	return &progressAggregator{bar: bar, interval: interval, lastFlush: time.Now()}
+}
+
+// Add64 adds n bytes, and passes the bytes added since the last time on to the bar if interval has passed.
+// It is safe to call from multiple goroutines.
+func (a *progressAggregator) Add64(n int64) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.done += n
+	a.pending += n
+	if time.Since(a.lastFlush) >= a.interval {
+		a.flushLocked()
+	}
+}
+
+// Flush passes the bytes not yet added to the bar on to it, eg before finishing the bar.
+func (a *progressAggregator) Flush() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.flushLocked()
+}
+
+func (a *progressAggregator) flushLocked() {
+	if a.bar != nil && a.pending != 0 {
+		_ = a.bar.Add64(a.pending)
+	}
+	a.pending = 0
+	a.lastFlush = time.Now()
+}
+
+// Done returns the number of bytes added in total, including any not yet passed on to the bar.
+func (a *progressAggregator) Done() int64 {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.done
 }
@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/schollz/progressbar/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressAggregator_ConcurrentAdds(t *testing.T) {
+	const workers, addsPerWorker, bytesPerAdd = 16, 1000, 3
+	const total = workers * addsPerWorker * bytesPerAdd
+	bar := progressbar.NewOptions64(total, progressbar.OptionSetWriter(io.Discard))
+	// A zero interval passes every add on to the bar, so that the bar is updated from all of the goroutines.
+	for _, interval := range []time.Duration{0, time.Hour} {
+		bar.Reset()
+		progress := newProgressAggregator(bar, interval)
+
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range addsPerWorker {
+					progress.Add64(bytesPerAdd)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(total), progress.Done(), "Every add should be counted (interval %s)", interval)
+
+		progress.Flush()
+		assert.Equal(t, int64(total), bar.State().CurrentNum, "The bar should show every add after a flush (interval %s)", interval)
+	}
+}
+
+func TestProgressAggregator_Coalesces(t *testing.T) {
+	bar := progressbar.NewOptions64(100, progressbar.OptionSetWriter(io.Discard))
+	progress := newProgressAggregator(bar, time.Hour)
+	progress.Add64(10)
+	progress.Add64(20)
+	assert.Equal(t, int64(0), bar.State().CurrentNum, "Adds within the interval should be held back")
+	assert.Equal(t, int64(30), progress.Done())
+	progress.Flush()
+	assert.Equal(t, int64(30), bar.State().CurrentNum)
+
+	// A nil aggregator, eg when there is no bar to show, ignores adds.
+	var nilProgress *progressAggregator
+	nilProgress.Add64(10)
+	nilProgress.Flush()
+	assert.Equal(t, int64(0), nilProgress.Done())
+}
+
+func TestNewStyledProgressBar_Plain(t *testing.T) {
+	var out strings.Builder
+	bar := newStyledProgressBar(&out, ProgressStylePlain, 100, "counting", progressbar.OptionShowCount())
+	require.NoError(t, bar.Add(30))
+	require.NoError(t, bar.Add(30)) // Within plainProgressInterval of the first draw, so not printed.
+	require.NoError(t, bar.Finish())
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, 2, "Output: %q", out.String())
+	assert.True(t, strings.HasPrefix(lines[0], "counting: 30% (30/100"), "Line: %q", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "counting: 100% (100/100"), "Line: %q", lines[1])
+	for _, r := range out.String() {
+		if r != '\n' {
+			assert.False(t, unicode.IsControl(r), "Output shouldn't have control characters: %q", out.String())
+		}
+	}
+}
+
+func TestNewStyledProgressBar_None(t *testing.T) {
+	var out strings.Builder
+	bar := newStyledProgressBar(&out, ProgressStyleNone, 100, "counting")
+	require.NoError(t, bar.Add(30))
+	require.NoError(t, bar.Finish())
+	require.NoError(t, bar.Exit())
+	assert.Empty(t, out.String())
+}
+
+func TestSetProgressStyle(t *testing.T) {
+	t.Cleanup(func() { progressStyle = "" })
+	require.NoError(t, SetProgressStyle(ProgressStyleNone))
+	assert.Equal(t, ProgressStyleNone, currentProgressStyle())
+	assert.ErrorContains(t, SetProgressStyle("fancy"), `invalid progress style "fancy"`)
+	assert.Equal(t, ProgressStyleNone, currentProgressStyle(), "An invalid style shouldn't change the style")
+}
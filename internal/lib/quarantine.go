@@ -0,0 +1,221 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// quarantineNoteSuffix is appended to the name of a quarantined file for the name of its note.
+const quarantineNoteSuffix = ".quarantine.json"
+
+// quarantineNote is written next to a quarantined file, to say why it was quarantined.
+type quarantineNote struct {
+	Failures      int       `json:"failures"`
+	LastError     string    `json:"last_error"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// recordUploadFailure records in ledger that the file of fileInfo, in the upload queue at uploadQueueRoot,
+// failed to upload with uploadErr. With uploadConfig.QuarantineAfter, it also counts the failure in failures,
+// and once the file has failed that many times, quarantines it and returns the path it was moved to.
+func recordUploadFailure(ctx context.Context, ledger *uploadLedger, failures map[string]uploadFailures, fileInfo itemFileInfo, uploadErr error, uploadQueueRoot string, uploadConfig config.UploadConfig) (string, error) {
+	// The file failed either way, so only warn if the failure can't be recorded.
+	if err := ledger.recordFailure(ctx, fileInfo.path, uploadErr, time.Now()); err != nil {
+		logger.Warn("Failed to record failed upload",
+			slog.String("path", fileInfo.path),
+			slog.String("error", err.Error()))
+	}
+	if uploadConfig.QuarantineAfter <= 0 {
+		return "", nil
+	}
+
+	name := filepath.Base(fileInfo.path)
+	fileFailures := uploadFailures{count: failures[name].count + 1, lastError: uploadErr.Error()}
+	failures[name] = fileFailures
+	if fileFailures.count < uploadConfig.QuarantineAfter {
+		return "", nil
+	}
+	destPath, err := quarantineFile(fileInfo, uploadQueueRoot, fileFailures, uploadConfig.MoveMode)
+	if err != nil {
+		return "", err
+	}
+	logger.Warn("Quarantined file that failed to upload too many times",
+		slog.String("path", fileInfo.path),
+		slog.String("quarantined_path", destPath),
+		slog.Int("failures", fileFailures.count))
+	delete(failures, name)
+	return destPath, nil
+}
+
+// quarantineFile moves the file of fileInfo, and its companions, from the upload queue at uploadQueueRoot
+// to its quarantine dir, at the same paths relative to it, and writes a note of failures next to the file.
+// moveMode is as for moveFile. It returns the path that the file was moved to.
+func quarantineFile(fileInfo itemFileInfo, uploadQueueRoot string, failures uploadFailures, moveMode string) (string, error) {
+	destPath, err := moveQueuedFile(fileInfo, uploadQueueRoot, filepath.Join(uploadQueueRoot, config.QuarantineDirName), moveMode)
+	if err != nil {
+		return "", fmt.Errorf("failed to quarantine %s: %w", fileInfo.path, err)
+	}
+
+	data, err := json.MarshalIndent(quarantineNote{
+		Failures:      failures.count,
+		LastError:     failures.lastError,
+		QuarantinedAt: time.Now().UTC(),
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode quarantine note: %w", err)
+	}
+	if err := os.WriteFile(destPath+quarantineNoteSuffix, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to write quarantine note for %s: %w", destPath, err)
+	}
+	return destPath, nil
+}
+
+// moveQueuedFile moves the file of fileInfo, and its companions, from the upload queue at uploadQueueRoot
+// to destDir, at the same paths relative to it. moveMode is as for moveFile. It returns the path that the
+// file was moved to.
+func moveQueuedFile(fileInfo itemFileInfo, uploadQueueRoot, destDir, moveMode string) (string, error) {
+	var destPath string
+	for i, item := range append([]itemFileInfo{fileInfo}, fileInfo.companions...) {
+		relPath, err := filepath.Rel(uploadQueueRoot, item.path)
+		if err != nil {
+			return "", fmt.Errorf("failed to find the path of %s in the upload queue: %w", item.path, err)
+		}
+		itemDestPath := filepath.Join(destDir, relPath)
+		if i == 0 {
+			destPath = itemDestPath
+		}
+		if err := moveFile(item.path, itemDestPath, item.size, item.modTime, moveMode); err != nil {
+			return "", err
+		}
+	}
+	return destPath, nil
+}
+
+// QuarantinedFile is a file in the quarantine dir of an upload queue.
+type QuarantinedFile struct {
+	Path string
+	// UploadQueueRoot is the root of the upload queue that the file was quarantined from.
+	UploadQueueRoot string
+	// Failures, LastError, and QuarantinedAt are from the note of the file. They are empty
+	// for files without a note, eg the RAW file of a quarantined RAW+JPEG pair.
+	Failures      int
+	LastError     string
+	QuarantinedAt time.Time
+}
+
+// ListQuarantine returns the files in the quarantine dirs of the photo and video upload queues, sorted by path.
+func ListQuarantine(cfg config.CamflowConfig) ([]QuarantinedFile, error) {
+	var files []QuarantinedFile
+	for _, uploadQueueRoot := range []string{cfg.LocalPhotos.GetUploadQueueRoot(), cfg.LocalVideos.GetUploadQueueRoot()} {
+		quarantineDir := filepath.Join(uploadQueueRoot, config.QuarantineDirName)
+		err := filepath.WalkDir(quarantineDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == quarantineDir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() || strings.HasSuffix(path, quarantineNoteSuffix) || isIgnoredQueueFile(d.Name()) {
+				return nil
+			}
+			file := QuarantinedFile{Path: path, UploadQueueRoot: uploadQueueRoot}
+			data, err := os.ReadFile(path + quarantineNoteSuffix)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read quarantine note for %s: %w", path, err)
+			}
+			if err == nil {
+				var note quarantineNote
+				if err := json.Unmarshal(data, &note); err != nil {
+					logger.Warn("Skipping invalid quarantine note",
+						slog.String("path", path+quarantineNoteSuffix),
+						slog.String("error", err.Error()))
+				} else {
+					file.Failures, file.LastError, file.QuarantinedAt = note.Failures, note.LastError, note.QuarantinedAt
+				}
+			}
+			files = append(files, file)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list quarantine dir %s: %w", quarantineDir, err)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// RequeueQuarantined moves the quarantined files at paths, or all of the quarantined files if paths is empty,
+// back to the upload queues that they were quarantined from, and resets their failure counts, so that the
+// next upload tries them again. It returns the paths that the files were (or would be) moved to.
+func RequeueQuarantined(ctx context.Context, cfg config.CamflowConfig, cacheDir string, paths []string, dryRun bool) ([]string, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	files, err := ListQuarantine(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) > 0 {
+		byPath := make(map[string]QuarantinedFile, len(files))
+		for _, file := range files {
+			byPath[file.Path] = file
+		}
+		files = files[:0]
+		for _, path := range paths {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get absolute path for %s: %w", path, err)
+			}
+			file, ok := byPath[absPath]
+			if !ok {
+				return nil, fmt.Errorf("%s is not a quarantined file", path)
+			}
+			files = append(files, file)
+		}
+	}
+
+	ledger := newUploadLedger(getUploadLedgerPath(cacheDir))
+	var requeuedPaths []string
+	for _, file := range files {
+		quarantineDir := filepath.Join(file.UploadQueueRoot, config.QuarantineDirName)
+		relPath, err := filepath.Rel(quarantineDir, file.Path)
+		if err != nil {
+			return requeuedPaths, fmt.Errorf("failed to find the path of %s in the quarantine dir: %w", file.Path, err)
+		}
+		destPath := filepath.Join(file.UploadQueueRoot, relPath)
+		if dryRun {
+			logger.Debug("Would requeue file",
+				slog.String("from", file.Path),
+				slog.String("to", destPath))
+			requeuedPaths = append(requeuedPaths, destPath)
+			continue
+		}
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			return requeuedPaths, fmt.Errorf("failed to stat %s: %w", file.Path, err)
+		}
+		if err := moveFile(file.Path, destPath, info.Size(), info.ModTime(), cfg.Upload.MoveMode); err != nil {
+			return requeuedPaths, fmt.Errorf("failed to requeue %s: %w", file.Path, err)
+		}
+		requeuedPaths = append(requeuedPaths, destPath)
+		if err := os.Remove(file.Path + quarantineNoteSuffix); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Failed to remove quarantine note",
+				slog.String("path", file.Path+quarantineNoteSuffix),
+				slog.String("error", err.Error()))
+		}
+		if err := ledger.recordRequeue(ctx, destPath, time.Now()); err != nil {
+			return requeuedPaths, err
+		}
+	}
+	return requeuedPaths, nil
+}
@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadLedgerFailures(t *testing.T) {
+	ledger := newUploadLedger(getUploadLedgerPath(t.TempDir()))
+	now := time.Now()
+	require.NoError(t, ledger.recordFailure(context.Background(), "/queue/2024-05-03-a.mp4", errors.New("error 1"), now))
+	require.NoError(t, ledger.recordFailure(context.Background(), "/queue/2024-05-03-a.mp4", errors.New("error 2"), now))
+	require.NoError(t, ledger.recordFailure(context.Background(), "/queue/2024-05-03-b.mp4", errors.New("error 1"), now))
+	require.NoError(t, ledger.recordFailure(context.Background(), "/queue/2024-05-03-c.mp4", errors.New("error 1"), now))
+
+	// An upload or a requeue resets the count.
+	require.NoError(t, ledger.record(context.Background(), "/queue/2024-05-03-b.mp4", 0, "id-b", "", nil, now))
+	require.NoError(t, ledger.recordRequeue(context.Background(), "/queue/2024-05-03-c.mp4", now))
+	require.NoError(t, ledger.recordFailure(context.Background(), "/queue/2024-05-03-c.mp4", errors.New("error 2"), now))
+
+	failures, err := ledger.failures()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uploadFailures{
+		"2024-05-03-a.mp4": {count: 2, lastError: "error 2"},
+		"2024-05-03-c.mp4": {count: 1, lastError: "error 2"},
+	}, failures)
+
+	ids, err := ledger.mediaItemIDs()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"2024-05-03-b.mp4": "id-b"}, ids, "Failures shouldn't have media items")
+}
+
+func TestUploadVideos_Quarantine(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "")
+	cfg.Upload.QuarantineAfter = 2
+	cfg.Upload.MaxConsecutiveFailures = 5
+	cacheDir := t.TempDir()
+	queue := cfg.VideosUploadQueueRoot
+	require.NoError(t, os.MkdirAll(filepath.Join(queue, "trip"), 0755))
+	relPath := "trip/2024-01-28-corrupt.mp4"
+	createTestFiles(t, queue, map[string]string{relPath: "corrupt"})
+	path := filepath.Join(queue, relPath)
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{}, nil).AnyTimes()
+	// The file is only tried until it is quarantined.
+	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), path).Return("", errors.New("upload rejected")).Times(2)
+
+	// Below the threshold, the file fails and stays in the upload queue.
+	report, err := UploadVideos(ctx, cfg, cacheDir, false /* keepQueued */, mockGPhotosClient, false)
+	require.Error(t, err)
+	assert.Equal(t, []string{path}, report.FailedPaths)
+	assert.Empty(t, report.QuarantinedPaths)
+	assert.FileExists(t, path)
+
+	// At the threshold, the file is quarantined, which doesn't fail the upload.
+	report, err = UploadVideos(ctx, cfg, cacheDir, false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	assert.Empty(t, report.FailedPaths)
+	assert.Equal(t, []string{path}, report.QuarantinedPaths)
+	quarantinedPath := filepath.Join(queue, "quarantine", relPath)
+	assert.NoFileExists(t, path)
+	assert.FileExists(t, quarantinedPath)
+
+	// Quarantined files are ignored.
+	report, err = UploadVideos(ctx, cfg, cacheDir, false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	assert.Empty(t, report.FailedPaths)
+	assert.Empty(t, report.QuarantinedPaths)
+
+	files, err := ListQuarantine(cfg)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, quarantinedPath, files[0].Path)
+	assert.Equal(t, 2, files[0].Failures)
+	assert.Contains(t, files[0].LastError, "upload rejected")
+	assert.False(t, files[0].QuarantinedAt.IsZero())
+
+	_, err = RequeueQuarantined(context.Background(), cfg, cacheDir, []string{path}, false)
+	assert.ErrorContains(t, err, "not a quarantined file")
+
+	requeued, err := RequeueQuarantined(context.Background(), cfg, cacheDir, nil, true /* dryRun */)
+	require.NoError(t, err)
+	assert.Equal(t, []string{path}, requeued)
+	assert.FileExists(t, quarantinedPath, "A dry run shouldn't move files")
+
+	requeued, err = RequeueQuarantined(context.Background(), cfg, cacheDir, []string{quarantinedPath}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{path}, requeued)
+	assert.FileExists(t, path)
+	assert.NoFileExists(t, quarantinedPath)
+	assert.NoFileExists(t, quarantinedPath+quarantineNoteSuffix)
+	failures, err := newUploadLedger(getUploadLedgerPath(cacheDir)).failures()
+	require.NoError(t, err)
+	assert.Empty(t, failures, "Requeuing should reset the failure count")
+}
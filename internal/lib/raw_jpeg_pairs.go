@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// rawExtensions are the lowercase extensions of the camera RAW formats that pair with JPEGs.
+var rawExtensions = map[string]struct{}{
+	".arw": {},
+	".cr2": {},
+	".cr3": {},
+	".dng": {},
+	".nef": {},
+	".orf": {},
+	".raf": {},
+	".rw2": {},
+}
+
+func isRawFile(path string) bool {
+	_, ok := rawExtensions[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+func isJpegFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// pairRawJpegFiles applies the rawJpegPairs policy to the RAW+JPEG pairs in items, which are a RAW
+// and a JPEG file with the same path apart from their extensions. For config.RawJpegPairsJpegOnly
+// and config.RawJpegPairsRawOnly, only one file of each pair is returned, with the other as its companion.
+// The order of items is otherwise kept.
+func pairRawJpegFiles(items []itemFileInfo, rawJpegPairs string) []itemFileInfo {
+	if rawJpegPairs != config.RawJpegPairsJpegOnly && rawJpegPairs != config.RawJpegPairsRawOnly {
+		return items
+	}
+
+	// Find the RAW and JPEG files of each stem, by their index in items.
+	type pair struct {
+		raws, jpegs []int
+	}
+	pairs := make(map[string]*pair)
+	for i, item := range items {
+		stem := strings.TrimSuffix(item.path, filepath.Ext(item.path))
+		if pairs[stem] == nil {
+			pairs[stem] = &pair{}
+		}
+		if isRawFile(item.path) {
+			pairs[stem].raws = append(pairs[stem].raws, i)
+		} else if isJpegFile(item.path) {
+			pairs[stem].jpegs = append(pairs[stem].jpegs, i)
+		}
+	}
+
+	companions := make(map[int]int)
+	skipped := make(map[int]bool)
+	for _, p := range pairs {
+		if len(p.raws) != 1 || len(p.jpegs) != 1 {
+			continue
+		}
+		kept, other := p.jpegs[0], p.raws[0]
+		if rawJpegPairs == config.RawJpegPairsRawOnly {
+			kept, other = other, kept
+		}
+		companions[kept] = other
+		skipped[other] = true
+	}
+
+	var result []itemFileInfo
+	for i, item := range items {
+		if skipped[i] {
+			logger.Debug("Skipping upload of file paired with another",
+				slog.String("path", item.path),
+				slog.String("raw_jpeg_pairs", rawJpegPairs))
+			continue
+		}
+		if other, ok := companions[i]; ok {
+			item.companions = append(item.companions, items[other])
+		}
+		result = append(result, item)
+	}
+	return result
+}
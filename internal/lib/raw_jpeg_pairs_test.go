@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPairRawJpegFiles(t *testing.T) {
+	pairRaw := itemFileInfo{path: "/q/2024-05-03-IMG_0001.CR3", size: 30}
+	pairJpeg := itemFileInfo{path: "/q/2024-05-03-IMG_0001.JPG", size: 10}
+	loneRaw := itemFileInfo{path: "/q/2024-05-03-IMG_0002.cr3", size: 31}
+	loneJpeg := itemFileInfo{path: "/q/2024-05-03-IMG_0003.jpeg", size: 11}
+	video := itemFileInfo{path: "/q/2024-05-03-IMG_0001.MP4", size: 50}
+	items := []itemFileInfo{pairRaw, pairJpeg, loneRaw, loneJpeg, video}
+
+	assert.Equal(t, items, pairRawJpegFiles(items, config.RawJpegPairsBoth))
+
+	jpegWithRaw := pairJpeg
+	jpegWithRaw.companions = []itemFileInfo{pairRaw}
+	assert.Equal(t, []itemFileInfo{jpegWithRaw, loneRaw, loneJpeg, video}, pairRawJpegFiles(items, config.RawJpegPairsJpegOnly),
+		"Only the JPEG of the pair should be uploaded, and lone files kept")
+
+	rawWithJpeg := pairRaw
+	rawWithJpeg.companions = []itemFileInfo{pairJpeg}
+	assert.Equal(t, []itemFileInfo{rawWithJpeg, loneRaw, loneJpeg, video}, pairRawJpegFiles(items, config.RawJpegPairsRawOnly),
+		"Only the RAW of the pair should be uploaded, and lone files kept")
+}
+
+func TestUploadPhotos_RawJpegPairsJpegOnly(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "") // No default albums
+	cfg.GooglePhotos.Photos.RawJpegPairs = config.RawJpegPairsJpegOnly
+
+	pairJpegName := "2024-05-03-IMG_0001.JPG"
+	pairRawName := "2024-05-03-IMG_0001.CR3"
+	loneRawName := "2024-05-03-IMG_0002.CR3"
+	createTestFiles(t, cfg.PhotosUploadQueueDir, map[string]string{
+		pairJpegName: "jpeg",
+		pairRawName:  "raw",
+		loneRawName:  "raw",
+	})
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+
+	// The RAW of the pair isn't uploaded.
+	for _, fileName := range []string{pairJpegName, loneRawName} {
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.PhotosUploadQueueDir, fileName)).
+			Return("token_for_"+fileName, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + fileName, Filename: fileName}).
+			Return(&media_items.MediaItem{ID: "media_id_for_" + fileName, Filename: fileName}, nil)
+	}
+
+	report, err := UploadPhotos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	assert.Len(t, report.UploadedItems, 2)
+
+	// All of the files, including the RAW of the pair, are moved to the uploaded dir.
+	for _, fileName := range []string{pairJpegName, pairRawName, loneRawName} {
+		_, statErr := os.Stat(filepath.Join(cfg.PhotosUploadedRoot, "2024", "05", "03", fileName))
+		assert.NoError(t, statErr, "Expected %s to be moved to the uploaded dir", fileName)
+	}
+	remainingFiles, err := os.ReadDir(cfg.PhotosUploadQueueDir)
+	require.NoError(t, err)
+	assert.Empty(t, remainingFiles)
+}
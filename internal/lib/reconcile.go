@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
+)
+
+// ReconcileResult describes the outcome of Reconcile.
+type ReconcileResult struct {
+	// MatchedCount is the number of uploaded files whose media items are in Google Photos.
+	MatchedCount int `json:"matched_count"`
+	// MissingInCloud are the uploaded files whose media items aren't in Google Photos,
+	// eg because they were deleted there, sorted by path.
+	MissingInCloud []ReconcileFile `json:"missing_in_cloud"`
+	// UnrecordedFiles are the uploaded files without a recorded media item, eg because they were uploaded
+	// before camflow recorded media items, which can't be checked. They are sorted.
+	UnrecordedFiles []string `json:"unrecorded_files"`
+	// MissingLocally are the media items that camflow created in Google Photos, with creation dates in
+	// the range, that no uploaded file was recorded as, eg because the file was removed from the uploaded
+	// dirs. They are sorted by creation time.
+	MissingLocally []ReconcileMediaItem `json:"missing_locally"`
+}
+
+// ReconcileFile is an uploaded file and the media item that it was recorded as.
+type ReconcileFile struct {
+	Path        string `json:"path"`
+	MediaItemID string `json:"media_item_id"`
+}
+
+// ReconcileMediaItem is a media item in Google Photos.
+type ReconcileMediaItem struct {
+	ID           string `json:"id"`
+	Filename     string `json:"filename"`
+	CreationTime string `json:"creation_time"`
+	ProductURL   string `json:"product_url"`
+}
+
+// Reconcile compares the files in the photo and video uploaded dirs dated from "from" to "to", inclusive,
+// with the media items in Google Photos, to find the files whose uploads are missing, and the media items
+// that camflow created in the range whose files are missing. Each file is matched by the media item that
+// camflow recorded uploading it as. A file whose media item was created on another date, eg because the
+// camera's clock was off, is looked up by its ID.
+func Reconcile(ctx context.Context, cfg config.CamflowConfig, cacheDir string, from, to time.Time, gphotosClient GPhotosClient) (ReconcileResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return ReconcileResult{}, fmt.Errorf("invalid config: %w", err)
+	}
+
+	var paths []string
+	for _, localConfig := range []LocalConfig{&cfg.LocalPhotos, &cfg.LocalVideos} {
+		uploadedRoot := localConfig.GetUploadedRoot()
+		if _, err := os.Stat(uploadedRoot); os.IsNotExist(err) {
+			logger.Info("Uploaded directory does not exist, skipping it",
+				slog.String("uploaded_root", uploadedRoot))
+			continue
+		}
+		items, _, err := scanUploadQueue(uploadedRoot, localConfig.GetSymlinks())
+		if err != nil {
+			return ReconcileResult{}, err
+		}
+		for _, item := range items {
+			date := itemDate(item)
+			if !date.Before(from) && !date.After(to) {
+				paths = append(paths, item.path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	mediaItemIDs, err := recordedMediaItemIDs(cacheDir, paths)
+	if err != nil {
+		return ReconcileResult{}, err
+	}
+
+	limiter := rate.NewLimiter(apiRequestsPerSecond, apiRequestBurst)
+	if err := limiter.Wait(ctx); err != nil {
+		return ReconcileResult{}, fmt.Errorf("rate limiter error before searching media items: %w", err)
+	}
+	cloudItems, err := callWithRetries(ctx, cfg.Upload.MaxRetries, limiter, func() ([]*media_items.MediaItem, error) {
+		return gphotosClient.MediaItems().Search(ctx, from, to)
+	})
+	if err != nil {
+		return ReconcileResult{}, fmt.Errorf("failed to list media items from %s to %s: %w", from.Format("2006-01-02"), to.Format("2006-01-02"), err)
+	}
+	cloudItemsByID := make(map[string]*media_items.MediaItem, len(cloudItems))
+	for _, item := range cloudItems {
+		cloudItemsByID[item.ID] = item
+	}
+
+	result := ReconcileResult{MissingInCloud: []ReconcileFile{}, UnrecordedFiles: []string{}, MissingLocally: []ReconcileMediaItem{}}
+	matchedIDs := make(map[string]bool)
+	for _, path := range paths {
+		mediaItemID, ok := mediaItemIDs[filepath.Base(path)]
+		if !ok {
+			result.UnrecordedFiles = append(result.UnrecordedFiles, path)
+			continue
+		}
+		if _, ok := cloudItemsByID[mediaItemID]; !ok {
+			exists, err := mediaItemExists(ctx, gphotosClient, cfg.Upload.MaxRetries, limiter, mediaItemID)
+			if err != nil {
+				return result, fmt.Errorf("failed to check media item %s of %s: %w", mediaItemID, path, err)
+			}
+			if !exists {
+				result.MissingInCloud = append(result.MissingInCloud, ReconcileFile{Path: path, MediaItemID: mediaItemID})
+				continue
+			}
+		}
+		result.MatchedCount++
+		matchedIDs[mediaItemID] = true
+	}
+
+	for _, item := range cloudItems {
+		if matchedIDs[item.ID] {
+			continue
+		}
+		result.MissingLocally = append(result.MissingLocally, ReconcileMediaItem{
+			ID:           item.ID,
+			Filename:     item.Filename,
+			CreationTime: item.MediaMetadata.CreationTime,
+			ProductURL:   item.ProductURL,
+		})
+	}
+	sort.SliceStable(result.MissingLocally, func(i, j int) bool {
+		return result.MissingLocally[i].CreationTime < result.MissingLocally[j].CreationTime
+	})
+	return result, nil
+}
+
+// mediaItemExists returns whether the media item mediaItemID is in Google Photos.
+func mediaItemExists(ctx context.Context, gphotosClient GPhotosClient, maxRetries int, limiter *rate.Limiter, mediaItemID string) (bool, error) {
+	if err := limiter.Wait(ctx); err != nil {
+		return false, fmt.Errorf("rate limiter error before getting media item %s: %w", mediaItemID, err)
+	}
+	mediaItem, err := callWithRetries(ctx, maxRetries, limiter, func() (*media_items.MediaItem, error) {
+		mediaItem, err := gphotosClient.MediaItems().Get(ctx, mediaItemID)
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return mediaItem, err
+	})
+	if err != nil {
+		return false, err
+	}
+	return mediaItem != nil, nil
+}
+
+// WriteReconcileJSON writes result to w as indented JSON.
+func WriteReconcileJSON(w io.Writer, result ReconcileResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		return fmt.Errorf("failed to write reconcile result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+func TestReconcile(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	cacheDir := t.TempDir()
+	dayDir := filepath.Join(cfg.PhotosUploadedRoot, "2024", "05", "03")
+	require.NoError(t, os.MkdirAll(dayDir, 0755))
+	photoPath := func(name string) string { return filepath.Join(dayDir, "2024-05-03-"+name+".jpg") }
+	for _, name := range []string{"a", "b", "c", "unrecorded"} {
+		require.NoError(t, os.WriteFile(photoPath(name), []byte(name), 0644))
+		if name != "unrecorded" {
+			require.NoError(t, recordInDayIndex(photoPath(name), 1, "id-"+name))
+		}
+	}
+	// Files outside the range aren't checked.
+	createDummyFile(t, filepath.Join(cfg.PhotosUploadedRoot, "2024", "06", "01", "2024-06-01-later.jpg"), "later", time.Now())
+	// Videos are checked too, with their media items from the upload ledger.
+	videoPath := filepath.Join(cfg.VideosUploadedRoot, "2024", "05", "04", "2024-05-04-video.mp4")
+	createDummyFile(t, videoPath, "video", time.Now())
+	require.NoError(t, newUploadLedger(getUploadLedgerPath(cacheDir)).record(context.Background(), videoPath, 0, "id-video", "", nil, time.Now()))
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+	mockMediaItemsSvc.EXPECT().Search(gomock.Any(), from, to).Return([]*media_items.MediaItem{
+		{ID: "id-a", Filename: "2024-05-03-a.jpg"},
+		{ID: "id-video", Filename: "2024-05-04-video.mp4"},
+		{ID: "id-other", Filename: "2024-05-09-other.jpg", ProductURL: "https://photos.example/other",
+			MediaMetadata: media_items.MediaMetadata{CreationTime: "2024-05-09T10:00:00Z"}},
+	}, nil)
+	// b's media item is dated outside the range, eg because the camera's clock was off, so it is looked up.
+	mockMediaItemsSvc.EXPECT().Get(gomock.Any(), "id-b").Return(&media_items.MediaItem{ID: "id-b"}, nil)
+	// c's media item was deleted in Google Photos.
+	mockMediaItemsSvc.EXPECT().Get(gomock.Any(), "id-c").Return(nil, fmt.Errorf("getting media item id-c: %w", &googleapi.Error{Code: http.StatusNotFound}))
+
+	res, err := Reconcile(context.Background(), cfg, cacheDir, from, to, mockGPhotosClient)
+	require.NoError(t, err)
+	assert.Equal(t, ReconcileResult{
+		MatchedCount:    3,
+		MissingInCloud:  []ReconcileFile{{Path: photoPath("c"), MediaItemID: "id-c"}},
+		UnrecordedFiles: []string{photoPath("unrecorded")},
+		MissingLocally: []ReconcileMediaItem{
+			{ID: "id-other", Filename: "2024-05-09-other.jpg", CreationTime: "2024-05-09T10:00:00Z", ProductURL: "https://photos.example/other"},
+		},
+	}, res)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteReconcileJSON(&out, res))
+	var decoded ReconcileResult
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, res, decoded)
+}
+
+func TestReconcile_SearchFails(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	cfg.Upload.MaxRetries = 0
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	mockMediaItemsSvc.EXPECT().Search(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, ErrInsufficientScope)
+
+	date := time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)
+	_, err := Reconcile(context.Background(), cfg, t.TempDir(), date, date, mockGPhotosClient)
+	assert.ErrorIs(t, err, ErrInsufficientScope)
+}
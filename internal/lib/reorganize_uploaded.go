@@ -0,0 +1,187 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// ReorganizeResult reports what ReorganizeUploaded did (or would do, in a dry run).
+type ReorganizeResult struct {
+	// Moved is the number of files moved into their expected location.
+	Moved int
+	// InPlace is the number of files already in their expected location.
+	InPlace int
+	// Collisions lists files that were not moved because their expected location is already taken.
+	Collisions []string
+	// Unparseable lists files whose names don't have a date prefix, so were left in place.
+	Unparseable []string
+}
+
+// ReorganizeUploaded moves the files in the photo and video uploaded dirs into the location that
+// camflow currently uses for them, based on each file's date prefix, or its EXIF capture date when
+// upload.uploaded_date is exif, as upload does. The day index entries of the files are moved with them.
+// Directories that are left empty are removed.
+func ReorganizeUploaded(ctx context.Context, cfg config.CamflowConfig, dryRun bool) (ReorganizeResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return ReorganizeResult{}, fmt.Errorf("invalid config: %w", err)
+	}
+	// The queue structure of uploaded files isn't recorded, so there is no location to move them to.
+	if cfg.Upload.KeepQueueStructure {
+		return ReorganizeResult{}, fmt.Errorf("cannot reorganize uploaded dirs when upload.keep_queue_structure is set")
+	}
+
+	var result ReorganizeResult
+	for _, root := range []struct {
+		localConfig LocalConfig
+		gpConfig    GPConfig
+	}{
+		{&cfg.LocalPhotos, &cfg.GooglePhotos.Photos},
+		{&cfg.LocalVideos, &cfg.GooglePhotos.Videos},
+	} {
+		if err := reorganizeUploadedRoot(ctx, root.localConfig, root.gpConfig, cfg.Upload, dryRun, &result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// reorganizeUploadedRoot reorganizes the files under localConfig's uploaded root and adds the outcome to result.
+func reorganizeUploadedRoot(ctx context.Context, localConfig LocalConfig, gpConfig GPConfig, uploadConfig config.UploadConfig, dryRun bool, result *ReorganizeResult) error {
+	uploadedRoot := localConfig.GetUploadedRoot()
+	if _, err := os.Stat(uploadedRoot); os.IsNotExist(err) {
+		logger.Info("Uploaded directory does not exist, nothing to reorganize",
+			slog.String("uploaded_root", uploadedRoot))
+		return nil
+	}
+
+	// Collect the files before moving any, so that the walk doesn't see files it already moved.
+	var items []itemFileInfo
+	err := filepath.WalkDir(uploadedRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || isIgnoredQueueFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to get file info for %s: %w", path, err)
+		}
+		items = append(items, itemFileInfo{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk uploaded dir %s: %w", uploadedRoot, err)
+	}
+
+	if uploadConfig.UploadedDate == config.UploadedDateExif {
+		// Date the files as upload did, so that companions stay with the file that they were moved with.
+		items = pairRawJpegFiles(items, gpConfig.GetRawJpegPairs())
+		paths := make([]string, len(items))
+		for i, item := range items {
+			paths[i] = item.path
+		}
+		exifs, err := getExifMetadata(ctx, paths, nil)
+		if err != nil {
+			return fmt.Errorf("failed to get EXIF metadata of uploaded files: %w", err)
+		}
+		setUploadedDates(items, exifs, uploadConfig.CaptureLocation)
+		var files []itemFileInfo
+		for _, item := range items {
+			companions := item.companions
+			item.companions = nil
+			files = append(files, item)
+			files = append(files, companions...)
+		}
+		items = files
+	}
+
+	// The destinations that files were moved to in this run. A dry run doesn't create them, so they
+	// can't be found with os.Stat.
+	claimed := make(map[string]bool)
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		destPath, err := uploadedPath(localConfig, item, false)
+		if err != nil {
+			logger.Warn("Skipping file without a date prefix",
+				slog.String("path", item.path))
+			result.Unparseable = append(result.Unparseable, item.path)
+			continue
+		}
+		if destPath == item.path {
+			result.InPlace++
+			continue
+		}
+		if _, err := os.Stat(destPath); err == nil || claimed[destPath] {
+			logger.Warn("Skipping file whose destination already exists",
+				slog.String("from", item.path),
+				slog.String("to", destPath))
+			result.Collisions = append(result.Collisions, item.path)
+			continue
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to check destination %s: %w", destPath, err)
+		}
+
+		claimed[destPath] = true
+		if dryRun {
+			logger.Debug("Would move file",
+				slog.String("from", item.path),
+				slog.String("to", destPath))
+			result.Moved++
+			continue
+		}
+
+		logger.Debug("Moving file",
+			slog.String("from", item.path),
+			slog.String("to", destPath))
+		if err := moveFile(item.path, destPath, item.size, item.modTime, uploadConfig.MoveMode); err != nil {
+			return err
+		}
+		result.Moved++
+		if err := moveDayIndexEntry(item.path, destPath); err != nil {
+			return err
+		}
+
+		if err := cleanupEmptyTargetRootDirectories(uploadedRoot, filepath.Dir(item.path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupEmptyTargetRootDirectories removes dir and then each of its parents, stopping at the first
+// one that isn't empty. It never removes root itself, and does nothing if dir is not inside root.
+// It is safe to call concurrently for dirs with shared parents: a dir that another call already
+// removed also stops the cleanup, since that call goes on to clean up the parents.
+func cleanupEmptyTargetRootDirectories(root, dir string) error {
+	root = filepath.Clean(root)
+	dir = filepath.Clean(dir)
+	for {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+
+		if err := os.Remove(dir); err != nil {
+			if errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EEXIST) || errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("failed to remove empty directory %s: %w", dir, err)
+		}
+		logger.Debug("Removed empty directory",
+			slog.String("dir", dir))
+		dir = filepath.Dir(dir)
+	}
+}
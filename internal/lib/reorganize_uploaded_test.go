@@ -0,0 +1,213 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorganizeUploaded(t *testing.T) {
+	t.Run("MovesMisplacedFiles", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		createDirStructure(t, cfg.PhotosUploadedRoot, map[string]string{
+			"2024/05/01/2024-05-01-IMG_0001.JPG": "in place",
+			"2024-05-02-IMG_0002.JPG":            "flat",
+			"old/layout/2024-05-03-IMG_0003.JPG": "nested",
+		})
+		createDirStructure(t, cfg.VideosUploadedRoot, map[string]string{
+			"2024/05/2024-05-04-VID_0001.MP4": "video",
+		})
+
+		res, err := ReorganizeUploaded(context.Background(), cfg, false)
+		require.NoError(t, err)
+		assert.Equal(t, 3, res.Moved)
+		assert.Equal(t, 1, res.InPlace)
+		assert.Empty(t, res.Collisions)
+		assert.Empty(t, res.Unparseable)
+
+		for _, path := range []string{
+			filepath.Join(cfg.PhotosUploadedRoot, "2024", "05", "01", "2024-05-01-IMG_0001.JPG"),
+			filepath.Join(cfg.PhotosUploadedRoot, "2024", "05", "02", "2024-05-02-IMG_0002.JPG"),
+			filepath.Join(cfg.PhotosUploadedRoot, "2024", "05", "03", "2024-05-03-IMG_0003.JPG"),
+			filepath.Join(cfg.VideosUploadedRoot, "2024", "05", "04", "2024-05-04-VID_0001.MP4"),
+		} {
+			_, err := os.Stat(path)
+			assert.NoError(t, err, "Expected file at %s", path)
+		}
+
+		// Directories emptied by the moves are removed, but the uploaded roots remain.
+		assertDirNotExists(t, filepath.Join(cfg.PhotosUploadedRoot, "old"), "Expected emptied dir to be removed")
+		assertDirExists(t, filepath.Join(cfg.VideosUploadedRoot, "2024", "05"), "Expected dir that is still in use to remain")
+		assertDirExists(t, cfg.PhotosUploadedRoot, "Expected uploaded root to remain")
+	})
+
+	t.Run("KeepQueueStructure", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		cfg.Upload.KeepQueueStructure = true
+		createDirStructure(t, cfg.PhotosUploadedRoot, map[string]string{
+			"Trips/Japan/2024-05-03-IMG_0003.JPG": "kept in its queue dir",
+		})
+
+		_, err := ReorganizeUploaded(context.Background(), cfg, false)
+		assert.ErrorContains(t, err, "keep_queue_structure")
+		_, err = os.Stat(filepath.Join(cfg.PhotosUploadedRoot, "Trips", "Japan", "2024-05-03-IMG_0003.JPG"))
+		assert.NoError(t, err, "Expected the file to be left in place")
+	})
+
+	t.Run("CollisionAndUnparseableLeftInPlace", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		createDirStructure(t, cfg.PhotosUploadedRoot, map[string]string{
+			"2024/05/01/2024-05-01-IMG_0001.JPG": "original",
+			"misc/2024-05-01-IMG_0001.JPG":       "duplicate",
+			"misc/notes.txt":                     "no date prefix",
+		})
+
+		res, err := ReorganizeUploaded(context.Background(), cfg, false)
+		require.NoError(t, err)
+		assert.Equal(t, 0, res.Moved)
+		assert.Equal(t, []string{filepath.Join(cfg.PhotosUploadedRoot, "misc", "2024-05-01-IMG_0001.JPG")}, res.Collisions)
+		assert.Equal(t, []string{filepath.Join(cfg.PhotosUploadedRoot, "misc", "notes.txt")}, res.Unparseable)
+
+		content, err := os.ReadFile(filepath.Join(cfg.PhotosUploadedRoot, "2024", "05", "01", "2024-05-01-IMG_0001.JPG"))
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(content), "Existing file must not be overwritten")
+	})
+
+	t.Run("MovesDayIndexEntries", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		createDirStructure(t, cfg.PhotosUploadedRoot, map[string]string{
+			"old/2024-05-03-IMG_0003.JPG": "nested",
+		})
+		oldPath := filepath.Join(cfg.PhotosUploadedRoot, "old", "2024-05-03-IMG_0003.JPG")
+		require.NoError(t, recordInDayIndex(oldPath, 6, "media-3"))
+
+		res, err := ReorganizeUploaded(context.Background(), cfg, false)
+		require.NoError(t, err)
+		assert.Equal(t, 1, res.Moved)
+
+		index, err := readDayIndex(filepath.Join(cfg.PhotosUploadedRoot, "2024", "05", "03"))
+		require.NoError(t, err)
+		assert.Equal(t, []dayIndexEntry{{File: "2024-05-03-IMG_0003.JPG", Size: 6, MediaItemID: "media-3"}}, index.Files)
+		assertDirNotExists(t, filepath.Join(cfg.PhotosUploadedRoot, "old"), "Expected the dir to be removed with its emptied day index")
+	})
+
+	t.Run("ExifUploadedDate", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		cfg.Upload.UploadedDate = config.UploadedDateExif
+		cfg.GooglePhotos.Photos.RawJpegPairs = config.RawJpegPairsJpegOnly
+		createDirStructure(t, cfg.PhotosUploadedRoot, map[string]string{
+			// Upload moved this pair to the dir of the capture date of the JPEG, not of their names.
+			"2023/12/31/2024-01-01-IMG_0001.JPG": "jpeg",
+			"2023/12/31/2024-01-01-IMG_0001.CR3": "raw",
+			"2024-01-02-IMG_0002.JPG":            "flat",
+		})
+
+		// Put an exiftool on the PATH that reports the capture date of the JPEG of the pair.
+		exifOutput, err := json.Marshal([]map[string]string{
+			{"SourceFile": filepath.Join(cfg.PhotosUploadedRoot, "2023", "12", "31", "2024-01-01-IMG_0001.JPG"), "DateTimeOriginal": "2023:12:31 23:30:00"},
+			{"SourceFile": filepath.Join(cfg.PhotosUploadedRoot, "2024-01-02-IMG_0002.JPG")},
+		})
+		require.NoError(t, err)
+		binDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(binDir, "exiftool"), []byte("#!/bin/sh\ncat <<'EOF'\n"+string(exifOutput)+"\nEOF\n"), 0755))
+		t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		res, err := ReorganizeUploaded(context.Background(), cfg, false)
+		require.NoError(t, err)
+		assert.Equal(t, 1, res.Moved)
+		assert.Equal(t, 2, res.InPlace, "The pair should stay in the dir of its capture date")
+		assert.FileExists(t, filepath.Join(cfg.PhotosUploadedRoot, "2024", "01", "02", "2024-01-02-IMG_0002.JPG"))
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		misplaced := filepath.Join(cfg.PhotosUploadedRoot, "2024-05-02-IMG_0002.JPG")
+		createDirStructure(t, cfg.PhotosUploadedRoot, map[string]string{
+			"2024-05-02-IMG_0002.JPG": "flat",
+		})
+
+		res, err := ReorganizeUploaded(context.Background(), cfg, true)
+		require.NoError(t, err)
+		assert.Equal(t, 1, res.Moved)
+
+		_, err = os.Stat(misplaced)
+		assert.NoError(t, err, "Dry run must not move files")
+	})
+
+	t.Run("DryRunCollision", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		createDirStructure(t, cfg.PhotosUploadedRoot, map[string]string{
+			"a/2024-05-02-IMG_0002.JPG": "first",
+			"b/2024-05-02-IMG_0002.JPG": "second",
+		})
+		want := ReorganizeResult{
+			Moved:      1,
+			Collisions: []string{filepath.Join(cfg.PhotosUploadedRoot, "b", "2024-05-02-IMG_0002.JPG")},
+		}
+
+		res, err := ReorganizeUploaded(context.Background(), cfg, true)
+		require.NoError(t, err)
+		assert.Equal(t, want, res, "A dry run should report the collision that a real run would")
+
+		res, err = ReorganizeUploaded(context.Background(), cfg, false)
+		require.NoError(t, err)
+		assert.Equal(t, want, res)
+	})
+}
+
+func TestCleanupEmptyTargetRootDirectories(t *testing.T) {
+	root := t.TempDir()
+	createDirStructure(t, root, map[string]string{
+		"a/keep.txt": "content",
+	})
+	emptyLeaf := filepath.Join(root, "a", "b", "c")
+	require.NoError(t, os.MkdirAll(emptyLeaf, 0755))
+
+	require.NoError(t, cleanupEmptyTargetRootDirectories(root, emptyLeaf))
+
+	assertDirNotExists(t, filepath.Join(root, "a", "b"), "Expected empty chain to be removed")
+	assertDirExists(t, filepath.Join(root, "a"), "Expected non-empty parent to remain")
+
+	// The root itself is never removed, even when empty.
+	emptyRoot := t.TempDir()
+	require.NoError(t, cleanupEmptyTargetRootDirectories(emptyRoot, emptyRoot))
+	assertDirExists(t, emptyRoot, "Expected root to remain")
+}
+
+func TestCleanupEmptyTargetRootDirectories_Concurrent(t *testing.T) {
+	// Run with -race. Each goroutine cleans up its own leaf, and they race to remove the shared parents.
+	for range 20 {
+		root := t.TempDir()
+		createDirStructure(t, root, map[string]string{
+			"2024/01/keep.txt": "content",
+		})
+		var leaves []string
+		for i := range 8 {
+			// Two goroutines clean up each leaf, so that some find it already removed.
+			leaf := filepath.Join(root, "2024", "05", fmt.Sprintf("%02d", i+1), "a")
+			require.NoError(t, os.MkdirAll(leaf, 0755))
+			leaves = append(leaves, leaf, leaf)
+		}
+
+		var wg sync.WaitGroup
+		for _, leaf := range leaves {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, cleanupEmptyTargetRootDirectories(root, leaf))
+			}()
+		}
+		wg.Wait()
+
+		assertDirNotExists(t, filepath.Join(root, "2024", "05"), "Expected the shared empty parent to be removed")
+		assertDirExists(t, filepath.Join(root, "2024", "01"), "Expected the non-empty dir to remain")
+	}
+}
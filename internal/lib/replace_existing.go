@@ -0,0 +1,57 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
+)
+
+// findReplacedMediaItem returns the media item that the file at filePath was uploaded as before,
+// or nil if there is none. previousIDs maps file basenames to media item IDs, from the upload ledger.
+// Only media items in the upload ledger are returned, which camflow created, so that replacing
+// an upload can't touch the other items in the library.
+// It returns nil if the media item no longer exists, eg because it was deleted in Google Photos.
+func findReplacedMediaItem(ctx context.Context, gphotosClient GPhotosClient, maxRetries int, limiter *rate.Limiter, previousIDs map[string]string, filePath string) (*media_items.MediaItem, error) {
+	previousID, ok := previousIDs[filepath.Base(filePath)]
+	if !ok {
+		return nil, nil
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limiter error before getting media item %s: %w", previousID, err)
+	}
+	mediaItem, err := callWithRetries(ctx, maxRetries, limiter, func() (*media_items.MediaItem, error) {
+		mediaItem, err := gphotosClient.MediaItems().Get(ctx, previousID)
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return mediaItem, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earlier media item %s of %s: %w", previousID, filepath.Base(filePath), err)
+	}
+	if mediaItem == nil {
+		logger.Debug("Earlier media item no longer exists, so there is nothing to replace",
+			slog.String("file", filepath.Base(filePath)),
+			slog.String("media_id", previousID))
+	}
+	return mediaItem, nil
+}
+
+// removeReplacedMediaItem removes the replaced media item from the albums albumIDs,
+// that its replacement was added to.
+func removeReplacedMediaItem(ctx context.Context, albumWriter *albumWriter, replaced *media_items.MediaItem, albumIDs []string) error {
+	for _, albumID := range albumIDs {
+		if err := albumWriter.removeMediaItems(ctx, albumID, []string{replaced.ID}); err != nil {
+			return fmt.Errorf("failed to remove replaced media item %s from album %s: %w", replaced.ID, albumID, err)
+		}
+	}
+	return nil
+}
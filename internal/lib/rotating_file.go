@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// rotatingFile is a log file that is rotated when it would grow beyond maxSize bytes.
+// The current file is at path, and the rotated files are at path.1 (the newest) to path.keep,
+// with a .gz suffix if they are compressed. It is safe for concurrent use.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	keep     int
+	compress bool
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// openRotatingFile opens the rotating file at path, appending to any existing file.
+func openRotatingFile(path string, maxSize int64, keep int, compress bool) (*rotatingFile, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid max log file size %d: must be positive", maxSize)
+	}
+	if keep < 0 {
+		return nil, fmt.Errorf("invalid number of log files to keep %d: must not be negative", keep)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dir for log file %s: %w", path, err)
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, keep: keep, compress: compress}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", r.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", r.path, err)
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// Write writes p to the file, first rotating it if p would make it grow beyond maxSize.
+// A single write larger than maxSize is written to a new file of its own.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// rotatedPath returns the path of the i'th newest rotated file.
+func (r *rotatingFile) rotatedPath(i int) string {
+	path := fmt.Sprintf("%s.%d", r.path, i)
+	if r.compress {
+		path += ".gz"
+	}
+	return path
+}
+
+// rotate moves the current file to path.1, shifting the older rotated files and removing the oldest,
+// and opens a new, empty file.
+// The caller is expected to hold r.mu.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file %s: %w", r.path, err)
+	}
+	if err := os.Remove(r.rotatedPath(r.keep)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old log file: %w", err)
+	}
+	for i := r.keep - 1; i >= 1; i-- {
+		if err := os.Rename(r.rotatedPath(i), r.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	switch {
+	case r.keep == 0:
+		if err := os.Remove(r.path); err != nil {
+			return fmt.Errorf("failed to remove log file %s: %w", r.path, err)
+		}
+	case r.compress:
+		if err := gzipFile(r.path, r.rotatedPath(1)); err != nil {
+			return err
+		}
+		if err := os.Remove(r.path); err != nil {
+			return fmt.Errorf("failed to remove log file %s: %w", r.path, err)
+		}
+	default:
+		if err := os.Rename(r.path, r.rotatedPath(1)); err != nil {
+			return fmt.Errorf("failed to rotate log file %s: %w", r.path, err)
+		}
+	}
+	return r.open()
+}
+
+// gzipFile writes the gzipped content of the file at src to dst.
+func gzipFile(src, dst string) (retErr error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer func() {
+		if err := out.Close(); err != nil && retErr == nil {
+			retErr = fmt.Errorf("failed to close %s: %w", dst, err)
+		}
+	}()
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", src, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", src, err)
+	}
+	return nil
+}
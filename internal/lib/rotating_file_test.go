@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "debug.log")
+	file, err := openRotatingFile(path, 10, 2, false)
+	require.NoError(t, err)
+	defer file.Close()
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		_, err := file.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	readFile := func(path string) string {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "gggg\n", readFile(path))
+	assert.Equal(t, "eeee\nffff\n", readFile(path+".1"))
+	assert.Equal(t, "cccc\ndddd\n", readFile(path+".2"))
+	assert.NoFileExists(t, path+".3", "No more than keep rotated files should be kept")
+}
+
+func TestRotatingFile_AppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "debug.log")
+	require.NoError(t, os.WriteFile(path, []byte("aaaaaaaa\n"), 0644))
+	file, err := openRotatingFile(path, 10, 1, false)
+	require.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.Write([]byte("bbbb\n"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "aaaaaaaa\n", string(data), "The existing file's size should count towards the max size")
+}
+
+func TestRotatingFile_Compress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "debug.log")
+	file, err := openRotatingFile(path, 10, 2, true)
+	require.NoError(t, err)
+	defer file.Close()
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n"} {
+		_, err := file.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	readGzipFile := func(path string) string {
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		data, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "cccc\ndddd\n", readGzipFile(path+".1.gz"))
+	assert.Equal(t, "aaaa\nbbbb\n", readGzipFile(path+".2.gz"))
+	assert.NoFileExists(t, path+".1", "The rotated file should only be kept compressed")
+}
+
+func TestOpenRotatingFile_InvalidArgs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "debug.log")
+	_, err := openRotatingFile(path, 0, 1, false)
+	assert.ErrorContains(t, err, "max log file size")
+	_, err = openRotatingFile(path, 10, -1, false)
+	assert.ErrorContains(t, err, "to keep")
+}
@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RunReport is the summary of a command's run, for monitoring scheduled runs.
+type RunReport struct {
+	Command        string    `json:"command"`
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+	DryRun         bool      `json:"dry_run"`
+	// AccountLabel is the config's AccountLabel, which names the account that the run targeted.
+	AccountLabel string `json:"account_label,omitempty"`
+	// Error is the error that the run ended with, if any. The rest of the report is then partial.
+	Error  string               `json:"error,omitempty"`
+	Import *ImportReportSummary `json:"import,omitempty"`
+	Upload *UploadReportSummary `json:"upload,omitempty"`
+}
+
+// ImportReportSummary summarizes an ImportResult.
+type ImportReportSummary struct {
+	PhotoCount    int           `json:"photo_count"`
+	VideoCount    int           `json:"video_count"`
+	ZeroByteFiles []string      `json:"zero_byte_files,omitempty"`
+	SkippedFiles  []SkippedFile `json:"skipped_files,omitempty"`
+}
+
+// UploadReportSummary summarizes an UploadReport.
+type UploadReportSummary struct {
+	UploadedCount int              `json:"uploaded_count"`
+	FailedCount   int              `json:"failed_count"`
+	FailedPaths   []string         `json:"failed_paths,omitempty"`
+	Albums        []AlbumItemCount `json:"albums,omitempty"`
+	// CreatedAlbumCount is the number of albums that the run created, or in a dry run would have.
+	CreatedAlbumCount int `json:"created_album_count"`
+}
+
+// newRunReport returns the report of a run of command from startedAt to finishedAt, which ended with err.
+func newRunReport(command string, startedAt, finishedAt time.Time, dryRun bool, err error) RunReport {
+	report := RunReport{
+		Command:        command,
+		StartedAt:      startedAt,
+		FinishedAt:     finishedAt,
+		ElapsedSeconds: finishedAt.Sub(startedAt).Seconds(),
+		DryRun:         dryRun,
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+// NewImportRunReport returns the report of an import run that returned res and err.
+func NewImportRunReport(command string, startedAt, finishedAt time.Time, dryRun bool, res ImportResult, err error) RunReport {
+	report := newRunReport(command, startedAt, finishedAt, dryRun, err)
+	report.Import = &ImportReportSummary{ZeroByteFiles: res.ZeroByteFiles, SkippedFiles: res.SkippedFiles}
+	for _, f := range res.ImportedFiles {
+		switch f.ItemType {
+		case ItemTypePhoto:
+			report.Import.PhotoCount++
+		case ItemTypeVideo:
+			report.Import.VideoCount++
+		}
+	}
+	return report
+}
+
+// NewUploadRunReport returns the report of an upload run that returned uploadReport and err.
+func NewUploadRunReport(command string, startedAt, finishedAt time.Time, dryRun bool, uploadReport UploadReport, err error) RunReport {
+	report := newRunReport(command, startedAt, finishedAt, dryRun, err)
+	report.Upload = &UploadReportSummary{
+		UploadedCount: len(uploadReport.UploadedItems),
+		FailedCount:   len(uploadReport.FailedPaths),
+		FailedPaths:   uploadReport.FailedPaths,
+		Albums:        uploadReport.AlbumItemCounts(),
+
+		CreatedAlbumCount: len(uploadReport.CreatedAlbums),
+	}
+	return report
+}
+
+// WriteRunReport writes report as JSON to path, replacing any existing file.
+// It is written with writeFileAtomic, so that readers never see a partial report.
+func WriteRunReport(path string, report RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run report: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write run report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewImportRunReport(t *testing.T) {
+	startedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	res := ImportResult{
+		ImportedFiles: []ImportedFile{
+			{SrcPath: "IMG_0001.JPG", ItemType: ItemTypePhoto},
+			{SrcPath: "IMG_0002.CR3", ItemType: ItemTypePhoto},
+			{SrcPath: "MVI_0003.MP4", ItemType: ItemTypeVideo},
+		},
+		ZeroByteFiles: []string{"IMG_0004.JPG"},
+		SkippedFiles:  []SkippedFile{{Path: "IMG_0004.JPG", Reason: SkipReasonZeroByte}},
+	}
+
+	report := NewImportRunReport("import", startedAt, startedAt.Add(90*time.Second), false, res, nil)
+	assert.Equal(t, "import", report.Command)
+	assert.Equal(t, 90.0, report.ElapsedSeconds)
+	assert.Empty(t, report.Error)
+	assert.Nil(t, report.Upload)
+	assert.Equal(t, &ImportReportSummary{
+		PhotoCount:    2,
+		VideoCount:    1,
+		ZeroByteFiles: []string{"IMG_0004.JPG"},
+		SkippedFiles:  []SkippedFile{{Path: "IMG_0004.JPG", Reason: SkipReasonZeroByte}},
+	}, report.Import)
+}
+
+func TestWriteRunReport_PartialUpload(t *testing.T) {
+	startedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	uploadReport := UploadReport{
+		UploadedItems: []UploadedItem{{Path: "a.jpg", AlbumTitles: []string{"Default"}}},
+		FailedPaths:   []string{"b.jpg"},
+		CreatedAlbums: []string{"Default"},
+	}
+	report := NewUploadRunReport("upload-photos", startedAt, startedAt.Add(time.Second), true, uploadReport, errors.New("api failed"))
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0644))
+	require.NoError(t, WriteRunReport(path, report))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "upload-photos", got["command"])
+	assert.Equal(t, "api failed", got["error"], "The error should be reported along with the partial summary")
+	assert.Equal(t, true, got["dry_run"])
+	assert.Equal(t, map[string]any{
+		"uploaded_count": 1.0,
+		"failed_count":   1.0,
+		"failed_paths":   []any{"b.jpg"},
+		"albums":         []any{map[string]any{"album_title": "Default", "item_count": 1.0, "failed_item_count": 0.0}},
+
+		"created_album_count": 1.0,
+	}, got["upload"])
+	assert.NotContains(t, got, "import")
+	assert.NotContains(t, got, "account_label", "An unset account label should be left out")
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "The temporary file should be renamed to the report file")
+}
+
+func TestWriteRunReport_AccountLabel(t *testing.T) {
+	startedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	report := NewUploadRunReport("upload-videos", startedAt, startedAt.Add(time.Second), false, UploadReport{}, nil)
+	report.AccountLabel = "Personal"
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, WriteRunReport(path, report))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "Personal", got["account_label"])
+}
@@ -0,0 +1,282 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// scanCacheVersion is the version of the scan cache format. A cache with another version is rebuilt.
+const scanCacheVersion = 3
+
+// scanCache records the listing of the dirs of the upload queues, with the EXIF metadata of their files,
+// so that an upload of a big queue only lists the dirs that changed and only reads the metadata of new
+// or changed files.
+type scanCache struct {
+	Version int `json:"version"`
+	// Trees maps the root of each upload queue to its listing.
+	Trees map[string]*scanCacheTree `json:"trees"`
+}
+
+// scanCacheTree is the listing of an upload queue.
+type scanCacheTree struct {
+	// Dirs maps the path of each dir relative to the upload queue root, "." for the root, to its listing.
+	Dirs map[string]scanCacheDir `json:"dirs"`
+
+	// files indexes the file entries of Dirs by their paths relative to the upload queue root.
+	// It is built when first needed.
+	files map[string]*scanCacheEntry
+}
+
+// scanCacheDir is the listing of a dir, which is valid while the dir's modification time is ModTime.
+type scanCacheDir struct {
+	ModTime time.Time `json:"mod_time"`
+	// Entries are the files and subdirs of the dir, sorted by name.
+	Entries []scanCacheEntry `json:"entries"`
+}
+
+// scanCacheEntry is a file or subdir in a scanCacheDir.
+type scanCacheEntry struct {
+	Name    string    `json:"name"`
+	IsDir   bool      `json:"is_dir,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time,omitzero"`
+	// Exif is the EXIF metadata of the file, without its path, or nil if it hasn't been read.
+	Exif *ExifData `json:"exif,omitempty"`
+}
+
+// scanCacheStats counts the dirs whose cached listing was reused and the dirs that were listed again.
+type scanCacheStats struct {
+	reusedDirs int
+	listedDirs int
+}
+
+// getScanCachePath constructs the path to the scan cache file.
+func getScanCachePath(cacheDir string) string {
+	return filepath.Join(cacheDir, "upload_queue_scan_cache.json")
+}
+
+// loadScanCache loads the scan cache from path. If there isn't a usable cache, eg because it is from
+// another version of camflow or is corrupt, it returns an empty cache, so that the queues are scanned in full.
+func loadScanCache(path string) *scanCache {
+	cache := &scanCache{Version: scanCacheVersion, Trees: make(map[string]*scanCacheTree)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("Failed to read scan cache, rebuilding it",
+				slog.String("path", path),
+				slog.String("error", err.Error()))
+		}
+		return cache
+	}
+	var loaded scanCache
+	if err := json.Unmarshal(data, &loaded); err != nil || loaded.Version != scanCacheVersion || loaded.Trees == nil {
+		logger.Warn("Scan cache is invalid or from another version of camflow, rebuilding it",
+			slog.String("path", path))
+		return cache
+	}
+	return &loaded
+}
+
+// save writes the scan cache to path, with writeFileAtomic so that an interrupted save doesn't leave a partial cache.
+func (c *scanCache) save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode scan cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for scan cache %s: %w", path, err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save scan cache: %w", err)
+	}
+	return nil
+}
+
+// tree returns the listing of the upload queue at root, which is empty if root hasn't been scanned.
+func (c *scanCache) tree(root string) *scanCacheTree {
+	tree, ok := c.Trees[root]
+	if !ok {
+		tree = &scanCacheTree{Dirs: make(map[string]scanCacheDir)}
+		c.Trees[root] = tree
+	}
+	return tree
+}
+
+// scanUploadQueueCached returns the files in the upload queue at uploadQueueDir and their total size,
+// like scanUploadQueue with config.SymlinksSkip, and updates tree to match. The listings of dirs whose
+// modification time hasn't changed are reused from tree, after checking that their files haven't changed.
+// Dirs that changed are listed again, and the cached EXIF metadata of their unchanged files is kept.
+func scanUploadQueueCached(uploadQueueDir string, tree *scanCacheTree) ([]itemFileInfo, int64, scanCacheStats, error) {
+	var stats scanCacheStats
+	if _, err := os.Stat(uploadQueueDir); os.IsNotExist(err) {
+		return nil, 0, stats, fmt.Errorf("upload queue directory does not exist: %s", uploadQueueDir)
+	}
+
+	var items []itemFileInfo
+	var totalSize int64
+	dirs := make(map[string]scanCacheDir, len(tree.Dirs))
+	var scanDir func(relDir string) error
+	scanDir = func(relDir string) error {
+		dirPath := filepath.Join(uploadQueueDir, relDir)
+		info, err := os.Stat(dirPath)
+		if err != nil {
+			return err
+		}
+		cached, ok := tree.Dirs[relDir]
+		if ok && cached.ModTime.Equal(info.ModTime()) && scanCacheFilesUnchanged(dirPath, cached) {
+			stats.reusedDirs++
+		} else {
+			stats.listedDirs++
+			if cached, err = listScanCacheDir(dirPath, info.ModTime(), cached); err != nil {
+				return err
+			}
+		}
+		dirs[relDir] = cached
+
+		for _, entry := range cached.Entries {
+			if !entry.IsDir {
+				items = append(items, itemFileInfo{path: filepath.Join(dirPath, entry.Name), size: entry.Size, modTime: entry.ModTime})
+				totalSize += entry.Size
+				continue
+			}
+			subdir := filepath.Join(relDir, entry.Name)
+			if err := scanDir(subdir); err != nil {
+				// As for scanUploadQueue, skip the dirs that can't be read.
+				logger.Error("Error accessing path during scan, skipping",
+					slog.String("path", filepath.Join(uploadQueueDir, subdir)),
+					slog.String("error", err.Error()))
+			}
+		}
+		return nil
+	}
+	if err := scanDir("."); err != nil {
+		return nil, 0, stats, fmt.Errorf("failed to scan upload queue dir '%s': %w", uploadQueueDir, err)
+	}
+	// Dirs that weren't reached, eg because they were removed, are dropped.
+	tree.Dirs = dirs
+	tree.files = nil
+	return items, totalSize, stats, nil
+}
+
+// scanCacheFilesUnchanged returns whether the files in the cached listing of the dir at dirPath
+// still have the same sizes and modification times, eg because none was overwritten in place.
+func scanCacheFilesUnchanged(dirPath string, cached scanCacheDir) bool {
+	for _, entry := range cached.Entries {
+		if entry.IsDir {
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(dirPath, entry.Name))
+		if err != nil || !info.Mode().IsRegular() || info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// listScanCacheDir lists the dir at dirPath, whose modification time is modTime, skipping symlinks,
+// .DS_Store files, and day indexes. The EXIF metadata of the files that are unchanged from the earlier listing old is kept.
+func listScanCacheDir(dirPath string, modTime time.Time, old scanCacheDir) (scanCacheDir, error) {
+	oldFiles := make(map[string]scanCacheEntry, len(old.Entries))
+	for _, entry := range old.Entries {
+		if !entry.IsDir {
+			oldFiles[entry.Name] = entry
+		}
+	}
+
+	dirEnts, err := os.ReadDir(dirPath)
+	if err != nil {
+		return scanCacheDir{}, err
+	}
+	listing := scanCacheDir{ModTime: modTime}
+	for _, dirEnt := range dirEnts {
+		if dirEnt.Type()&os.ModeSymlink != 0 || isIgnoredQueueFile(dirEnt.Name()) {
+			continue
+		}
+		if dirEnt.IsDir() {
+			listing.Entries = append(listing.Entries, scanCacheEntry{Name: dirEnt.Name(), IsDir: true})
+			continue
+		}
+		info, err := dirEnt.Info()
+		if err != nil {
+			return scanCacheDir{}, fmt.Errorf("failed to get file info for %s: %w", filepath.Join(dirPath, dirEnt.Name()), err)
+		}
+		entry := scanCacheEntry{Name: dirEnt.Name(), Size: info.Size(), ModTime: info.ModTime()}
+		if oldEntry, ok := oldFiles[entry.Name]; ok && oldEntry.Size == entry.Size && oldEntry.ModTime.Equal(entry.ModTime) {
+			entry.Exif = oldEntry.Exif
+		}
+		listing.Entries = append(listing.Entries, entry)
+	}
+	return listing, nil
+}
+
+// entry returns the cached entry of the file at path in the upload queue at root, or nil if it isn't cached.
+func (t *scanCacheTree) entry(root, path string) *scanCacheEntry {
+	if t.files == nil {
+		t.files = make(map[string]*scanCacheEntry)
+		for relDir, dir := range t.Dirs {
+			// The entries share their backing array with t.Dirs, so changes to them are saved.
+			for i := range dir.Entries {
+				if !dir.Entries[i].IsDir {
+					t.files[filepath.Join(relDir, dir.Entries[i].Name)] = &dir.Entries[i]
+				}
+			}
+		}
+	}
+	relPath, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil
+	}
+	return t.files[relPath]
+}
+
+// getExifMetadataCached returns the EXIF metadata of the files at paths in the upload queue at root,
+// like getExifMetadata, but only reads the metadata of the files that isn't in tree, and adds it to tree.
+// The metadata is read in batches, and the metadata of the batches that were read is kept in tree
+// even if a later batch fails, so that a retry continues where this left off.
+func getExifMetadataCached(ctx context.Context, tree *scanCacheTree, root string, paths []string, bar *progressbar.ProgressBar) ([]ExifData, error) {
+	exifs := make([]ExifData, 0, len(paths))
+	var unreadPaths []string
+	for _, path := range paths {
+		entry := tree.entry(root, path)
+		if entry == nil || entry.Exif == nil {
+			unreadPaths = append(unreadPaths, path)
+			continue
+		}
+		exif := *entry.Exif
+		exif.Path = path
+		exifs = append(exifs, exif)
+	}
+	if bar != nil {
+		_ = bar.Add(len(paths) - len(unreadPaths))
+	}
+
+	for start := 0; start < len(unreadPaths); start += exifBatchSize {
+		batch := unreadPaths[start:min(start+exifBatchSize, len(unreadPaths))]
+		batchExifs, err := getExifMetadata(ctx, batch, bar)
+		if err != nil {
+			return nil, err
+		}
+		exifs = append(exifs, batchExifs...)
+
+		// Files that exiftool didn't report have no metadata, which is also worth caching.
+		batchExifsByPath := make(map[string]ExifData, len(batchExifs))
+		for _, exif := range batchExifs {
+			batchExifsByPath[exif.Path] = exif
+		}
+		for _, path := range batch {
+			if entry := tree.entry(root, path); entry != nil {
+				exif := batchExifsByPath[path]
+				exif.Path = ""
+				entry.Exif = &exif
+			}
+		}
+	}
+	return exifs, nil
+}
@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupScanCacheQueue creates an upload queue with files in its root and in the dirs a and b.
+// The dirs' modification times are set in the past, so that changing them is always noticed.
+func setupScanCacheQueue(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "b"), 0755))
+	createTestFiles(t, root, map[string]string{
+		"2024-01-01-root.jpg": "root",
+		"a/2024-01-02-a1.jpg": "a1",
+		"a/2024-01-02-a2.jpg": "a2",
+		"b/2024-01-03-b1.jpg": "b1",
+		".DS_Store":           "finder",
+	})
+	require.NoError(t, os.Symlink(filepath.Join(root, "a/2024-01-02-a1.jpg"), filepath.Join(root, "b/link.jpg")))
+	past := time.Now().Add(-time.Hour)
+	for _, dir := range []string{root, filepath.Join(root, "a"), filepath.Join(root, "b")} {
+		require.NoError(t, os.Chtimes(dir, past, past))
+	}
+	return root
+}
+
+func scanCachePaths(items []itemFileInfo) []string {
+	paths := make([]string, len(items))
+	for i, item := range items {
+		paths[i] = item.path
+	}
+	return paths
+}
+
+func TestScanUploadQueueCached(t *testing.T) {
+	t.Run("CacheHit", func(t *testing.T) {
+		root := setupScanCacheQueue(t)
+		tree := (&scanCache{Trees: make(map[string]*scanCacheTree)}).tree(root)
+
+		items, totalSize, stats, err := scanUploadQueueCached(root, tree)
+		require.NoError(t, err)
+		assert.Equal(t, scanCacheStats{listedDirs: 3}, stats, "An empty cache should list every dir")
+		wantItems, wantSize, err := scanUploadQueue(root, config.SymlinksSkip)
+		require.NoError(t, err)
+		assert.Equal(t, scanCachePaths(wantItems), scanCachePaths(items), "The files should match a full scan, in the same order")
+		assert.Equal(t, wantSize, totalSize)
+
+		items, totalSize, stats, err = scanUploadQueueCached(root, tree)
+		require.NoError(t, err)
+		assert.Equal(t, scanCacheStats{reusedDirs: 3}, stats, "Unchanged dirs shouldn't be listed again")
+		assert.Equal(t, scanCachePaths(wantItems), scanCachePaths(items))
+		assert.Equal(t, wantSize, totalSize)
+	})
+
+	t.Run("PartialInvalidation", func(t *testing.T) {
+		root := setupScanCacheQueue(t)
+		tree := (&scanCache{Trees: make(map[string]*scanCacheTree)}).tree(root)
+		_, _, _, err := scanUploadQueueCached(root, tree)
+		require.NoError(t, err)
+		tree.entry(root, filepath.Join(root, "a/2024-01-02-a2.jpg")).Exif = &ExifData{Label: "Red"}
+		tree.entry(root, filepath.Join(root, "b/2024-01-03-b1.jpg")).Exif = &ExifData{Label: "Blue"}
+
+		// Add a file to b, and overwrite a file in a in place, which doesn't change a's modification time.
+		createTestFiles(t, root, map[string]string{"b/2024-01-03-b2.jpg": "b2"})
+		aInfo, err := os.Stat(filepath.Join(root, "a"))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(root, "a/2024-01-02-a1.jpg"), []byte("a1, edited"), 0644))
+		require.NoError(t, os.Chtimes(filepath.Join(root, "a"), aInfo.ModTime(), aInfo.ModTime()))
+
+		items, totalSize, stats, err := scanUploadQueueCached(root, tree)
+		require.NoError(t, err)
+		assert.Equal(t, scanCacheStats{reusedDirs: 1, listedDirs: 2}, stats, "Only a and b should be listed again")
+		assert.Equal(t, []string{
+			filepath.Join(root, "2024-01-01-root.jpg"),
+			filepath.Join(root, "a/2024-01-02-a1.jpg"),
+			filepath.Join(root, "a/2024-01-02-a2.jpg"),
+			filepath.Join(root, "b/2024-01-03-b1.jpg"),
+			filepath.Join(root, "b/2024-01-03-b2.jpg"),
+		}, scanCachePaths(items))
+		assert.Equal(t, int64(len("root")+len("a1, edited")+len("a2")+len("b1")+len("b2")), totalSize)
+		assert.Equal(t, &ExifData{Label: "Red"}, tree.entry(root, filepath.Join(root, "a/2024-01-02-a2.jpg")).Exif,
+			"The metadata of unchanged files should be kept")
+		assert.Equal(t, &ExifData{Label: "Blue"}, tree.entry(root, filepath.Join(root, "b/2024-01-03-b1.jpg")).Exif)
+
+		// Removed dirs are dropped from the cache.
+		require.NoError(t, os.RemoveAll(filepath.Join(root, "b")))
+		items, _, _, err = scanUploadQueueCached(root, tree)
+		require.NoError(t, err)
+		assert.Len(t, items, 3)
+		assert.NotContains(t, tree.Dirs, "b")
+	})
+
+	t.Run("FullRebuild", func(t *testing.T) {
+		root := setupScanCacheQueue(t)
+		cachePath := getScanCachePath(t.TempDir())
+		cache := loadScanCache(cachePath)
+		_, _, _, err := scanUploadQueueCached(root, cache.tree(root))
+		require.NoError(t, err)
+		require.NoError(t, cache.save(cachePath))
+
+		// A saved cache is reused.
+		_, _, stats, err := scanUploadQueueCached(root, loadScanCache(cachePath).tree(root))
+		require.NoError(t, err)
+		assert.Equal(t, scanCacheStats{reusedDirs: 3}, stats)
+
+		// A cache from another version, or a corrupt cache, is rebuilt.
+		for _, data := range []string{`{"version": 999, "trees": {}}`, `{"version": `} {
+			require.NoError(t, os.WriteFile(cachePath, []byte(data), 0644))
+			_, _, stats, err := scanUploadQueueCached(root, loadScanCache(cachePath).tree(root))
+			require.NoError(t, err)
+			assert.Equal(t, scanCacheStats{listedDirs: 3}, stats, "An unusable cache should be rebuilt from %q", data)
+		}
+	})
+}
+
+func TestGetExifMetadataCached(t *testing.T) {
+	// The fake exiftool logs the files it is run on, and gives each file the label "Red".
+	binDir := t.TempDir()
+	logPath := filepath.Join(binDir, "exiftool.log")
+	script := `#!/bin/sh
+sep=''
+printf '['
+for f in "$@"; do
+	case "$f" in -*) continue;; esac
+	echo "$f" >> '` + logPath + `'
+	printf '%s{"SourceFile": "%s", "Label": "Red"}' "$sep" "$f"
+	sep=','
+done
+printf ']'
+`
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "exiftool"), []byte(script), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	readPaths := func() []string {
+		data, err := os.ReadFile(logPath)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(logPath))
+		return strings.Fields(string(data))
+	}
+
+	root := setupScanCacheQueue(t)
+	tree := (&scanCache{Trees: make(map[string]*scanCacheTree)}).tree(root)
+	items, _, _, err := scanUploadQueueCached(root, tree)
+	require.NoError(t, err)
+	paths := scanCachePaths(items)
+
+	exifs, err := getExifMetadataCached(context.Background(), tree, root, paths, nil)
+	require.NoError(t, err)
+	assert.Len(t, exifs, len(paths))
+	assert.Equal(t, paths, readPaths(), "Every file should be read the first time")
+
+	exifs, err = getExifMetadataCached(context.Background(), tree, root, paths, nil)
+	require.NoError(t, err)
+	assert.Empty(t, readPaths(), "Cached metadata shouldn't be read again")
+	require.Len(t, exifs, len(paths))
+	for i, exif := range exifs {
+		assert.Equal(t, ExifData{Path: paths[i], Label: "Red"}, exif)
+	}
+
+	// Only the new file is read after it is added.
+	createTestFiles(t, root, map[string]string{"b/2024-01-03-b2.jpg": "b2"})
+	items, _, _, err = scanUploadQueueCached(root, tree)
+	require.NoError(t, err)
+	_, err = getExifMetadataCached(context.Background(), tree, root, scanCachePaths(items), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "b/2024-01-03-b2.jpg")}, readPaths())
+}
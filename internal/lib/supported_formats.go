@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// WriteSupportedFormats writes to w the extensions of the photos and videos that import and upload recognize,
+// and the files that they ignore, under cfg. It reads the same tables that the files are classified with.
+func WriteSupportedFormats(w io.Writer, cfg config.CamflowConfig) error {
+	var b strings.Builder
+	fmt.Fprintln(&b, "Import (extensions in lower or upper case):")
+	fmt.Fprintf(&b, "\tphoto: %s\n", strings.Join(extensionsOfType(importExtensions, ItemTypePhoto), " "))
+	fmt.Fprintf(&b, "\tvideo: %s\n", strings.Join(extensionsOfType(importExtensions, ItemTypeVideo), " "))
+	if cfg.Import.SniffExtensionless {
+		fmt.Fprintln(&b, "\tfiles without an extension: detected from their content (import.sniff_extensionless)")
+	} else {
+		fmt.Fprintln(&b, "\tfiles without an extension: skipped (see import.sniff_extensionless)")
+	}
+	fmt.Fprintln(&b, "\tignored: zero-byte files, and dirs in DCIM whose names aren't a DCIM media dir, eg CANONMSC")
+
+	fmt.Fprintln(&b, "Upload (extensions in any case):")
+	fmt.Fprintf(&b, "\tphoto: %s\n", strings.Join(extensionsOfType(mediaExtensions, ItemTypePhoto), " "))
+	fmt.Fprintf(&b, "\tvideo: %s\n", strings.Join(extensionsOfType(mediaExtensions, ItemTypeVideo), " "))
+	if len(cfg.Upload.IncludeExtensions) > 0 {
+		fmt.Fprintf(&b, "\tonly: %s (upload.include_extensions)\n", strings.Join(cfg.Upload.IncludeExtensions, " "))
+	}
+	if len(cfg.Upload.ExcludeExtensions) > 0 {
+		fmt.Fprintf(&b, "\texcluded: %s (upload.exclude_extensions)\n", strings.Join(cfg.Upload.ExcludeExtensions, " "))
+	}
+	fmt.Fprintf(&b, "\tlargest: %d MiB for photos, %d GiB for videos\n", maxUploadSizes[ItemTypePhoto]>>20, maxUploadSizes[ItemTypeVideo]>>30)
+	fmt.Fprintf(&b, "\tignored: %s, and the %s, %s, and %s dirs of each upload queue\n", strings.Join(ignoredQueueFileNames, " "), config.RejectedDirName, config.OversizedDirName, config.QuarantineDirName)
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write supported formats: %w", err)
+	}
+	return nil
+}
+
+// extensionsOfType returns the extensions in extensions of itemType, without their dots, sorted.
+func extensionsOfType(extensions map[string]ItemType, itemType ItemType) []string {
+	var exts []string
+	for ext, extType := range extensions {
+		if extType == itemType {
+			exts = append(exts, strings.TrimPrefix(ext, "."))
+		}
+	}
+	slices.Sort(exts)
+	return exts
+}
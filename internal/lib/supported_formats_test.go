@@ -0,0 +1,29 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSupportedFormats(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	cfg.Upload.ExcludeExtensions = []string{"cr3"}
+
+	var b strings.Builder
+	require.NoError(t, WriteSupportedFormats(&b, cfg))
+	out := b.String()
+	assert.Contains(t, out, "\tphoto: cr3 jpg\n\tvideo: mp4\n", "The import defaults should be listed")
+	assert.Contains(t, out, " cr3 ", "The upload photo extensions should include RAW formats")
+	assert.Contains(t, out, " heic ")
+	assert.Contains(t, out, " mov ")
+	assert.Contains(t, out, "\texcluded: cr3 (upload.exclude_extensions)\n")
+	assert.Contains(t, out, ".DS_Store camflow-index.json")
+
+	// Every extension in the tables is listed.
+	for ext := range mediaExtensions {
+		assert.Contains(t, out, " "+strings.TrimPrefix(ext, "."), "%s should be listed", ext)
+	}
+}
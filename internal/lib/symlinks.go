@@ -0,0 +1,155 @@
+package lib
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// walkDirSymlinks walks the tree at root like filepath.WalkDir, but handles the symlinks in it as selected
+// by symlinks, a config.Symlinks value. With config.SymlinksSkip they are skipped. Otherwise, symlinked
+// files are passed to fn, with a dir entry for their target, and symlinked dirs are walked, with paths
+// under the symlink. config.SymlinksFollowWithinRoot only follows symlinks whose targets are within root.
+// When following symlinks, each file and dir is visited at most once, so that files reachable through
+// more than one path aren't processed twice and symlink cycles end.
+// root itself is always followed, if it is a symlink.
+func walkDirSymlinks(root, symlinks string, fn fs.WalkDirFunc) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		// Let WalkDir report the error to fn.
+		return filepath.WalkDir(root, fn)
+	}
+	w := &symlinkWalker{
+		symlinks: symlinks,
+		realRoot: realRoot,
+		fn:       fn,
+		visited:  make(map[string]bool),
+	}
+	return w.walk(root, realRoot)
+}
+
+type symlinkWalker struct {
+	symlinks string
+	realRoot string
+	fn       fs.WalkDirFunc
+	// visited holds the real paths of the files and dirs that have been visited, when following symlinks.
+	visited map[string]bool
+}
+
+func (w *symlinkWalker) following() bool {
+	return w.symlinks == config.SymlinksFollow || w.symlinks == config.SymlinksFollowWithinRoot
+}
+
+// walk walks the real dir realDir, passing the paths of its entries to fn as if it were at path.
+func (w *symlinkWalker) walk(path, realDir string) error {
+	return filepath.WalkDir(realDir, func(realPath string, d fs.DirEntry, err error) error {
+		entryPath := realPath
+		if path != realDir {
+			rel, relErr := filepath.Rel(realDir, realPath)
+			if relErr != nil {
+				return relErr
+			}
+			entryPath = filepath.Join(path, rel)
+		}
+		if err != nil {
+			return w.fn(entryPath, d, err)
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return w.walkSymlink(entryPath, realPath, d)
+		}
+		if w.following() {
+			if w.visited[realPath] {
+				logger.Debug("Skipping path that was already visited through a symlink",
+					slog.String("path", entryPath))
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			w.visited[realPath] = true
+		}
+		return w.fn(entryPath, d, nil)
+	})
+}
+
+// walkSymlink handles the symlink at linkPath, which is at path as walked.
+func (w *symlinkWalker) walkSymlink(path, linkPath string, d fs.DirEntry) error {
+	if !w.following() {
+		logger.Warn("Skipping symlink (set symlinks in the config to follow it)",
+			slog.String("path", path))
+		return nil
+	}
+	target, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		logger.Warn("Skipping broken symlink",
+			slog.String("path", path),
+			slog.String("error", err.Error()))
+		return nil
+	}
+	if w.symlinks == config.SymlinksFollowWithinRoot && !isWithinDir(w.realRoot, target) {
+		logger.Warn("Skipping symlink to outside of the walked dir",
+			slog.String("path", path),
+			slog.String("target", target))
+		return nil
+	}
+	if w.visited[target] {
+		logger.Debug("Skipping symlink to a path that was already visited",
+			slog.String("path", path),
+			slog.String("target", target))
+		return nil
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return w.fn(path, d, fmt.Errorf("failed to stat symlink target %s: %w", target, err))
+	}
+	w.visited[target] = true
+
+	entry := symlinkDirEntry{DirEntry: fs.FileInfoToDirEntry(info), name: d.Name()}
+	if !info.IsDir() {
+		return w.fn(path, entry, nil)
+	}
+	if err := w.fn(path, entry, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	// The target dir itself was passed to fn above, so walk only its entries.
+	entries, err := os.ReadDir(target)
+	if err != nil {
+		return w.fn(path, entry, err)
+	}
+	for _, e := range entries {
+		if err := w.walk(filepath.Join(path, e.Name()), filepath.Join(target, e.Name())); err != nil {
+			if err == filepath.SkipDir {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// symlinkDirEntry is the dir entry of a symlink's target, with the symlink's name.
+type symlinkDirEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (e symlinkDirEntry) Name() string {
+	return e.name
+}
+
+// isWithinDir returns whether path is dir or is in the tree under it.
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createSymlinkTree creates a tree with symlinked media files and dirs, inside and outside of root,
+// and returns root.
+func createSymlinkTree(t *testing.T) string {
+	t.Helper()
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	createDirStructure(t, base, map[string]string{
+		"root/2024-05-01-a.jpg":     "a",
+		"root/sub/2024-05-02-b.jpg": "bb",
+		"outside/2024-05-03-c.jpg":  "ccc",
+	})
+	require.NoError(t, os.Symlink(filepath.Join(root, "sub", "2024-05-02-b.jpg"), filepath.Join(root, "2024-05-02-link.jpg")))
+	require.NoError(t, os.Symlink(filepath.Join(base, "outside", "2024-05-03-c.jpg"), filepath.Join(root, "2024-05-03-outside.jpg")))
+	require.NoError(t, os.Symlink(filepath.Join(base, "outside"), filepath.Join(root, "linkdir")))
+	require.NoError(t, os.Symlink(root, filepath.Join(root, "loop")))
+	require.NoError(t, os.Symlink(filepath.Join(base, "missing.jpg"), filepath.Join(root, "2024-05-04-broken.jpg")))
+	return root
+}
+
+func TestWalkDirSymlinks(t *testing.T) {
+	root := createSymlinkTree(t)
+
+	for _, tt := range []struct {
+		symlinks  string
+		wantFiles []string
+	}{
+		{
+			symlinks:  config.SymlinksSkip,
+			wantFiles: []string{"2024-05-01-a.jpg", "sub/2024-05-02-b.jpg"},
+		},
+		{
+			// Each linked file is visited through the first path to it in walk order, and not again.
+			symlinks:  config.SymlinksFollow,
+			wantFiles: []string{"2024-05-01-a.jpg", "2024-05-02-link.jpg", "2024-05-03-outside.jpg"},
+		},
+		{
+			symlinks:  config.SymlinksFollowWithinRoot,
+			wantFiles: []string{"2024-05-01-a.jpg", "2024-05-02-link.jpg"},
+		},
+	} {
+		t.Run(tt.symlinks, func(t *testing.T) {
+			var gotFiles []string
+			err := walkDirSymlinks(root, tt.symlinks, func(path string, d fs.DirEntry, err error) error {
+				require.NoError(t, err)
+				if !d.IsDir() {
+					rel, err := filepath.Rel(root, path)
+					require.NoError(t, err)
+					gotFiles = append(gotFiles, filepath.ToSlash(rel))
+				}
+				return nil
+			})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.wantFiles, gotFiles)
+		})
+	}
+}
+
+func TestWalkDirSymlinks_SymlinkedRoot(t *testing.T) {
+	base := t.TempDir()
+	createDirStructure(t, base, map[string]string{"real/2024-05-01-a.jpg": "a"})
+	root := filepath.Join(base, "root")
+	require.NoError(t, os.Symlink(filepath.Join(base, "real"), root))
+
+	var gotPaths []string
+	err := walkDirSymlinks(root, config.SymlinksSkip, func(path string, d fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		if !d.IsDir() {
+			gotPaths = append(gotPaths, path)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "2024-05-01-a.jpg")}, gotPaths, "The root should be followed, with paths under it")
+}
+
+func TestScanUploadQueue_Symlinks(t *testing.T) {
+	root := createSymlinkTree(t)
+
+	items, totalSize, err := scanUploadQueue(root, config.SymlinksSkip)
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, int64(len("a")+len("bb")), totalSize)
+
+	// Followed files have the size of their targets.
+	items, totalSize, err = scanUploadQueue(root, config.SymlinksFollow)
+	require.NoError(t, err)
+	assert.Len(t, items, 3)
+	assert.Equal(t, int64(len("a")+len("bb")+len("ccc")), totalSize)
+}
+
+func TestGetFilesAndSize_Symlinks(t *testing.T) {
+	base := t.TempDir()
+	card := filepath.Join(base, "card")
+	createDirStructure(t, base, map[string]string{
+		"card/100CANON/IMG_0001.JPG": "jpeg",
+		"other/IMG_0002.JPG":         "jpeg2",
+	})
+	require.NoError(t, os.Symlink(filepath.Join(base, "other"), filepath.Join(card, "101LINK")))
+
+	files, _, _, err := getMediaRootFilesAndSize(mediaRoot{dir: card, dcim: true}, false, config.SymlinksFollowWithinRoot)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(card, "100CANON", "IMG_0001.JPG")}, files)
+
+	files, totalSize, _, err := getMediaRootFilesAndSize(mediaRoot{dir: card, dcim: true}, false, config.SymlinksFollow)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(card, "100CANON", "IMG_0001.JPG"),
+		filepath.Join(card, "101LINK", "IMG_0002.JPG"),
+	}, files)
+	assert.Equal(t, int64(len("jpeg")+len("jpeg2")), totalSize)
+}
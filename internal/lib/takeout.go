@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTakeoutSidecarName is the longest name that Google Takeout gives a sidecar. Longer names are truncated.
+const maxTakeoutSidecarName = 51
+
+// takeoutSidecarSuffixes are the suffixes that Google Takeout appends to the name of a media file for the
+// name of its sidecar, newest first.
+var takeoutSidecarSuffixes = []string{".supplemental-metadata.json", ".json"}
+
+// takeoutDuplicateRe matches the "(n)" that Google Takeout appends to the names of files with the same name
+// in a dir, eg "IMG_0001(1).JPG", whose sidecar is then "IMG_0001.JPG(1).json".
+var takeoutDuplicateRe = regexp.MustCompile(`^(.*)(\(\d+\))$`)
+
+// takeoutYearDirRe matches the dirs that Google Takeout puts the files of each year in, which aren't albums.
+var takeoutYearDirRe = regexp.MustCompile(`^Photos from \d{4}$`)
+
+// takeoutMetadata is the part of a Google Takeout sidecar, or of the metadata.json of an album dir,
+// that import reads.
+type takeoutMetadata struct {
+	Title          string `json:"title"`
+	PhotoTakenTime struct {
+		// Timestamp is the time in seconds since the Unix epoch, as a string.
+		Timestamp string `json:"timestamp"`
+	} `json:"photoTakenTime"`
+}
+
+// takeoutSidecarPaths returns the paths that the Google Takeout sidecar of the media file at path can have,
+// in the order to try them.
+func takeoutSidecarPaths(path string) []string {
+	dir, name := filepath.Split(path)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	// Edited copies share the sidecar of the original.
+	base = strings.TrimSuffix(base, "-edited")
+	var names []string
+	for _, suffix := range takeoutSidecarSuffixes {
+		sidecarName := base + ext + suffix
+		if m := takeoutDuplicateRe.FindStringSubmatch(base); m != nil {
+			sidecarName = m[1] + ext + strings.TrimSuffix(suffix, ".json") + m[2] + ".json"
+		}
+		if len(sidecarName) > maxTakeoutSidecarName {
+			stem := strings.TrimSuffix(sidecarName, ".json")
+			sidecarName = stem[:maxTakeoutSidecarName-len(".json")] + ".json"
+		}
+		names = append(names, sidecarName)
+	}
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(dir, name)
+	}
+	return paths
+}
+
+// readTakeoutMetadata reads the Google Takeout metadata at path.
+func readTakeoutMetadata(path string) (takeoutMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return takeoutMetadata{}, err
+	}
+	var metadata takeoutMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return takeoutMetadata{}, fmt.Errorf("failed to parse takeout metadata %s: %w", path, err)
+	}
+	return metadata, nil
+}
+
+// takeoutTakenTime returns the time that the media file at path was taken, from its Google Takeout
+// sidecar, and whether it has one. Files without a sidecar, or with one that can't be read or has no
+// time, are dated as usual.
+func takeoutTakenTime(path string) (time.Time, bool) {
+	for _, sidecarPath := range takeoutSidecarPaths(path) {
+		metadata, err := readTakeoutMetadata(sidecarPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			logger.Warn("Failed to read takeout sidecar, dating the file as usual",
+				slog.String("path", sidecarPath),
+				slog.String("error", err.Error()))
+			return time.Time{}, false
+		}
+		seconds, err := strconv.ParseInt(metadata.PhotoTakenTime.Timestamp, 10, 64)
+		if err != nil || seconds <= 0 {
+			logger.Warn("Takeout sidecar has no photo taken time, dating the file as usual",
+				slog.String("path", sidecarPath))
+			return time.Time{}, false
+		}
+		return time.Unix(seconds, 0), true
+	}
+	logger.Debug("No takeout sidecar, dating the file as usual",
+		slog.String("path", path))
+	return time.Time{}, false
+}
+
+// takeoutAlbumDirs caches the album dir names of the dirs of a Google Takeout export, per takeoutAlbumDir.
+type takeoutAlbumDirs map[string]string
+
+// takeoutAlbumDir returns the name of the dir to import the files in the Google Takeout dir at dir into,
+// so that they can be added to the album that dir holds, or "" if dir isn't an album, eg because it is
+// a "Photos from 2024" dir. The album's title is from its metadata.json, and falls back to dir's name.
+func (d takeoutAlbumDirs) takeoutAlbumDir(dir string) string {
+	if albumDir, ok := d[dir]; ok {
+		return albumDir
+	}
+	var title string
+	if !takeoutYearDirRe.MatchString(filepath.Base(dir)) {
+		metadata, err := readTakeoutMetadata(filepath.Join(dir, "metadata.json"))
+		switch {
+		case err == nil:
+			title = metadata.Title
+			if title == "" {
+				title = filepath.Base(dir)
+			}
+		case !os.IsNotExist(err):
+			logger.Warn("Failed to read takeout album metadata, importing its files without the album",
+				slog.String("dir", dir),
+				slog.String("error", err.Error()))
+		}
+	}
+	albumDir := strings.TrimSpace(strings.NewReplacer("/", "_", "\\", "_", "\x00", "").Replace(title))
+	if albumDir == "." || albumDir == ".." {
+		albumDir = ""
+	}
+	d[dir] = albumDir
+	return albumDir
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTakeoutSidecarPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"IMG_0001.JPG", []string{"IMG_0001.JPG.supplemental-metadata.json", "IMG_0001.JPG.json"}},
+		{"IMG_0001-edited.JPG", []string{"IMG_0001.JPG.supplemental-metadata.json", "IMG_0001.JPG.json"}},
+		{"IMG_0001(1).JPG", []string{"IMG_0001.JPG.supplemental-metadata(1).json", "IMG_0001.JPG(1).json"}},
+		{"PXL_20240503_101112345.NIGHT.jpg", []string{"PXL_20240503_101112345.NIGHT.jpg.supplemental-.json", "PXL_20240503_101112345.NIGHT.jpg.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want []string
+			for _, name := range tt.want {
+				want = append(want, filepath.Join("/takeout", name))
+			}
+			assert.Equal(t, want, takeoutSidecarPaths(filepath.Join("/takeout", tt.name)))
+		})
+	}
+}
+
+func TestImportFiles_Takeout(t *testing.T) {
+	cfg := newTestConfig(t, "", "")
+	cfg.Import.Takeout = true
+	modTime := time.Date(2025, 1, 2, 12, 0, 0, 0, time.Local)
+	takenTime := time.Unix(1714737600, 0) // 2024-05-03T12:00:00Z
+	takenDate := takenTime.Format("2006-01-02")
+	takeoutDir := t.TempDir()
+
+	// A file in an album dir, with a sidecar.
+	albumDir := filepath.Join(takeoutDir, "Trip to Rome")
+	albumPhoto := filepath.Join(albumDir, "IMG_0001.JPG")
+	createDummyFile(t, albumPhoto, "photo", modTime)
+	createDummyFile(t, filepath.Join(albumDir, "metadata.json"), `{"title": "Rome / 2024", "description": ""}`, modTime)
+	createDummyFile(t, albumPhoto+".supplemental-metadata.json",
+		`{"title": "IMG_0001.JPG", "photoTakenTime": {"timestamp": "1714737600", "formatted": "May 3, 2024, 12:00:00 PM UTC"}}`, modTime)
+	// A video in a year dir, which isn't an album, with an older style sidecar.
+	yearDir := filepath.Join(takeoutDir, "Photos from 2024")
+	yearVideo := filepath.Join(yearDir, "MVI_0002.MP4")
+	createDummyFile(t, yearVideo, "video", modTime)
+	createDummyFile(t, filepath.Join(yearDir, "metadata.json"), `{"title": "Photos from 2024"}`, modTime)
+	createDummyFile(t, yearVideo+".json", `{"title": "MVI_0002.MP4", "photoTakenTime": {"timestamp": "1714737600"}}`, modTime)
+	// Files without a sidecar, or with an invalid one, are dated by their modification times.
+	noSidecar := filepath.Join(yearDir, "IMG_0003.JPG")
+	createDummyFile(t, noSidecar, "no sidecar", modTime)
+	invalidSidecar := filepath.Join(yearDir, "IMG_0004.JPG")
+	createDummyFile(t, invalidSidecar, "invalid sidecar", modTime)
+	createDummyFile(t, invalidSidecar+".json", `{"title": `, modTime)
+
+	_, err := ImportFiles(context.Background(), cfg, t.TempDir(), []string{albumPhoto, yearVideo, noSidecar, invalidSidecar}, false, false)
+	require.NoError(t, err)
+
+	takenDayDir := takenTime.Format("2006/01/02")
+	assert.FileExists(t, filepath.Join(cfg.PhotosProcessQueueRoot, "Rome _ 2024", takenDayDir, takenDate+"-IMG_0001.JPG"))
+	assert.FileExists(t, filepath.Join(cfg.VideosUploadQueueRoot, takenDate+"-MVI_0002.MP4"))
+	assert.FileExists(t, filepath.Join(cfg.PhotosProcessQueueRoot, "2025/01/02/2025-01-02-IMG_0003.JPG"))
+	assert.FileExists(t, filepath.Join(cfg.PhotosProcessQueueRoot, "2025/01/02/2025-01-02-IMG_0004.JPG"))
+	_, err = os.Stat(albumPhoto + ".supplemental-metadata.json")
+	assert.NoError(t, err, "Sidecars should be left alone")
+}
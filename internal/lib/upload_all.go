@@ -0,0 +1,33 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// UploadAll uploads the photos and then the videos from their upload queue dirs to Google Photos,
+// as UploadPhotos and UploadVideos do, sharing the rate limiter, preflight check, and album cache
+// between them. The videos are uploaded even if uploading the photos fails, since the queues are
+// independent, unless ctx is done.
+// It returns the combined report, including the media items uploaded before any error.
+func UploadAll(ctx context.Context, cfg config.CamflowConfig, cacheDirFlag string, keepQueued bool, gphotosClient GPhotosClient, dryRun bool) (UploadReport, error) {
+	if err := cfg.Validate(); err != nil {
+		return UploadReport{}, fmt.Errorf("invalid config: %w", err)
+	}
+	session := newUploadSession()
+	report, photosErr := uploadMediaItems(ctx, session, cacheDirFlag, keepQueued, &cfg.LocalPhotos, &cfg.GooglePhotos.Photos, cfg.Upload, "photos", gphotosClient, dryRun)
+	if photosErr != nil {
+		photosErr = fmt.Errorf("failed to upload photos: %w", photosErr)
+		if ctx.Err() != nil {
+			return report, photosErr
+		}
+	}
+	videosReport, videosErr := uploadMediaItems(ctx, session, cacheDirFlag, keepQueued, &cfg.LocalVideos, &cfg.GooglePhotos.Videos, cfg.Upload, "videos", gphotosClient, dryRun)
+	if videosErr != nil {
+		videosErr = fmt.Errorf("failed to upload videos: %w", videosErr)
+	}
+	return report.merge(videosReport), errors.Join(photosErr, videosErr)
+}
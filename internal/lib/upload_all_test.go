@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadAll(t *testing.T) {
+	ctx := context.Background()
+
+	// Photos and videos go to the same album, which should only be looked up and created once.
+	albumTitle := "Camflow"
+	cfg := newTestConfig(t, albumTitle, albumTitle)
+	cfg.Upload.SkipPreflight = false
+	photoFile := "2024-01-28-IMG_0001.JPG"
+	videoFile := "2024-01-28-MVI_0002.MP4"
+	photoPath := filepath.Join(cfg.PhotosUploadQueueDir, photoFile)
+	videoPath := filepath.Join(cfg.VideosUploadQueueRoot, videoFile)
+	require.NoError(t, os.WriteFile(photoPath, []byte("photo"), 0644))
+	require.NoError(t, os.WriteFile(videoPath, []byte("video"), 0644))
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+
+	mockAlbumsSvc.EXPECT().ListPage(gomock.Any(), 1).Times(1) // The preflight check runs once.
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{}, nil).Times(1)
+	mockAlbumsSvc.EXPECT().Create(gomock.Any(), albumTitle).Return(&albums.Album{ID: "album-id", Title: albumTitle}, nil).Times(1)
+	for path, name := range map[string]string{photoPath: photoFile, videoPath: videoFile} {
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), path).Return("token_for_"+name, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + name, Filename: name}).
+			Return(&media_items.MediaItem{ID: "media_id_for_" + name, Filename: name}, nil)
+		mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "album-id", []string{"media_id_for_" + name}).Return(nil)
+	}
+
+	report, err := UploadAll(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	require.NoError(t, err)
+	assert.Equal(t, []UploadedItem{
+		{Path: photoPath, AlbumTitles: []string{albumTitle}},
+		{Path: videoPath, AlbumTitles: []string{albumTitle}},
+	}, report.UploadedItems, "Photos should be uploaded before videos")
+	assert.FileExists(t, filepath.Join(cfg.PhotosUploadedRoot, "2024", "01", "28", photoFile))
+	assert.FileExists(t, filepath.Join(cfg.VideosUploadedRoot, "2024", "01", "28", videoFile))
+}
+
+func TestUploadAll_PhotosFailure(t *testing.T) {
+	cfg := newTestConfig(t, "Photos", "")
+	videoFile := "2024-01-28-MVI_0002.MP4"
+	videoPath := filepath.Join(cfg.VideosUploadQueueRoot, videoFile)
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.PhotosUploadQueueDir, "2024-01-28-IMG_0001.JPG"), []byte("photo"), 0644))
+	require.NoError(t, os.WriteFile(videoPath, []byte("video"), 0644))
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return(nil, errors.New("simulated list failure"))
+	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), videoPath).Return("token", nil)
+	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token", Filename: videoFile}).
+		Return(&media_items.MediaItem{ID: "media_id", Filename: videoFile}, nil)
+
+	report, err := UploadAll(context.Background(), cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	assert.ErrorContains(t, err, "failed to upload photos")
+	assert.ErrorContains(t, err, "simulated list failure")
+	require.Len(t, report.UploadedItems, 1, "Videos should still be uploaded")
+	assert.Equal(t, videoPath, report.UploadedItems[0].Path)
+}
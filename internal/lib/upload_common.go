@@ -2,12 +2,17 @@ package lib
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"math"
+	"math/rand/v2"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -15,19 +20,33 @@ import (
 	//"github.com/evanoberholster/imagemeta/xmp"
 	"github.com/ccfrost/camflow/internal/config"
 	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
-	"github.com/schollz/progressbar/v3"
 	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
+)
+
+// Limit API requests to 5 operations per second, allowing bursts of up to 10.
+// TODO: check the actual rate limits for Google Photos API.
+const (
+	apiRequestsPerSecond = 5
+	apiRequestBurst      = 10
 )
 
 type LocalConfig interface {
 	GetUploadQueueRoot() string
 	GetUploadedRoot() string
+	GetSymlinks() string
+	GetLongNames() string
 }
 
 type GPConfig interface {
-	GetDefaultAlbum() string
+	GetDefaultAlbums() []string
 	GetLabelAlbums() []config.KeyAlbum
 	GetSubjectAlbums() []config.KeyAlbum
+	GetUnmatchedAlbum() string
+	GetDefaultAlbumOnlyWhenUnmatched() bool
+	GetAppendDateRangeToAlbumTitles() bool
+	GetCameraModelAlbums() bool
+	GetRawJpegPairs() string
 }
 
 // itemFileInfo stores path and size for progress tracking.
@@ -35,11 +54,36 @@ type itemFileInfo struct {
 	path    string
 	size    int64
 	modTime time.Time
+	// companions are moved to the uploaded dir with this file, without being uploaded,
+	// eg the RAW file of a RAW+JPEG pair when only the JPEG is uploaded.
+	companions []itemFileInfo
+	// uploadedDate, if not empty, is the YYYY-MM-DD date of the dir to move the file to under the
+	// uploaded root, instead of the date prefix of its name. See config.UploadedDateExif.
+	uploadedDate string
+}
+
+// sumItemSizes returns the total size of items, not counting their companions.
+func sumItemSizes(items []itemFileInfo) int64 {
+	var total int64
+	for _, item := range items {
+		total += item.size
+	}
+	return total
+}
+
+// ignoredQueueFileNames are the names of the files in the upload queues and uploaded dirs that aren't media
+// files, and so are left alone rather than uploaded or moved.
+var ignoredQueueFileNames = []string{".DS_Store", dayIndexFileName}
+
+// isIgnoredQueueFile returns whether name is in ignoredQueueFileNames.
+func isIgnoredQueueFile(name string) bool {
+	return slices.Contains(ignoredQueueFileNames, name)
 }
 
 // scanUploadQueue walks the upload queue directory and returns the list of files to process,
 // the total size of those files, and a slice of non-fatal warnings encountered during the walk.
-func scanUploadQueue(uploadQueueDir string) ([]itemFileInfo, int64, error) {
+// Symlinks are handled as selected by symlinks, a config.Symlinks value.
+func scanUploadQueue(uploadQueueDir, symlinks string) ([]itemFileInfo, int64, error) {
 	if _, err := os.Stat(uploadQueueDir); os.IsNotExist(err) {
 		return nil, 0, fmt.Errorf("upload queue directory does not exist: %s", uploadQueueDir)
 	}
@@ -47,7 +91,7 @@ func scanUploadQueue(uploadQueueDir string) ([]itemFileInfo, int64, error) {
 	var items []itemFileInfo
 	var totalSize int64
 	var numWalkErrors int
-	err := filepath.WalkDir(uploadQueueDir, func(path string, d fs.DirEntry, walkErr error) error {
+	err := walkDirSymlinks(uploadQueueDir, symlinks, func(path string, d fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			// If the error is about the root uploadQueueDir itself not existing, propagate it.
 			if path == uploadQueueDir && os.IsNotExist(walkErr) {
@@ -61,7 +105,7 @@ func scanUploadQueue(uploadQueueDir string) ([]itemFileInfo, int64, error) {
 			return nil
 		}
 
-		if d.IsDir() || d.Name() == ".DS_Store" {
+		if d.IsDir() || isIgnoredQueueFile(d.Name()) {
 			return nil
 		}
 
@@ -83,18 +127,66 @@ func scanUploadQueue(uploadQueueDir string) ([]itemFileInfo, int64, error) {
 	return items, totalSize, nil
 }
 
-// moveToUploaded moves a single media item from upload queue to the uploaded directory.
-// Returns the destination path.
-func moveToUploaded(localConfig LocalConfig, fileInfo itemFileInfo, dryRun bool) (string, error) {
-	fileBasename := filepath.Base(fileInfo.path)
+// uploadedPath returns the path under the uploaded root that the file fileInfo belongs at.
+// With keepQueueStructure, that is the file's path relative to the upload queue root.
+// Otherwise it's based on the file's uploadedDate, if it has one, or else on the date prefix of its basename.
+// The file name is shortened if the path would be too long, as for fitPath.
+func uploadedPath(localConfig LocalConfig, fileInfo itemFileInfo, keepQueueStructure bool) (string, error) {
+	filePath := fileInfo.path
+	if keepQueueStructure {
+		relPath, err := filepath.Rel(localConfig.GetUploadQueueRoot(), filePath)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("file %s is not in the upload queue dir %s", filePath, localConfig.GetUploadQueueRoot())
+		}
+		return fitPath(filepath.Join(localConfig.GetUploadedRoot(), relPath), localConfig.GetLongNames())
+	}
 
+	fileBasename := filepath.Base(filePath)
+	if fileInfo.uploadedDate != "" {
+		date := strings.Split(fileInfo.uploadedDate, "-")
+		return fitPath(filepath.Join(localConfig.GetUploadedRoot(), date[0], date[1], date[2], fileBasename), localConfig.GetLongNames())
+	}
 	year, month, day, err := parseDatePrefix(fileBasename)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse date prefix from file name %s: %w", fileBasename, err)
 	}
-	relPath := filepath.Join(year, month, day, fileBasename)
-	destPath := filepath.Join(localConfig.GetUploadedRoot(), relPath)
-	destDir := filepath.Dir(destPath)
+	return fitPath(filepath.Join(localConfig.GetUploadedRoot(), year, month, day, fileBasename), localConfig.GetLongNames())
+}
+
+// setUploadedDates sets the uploadedDate of each of items, and of its companions, to its EXIF capture date
+// in exifs, in location as for ExifData.captureDateIn, for config.UploadedDateExif. Items without a capture
+// date keep using the date prefix of their names.
+func setUploadedDates(items []itemFileInfo, exifs []ExifData, location *time.Location) {
+	captureDates := make(map[string]string, len(exifs))
+	for _, exif := range exifs {
+		if date := exif.captureDateIn(location); date != "" {
+			captureDates[exif.Path] = date
+		}
+	}
+	for i := range items {
+		date, ok := captureDates[items[i].path]
+		if !ok {
+			continue
+		}
+		if year, month, day, err := parseDatePrefix(filepath.Base(items[i].path)); err != nil || year+"-"+month+"-"+day != date {
+			logger.Info("Moving file to the dir of its EXIF capture date, which differs from the date of its name",
+				slog.String("path", items[i].path),
+				slog.String("capture_date", date))
+		}
+		items[i].uploadedDate = date
+		for j := range items[i].companions {
+			items[i].companions[j].uploadedDate = date
+		}
+	}
+}
+
+// moveToUploaded moves a single media item from upload queue to the uploaded directory.
+// moveMode is as for moveFile and keepQueueStructure as for uploadedPath. Returns the destination path.
+func moveToUploaded(localConfig LocalConfig, fileInfo itemFileInfo, moveMode string, keepQueueStructure bool, dryRun bool) (string, error) {
+	destPath, err := uploadedPath(localConfig, fileInfo, keepQueueStructure)
+	if err != nil {
+		return "", err
+	}
 
 	if dryRun {
 		// Verify destination directory creation (simulate) and check for collisions.
@@ -116,74 +208,209 @@ func moveToUploaded(localConfig LocalConfig, fileInfo itemFileInfo, dryRun bool)
 		slog.String("from", fileInfo.path),
 		slog.String("to", destPath))
 
+	if err := moveFile(fileInfo.path, destPath, fileInfo.size, fileInfo.modTime, moveMode); err != nil {
+		return "", err
+	}
+	logger.Debug("Successfully moved file",
+		slog.String("from", fileInfo.path),
+		slog.String("to", destPath))
+	return destPath, nil
+}
+
+// moveFile moves the file at srcPath to destPath, creating destPath's parent dirs as needed.
+// It renames the file when both paths are on the same filesystem and otherwise copies and then deletes it.
+// moveMode config.MoveModeRename or config.MoveModeCopy skips checking the filesystems and always does that.
+// It refuses to overwrite an existing destPath.
+func moveFile(srcPath, destPath string, size int64, modTime time.Time, moveMode string) error {
+	destDir := filepath.Dir(destPath)
 	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create destination directory %s for moving %s: %w", destDir, fileInfo.path, err)
+		return fmt.Errorf("failed to create destination directory %s for moving %s: %w", destDir, srcPath, err)
 	}
 
 	// Destination collision handling
 	if _, statErr := os.Stat(destPath); statErr == nil {
-		return "", fmt.Errorf("failed to move %s: destination file %s already exists", fileInfo.path, destPath)
+		return fmt.Errorf("failed to move %s: destination file %s already exists", srcPath, destPath)
 	} else if !os.IsNotExist(statErr) {
-		return "", fmt.Errorf("failed to check destination %s: %w", destPath, statErr)
+		return fmt.Errorf("failed to check destination %s: %w", destPath, statErr)
 	}
 
 	// Move the file
-	sameFilesystem, err := isSameFilesystem(fileInfo.path, destDir)
-	if err != nil {
-		return "", fmt.Errorf("failed to check if source and destination are on the same filesystem: %w", err)
+	var rename bool
+	switch moveMode {
+	case config.MoveModeRename:
+		rename = true
+	case config.MoveModeCopy:
+		rename = false
+	default:
+		sameFilesystem, err := isSameFilesystem(srcPath, destDir)
+		if err != nil {
+			return fmt.Errorf("failed to check if source and destination are on the same filesystem: %w", err)
+		}
+		rename = sameFilesystem
 	}
-	if sameFilesystem {
-		if err := os.Rename(fileInfo.path, destPath); err != nil {
-			return "", fmt.Errorf("failed to move %s from export queue to %s: %w", fileInfo.path, destPath, err)
+	if rename {
+		if err := os.Rename(srcPath, destPath); err != nil {
+			return fmt.Errorf("failed to move %s to %s: %w", srcPath, destPath, err)
 		}
 	} else {
 		// Cross-filesystem move: copy then delete.
 		// TOOD: clean up the possible .tmp file that could be left if this doesn't complete.
-		if err := copyFile(fileInfo.path, destPath, fileInfo.size, fileInfo.modTime, nil /*bar*/); err != nil {
-			return "", fmt.Errorf("failed to copy %s to %s: %w", fileInfo.path, destPath, err)
+		if err := copyFile(srcPath, destPath, size, modTime, 0 /*bufferSize*/, nil /*bar*/); err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", srcPath, destPath, err)
 		}
-		if err := os.Remove(fileInfo.path); err != nil {
-			return "", fmt.Errorf("failed to remove original file %s after copying to %s: %w", fileInfo.path, destPath, err)
+		// Keep the metadata that a rename would, eg the media item extended attributes. This is best effort,
+		// like it is for the extended attributes, since eg FAT and exFAT disks don't support setting the mode.
+		if err := copyFileMetadata(srcPath, destPath); err != nil {
+			logger.Warn("Failed to keep file metadata when moving",
+				slog.String("src", srcPath),
+				slog.String("dst", destPath),
+				slog.String("error", err.Error()))
+		}
+		if err := os.Remove(srcPath); err != nil {
+			return fmt.Errorf("failed to remove original file %s after copying to %s: %w", srcPath, destPath, err)
 		}
 	}
-	logger.Debug("Successfully moved file",
-		slog.String("from", fileInfo.path),
-		slog.String("to", destPath))
-	return destPath, nil
+	return nil
+}
+
+// uploadSession is the state that the uploads of a run share, so that uploading photos and videos
+// in one run doesn't duplicate rate limiting, the preflight check, or album lookups.
+type uploadSession struct {
+	limiter          *rate.Limiter
+	preflightChecked bool
+	albumCache       *albumCache
+}
+
+func newUploadSession() *uploadSession {
+	return &uploadSession{limiter: rate.NewLimiter(apiRequestsPerSecond, apiRequestBurst)}
+}
+
+// getAlbumCache returns the album cache in cacheDir, loading it on first use.
+func (s *uploadSession) getAlbumCache(cacheDir string) (*albumCache, error) {
+	if s.albumCache == nil {
+		albumCache, err := loadAlbumCache(getAlbumCachePath(cacheDir))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load album cache: %w", err)
+		}
+		s.albumCache = albumCache
+	}
+	return s.albumCache, nil
 }
 
 // uploadMediaItems uploads media items from the upload queue dir to Google Photos.
-// Media items are added to Google Photos album named DefaultAlbum.
+// Media items are added to the Google Photos albums named by DefaultAlbums.
 // Uploaded media items are moved from upload queue to uploaded dir; unless keepQueued is true, in which case they are copied (but not moved).
 // The function is idempotent - if interrupted, it can be recalled to resume.
-func uploadMediaItems(ctx context.Context, cacheDir string, keepQueued bool, localConfig LocalConfig, gpConfig GPConfig, itemTypePluralName string, gphotosClient GPhotosClient, dryRun bool) (retErr error) {
+// It returns a report of the uploaded media items, including any uploaded before an error.
+// session is shared with the other uploads of the run.
+func uploadMediaItems(ctx context.Context, session *uploadSession, cacheDir string, keepQueued bool, localConfig LocalConfig, gpConfig GPConfig, uploadConfig config.UploadConfig, itemTypePluralName string, gphotosClient GPhotosClient, dryRun bool) (report UploadReport, retErr error) {
+	// upload.check_api only makes read-only API calls.
+	if uploadConfig.CheckAPI {
+		dryRun = true
+	}
+	// The last uploaded date is read from the date dirs of the uploaded dir, which it doesn't have then.
+	if uploadConfig.NewOnly && uploadConfig.KeepQueueStructure {
+		return UploadReport{}, fmt.Errorf("cannot upload only new files when upload.keep_queue_structure is set")
+	}
 	uploadQueueDir := localConfig.GetUploadQueueRoot()
 	if _, err := os.Stat(uploadQueueDir); os.IsNotExist(err) {
+		if err := checkUploadQueueMounted(uploadQueueDir); err != nil {
+			return UploadReport{}, err
+		}
 		logger.Info("Upload queue directory does not exist, nothing to upload",
 			slog.String("upload_queue_dir", uploadQueueDir))
-		return nil
+		return UploadReport{}, nil
+	}
+	if err := config.CheckQueueAndUploadedRoots(uploadQueueDir, localConfig.GetUploadedRoot()); err != nil {
+		return UploadReport{}, err
+	}
+	if !keepQueued {
+		if err := checkUploadedRoot(localConfig.GetUploadedRoot(), dryRun); err != nil {
+			return UploadReport{}, err
+		}
 	}
 
-	// --- Initialize Rate Limiter ---
-	// Limit to 5 operations per second, allowing bursts of up to 10.
-	// TODO: check the actual rate limits for Google Photos API.
-	limiter := rate.NewLimiter(rate.Every(time.Second/5), 10)
+	limiter := session.limiter
 
-	itemsToUpload, totalSize, err := scanUploadQueue(uploadQueueDir)
+	// Check that the token works before the scan and EXIF pass, which can take minutes.
+	// A dry run makes no API calls, unless upload.check_api asks for the read-only ones.
+	if (uploadConfig.CheckAPI || (!uploadConfig.SkipPreflight && !dryRun)) && !session.preflightChecked {
+		if err := preflightCheck(ctx, gphotosClient, limiter); err != nil {
+			return UploadReport{}, err
+		}
+		session.preflightChecked = true
+	}
+
+	var itemsToUpload []itemFileInfo
+	var err error
+	var scanCacheTree *scanCacheTree
+	if uploadConfig.ScanCache && localConfig.GetSymlinks() == config.SymlinksSkip {
+		queueScanCache := loadScanCache(getScanCachePath(cacheDir))
+		scanCacheTree = queueScanCache.tree(uploadQueueDir)
+		var stats scanCacheStats
+		itemsToUpload, _, stats, err = scanUploadQueueCached(uploadQueueDir, scanCacheTree)
+		if err != nil {
+			return UploadReport{}, err
+		}
+		logger.Info("Scanned upload queue with the scan cache",
+			slog.Int("reused_dirs", stats.reusedDirs),
+			slog.Int("listed_dirs", stats.listedDirs))
+		// Save the cache even if the upload fails, so that later runs keep the listing and the
+		// EXIF metadata that was read. The dirs that files are moved out of are listed again then.
+		defer func() {
+			if err := queueScanCache.save(getScanCachePath(cacheDir)); err != nil {
+				logger.Warn("Failed to save scan cache",
+					slog.String("error", err.Error()))
+			}
+		}()
+	} else {
+		itemsToUpload, _, err = scanUploadQueue(uploadQueueDir, localConfig.GetSymlinks())
+		if err != nil {
+			return UploadReport{}, err
+		}
+	}
+	itemsToUpload, left, err := filterUploadQueue(itemsToUpload, cacheDir, keepQueued, localConfig, gpConfig, uploadConfig)
 	if err != nil {
-		return err
+		return UploadReport{}, err
+	}
+	if len(left.nonMedia) > 0 {
+		if err := handleNonMedia(left.nonMedia, uploadQueueDir, uploadConfig.NonMedia, uploadConfig.MoveMode, dryRun); err != nil {
+			return UploadReport{}, err
+		}
+	}
+	// Oversized files would fail to upload on every run, including with keepQueued.
+	if len(left.oversized) > 0 {
+		if err := handleOversized(left.oversized, uploadQueueDir, uploadConfig.Oversized, uploadConfig.MoveMode, dryRun); err != nil {
+			return UploadReport{}, err
+		}
+	}
+	if left.numExcluded > 0 {
+		fmt.Printf("Leaving %d %s excluded by their extension in the upload queue\n", left.numExcluded, itemTypePluralName)
+	}
+	if left.numPaired > 0 {
+		logger.Info("Skipping upload of the other file of RAW+JPEG pairs",
+			slog.Int("count", left.numPaired),
+			slog.String("raw_jpeg_pairs", gpConfig.GetRawJpegPairs()))
+	}
+	pending := left.pending
+	if left.numPending > 0 {
+		fmt.Printf("Leaving %d uploaded %s in the upload queue until commit-uploads\n", left.numPending, itemTypePluralName)
+	}
+	if left.numOld > 0 {
+		fmt.Printf("Leaving %d %s dated before the last uploaded date %s in the upload queue\n", left.numOld, itemTypePluralName, left.lastDate)
 	}
 
 	if len(itemsToUpload) == 0 {
 		logger.Info("No media items found in upload queue directory",
 			slog.String("upload_queue_dir", uploadQueueDir))
-		return nil
+		return UploadReport{}, nil
 	}
 	logger.Info("Found files to upload",
 		slog.Int("count", len(itemsToUpload)),
-		slog.Float64("total_size_gb", math.Ceil(float64(totalSize)/1024/1024/1024)))
+		slog.Float64("total_size_gb", math.Ceil(float64(sumItemSizes(itemsToUpload))/1024/1024/1024)))
 
-	if gpConfig.GetDefaultAlbum() == "" {
+	defaultAlbums := gpConfig.GetDefaultAlbums()
+	if len(defaultAlbums) == 0 {
 		logger.Warn("No default albums specified in config, files may only be uploaded to the library")
 	}
 
@@ -192,45 +419,72 @@ func uploadMediaItems(ctx context.Context, cacheDir string, keepQueued bool, loc
 	for i, item := range itemsToUpload {
 		itemPaths[i] = item.path
 	}
-	itemExifs, err := getExifMetadata(ctx, itemPaths)
+	// Reading the metadata of a big queue can take minutes, so show that it is progressing.
+	exifBar := NewCountProgressBar(len(itemPaths), "reading metadata")
+	var itemExifs []ExifData
+	if scanCacheTree != nil {
+		itemExifs, err = getExifMetadataCached(ctx, scanCacheTree, uploadQueueDir, itemPaths, exifBar)
+	} else {
+		itemExifs, err = getExifMetadata(ctx, itemPaths, exifBar)
+	}
 	if err != nil {
-		return err
+		_ = exifBar.Exit()
+		return UploadReport{}, err
 	}
-	additionalAlbumsPathToTitlesMap := make(map[string][]string)
-	labelAlbums := gpConfig.GetLabelAlbums()
-	subjectAlbums := gpConfig.GetSubjectAlbums()
-	if len(labelAlbums) != 0 || len(subjectAlbums) != 0 {
-		for _, exif := range itemExifs {
-			if exif.Label != "" {
-				if albumTitle, hasKey := albumForKey(labelAlbums, exif.Label); hasKey {
-					additionalAlbumsPathToTitlesMap[exif.Path] = append(additionalAlbumsPathToTitlesMap[exif.Path], albumTitle)
-				}
-			}
+	_ = exifBar.Finish()
 
-			for _, subject := range exif.Subjects {
-				if subject != "" {
-					if albumTitle, hasKey := albumForKey(subjectAlbums, subject); hasKey {
-						additionalAlbumsPathToTitlesMap[exif.Path] = append(additionalAlbumsPathToTitlesMap[exif.Path], albumTitle)
-					}
-				}
+	if uploadConfig.MinRating > 0 {
+		var numBelowMinRating int
+		itemsToUpload, itemExifs, numBelowMinRating = filterByRating(itemsToUpload, itemExifs, uploadConfig.MinRating, uploadConfig.Unrated != config.UnratedExclude)
+		if numBelowMinRating > 0 {
+			fmt.Printf("Leaving %d %s rated below %d in the upload queue\n", numBelowMinRating, itemTypePluralName, uploadConfig.MinRating)
+		}
+		if len(itemsToUpload) == 0 {
+			return UploadReport{}, nil
+		}
+	}
+	if uploadConfig.DeepValidate {
+		var invalidPaths []string
+		itemsToUpload, itemExifs, invalidPaths, err = filterInvalidVideos(ctx, itemsToUpload, itemExifs, uploadConfig.ValidateWorkers)
+		if err != nil {
+			return UploadReport{}, err
+		}
+		if len(invalidPaths) > 0 {
+			fmt.Printf("Leaving %d invalid or truncated video(s) in the upload queue:\n", len(invalidPaths))
+			for _, path := range invalidPaths {
+				fmt.Printf("\t%s\n", path)
 			}
 		}
+		if len(itemsToUpload) == 0 {
+			return UploadReport{}, nil
+		}
+	}
+	if uploadConfig.UploadedDate == config.UploadedDateExif {
+		setUploadedDates(itemsToUpload, itemExifs, uploadConfig.CaptureLocation)
+	}
+	itemAlbumsMap, err := resolveAlbums(itemsToUpload, itemExifs, uploadQueueDir, gpConfig, uploadConfig)
+	if err != nil {
+		return UploadReport{}, err
 	}
 
 	// Look up (and create any missing) album ids.
 
-	albumCache, err := loadAlbumCache(getAlbumCachePath(cacheDir))
+	albumCache, err := session.getAlbumCache(cacheDir)
 	if err != nil {
-		return fmt.Errorf("failed to load album cache: %w", err)
+		return UploadReport{}, err
+	}
+	albumCache.pinnedIDs = uploadConfig.PinnedAlbumIDs()
+	albumCache.duplicateAlbums = uploadConfig.DuplicateAlbums
+	albumCache.onlyExisting = uploadConfig.OnlyExistingAlbums
+	albumCache.maxNewAlbums = uploadConfig.MaxNewAlbums
+	if isTerminal(os.Stdin) {
+		albumCache.confirmCreate = confirmAlbumCreationOnTerminal
 	}
+	albumCache.checkOnline = uploadConfig.CheckAPI
 
 	albumTitlesMap := make(map[string]struct{})
-	defaultAlbum := gpConfig.GetDefaultAlbum()
-	if defaultAlbum != "" {
-		albumTitlesMap[defaultAlbum] = struct{}{}
-	}
-	for _, albumTitles := range additionalAlbumsPathToTitlesMap {
-		for _, albumTitle := range albumTitles {
+	for _, albums := range itemAlbumsMap {
+		for _, albumTitle := range albums.titles {
 			albumTitlesMap[albumTitle] = struct{}{}
 		}
 	}
@@ -245,11 +499,12 @@ func uploadMediaItems(ctx context.Context, cacheDir string, keepQueued bool, loc
 		var err error
 		albumIDs, err = albumCache.getOrFetchAndCreateAlbumIDs(ctx, gphotosClient.Albums(), albumTitlesSlice, limiter, dryRun)
 		if err != nil {
-			return fmt.Errorf("failed to resolve or create album IDs for titles %v: %w", albumTitlesSlice, err)
+			return UploadReport{}, fmt.Errorf("failed to resolve or create album IDs for titles %v: %w", albumTitlesSlice, err)
 		}
 		logger.Debug("Target album IDs resolved/created",
 			slog.Any("album_titles", albumTitlesSlice),
 			slog.Any("album_ids", albumIDs))
+		report.CreatedAlbums = albumCache.createdTitles(albumTitlesSlice)
 
 		for i, albumID := range albumIDs {
 			albumTitleToIdMap[albumTitlesSlice[i]] = albumID
@@ -262,114 +517,628 @@ func uploadMediaItems(ctx context.Context, cacheDir string, keepQueued bool, loc
 	if dryRun {
 		desc = "simulating"
 	}
-	bar := NewProgressBar(totalSize, desc)
+	bar := NewProgressBar(sumItemSizes(itemsToUpload), desc)
+	// The uploads add to the bar through progress, which is safe to share between goroutines.
+	progress := newProgressAggregator(bar, progressFlushInterval)
 	defer func() {
 		if retErr != nil && bar != nil {
 			_ = bar.Exit()
 		}
 	}()
 
+	var albumWriter *albumWriter
+	if len(albumTitleToIdMap) > 0 {
+		albumWriter = newAlbumWriter(gphotosClient.Albums(), uploadConfig.AlbumAddsPerSecond)
+	}
+
+	ledger := newUploadLedger(getUploadLedgerPath(cacheDir))
+	var previousMediaItemIDs map[string]string
+	if uploadConfig.ReplaceExisting {
+		if previousMediaItemIDs, err = ledger.mediaItemIDs(); err != nil {
+			return UploadReport{}, err
+		}
+	}
+	// The failures of each file across runs, for upload.quarantine_after.
+	var failures map[string]uploadFailures
+	if uploadConfig.QuarantineAfter > 0 {
+		if failures, err = ledger.failures(); err != nil {
+			return UploadReport{}, err
+		}
+	}
+
+	// Dates of the media items added to each label and subject album, for naming the albums.
+	albumDates := make(map[string][]time.Time)
+
+	// Count the files in a row whose upload failed, to stop early when the API is failing.
+	var consecutiveFailures int
+	// The files that failed to upload and were left in the upload queue, for upload.move_failed_to.
+	var failedItems []itemFileInfo
+	moveFailed := func() error {
+		if uploadConfig.MoveFailedTo == "" || dryRun || len(failedItems) == 0 {
+			return nil
+		}
+		movedPaths, err := moveFailedFiles(failedItems, uploadQueueDir, uploadConfig.MoveFailedTo, uploadConfig.MoveMode)
+		for i, movedPath := range movedPaths {
+			if j := slices.Index(report.FailedPaths, failedItems[i].path); j >= 0 {
+				report.FailedPaths[j] = movedPath
+			}
+		}
+		return err
+	}
+
 	// TODO: consider batching adding media items to albums. How to make it idempotent in face of failure part way through?
 	for _, fileInfo := range itemsToUpload {
-		additionalAlbumTitles := additionalAlbumsPathToTitlesMap[fileInfo.path]
-		targetAlbumTitles := append(make([]string, 0, len(additionalAlbumTitles)+1), additionalAlbumTitles...)
-		if defaultAlbum != "" {
-			targetAlbumTitles = append(targetAlbumTitles, defaultAlbum)
+		additionalAlbumTitles := itemAlbumsMap[fileInfo.path].keywordTitles
+		targetAlbumTitles := slices.Clone(itemAlbumsMap[fileInfo.path].titles)
+		var replaced *media_items.MediaItem
+		var err error
+		if previousMediaItemIDs != nil {
+			replaced, err = findReplacedMediaItem(ctx, gphotosClient, uploadConfig.MaxRetries, limiter, previousMediaItemIDs, fileInfo.path)
+		}
+		var failedAlbumTitles []string
+		var replacedURL string
+		if err == nil {
+			failedAlbumTitles, replacedURL, err = uploadMediaItem(ctx, keepQueued, localConfig, uploadConfig, gphotosClient, fileInfo, targetAlbumTitles, albumTitleToIdMap, progress, limiter, albumWriter, ledger, pending, replaced, dryRun)
+		}
+		// The file of an unrecorded upload was uploaded, so it is reported as uploaded before the upload stops.
+		var recordErr error
+		if errors.Is(err, errUnrecordedUpload) {
+			recordErr, err = err, nil
+		}
+		if err != nil {
+			// Only API failures count toward the circuit breaker and toward quarantining the file;
+			// other errors stop the upload.
+			var apiErr *uploadAPIError
+			isAPIErr := errors.As(err, &apiErr)
+			quarantinedPath := ""
+			if isAPIErr && !dryRun {
+				var quarantineErr error
+				if quarantinedPath, quarantineErr = recordUploadFailure(ctx, ledger, failures, fileInfo, err, uploadQueueDir, uploadConfig); quarantineErr != nil {
+					return report, quarantineErr
+				}
+			}
+			if quarantinedPath != "" {
+				report.QuarantinedPaths = append(report.QuarantinedPaths, fileInfo.path)
+			} else {
+				report.FailedPaths = append(report.FailedPaths, fileInfo.path)
+			}
+			if !isAPIErr || uploadConfig.MaxConsecutiveFailures <= 1 {
+				return report, fmt.Errorf("failed to upload media item %s: %w", fileInfo.path, err)
+			}
+			if quarantinedPath == "" {
+				failedItems = append(failedItems, fileInfo)
+			}
+			consecutiveFailures++
+			if consecutiveFailures >= uploadConfig.MaxConsecutiveFailures {
+				uploadErr := fmt.Errorf("google photos api appears to be failing, stopping after %d %s in a row failed to upload: %w", consecutiveFailures, itemTypePluralName, err)
+				return report, errors.Join(uploadErr, moveFailed())
+			}
+			logger.Warn("Failed to upload media item, leaving it in the upload queue",
+				slog.String("path", fileInfo.path),
+				slog.Int("consecutive_failures", consecutiveFailures),
+				slog.String("error", err.Error()))
+			continue
 		}
-		if err := uploadMediaItem(ctx, keepQueued, localConfig, gphotosClient, fileInfo, targetAlbumTitles, albumTitleToIdMap, bar, limiter, dryRun); err != nil {
-			return fmt.Errorf("failed to upload media item %s: %w", fileInfo.path, err)
+		consecutiveFailures = 0
+		report.UploadedItems = append(report.UploadedItems, UploadedItem{
+			Path:                 fileInfo.path,
+			AlbumTitles:          withoutStrings(targetAlbumTitles, failedAlbumTitles),
+			FailedAlbumTitles:    failedAlbumTitles,
+			ReplacedMediaItemURL: replacedURL,
+		})
+		for _, albumTitle := range additionalAlbumTitles {
+			if !slices.Contains(defaultAlbums, albumTitle) {
+				albumDates[albumTitle] = append(albumDates[albumTitle], itemDate(fileInfo))
+			}
+		}
+		if recordErr != nil {
+			return report, errors.Join(recordErr, moveFailed())
 		}
 	}
+	progress.Flush()
 	_ = bar.Finish()
 	bar = nil
 
+	// The album cache keeps the configured titles, so later uploads still find the renamed albums.
+	if gpConfig.GetAppendDateRangeToAlbumTitles() {
+		renameAlbumsWithDateRange(ctx, gphotosClient.Albums(), albumCache, albumDates, albumTitleToIdMap, limiter, dryRun)
+	}
+
 	if dryRun {
-		fmt.Printf("Would have uploaded %d %s\n", len(itemsToUpload), itemTypePluralName)
+		fmt.Printf("Would have uploaded %d %s\n", len(report.UploadedItems), itemTypePluralName)
 	} else {
-		fmt.Printf("Finished uploading %d %s\n", len(itemsToUpload), itemTypePluralName)
+		fmt.Printf("Finished uploading %d %s\n", len(report.UploadedItems), itemTypePluralName)
+	}
+	if pending != nil && !dryRun && len(report.UploadedItems) > 0 {
+		fmt.Printf("Check the uploads in Google Photos, then run commit-uploads to move the %s out of the upload queue\n", itemTypePluralName)
+	}
+	if replacedURLs := report.ReplacedMediaItemURLs(); len(replacedURLs) > 0 {
+		// The Google Photos API can't delete media items.
+		fmt.Printf("Replaced %d earlier upload(s) in their albums. Delete them from your library by hand:\n", len(replacedURLs))
+		for _, url := range replacedURLs {
+			fmt.Printf("\t%s\n", url)
+		}
+	}
+	if len(report.QuarantinedPaths) > 0 {
+		fmt.Printf("Quarantined %d %s that failed to upload %d times; run list-quarantine to see why:\n", len(report.QuarantinedPaths), itemTypePluralName, uploadConfig.QuarantineAfter)
+		for _, path := range report.QuarantinedPaths {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+	if err := moveFailed(); err != nil {
+		return report, err
+	}
+	if len(report.FailedPaths) > 0 {
+		if uploadConfig.MoveFailedTo != "" && !dryRun {
+			return report, fmt.Errorf("failed to upload %d %s, which were moved to %s: %v", len(report.FailedPaths), itemTypePluralName, uploadConfig.MoveFailedTo, report.FailedPaths)
+		}
+		return report, fmt.Errorf("failed to upload %d %s, which were left in the upload queue: %v", len(report.FailedPaths), itemTypePluralName, report.FailedPaths)
+	}
+	return report, nil
+}
+
+// moveFailedFiles moves the files of items, which failed to upload, and their companions, from the upload
+// queue at uploadQueueRoot to failedDir, at the same paths relative to it, so that the upload queue only
+// holds files that haven't been tried. moveMode is as for moveFile. It returns the paths that the files
+// were moved to, in the order of items, which are only those that were moved if it fails part way.
+func moveFailedFiles(items []itemFileInfo, uploadQueueRoot, failedDir, moveMode string) ([]string, error) {
+	var movedPaths []string
+	for _, item := range items {
+		destPath, err := moveQueuedFile(item, uploadQueueRoot, failedDir, moveMode)
+		if err != nil {
+			return movedPaths, fmt.Errorf("failed to move %s, which failed to upload, to %s: %w", item.path, failedDir, err)
+		}
+		movedPaths = append(movedPaths, destPath)
+	}
+	fmt.Printf("Moved %d file(s) that failed to upload to %s\n", len(movedPaths), failedDir)
+	return movedPaths, nil
+}
+
+// preflightCheck makes a cheap Google Photos API call, to return any auth error before a long upload starts.
+func preflightCheck(ctx context.Context, gphotosClient GPhotosClient, limiter *rate.Limiter) error {
+	if err := limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter error before preflight check: %w", err)
+	}
+	if _, err := gphotosClient.Albums().ListPage(ctx, 1); err != nil {
+		return fmt.Errorf("preflight check of google photos access failed (skip it with --no-preflight): %w", err)
 	}
 	return nil
 }
 
+// uploadQueueLeftOut is what filterUploadQueue leaves out of an upload, and why.
+type uploadQueueLeftOut struct {
+	nonMedia    []itemFileInfo
+	oversized   []itemFileInfo
+	numExcluded int // Excluded by their extension.
+	numPaired   int // The other file of RAW+JPEG pairs.
+	numPending  int // Uploaded with upload.defer_commit and waiting for commit-uploads.
+	numOld      int // Dated before lastDate, with upload.new_only.
+	lastDate    string
+	// pending is the pending commits, with upload.defer_commit unless keepQueued, else nil.
+	pending *pendingCommits
+}
+
+// filterUploadQueue returns the items of an upload queue that an upload would upload, before reading
+// their metadata, and what it leaves out. It doesn't move or print anything, so that a summary of the
+// queue counts the same files as an upload.
+func filterUploadQueue(items []itemFileInfo, cacheDir string, keepQueued bool, localConfig LocalConfig, gpConfig GPConfig, uploadConfig config.UploadConfig) ([]itemFileInfo, uploadQueueLeftOut, error) {
+	var left uploadQueueLeftOut
+	uploadQueueDir := localConfig.GetUploadQueueRoot()
+	items, left.nonMedia = splitNonMedia(items, uploadQueueDir)
+	items, left.oversized = splitOversized(items)
+	if len(uploadConfig.IncludeExtensions) > 0 || len(uploadConfig.ExcludeExtensions) > 0 {
+		items, left.numExcluded = filterByExtension(items, uploadConfig.IncludeExtensions, uploadConfig.ExcludeExtensions)
+	}
+	numItems := len(items)
+	items = pairRawJpegFiles(items, gpConfig.GetRawJpegPairs())
+	left.numPaired = numItems - len(items)
+
+	// With upload.defer_commit, files that were uploaded stay in the queue until commit-uploads.
+	if uploadConfig.DeferCommit && !keepQueued {
+		var err error
+		if left.pending, err = loadPendingCommits(getPendingCommitsPath(cacheDir)); err != nil {
+			return nil, uploadQueueLeftOut{}, err
+		}
+		items, left.numPending = left.pending.filterPending(uploadQueueDir, items)
+	}
+
+	if uploadConfig.NewOnly && len(items) > 0 {
+		lastDate, err := lastUploadedDate(localConfig.GetUploadedRoot())
+		if err != nil {
+			return nil, uploadQueueLeftOut{}, fmt.Errorf("failed to find the last uploaded date: %w", err)
+		}
+		if lastDate == "" {
+			logger.Info("Nothing uploaded yet, so considering all files as new",
+				slog.String("uploaded_dir", localConfig.GetUploadedRoot()))
+		} else {
+			left.lastDate = lastDate
+			items, left.numOld = filterNewOnly(items, lastDate)
+		}
+	}
+	return items, left, nil
+}
+
+// filterByExtension returns the items whose extension is in include, if it isn't empty, and not in exclude,
+// and the number of items that were filtered out. Extensions are compared ignoring case and any leading dot.
+func filterByExtension(items []itemFileInfo, include, exclude []string) ([]itemFileInfo, int) {
+	normalize := func(ext string) string {
+		return strings.ToLower(strings.TrimPrefix(ext, "."))
+	}
+	toSet := func(exts []string) map[string]bool {
+		set := make(map[string]bool, len(exts))
+		for _, ext := range exts {
+			set[normalize(ext)] = true
+		}
+		return set
+	}
+	includeSet, excludeSet := toSet(include), toSet(exclude)
+
+	var keptItems []itemFileInfo
+	for _, item := range items {
+		ext := normalize(filepath.Ext(item.path))
+		if (len(includeSet) > 0 && !includeSet[ext]) || excludeSet[ext] {
+			logger.Debug("Skipping file excluded by its extension", slog.String("path", item.path))
+			continue
+		}
+		keptItems = append(keptItems, item)
+	}
+	return keptItems, len(items) - len(keptItems)
+}
+
+// filterByRating returns the items, and their exif data, that are rated at least minRating,
+// and the number of items that were filtered out. Unrated items are kept only if includeUnrated.
+func filterByRating(items []itemFileInfo, itemExifs []ExifData, minRating int, includeUnrated bool) ([]itemFileInfo, []ExifData, int) {
+	ratings := make(map[string]*int, len(itemExifs))
+	for _, exif := range itemExifs {
+		ratings[exif.Path] = exif.Rating
+	}
+	keep := func(path string) bool {
+		rating := ratings[path]
+		if rating == nil {
+			return includeUnrated
+		}
+		return *rating >= minRating
+	}
+
+	var keptItems []itemFileInfo
+	for _, item := range items {
+		if keep(item.path) {
+			keptItems = append(keptItems, item)
+		} else {
+			logger.Debug("Skipping file below minimum rating", slog.String("path", item.path))
+		}
+	}
+	var keptExifs []ExifData
+	for _, exif := range itemExifs {
+		if keep(exif.Path) {
+			keptExifs = append(keptExifs, exif)
+		}
+	}
+	return keptItems, keptExifs, len(items) - len(keptItems)
+}
+
 // uploadMediaItem uploads a single media item "filePath" of size "fileSize" to google photos.
-// It updates "bar" with the bytes it has uploaded.
-// It deletes the file after uploading if "keepQueued" is false.
+// It adds the bytes it has uploaded to "progress", and records the created media item in "ledger".
+// If the media item can't be recorded, the file is still finished with, and an error wrapping
+// errUnrecordedUpload is returned.
+// It deletes the file after uploading if "keepQueued" is false, unless "pending" isn't nil,
+// in which case it records the file in "pending" for commit-uploads to move it later.
 // "targetAlbumIDs" are the ids for DefaultAlbums in the config.
-func uploadMediaItem(ctx context.Context, keepQueued bool, localConfig LocalConfig, gphotosClient GPhotosClient, fileInfo itemFileInfo, targetAlbumTitles []string, albumTitleToIdMap map[string]string, bar *progressbar.ProgressBar, limiter *rate.Limiter, dryRun bool) error {
+// If adding the media item to an album fails, uploadConfig.AlbumAddFailure selects whether to
+// return the error, or to return the failed album titles and move or keep the file.
+// With uploadConfig.Safe, the file is only moved after its media item is fetched back from Google Photos
+// and it was added to all of its albums.
+// "replaced", if not nil, is the media item of an earlier upload of the file, which is removed from the
+// albums that the new media item is added to. Its product URL is returned if it was (or would be) replaced.
+func uploadMediaItem(ctx context.Context, keepQueued bool, localConfig LocalConfig, uploadConfig config.UploadConfig, gphotosClient GPhotosClient, fileInfo itemFileInfo, targetAlbumTitles []string, albumTitleToIdMap map[string]string, progress *progressAggregator, limiter *rate.Limiter, albumWriter *albumWriter, ledger *uploadLedger, pending *pendingCommits, replaced *media_items.MediaItem, dryRun bool) ([]string, string, error) {
 	fileBasename := filepath.Base(fileInfo.path)
+	var failedAlbumTitles []string
+	var replacedURL string
+	var mediaItemID string
+	var recordErr error
 
 	// Defer the progress bar update to ensure it happens once per file attempt.
-	defer bar.Add64(fileInfo.size)
+	defer progress.Add64(fileInfo.size)
 
 	// Wait before uploading file
 	if err := limiter.Wait(ctx); err != nil {
-		return fmt.Errorf("rate limiter error before uploading %s: %w", fileBasename, err)
+		return nil, "", fmt.Errorf("rate limiter error before uploading %s: %w", fileBasename, err)
 	}
 
 	if dryRun {
 		logger.Debug("Would upload file",
 			slog.String("file", fileBasename),
 			slog.Any("albums", targetAlbumTitles))
+		if replaced != nil {
+			replacedURL = replaced.ProductURL
+		}
 	} else {
 		// TODO: consider parallelizing uploads.
 		// TODO: consider doing resumable uploads.
 		// TODO: consider updating progress bar with actual upload progress. (gphotos UploadFile calls NewUploadFromFile, which returns a file, so it is close.)
-		uploadToken, err := gphotosClient.Uploader().UploadFile(ctx, fileInfo.path)
+		uploadToken, err := callWithRetries(ctx, uploadConfig.MaxRetries, limiter, func() (string, error) {
+			token, err := gphotosClient.Uploader().UploadFile(ctx, fileInfo.path)
+			if err == nil && token == "" {
+				// Creating a media item from an empty token would fail with a less clear error, so treat it as a failed upload.
+				return "", errEmptyUploadToken
+			}
+			return token, err
+		})
 		if err != nil {
 			// TODO: only log error and skip? Want to make sure user notices.
 			// fmt.Printf("\nError uploading file %s: %v. Skipping.\n", fileBasename, err)
 			// return nil // Skip to the next item, progress bar will be updated by defer
-			return fmt.Errorf("failed to upload file %s: %w", fileBasename, err)
+			return nil, "", fmt.Errorf("failed to upload file %s: %w", fileBasename, err)
 		}
 
 		if err := limiter.Wait(ctx); err != nil {
-			return fmt.Errorf("rate limiter error before creating media item for %s: %w", fileBasename, err)
+			return nil, "", fmt.Errorf("rate limiter error before creating media item for %s: %w", fileBasename, err)
 		}
 		simpleMediaItem := media_items.SimpleMediaItem{
 			UploadToken: uploadToken,
 			Filename:    fileBasename,
 		}
 		// TODO: consider batching media item creation.
-		mediaItem, err := gphotosClient.MediaItems().Create(ctx, simpleMediaItem)
+		mediaItem, err := callWithRetries(ctx, uploadConfig.MaxRetries, limiter, func() (*media_items.MediaItem, error) {
+			if uploadConfig.TagDescription {
+				return gphotosClient.MediaItems().CreateWithDescription(ctx, simpleMediaItem, uploadConfig.Tag)
+			}
+			return gphotosClient.MediaItems().Create(ctx, simpleMediaItem)
+		})
 		if err != nil {
-			return fmt.Errorf("failed to create media item for %s: uploadToken %s: %w", fileBasename, uploadToken, err)
+			return nil, "", fmt.Errorf("failed to create media item for %s: uploadToken %s: %w", fileBasename, uploadToken, err)
 		}
 		logger.Debug("Successfully created media item",
 			slog.String("file", fileBasename),
 			slog.String("media_id", mediaItem.ID))
+		mediaItemID = mediaItem.ID
+		// The media item exists, so finish with the file even if it can't be recorded,
+		// and return the error after, so that the upload stops before creating more unrecorded media items.
+		if err := ledger.record(ctx, fileInfo.path, fileInfo.size, mediaItem.ID, uploadConfig.Tag, targetAlbumTitles, time.Now()); err != nil {
+			logger.Warn("Failed to record uploaded media item",
+				slog.String("file", fileBasename),
+				slog.String("media_id", mediaItem.ID),
+				slog.String("error", err.Error()))
+			recordErr = fmt.Errorf("%w: media item %s of %s; free up space if the disk is full before uploading more: %w", errUnrecordedUpload, mediaItem.ID, fileInfo.path, err)
+		}
 
 		// TODO: consider batch adding items to albums.
+		var addedAlbumIDs []string
 		for _, albumTitle := range targetAlbumTitles {
 			albumID, ok := albumTitleToIdMap[albumTitle]
 			if !ok {
-				return fmt.Errorf("album '%s' not found in album ID map", albumTitle)
-			}
-			if err := limiter.Wait(ctx); err != nil {
-				return fmt.Errorf("rate limiter error before adding %s to album %s: %w", fileBasename, albumTitle, err)
+				return nil, "", fmt.Errorf("album '%s' not found in album ID map", albumTitle)
 			}
-			if err := gphotosClient.Albums().AddMediaItems(ctx, albumID, []string{mediaItem.ID}); err != nil {
-				return fmt.Errorf("error adding media item to album %s: %w", albumTitle, err)
+			if err := albumWriter.addMediaItems(ctx, albumID, []string{mediaItem.ID}); err != nil {
+				if uploadConfig.AlbumAddFailure == config.AlbumAddFailureFail {
+					return nil, "", fmt.Errorf("error adding media item to album %s: %w", albumTitle, err)
+				}
+				logger.Warn("Failed to add media item to album",
+					slog.String("file", fileBasename),
+					slog.String("album_title", albumTitle),
+					slog.String("error", err.Error()))
+				failedAlbumTitles = append(failedAlbumTitles, albumTitle)
+				continue
 			}
 			logger.Debug("Added media item to album",
 				slog.String("media_id", mediaItem.ID),
 				slog.String("album_title", albumTitle))
+			addedAlbumIDs = append(addedAlbumIDs, albumID)
+		}
 
+		if replaced != nil && replaced.ID != mediaItem.ID {
+			// The new media item exists, so only warn if the replaced one can't be removed from its albums.
+			if err := removeReplacedMediaItem(ctx, albumWriter, replaced, addedAlbumIDs); err != nil {
+				logger.Warn("Failed to remove replaced media item from albums",
+					slog.String("file", fileBasename),
+					slog.String("error", err.Error()))
+			}
+			replacedURL = replaced.ProductURL
+		} else if replaced != nil {
+			logger.Info("Uploaded file is unchanged, so its media item was kept",
+				slog.String("file", fileBasename),
+				slog.String("media_id", mediaItem.ID))
+		}
+
+		if uploadConfig.Safe {
+			if err := verifyMediaItem(ctx, gphotosClient, uploadConfig.MaxRetries, limiter, mediaItem.ID); err != nil {
+				return nil, "", fmt.Errorf("failed to verify media item for %s: %w", fileBasename, err)
+			}
 		}
 	}
 
+	// Keep the file in the queue to retry the failed album adds on the next upload,
+	// which Google Photos resolves to the same media item.
+	if len(failedAlbumTitles) > 0 && (uploadConfig.AlbumAddFailure == config.AlbumAddFailureKeepInQueue || uploadConfig.Safe) {
+		logger.Debug("Keeping file in upload queue directory because adding it to albums failed",
+			slog.String("file", fileInfo.path))
+		return failedAlbumTitles, replacedURL, recordErr
+	}
+
 	// Only move when keepQueued is false; uploading with keepQueued=true does not copy to uploaded.
-	if !keepQueued {
-		if _, err := moveToUploaded(localConfig, fileInfo, dryRun); err != nil {
-			return err
-		}
-	} else {
+	if keepQueued {
 		logger.Debug("Keeping file in upload queue directory as per keepQueued flag",
 			slog.String("file", fileInfo.path))
+	} else if pending != nil {
+		if dryRun {
+			logger.Debug("Would keep file in upload queue directory until commit-uploads",
+				slog.String("file", fileInfo.path))
+		} else if err := pending.add(localConfig.GetUploadQueueRoot(), fileInfo, mediaItemID, withoutStrings(targetAlbumTitles, failedAlbumTitles)); err != nil {
+			return failedAlbumTitles, "", err
+		}
+	} else if err := moveUploadedFiles(localConfig, uploadConfig, fileInfo, mediaItemID, withoutStrings(targetAlbumTitles, failedAlbumTitles), dryRun); err != nil {
+		return failedAlbumTitles, "", err
+	}
+
+	return failedAlbumTitles, replacedURL, recordErr
+}
+
+// moveUploadedFiles moves the file of fileInfo, which was uploaded as mediaItemID and added to albumTitles,
+// and its companions to the uploaded dir, and records them as uploadConfig selects.
+func moveUploadedFiles(localConfig LocalConfig, uploadConfig config.UploadConfig, fileInfo itemFileInfo, mediaItemID string, albumTitles []string, dryRun bool) error {
+	destPath, err := moveToUploaded(localConfig, fileInfo, uploadConfig.MoveMode, uploadConfig.KeepQueueStructure, dryRun)
+	if err != nil {
+		return err
 	}
+	if uploadConfig.DayIndex && !dryRun {
+		if err := recordInDayIndex(destPath, fileInfo.size, mediaItemID); err != nil {
+			return err
+		}
+	}
+	if uploadConfig.MediaItemXattrs && !dryRun {
+		// The tags are only a convenience, so don't leave the companions behind in the queue over them.
+		if err := tagMediaItemXattrs(destPath, mediaItemID, albumTitles); err != nil {
+			logger.Warn("Failed to tag uploaded file with its media item",
+				slog.String("path", destPath),
+				slog.String("media_id", mediaItemID),
+				slog.String("error", err.Error()))
+		}
+	}
+	for _, companion := range fileInfo.companions {
+		destPath, err := moveToUploaded(localConfig, companion, uploadConfig.MoveMode, uploadConfig.KeepQueueStructure, dryRun)
+		if err != nil {
+			return err
+		}
+		if uploadConfig.DayIndex && !dryRun {
+			if err := recordInDayIndex(destPath, companion.size, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
+// verifyMediaItem fetches the media item mediaItemID back from Google Photos, to confirm that it exists
+// before its file is moved out of the upload queue.
+func verifyMediaItem(ctx context.Context, gphotosClient GPhotosClient, maxRetries int, limiter *rate.Limiter, mediaItemID string) error {
+	if err := limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter error before getting media item %s: %w", mediaItemID, err)
+	}
+	mediaItem, err := callWithRetries(ctx, maxRetries, limiter, func() (*media_items.MediaItem, error) {
+		return gphotosClient.MediaItems().Get(ctx, mediaItemID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get media item %s: %w", mediaItemID, err)
+	}
+	if mediaItem == nil || mediaItem.ID != mediaItemID {
+		return fmt.Errorf("media item %s was not found", mediaItemID)
+	}
+	logger.Debug("Verified media item", slog.String("media_id", mediaItemID))
 	return nil
 }
 
+// errUnrecordedUpload is the error of an upload whose media item was created, but couldn't be recorded
+// in the upload ledger.
+var errUnrecordedUpload = errors.New("failed to record uploaded media item in the upload ledger")
+
+// errEmptyUploadToken is the error of an upload that succeeded, but returned no upload token.
+var errEmptyUploadToken = errors.New("upload returned an empty upload token")
+
+// uploadAPIError is an error from a Google Photos API call to upload a media item, that remained after any retries.
+type uploadAPIError struct {
+	err error
+}
+
+func (e *uploadAPIError) Error() string {
+	return e.err.Error()
+}
+
+func (e *uploadAPIError) Unwrap() error {
+	return e.err
+}
+
+// retryBaseDelay and retryMaxDelay bound the exponential backoff between retries of Google Photos API calls.
+// They are vars so that tests can shorten them.
+var (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// maxRetryAfter is the longest delay that a Retry-After header of a failed call is followed for.
+const maxRetryAfter = 5 * time.Minute
+
+// callWithRetries calls "call", and retries it up to "maxRetries" times while it fails with a retryable error,
+// waiting with exponential backoff, or as long as the error's Retry-After header asks, and then on "limiter",
+// before each retry. Its final error is returned as an uploadAPIError, unless "ctx" was canceled.
+func callWithRetries[T any](ctx context.Context, maxRetries int, limiter *rate.Limiter, call func() (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := call()
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return result, err
+		}
+		if attempt >= maxRetries || !retryableAPIError(err) {
+			return result, &uploadAPIError{err: err}
+		}
+		delay := retryDelay(attempt, err)
+		logger.Warn("Google Photos API call failed, retrying",
+			slog.Int("retry", attempt+1),
+			slog.Int("max_retries", maxRetries),
+			slog.Duration("delay", delay),
+			slog.String("error", err.Error()))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, fmt.Errorf("canceled before retrying: %w", ctx.Err())
+		case <-timer.C:
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			return result, fmt.Errorf("rate limiter error before retrying: %w", err)
+		}
+	}
+}
+
+// retryableAPIError returns whether a Google Photos API call that failed with err may succeed if it is retried,
+// ie whether err is a temporary failure, such as a rate limit, a server error, or a network error, rather than
+// eg a missing file or a rejected request. Media items that failed to be created are retryable if their status is.
+func retryableAPIError(err error) bool {
+	var createErr *mediaItemCreateError
+	if errors.As(err, &createErr) {
+		return createErr.retryable()
+	}
+	if errors.Is(err, ErrInsufficientScope) {
+		return false
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return false
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusRequestTimeout || apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// retryDelay returns how long to wait before retrying a call whose attempt, from 0, failed with err.
+// It is the delay that err's Retry-After header asks for, up to maxRetryAfter, or else retryBaseDelay
+// doubled for each attempt, up to retryMaxDelay, with jitter so that retries don't line up.
+func retryDelay(attempt int, err error) time.Duration {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Header != nil {
+		if retryAfter := apiErr.Header.Get("Retry-After"); retryAfter != "" {
+			if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+				return min(time.Duration(seconds)*time.Second, maxRetryAfter)
+			}
+			if at, err := http.ParseTime(retryAfter); err == nil {
+				return min(max(time.Until(at), 0), maxRetryAfter)
+			}
+		}
+	}
+	delay := retryMaxDelay
+	if attempt < 30 {
+		delay = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Wait between half and all of the delay.
+	return delay/2 + rand.N(delay/2+1)
+}
+
 // parseDatePrefix parses a basename "s" that is in the standard format of "YYYY-MM-DD-<rest-of-name>"
 // and returns the year, month, and day parts.
 func parseDatePrefix(s string) (year, month, day string, err error) {
@@ -459,6 +1228,45 @@ func isSameFilesystem(path1, path2 string) (bool, error) {
 	return stat1Sys.Dev == stat2Sys.Dev, nil
 }
 
+// additionalAlbumTitles returns the titles of the label and subject albums for the media item with exif.
+// If the item has a label or subjects but none of them map to an album, it returns unmatchedAlbum, if set.
+func additionalAlbumTitles(exif ExifData, labelAlbums, subjectAlbums []config.KeyAlbum, unmatchedAlbum string) []string {
+	var albumTitles []string
+	hasKeywords := false
+	if exif.Label != "" {
+		hasKeywords = true
+		if albumTitle, hasKey := albumForKey(labelAlbums, exif.Label); hasKey {
+			albumTitles = append(albumTitles, albumTitle)
+		}
+	}
+	for _, subject := range exif.Subjects {
+		if subject != "" {
+			hasKeywords = true
+			if albumTitle, hasKey := albumForKey(subjectAlbums, subject); hasKey {
+				albumTitles = append(albumTitles, albumTitle)
+			}
+		}
+	}
+	if len(albumTitles) == 0 && hasKeywords && unmatchedAlbum != "" {
+		albumTitles = append(albumTitles, unmatchedAlbum)
+	}
+	return albumTitles
+}
+
+// withoutStrings returns the elements of a that aren't in b.
+func withoutStrings(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	var result []string
+	for _, s := range a {
+		if !slices.Contains(b, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
 // albumForKey returns the album name for the given key from the provided keyAlbums slice.
 func albumForKey(keyAlbums []config.KeyAlbum, key string) (string, bool) {
 	for _, ka := range keyAlbums {
@@ -1,14 +1,26 @@
 package lib
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"syscall"
 	"testing"
+	"time"
 
+	"github.com/ccfrost/camflow/internal/config"
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
 )
 
 func TestParseDatePrefix(t *testing.T) {
@@ -520,3 +532,263 @@ func TestIsSameFilesystem_ForceFalse(t *testing.T) {
 	require.NoError(t, err)
 	assert.False(t, same, "Should return false when IsSameFileSystemForTests_ForceFalse is true")
 }
+
+func TestFilterByRating(t *testing.T) {
+	rating := func(n int) *int { return &n }
+	items := []itemFileInfo{
+		{path: "/q/five.JPG", size: 5},
+		{path: "/q/three.JPG", size: 3},
+		{path: "/q/one.JPG", size: 1},
+		{path: "/q/unrated.JPG", size: 9},
+	}
+	exifs := []ExifData{
+		{Path: "/q/five.JPG", Rating: rating(5)},
+		{Path: "/q/three.JPG", Rating: rating(3)},
+		{Path: "/q/one.JPG", Rating: rating(1)},
+		{Path: "/q/unrated.JPG"},
+	}
+
+	t.Run("IncludeUnrated", func(t *testing.T) {
+		gotItems, gotExifs, numFiltered := filterByRating(items, exifs, 3, true)
+		assert.Equal(t, []itemFileInfo{items[0], items[1], items[3]}, gotItems)
+		assert.Equal(t, []ExifData{exifs[0], exifs[1], exifs[3]}, gotExifs)
+		assert.Equal(t, 1, numFiltered)
+	})
+
+	t.Run("ExcludeUnrated", func(t *testing.T) {
+		gotItems, gotExifs, numFiltered := filterByRating(items, exifs, 3, false)
+		assert.Equal(t, []itemFileInfo{items[0], items[1]}, gotItems)
+		assert.Equal(t, []ExifData{exifs[0], exifs[1]}, gotExifs)
+		assert.Equal(t, 2, numFiltered)
+	})
+}
+
+func TestFilterByExtension(t *testing.T) {
+	items := []itemFileInfo{
+		{path: "/q/IMG_0001.JPG"},
+		{path: "/q/IMG_0001.CR3"},
+		{path: "/q/IMG_0002.jpeg"},
+		{path: "/q/README"},
+	}
+
+	gotItems, numFiltered := filterByExtension(items, nil, []string{"cr3"})
+	assert.Equal(t, []itemFileInfo{items[0], items[2], items[3]}, gotItems)
+	assert.Equal(t, 1, numFiltered)
+
+	gotItems, numFiltered = filterByExtension(items, []string{".jpg", "JPEG"}, nil)
+	assert.Equal(t, []itemFileInfo{items[0], items[2]}, gotItems, "Extensions should match ignoring case and a leading dot")
+	assert.Equal(t, 2, numFiltered)
+
+	gotItems, numFiltered = filterByExtension(items, []string{"jpg", "jpeg"}, []string{"jpeg"})
+	assert.Equal(t, []itemFileInfo{items[0]}, gotItems, "Exclusions should apply to included extensions")
+	assert.Equal(t, 3, numFiltered)
+}
+
+func TestAdditionalAlbumTitles(t *testing.T) {
+	labelAlbums := []config.KeyAlbum{{Key: "Red", Album: "Favorites"}}
+	subjectAlbums := []config.KeyAlbum{{Key: "japan", Album: "Japan"}, {Key: "family", Album: "Family"}}
+
+	for _, tt := range []struct {
+		name           string
+		exif           ExifData
+		unmatchedAlbum string
+		want           []string
+	}{
+		{name: "Matched", exif: ExifData{Label: "Red", Subjects: []string{"japan", "food"}}, unmatchedAlbum: "Uncategorized", want: []string{"Favorites", "Japan"}},
+		{name: "UnmatchedWithKeywords", exif: ExifData{Label: "Blue", Subjects: []string{"food"}}, unmatchedAlbum: "Uncategorized", want: []string{"Uncategorized"}},
+		{name: "UnmatchedWithoutUnmatchedAlbum", exif: ExifData{Subjects: []string{"food"}}, want: nil},
+		{name: "NoKeywords", exif: ExifData{Subjects: []string{""}}, unmatchedAlbum: "Uncategorized", want: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, additionalAlbumTitles(tt.exif, labelAlbums, subjectAlbums, tt.unmatchedAlbum))
+		})
+	}
+}
+
+func TestUploadPhotos_DefaultAlbumOnlyWhenUnmatched(t *testing.T) {
+	cfg := newTestConfig(t, "Camflow: Photos", "")
+	cfg.GooglePhotos.Photos.LabelAlbums = []config.KeyAlbum{{Key: "Red", Album: "Favorites"}}
+	cfg.GooglePhotos.Photos.UnmatchedAlbum = "Uncategorized"
+	cfg.GooglePhotos.Photos.DefaultAlbumOnlyWhenUnmatched = true
+
+	matchedPath := filepath.Join(cfg.PhotosUploadQueueDir, "2024-01-28-IMG_0001.JPG")
+	unmatchedPath := filepath.Join(cfg.PhotosUploadQueueDir, "2024-01-28-IMG_0002.JPG")
+	noKeywordsPath := filepath.Join(cfg.PhotosUploadQueueDir, "2024-01-28-IMG_0003.JPG")
+	for _, path := range []string{matchedPath, unmatchedPath, noKeywordsPath} {
+		require.NoError(t, os.WriteFile(path, []byte("content"), 0644))
+	}
+
+	// Put an exiftool on the PATH that reports the label of each file.
+	exifOutput, err := json.Marshal([]map[string]string{
+		{"SourceFile": matchedPath, "Label": "Red"},
+		{"SourceFile": unmatchedPath, "Label": "Blue"},
+		{"SourceFile": noKeywordsPath},
+	})
+	require.NoError(t, err)
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "exiftool"), []byte("#!/bin/sh\ncat <<'EOF'\n"+string(exifOutput)+"\nEOF\n"), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{
+		{ID: "photos-album-id", Title: "Camflow: Photos"},
+		{ID: "favorites-album-id", Title: "Favorites"},
+		{ID: "uncategorized-album-id", Title: "Uncategorized"},
+	}, nil)
+	for _, path := range []string{matchedPath, unmatchedPath, noKeywordsPath} {
+		name := filepath.Base(path)
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), path).Return("token_for_"+name, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + name, Filename: name}).
+			Return(&media_items.MediaItem{ID: "media_id_for_" + name, Filename: name}, nil)
+	}
+	// The matched photo is only added to the album that it matched.
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "favorites-album-id", []string{"media_id_for_2024-01-28-IMG_0001.JPG"}).Return(nil)
+	// The others are also added to the default album, including the one in the unmatched album.
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "uncategorized-album-id", []string{"media_id_for_2024-01-28-IMG_0002.JPG"}).Return(nil)
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "photos-album-id", []string{"media_id_for_2024-01-28-IMG_0002.JPG"}).Return(nil)
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "photos-album-id", []string{"media_id_for_2024-01-28-IMG_0003.JPG"}).Return(nil)
+
+	report, err := UploadPhotos(context.Background(), cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	albumTitles := make(map[string][]string)
+	for _, item := range report.UploadedItems {
+		albumTitles[item.Path] = item.AlbumTitles
+	}
+	assert.Equal(t, map[string][]string{
+		matchedPath:    {"Favorites"},
+		unmatchedPath:  {"Uncategorized", "Camflow: Photos"},
+		noKeywordsPath: {"Camflow: Photos"},
+	}, albumTitles)
+}
+
+func TestMoveFile_MoveMode(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	// moveWithMode moves a new file within a temp dir, so on the same filesystem, and returns
+	// whether the destination is the same file as the source, ie whether it was renamed.
+	moveWithMode := func(t *testing.T, moveMode string) bool {
+		dir := t.TempDir()
+		srcPath := filepath.Join(dir, "queue", "2024-05-01-IMG_0001.JPG")
+		destPath := filepath.Join(dir, "uploaded", "2024", "05", "01", "2024-05-01-IMG_0001.JPG")
+		createDummyFile(t, srcPath, "photo", modTime)
+		require.NoError(t, os.Chmod(srcPath, 0600))
+		require.NoError(t, os.Chtimes(srcPath, modTime, modTime)) // Chmod can change the times.
+		srcInfo, err := os.Stat(srcPath)
+		require.NoError(t, err)
+
+		require.NoError(t, moveFile(srcPath, destPath, srcInfo.Size(), modTime, moveMode))
+
+		_, err = os.Stat(srcPath)
+		assert.True(t, os.IsNotExist(err), "Source should be removed")
+		destInfo, err := os.Stat(destPath)
+		require.NoError(t, err)
+		content, err := os.ReadFile(destPath)
+		require.NoError(t, err)
+		assert.Equal(t, "photo", string(content))
+		assert.True(t, modTime.Equal(destInfo.ModTime()))
+		assert.Equal(t, os.FileMode(0600), destInfo.Mode().Perm(), "The mode bits should be kept")
+		return os.SameFile(srcInfo, destInfo)
+	}
+
+	t.Run("Auto", func(t *testing.T) {
+		assert.True(t, moveWithMode(t, config.MoveModeAuto), "Same-filesystem moves should rename")
+	})
+	t.Run("Rename", func(t *testing.T) {
+		assert.True(t, moveWithMode(t, config.MoveModeRename))
+	})
+	t.Run("CopyOnSameFilesystem", func(t *testing.T) {
+		assert.False(t, moveWithMode(t, config.MoveModeCopy), "Forced copy should copy even on the same filesystem")
+	})
+}
+
+func TestCallWithRetries(t *testing.T) {
+	ctx := context.Background()
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{"server error", &googleapi.Error{Code: http.StatusServiceUnavailable}, 3},
+		{"rate limit", &googleapi.Error{Code: http.StatusTooManyRequests}, 3},
+		{"network error", errors.New("connection reset by peer"), 3},
+		{"bad request", &googleapi.Error{Code: http.StatusBadRequest}, 1},
+		{"missing file", &fs.PathError{Op: "open", Path: "/queue/missing.mp4", Err: fs.ErrNotExist}, 1},
+		{"insufficient scope", ErrInsufficientScope, 1},
+		{"invalid upload token", &mediaItemCreateError{Code: 3}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			_, err := callWithRetries(ctx, 2, limiter, func() (string, error) {
+				calls++
+				return "", tt.err
+			})
+			var apiErr *uploadAPIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+
+	calls := 0
+	token, err := callWithRetries(ctx, 2, limiter, func() (string, error) {
+		if calls++; calls == 1 {
+			return "", &googleapi.Error{Code: http.StatusInternalServerError}
+		}
+		return "token", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+	assert.Equal(t, 2, calls)
+}
+
+func TestCallWithRetries_CanceledWhileWaiting(t *testing.T) {
+	defer func(base, max time.Duration) { retryBaseDelay, retryMaxDelay = base, max }(retryBaseDelay, retryMaxDelay)
+	retryBaseDelay, retryMaxDelay = time.Hour, time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	calls := 0
+	_, err := callWithRetries(ctx, 3, rate.NewLimiter(rate.Inf, 1), func() (string, error) {
+		calls++
+		return "", &googleapi.Error{Code: http.StatusServiceUnavailable}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+	assert.Less(t, time.Since(start), time.Minute, "Canceling should stop waiting to retry")
+}
+
+func TestRetryDelay(t *testing.T) {
+	defer func(base, max time.Duration) { retryBaseDelay, retryMaxDelay = base, max }(retryBaseDelay, retryMaxDelay)
+	retryBaseDelay, retryMaxDelay = time.Second, 4*time.Second
+
+	err := errors.New("connection reset by peer")
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		delay := retryDelay(attempt, err)
+		assert.GreaterOrEqual(t, delay, want/2, "attempt %d", attempt)
+		assert.LessOrEqual(t, delay, want, "attempt %d", attempt)
+	}
+	delay := retryDelay(100, err)
+	assert.LessOrEqual(t, delay, retryMaxDelay, "The backoff shouldn't overflow")
+
+	retryAfter := func(value string) error {
+		return &googleapi.Error{Code: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {value}}}
+	}
+	assert.Equal(t, 7*time.Second, retryDelay(0, retryAfter("7")))
+	assert.Equal(t, maxRetryAfter, retryDelay(0, retryAfter("86400")), "A long Retry-After should be capped")
+	delay = retryDelay(0, retryAfter(time.Now().Add(20*time.Second).UTC().Format(http.TimeFormat)))
+	assert.Greater(t, delay, 15*time.Second)
+	assert.LessOrEqual(t, delay, 20*time.Second)
+	delay = retryDelay(0, retryAfter("soon"))
+	assert.LessOrEqual(t, delay, time.Second, "An invalid Retry-After should fall back to the backoff")
+}
@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// mediaContentTypes maps the lowercase extensions of photos and videos to their MIME types, for the files
+// whose content http.DetectContentType doesn't recognize, eg HEIC photos and QuickTime videos.
+// RAW photos have no standard MIME type, so they are uploaded as application/octet-stream.
+var mediaContentTypes = map[string]string{
+	".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".png": "image/png", ".gif": "image/gif", ".webp": "image/webp",
+	".heic": "image/heic", ".heif": "image/heif", ".avif": "image/avif", ".bmp": "image/bmp", ".tif": "image/tiff",
+	".tiff": "image/tiff", ".ico": "image/x-icon",
+	".3gp": "video/3gpp", ".3g2": "video/3gpp2", ".asf": "video/x-ms-asf", ".avi": "video/x-msvideo",
+	".m2t": "video/mp2t", ".m2ts": "video/mp2t", ".m4v": "video/x-m4v", ".mkv": "video/x-matroska",
+	".mov": "video/quicktime", ".mp4": "video/mp4", ".mpg": "video/mpeg", ".mpeg": "video/mpeg", ".mts": "video/mp2t",
+	".wmv": "video/x-ms-wmv",
+}
+
+// uploadContentType returns the MIME type to upload the file at path as: the type sniffed from its content,
+// if that is a photo or video type, and otherwise the type of its extension. It returns "" if neither is known.
+func uploadContentType(path string) string {
+	// A file that can't be read fails its upload, with a better error than this would give.
+	if contentType, err := sniffContentType(path); err == nil &&
+		(strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/")) {
+		return contentType
+	}
+	return mediaContentTypes[strings.ToLower(filepath.Ext(path))]
+}
+
+// uploadContentTypeKey is the context key of the MIME type of the file that a request uploads.
+type uploadContentTypeKey struct{}
+
+// withUploadContentType returns ctx with contentType as the MIME type of the file that its requests upload.
+func withUploadContentType(ctx context.Context, contentType string) context.Context {
+	return context.WithValue(ctx, uploadContentTypeKey{}, contentType)
+}
+
+// uploadContentTypeTransport sets the X-Goog-Upload-Content-Type header of upload requests to the MIME type
+// in their context, since the gphotos uploader always sends application/octet-stream.
+type uploadContentTypeTransport struct {
+	// base sends the requests. If it is nil, http.DefaultTransport is used.
+	base http.RoundTripper
+}
+
+// RoundTrip sends req, with its upload content type, if it has one.
+func (t *uploadContentTypeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	contentType, ok := req.Context().Value(uploadContentTypeKey{}).(string)
+	if ok && req.Header.Get("X-Goog-Upload-Content-Type") != "" {
+		// A RoundTripper mustn't change the request that it is given.
+		req = req.Clone(req.Context())
+		req.Header.Set("X-Goog-Upload-Content-Type", contentType)
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
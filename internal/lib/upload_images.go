@@ -8,12 +8,13 @@ import (
 )
 
 // UploadPhotos uploads photos from the photo upload queue dir to Google Photos.
-// Photos are added to Google Photos album named DefaultAlbum.
+// Photos are added to the Google Photos albums named by DefaultAlbums.
 // Uploaded photos are moved from upload queue to uploaded dir; unless keepQueued is true, in which case they are copied (but not moved).
 // The function is idempotent - if interrupted, it can be recalled to resume.
-func UploadPhotos(ctx context.Context, cfg config.CamflowConfig, cacheDirFlag string, keepQueued bool, gphotosClient GPhotosClient, dryRun bool) error {
+// It returns a report of the uploaded photos, including any uploaded before an error.
+func UploadPhotos(ctx context.Context, cfg config.CamflowConfig, cacheDirFlag string, keepQueued bool, gphotosClient GPhotosClient, dryRun bool) (UploadReport, error) {
 	if err := cfg.Validate(); err != nil {
-		return fmt.Errorf("invalid config: %w", err)
+		return UploadReport{}, fmt.Errorf("invalid config: %w", err)
 	}
-	return uploadMediaItems(ctx, cacheDirFlag, keepQueued, &cfg.LocalPhotos, &cfg.GooglePhotos.Photos, "photos", gphotosClient, dryRun)
+	return uploadMediaItems(ctx, newUploadSession(), cacheDirFlag, keepQueued, &cfg.LocalPhotos, &cfg.GooglePhotos.Photos, cfg.Upload, "photos", gphotosClient, dryRun)
 }
@@ -0,0 +1,227 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// uploadLedgerEntry records the Google Photos media item that a file was uploaded as,
+// or that uploading the file failed, or that the file was requeued from quarantine.
+type uploadLedgerEntry struct {
+	// File is the basename of the uploaded file, which is unique because of its date prefix.
+	File string `json:"file"`
+	// Path and Size are the path of the file in the upload queue when it was uploaded, and its size.
+	Path        string    `json:"path,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	MediaItemID string    `json:"media_item_id,omitempty"`
+	UploadedAt  time.Time `json:"uploaded_at,omitzero"`
+	// Albums are the titles of the albums that the media item was to be added to.
+	Albums []string `json:"albums,omitempty"`
+	// Tag is the upload.tag of the run that uploaded the file, if any.
+	Tag string `json:"tag,omitempty"`
+	// FailedAt and Error record a failed upload of the file, after any retries.
+	FailedAt time.Time `json:"failed_at,omitzero"`
+	Error    string    `json:"error,omitempty"`
+	// RequeuedAt records that the file was moved back to the upload queue from quarantine,
+	// which resets its failure count.
+	RequeuedAt time.Time `json:"requeued_at,omitzero"`
+}
+
+// uploadFailures counts the failed uploads of a file since it was last uploaded or requeued.
+type uploadFailures struct {
+	count     int
+	lastError string
+}
+
+// uploadLedger is an append-only log of the media items that camflow uploaded, and of the files
+// that failed to upload, so that later commands can refer to them.
+type uploadLedger struct {
+	path string
+	mu   sync.Mutex
+	// failedWrite is whether the last write failed, and so may have left a partial line.
+	failedWrite bool
+}
+
+// getUploadLedgerPath constructs the path to the upload ledger file.
+func getUploadLedgerPath(cacheDir string) string {
+	return filepath.Join(cacheDir, "upload_ledger.jsonl")
+}
+
+// newUploadLedger returns the upload ledger at path.
+func newUploadLedger(path string) *uploadLedger {
+	return &uploadLedger{path: path}
+}
+
+// record appends an entry for the file at filePath, of size bytes, that was uploaded as mediaItemID,
+// to be added to albumTitles, in a run tagged tag.
+func (l *uploadLedger) record(ctx context.Context, filePath string, size int64, mediaItemID, tag string, albumTitles []string, uploadedAt time.Time) error {
+	return l.append(ctx, uploadLedgerEntry{File: filepath.Base(filePath), Path: filePath, Size: size, MediaItemID: mediaItemID, UploadedAt: uploadedAt.UTC(), Tag: tag, Albums: albumTitles})
+}
+
+// recordFailure appends an entry for the file at filePath that failed to upload with uploadErr.
+func (l *uploadLedger) recordFailure(ctx context.Context, filePath string, uploadErr error, failedAt time.Time) error {
+	return l.append(ctx, uploadLedgerEntry{File: filepath.Base(filePath), FailedAt: failedAt.UTC(), Error: uploadErr.Error()})
+}
+
+// recordRequeue appends an entry for the file at filePath that was requeued from quarantine.
+func (l *uploadLedger) recordRequeue(ctx context.Context, filePath string, requeuedAt time.Time) error {
+	return l.append(ctx, uploadLedgerEntry{File: filepath.Base(filePath), RequeuedAt: requeuedAt.UTC()})
+}
+
+// ledgerWriteRetries is the number of times that a failed write to the upload ledger is retried,
+// eg to ride out a disk that was briefly full.
+const ledgerWriteRetries = 2
+
+// ledgerWriteRetryDelay is the time to wait before retrying a failed write to the upload ledger.
+// It is a var so that tests can shorten it.
+var ledgerWriteRetryDelay = time.Second
+
+// append appends entry to the ledger, retrying the write if it fails, until ctx is canceled.
+func (l *uploadLedger) append(ctx context.Context, entry uploadLedgerEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload ledger entry: %w", err)
+	}
+	line = append(line, '\n')
+	return retryLedgerWrite(ctx, func() error {
+		return l.writeLine(line)
+	})
+}
+
+// writeLine appends line to the ledger. The lock is only held for the write, not while waiting to retry,
+// so that other uploads aren't blocked on a failing disk.
+func (l *uploadLedger) writeLine(line []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.failedWrite {
+		// Start a new line, in case the failed write left a partial one. Empty lines are skipped.
+		line = append([]byte{'\n'}, line...)
+	}
+	err := l.write(line)
+	l.failedWrite = err != nil
+	return err
+}
+
+// retryLedgerWrite calls write until it succeeds, or up to ledgerWriteRetries more times.
+// It returns the last error, or an error if ctx is canceled while waiting to retry.
+func retryLedgerWrite(ctx context.Context, write func() error) error {
+	var err error
+	for attempt := 0; attempt <= ledgerWriteRetries; attempt++ {
+		if attempt > 0 {
+			logger.Warn("Failed to write upload ledger, retrying",
+				slog.Int("attempt", attempt),
+				slog.String("error", err.Error()))
+			timer := time.NewTimer(ledgerWriteRetryDelay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("canceled before retrying: %w", errors.Join(err, ctx.Err()))
+			case <-timer.C:
+			}
+		}
+		if err = write(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// write appends data to the ledger file.
+func (l *uploadLedger) write(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for upload ledger %s: %w", l.path, err)
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open upload ledger %s: %w", l.path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write upload ledger %s: %w", l.path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close upload ledger %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// mediaItemIDs returns the map from the basenames of uploaded files to their media item IDs.
+// If a file was uploaded more than once, the latest media item ID is used.
+// It returns an empty map if the ledger doesn't exist.
+func (l *uploadLedger) mediaItemIDs() (map[string]string, error) {
+	ids := make(map[string]string)
+	err := l.forEach(func(entry uploadLedgerEntry) {
+		if entry.MediaItemID != "" {
+			ids[entry.File] = entry.MediaItemID
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// failures returns the map from the basenames of the files that failed to upload since they were
+// last uploaded or requeued to their failures. It returns an empty map if the ledger doesn't exist.
+func (l *uploadLedger) failures() (map[string]uploadFailures, error) {
+	failures := make(map[string]uploadFailures)
+	err := l.forEach(func(entry uploadLedgerEntry) {
+		switch {
+		case !entry.FailedAt.IsZero():
+			f := failures[entry.File]
+			failures[entry.File] = uploadFailures{count: f.count + 1, lastError: entry.Error}
+		case entry.MediaItemID != "", !entry.RequeuedAt.IsZero():
+			delete(failures, entry.File)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+// forEach calls fn with each entry of the ledger, in the order they were recorded.
+// It does nothing if the ledger doesn't exist.
+func (l *uploadLedger) forEach(fn func(entry uploadLedgerEntry)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open upload ledger %s: %w", l.path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry uploadLedgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A partial last line can be left if camflow was killed while writing it.
+			logger.Warn("Skipping invalid upload ledger line",
+				slog.String("path", l.path),
+				slog.Int("line", lineNum),
+				slog.String("error", err.Error()))
+			continue
+		}
+		fn(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read upload ledger %s: %w", l.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadLedger(t *testing.T) {
+	path := getUploadLedgerPath(filepath.Join(t.TempDir(), "cache"))
+	ledger := newUploadLedger(path)
+
+	ids, err := ledger.mediaItemIDs()
+	require.NoError(t, err)
+	assert.Empty(t, ids, "a missing ledger should have no entries")
+
+	now := time.Now()
+	require.NoError(t, ledger.record(context.Background(), "/queue/2024-05-03-a.jpg", 0, "id-a", "", nil, now))
+	require.NoError(t, ledger.record(context.Background(), "/queue/2024-05-03-b.jpg", 0, "id-b", "", nil, now))
+	require.NoError(t, ledger.record(context.Background(), "/other/2024-05-03-a.jpg", 0, "id-a2", "", nil, now))
+
+	// A partial line, as left by an interrupted write, is skipped.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"file":"2024-05-03-c.jpg","media_`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	ids, err = newUploadLedger(path).mediaItemIDs()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"2024-05-03-a.jpg": "id-a2",
+		"2024-05-03-b.jpg": "id-b",
+	}, ids)
+}
+
+func TestRetryLedgerWrite(t *testing.T) {
+	defer func(delay time.Duration) { ledgerWriteRetryDelay = delay }(ledgerWriteRetryDelay)
+	ledgerWriteRetryDelay = 0
+
+	calls := 0
+	err := retryLedgerWrite(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("no space left on device")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = retryLedgerWrite(context.Background(), func() error {
+		calls++
+		return fmt.Errorf("write %d: no space left on device", calls)
+	})
+	assert.EqualError(t, err, fmt.Sprintf("write %d: no space left on device", ledgerWriteRetries+1))
+	assert.Equal(t, ledgerWriteRetries+1, calls)
+
+	// Canceling stops the wait to retry.
+	ledgerWriteRetryDelay = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	err = retryLedgerWrite(ctx, func() error {
+		calls++
+		return errors.New("no space left on device")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorContains(t, err, "no space left on device")
+	assert.Equal(t, 1, calls)
+}
+
+func TestUploadVideos_LedgerWriteFails(t *testing.T) {
+	defer func(delay time.Duration) { ledgerWriteRetryDelay = delay }(ledgerWriteRetryDelay)
+	ledgerWriteRetryDelay = 0
+
+	cfg := newTestConfig(t, "", "")
+	cacheDir := t.TempDir()
+	// A dir in place of the ledger can't be written, like a full disk.
+	require.NoError(t, os.Mkdir(getUploadLedgerPath(cacheDir), 0755))
+	fileNames := []string{"2024-01-01-video1.mp4", "2024-01-02-video2.mp4"}
+	for _, fileName := range fileNames {
+		createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{fileName: "content"})
+	}
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	// Only the first video is uploaded; the upload stops before the second.
+	firstPath := filepath.Join(cfg.VideosUploadQueueRoot, fileNames[0])
+	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), firstPath).Return("token", nil)
+	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), gomock.Any()).Return(&media_items.MediaItem{ID: "id-1"}, nil)
+
+	report, err := UploadVideos(context.Background(), cfg, cacheDir, false /* keepQueued */, mockGPhotosClient, false)
+	require.ErrorIs(t, err, errUnrecordedUpload)
+	assert.Contains(t, err.Error(), "media item id-1 of "+firstPath)
+	assert.Contains(t, err.Error(), "free up space")
+	require.Len(t, report.UploadedItems, 1, "The video was uploaded, so it should be reported")
+	assert.Equal(t, firstPath, report.UploadedItems[0].Path)
+	assert.Empty(t, report.FailedPaths)
+	assert.NoFileExists(t, firstPath, "The uploaded video should be moved out of the upload queue")
+	assert.FileExists(t, filepath.Join(cfg.VideosUploadQueueRoot, fileNames[1]))
+}
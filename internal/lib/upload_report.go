@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"slices"
+	"sort"
+)
+
+// UploadReport describes the media items that an upload run uploaded.
+type UploadReport struct {
+	// UploadedItems are the uploaded media items, in upload order.
+	// In a dry run, they are the media items that would have been uploaded.
+	UploadedItems []UploadedItem
+	// FailedPaths are the paths of the files that failed to upload and were left in the upload queue.
+	FailedPaths []string
+	// QuarantinedPaths are the paths of the files that failed to upload too many times,
+	// per upload.quarantine_after, and were moved to the quarantine dir of the upload queue.
+	QuarantinedPaths []string
+	// CreatedAlbums are the titles of the albums that the upload created, or in a dry run would have, sorted.
+	CreatedAlbums []string
+}
+
+// UploadedItem is a media item that was uploaded, and the albums that it was added to.
+type UploadedItem struct {
+	// Path is the path of the item's file in the upload queue.
+	Path        string
+	AlbumTitles []string
+	// FailedAlbumTitles are the albums that adding the item to failed, per upload.album_add_failure.
+	FailedAlbumTitles []string
+	// ReplacedMediaItemURL is the product URL of the media item of an earlier upload of the file,
+	// that this upload replaced in its albums, per upload.replace_existing.
+	ReplacedMediaItemURL string
+}
+
+// merge returns a report of the uploads of both r and other.
+func (r UploadReport) merge(other UploadReport) UploadReport {
+	return UploadReport{
+		UploadedItems:    append(append([]UploadedItem(nil), r.UploadedItems...), other.UploadedItems...),
+		FailedPaths:      append(append([]string(nil), r.FailedPaths...), other.FailedPaths...),
+		QuarantinedPaths: append(append([]string(nil), r.QuarantinedPaths...), other.QuarantinedPaths...),
+		// Both uploads can use an album that the first created.
+		CreatedAlbums: mergeSorted(r.CreatedAlbums, other.CreatedAlbums),
+	}
+}
+
+// mergeSorted returns the sorted strings that are in either of the sorted a and b, once each.
+func mergeSorted(a, b []string) []string {
+	merged := append(append([]string(nil), a...), b...)
+	sort.Strings(merged)
+	return slices.Compact(merged)
+}
+
+// AlbumItemCount is the number of media items that were added to an album,
+// and the number that failed to be.
+type AlbumItemCount struct {
+	AlbumTitle      string `json:"album_title"`
+	ItemCount       int    `json:"item_count"`
+	FailedItemCount int    `json:"failed_item_count"`
+}
+
+// AlbumItemCounts returns the number of uploaded media items added to, and that failed to be added to,
+// each album, sorted by album title.
+func (r UploadReport) AlbumItemCounts() []AlbumItemCount {
+	counts := make(map[string]*AlbumItemCount)
+	count := func(albumTitle string) *AlbumItemCount {
+		if counts[albumTitle] == nil {
+			counts[albumTitle] = &AlbumItemCount{AlbumTitle: albumTitle}
+		}
+		return counts[albumTitle]
+	}
+	for _, item := range r.UploadedItems {
+		for _, albumTitle := range item.AlbumTitles {
+			count(albumTitle).ItemCount++
+		}
+		for _, albumTitle := range item.FailedAlbumTitles {
+			count(albumTitle).FailedItemCount++
+		}
+	}
+	albumItemCounts := make([]AlbumItemCount, 0, len(counts))
+	for _, c := range counts {
+		albumItemCounts = append(albumItemCounts, *c)
+	}
+	sort.Slice(albumItemCounts, func(i, j int) bool {
+		return albumItemCounts[i].AlbumTitle < albumItemCounts[j].AlbumTitle
+	})
+	return albumItemCounts
+}
+
+// ReplacedMediaItemURLs returns the product URLs of the media items that uploads replaced, in upload order.
+func (r UploadReport) ReplacedMediaItemURLs() []string {
+	var urls []string
+	for _, item := range r.UploadedItems {
+		if item.ReplacedMediaItemURL != "" {
+			urls = append(urls, item.ReplacedMediaItemURL)
+		}
+	}
+	return urls
+}
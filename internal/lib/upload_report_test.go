@@ -0,0 +1,22 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadReportAlbumItemCounts(t *testing.T) {
+	report := UploadReport{UploadedItems: []UploadedItem{
+		{Path: "/q/2024-05-01-IMG_0001.JPG", AlbumTitles: []string{"Japan", "Camflow: Photos"}},
+		{Path: "/q/2024-05-01-IMG_0002.JPG", AlbumTitles: []string{"Camflow: Photos"}},
+		{Path: "/q/2024-05-01-IMG_0003.JPG"},
+		{Path: "/q/2024-05-01-IMG_0004.JPG", AlbumTitles: []string{"Camflow: Photos"}, FailedAlbumTitles: []string{"Japan"}},
+	}}
+	assert.Equal(t, []AlbumItemCount{
+		{AlbumTitle: "Camflow: Photos", ItemCount: 3},
+		{AlbumTitle: "Japan", ItemCount: 1, FailedItemCount: 1},
+	}, report.AlbumItemCounts())
+
+	assert.Empty(t, UploadReport{}.AlbumItemCounts())
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ccfrost/camflow/internal/config"
+)
+
+// UploadQueueSummary describes the media items waiting in an upload queue.
+type UploadQueueSummary struct {
+	Count     int
+	TotalSize int64
+	// FirstDate and LastDate are the range of the dates of the media items. They are zero if Count is 0.
+	FirstDate time.Time
+	LastDate  time.Time
+	// EstimatedDuration is how long uploading the media items is expected to take,
+	// limited by the API rate limits and, if configured, the upload bandwidth.
+	EstimatedDuration time.Duration
+	// BandwidthKnown is whether EstimatedDuration accounts for the upload bandwidth.
+	BandwidthKnown bool
+}
+
+// SummarizePhotosUploadQueue summarizes the photos in the upload queue that UploadPhotos would upload,
+// without reading their metadata or calling the Google Photos API. cacheDir and keepQueued are as for UploadPhotos.
+func SummarizePhotosUploadQueue(cfg config.CamflowConfig, cacheDir string, keepQueued bool) (UploadQueueSummary, error) {
+	if err := cfg.Validate(); err != nil {
+		return UploadQueueSummary{}, fmt.Errorf("invalid config: %w", err)
+	}
+	return summarizeUploadQueue(cacheDir, keepQueued, &cfg.LocalPhotos, &cfg.GooglePhotos.Photos, cfg.Upload)
+}
+
+// SummarizeVideosUploadQueue summarizes the videos in the upload queue that UploadVideos would upload,
+// without reading their metadata or calling the Google Photos API. cacheDir and keepQueued are as for UploadVideos.
+func SummarizeVideosUploadQueue(cfg config.CamflowConfig, cacheDir string, keepQueued bool) (UploadQueueSummary, error) {
+	if err := cfg.Validate(); err != nil {
+		return UploadQueueSummary{}, fmt.Errorf("invalid config: %w", err)
+	}
+	return summarizeUploadQueue(cacheDir, keepQueued, &cfg.LocalVideos, &cfg.GooglePhotos.Videos, cfg.Upload)
+}
+
+func summarizeUploadQueue(cacheDir string, keepQueued bool, localConfig LocalConfig, gpConfig GPConfig, uploadConfig config.UploadConfig) (UploadQueueSummary, error) {
+	uploadQueueDir := localConfig.GetUploadQueueRoot()
+	if _, err := os.Stat(uploadQueueDir); os.IsNotExist(err) {
+		return UploadQueueSummary{}, checkUploadQueueMounted(uploadQueueDir)
+	}
+	items, _, err := scanUploadQueue(uploadQueueDir, localConfig.GetSymlinks())
+	if err != nil {
+		return UploadQueueSummary{}, err
+	}
+	items, _, err = filterUploadQueue(items, cacheDir, keepQueued, localConfig, gpConfig, uploadConfig)
+	if err != nil {
+		return UploadQueueSummary{}, err
+	}
+
+	summary := UploadQueueSummary{
+		Count:     len(items),
+		TotalSize: sumItemSizes(items),
+	}
+	for i, item := range items {
+		date := itemDate(item)
+		if i == 0 || date.Before(summary.FirstDate) {
+			summary.FirstDate = date
+		}
+		if i == 0 || date.After(summary.LastDate) {
+			summary.LastDate = date
+		}
+	}
+
+	// Each media item needs an upload and a create request, and an album addition for each default album.
+	// Album additions for label and subject albums aren't known without reading the metadata, so they are ignored.
+	estimate := time.Duration(float64(2*len(items)) / apiRequestsPerSecond * float64(time.Second))
+	if defaultAlbums := gpConfig.GetDefaultAlbums(); len(defaultAlbums) > 0 && uploadConfig.AlbumAddsPerSecond > 0 {
+		estimate = max(estimate, time.Duration(float64(len(defaultAlbums)*len(items))/uploadConfig.AlbumAddsPerSecond*float64(time.Second)))
+	}
+	if uploadConfig.UploadMbps > 0 {
+		summary.BandwidthKnown = true
+		estimate = max(estimate, time.Duration(float64(summary.TotalSize)*8/(uploadConfig.UploadMbps*1e6)*float64(time.Second)))
+	}
+	summary.EstimatedDuration = estimate.Round(time.Second)
+	return summary, nil
+}
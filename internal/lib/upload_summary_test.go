@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeUploadQueue(t *testing.T) {
+	t.Run("CountsSizeDatesAndEstimate", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "Camflow: Videos")
+		createDirStructure(t, cfg.VideosUploadQueueRoot, map[string]string{
+			"2024-05-17-VID_0002.MP4": "0123456789",
+			"2024-05-03-VID_0001.MP4": "01234",
+			"2024-05-09-VID_0003.MP4": "",
+		})
+		cfg.Upload.UploadMbps = 1
+
+		summary, err := SummarizeVideosUploadQueue(cfg, t.TempDir(), false)
+		require.NoError(t, err)
+		assert.Equal(t, 3, summary.Count)
+		assert.Equal(t, int64(15), summary.TotalSize)
+		assert.Equal(t, time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC), summary.FirstDate)
+		assert.Equal(t, time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC), summary.LastDate)
+		assert.True(t, summary.BandwidthKnown)
+		// The tiny files upload instantly, so the estimate is limited by adding to the default album
+		// at the default 2 per second.
+		assert.Equal(t, 2*time.Second, summary.EstimatedDuration)
+	})
+
+	t.Run("LeavesOutWhatUploadWouldnt", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "Camflow: Videos")
+		createDirStructure(t, cfg.VideosUploadQueueRoot, map[string]string{
+			"2024-05-03-VID_0001.MP4": "01234",
+			"2024-05-04-VID_0002.MP4": "oversized",
+			"2024-05-05-VID_0003.MP4": "pending",
+		})
+		require.NoError(t, os.Truncate(filepath.Join(cfg.VideosUploadQueueRoot, "2024-05-04-VID_0002.MP4"), maxUploadSizes[ItemTypeVideo]+1))
+		cfg.Upload.DeferCommit = true
+		cacheDir := t.TempDir()
+		pendingPath := filepath.Join(cfg.VideosUploadQueueRoot, "2024-05-05-VID_0003.MP4")
+		info, err := os.Stat(pendingPath)
+		require.NoError(t, err)
+		pending, err := loadPendingCommits(getPendingCommitsPath(cacheDir))
+		require.NoError(t, err)
+		require.NoError(t, pending.add(cfg.VideosUploadQueueRoot, itemFileInfo{path: pendingPath, size: info.Size(), modTime: info.ModTime()}, "media-1", nil))
+
+		summary, err := SummarizeVideosUploadQueue(cfg, cacheDir, false)
+		require.NoError(t, err)
+		assert.Equal(t, 1, summary.Count, "The oversized file and the file waiting for commit-uploads shouldn't be counted")
+		assert.Equal(t, int64(5), summary.TotalSize)
+
+		// Files aren't left to wait for commit-uploads when they are kept queued.
+		summary, err = SummarizeVideosUploadQueue(cfg, cacheDir, true)
+		require.NoError(t, err)
+		assert.Equal(t, 2, summary.Count)
+	})
+
+	t.Run("MissingQueue", func(t *testing.T) {
+		cfg := newTestConfig(t, "", "")
+		cfg.PhotosUploadQueueDir = cfg.PhotosUploadQueueDir + "-missing"
+		cfg.LocalPhotos.UploadQueueDir = cfg.PhotosUploadQueueDir
+
+		summary, err := SummarizePhotosUploadQueue(cfg, t.TempDir(), false)
+		require.NoError(t, err)
+		assert.Equal(t, UploadQueueSummary{}, summary)
+	})
+}
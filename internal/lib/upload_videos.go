@@ -8,12 +8,13 @@ import (
 )
 
 // UploadVideos uploads videos from the video upload queue to Google Photos.
-// Videos are added to Google Photos album named DefaultAlbum.
+// Videos are added to the Google Photos albums named by DefaultAlbums.
 // Uploaded videos are moved from upload queue to uploaded dir; unless keepQueued is true, in which case they are copied (but not moved).
 // The function is idempotent - if interrupted, it can be recalled to resume.
-func UploadVideos(ctx context.Context, cfg config.CamflowConfig, cacheDirFlag string, keepQueued bool, gphotosClient GPhotosClient, dryRun bool) error {
+// It returns a report of the uploaded videos, including any uploaded before an error.
+func UploadVideos(ctx context.Context, cfg config.CamflowConfig, cacheDirFlag string, keepQueued bool, gphotosClient GPhotosClient, dryRun bool) (UploadReport, error) {
 	if err := cfg.Validate(); err != nil {
-		return fmt.Errorf("invalid config: %w", err)
+		return UploadReport{}, fmt.Errorf("invalid config: %w", err)
 	}
-	return uploadMediaItems(ctx, cacheDirFlag, keepQueued, &cfg.LocalVideos, &cfg.GooglePhotos.Videos, "videos", gphotosClient, dryRun)
+	return uploadMediaItems(ctx, newUploadSession(), cacheDirFlag, keepQueued, &cfg.LocalVideos, &cfg.GooglePhotos.Videos, cfg.Upload, "videos", gphotosClient, dryRun)
 }
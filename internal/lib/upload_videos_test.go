@@ -1,19 +1,26 @@
 package lib
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync" // For wg in context cancellation test
 	"testing"
 	"time"
 
+	"github.com/ccfrost/camflow/internal/config"
 	"github.com/golang/mock/gomock"
 	"github.com/gphotosuploader/google-photos-api-client-go/v3/albums"      // For types like albums.Album
 	"github.com/gphotosuploader/google-photos-api-client-go/v3/media_items" // For types like media_items.SimpleMediaItem
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
 )
 
 // --- Test Helper Functions ---
@@ -66,7 +73,7 @@ func TestUploadVideos_TargetRootDirNotConfigured(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockGPhotosClient := NewMockGPhotosClient(ctrl) // Changed from localMocks.NewMockGPhotosClient
 
-	err := UploadVideos(context.Background(), cfg, t.TempDir(), false, mockGPhotosClient, false)
+	_, err := UploadVideos(context.Background(), cfg, t.TempDir(), false, mockGPhotosClient, false)
 	require.Error(t, err, "Expected an error when uploadQueue dir is not configured, got nil")
 	assert.Contains(t, err.Error(), "missing videos field", "Expected error message about uploadQueue dir not configured, got: %v", err)
 }
@@ -77,7 +84,7 @@ func TestUploadVideos_TargetRootDirDoesNotExist(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockGPhotosClient := NewMockGPhotosClient(ctrl) // Changed from localMocks.NewMockGPhotosClient
 
-	err := UploadVideos(context.Background(), cfg, t.TempDir(), false, mockGPhotosClient, false)
+	_, err := UploadVideos(context.Background(), cfg, t.TempDir(), false, mockGPhotosClient, false)
 	assert.NoError(t, err, "Expected no error when uploadQueue dir does not exist, got: %v", err)
 }
 
@@ -86,7 +93,7 @@ func TestUploadVideos_EmptyTargetRootDir(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockGPhotosClient := NewMockGPhotosClient(ctrl) // Changed from localMocks.NewMockGPhotosClient
 
-	err := UploadVideos(context.Background(), cfg, t.TempDir(), false, mockGPhotosClient, false)
+	_, err := UploadVideos(context.Background(), cfg, t.TempDir(), false, mockGPhotosClient, false)
 	assert.NoError(t, err, "Expected no error for empty uploadQueue dir, got: %v", err)
 }
 
@@ -121,7 +128,7 @@ func TestUploadVideos_FilesToUpload_NoAlbums_MoveFiles(t *testing.T) {
 			Return(&media_items.MediaItem{ID: mediaItemID, Filename: baseName}, nil)
 	}
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
 	require.NoError(t, err, "UploadVideos failed: %v", err)
 
 	// Verify files are moved from uploadQueue and exist in VideosUploadedRoot
@@ -144,6 +151,136 @@ func TestUploadVideos_FilesToUpload_NoAlbums_MoveFiles(t *testing.T) {
 	assert.Empty(t, remainingFiles, "Expected uploadQueue directory to be empty after moves, but found %d files", len(remainingFiles))
 }
 
+func TestUploadVideos_KeepQueueStructure(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := newTestConfig(t, "", "") // No default albums
+	cfg.Upload.KeepQueueStructure = true
+	// Files in the queue's subdirs don't need a date prefix, since it isn't used for their destination.
+	queueFiles := map[string]string{
+		"2024-01-28-video1.mp4":                  "content1",
+		"Trips/Japan/2024-05-03-video2.mov":      "content2",
+		"Trips/Japan/Kyoto/temple-walk.mp4":      "content3",
+		"Family/Birthdays/2023-11-02-video3.mp4": "content4",
+	}
+	createDirStructure(t, cfg.VideosUploadQueueRoot, queueFiles)
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	for relPath := range queueFiles {
+		baseName := filepath.Base(relPath)
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, relPath)).
+			Return("token_for_"+baseName, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + baseName, Filename: baseName}).
+			Return(&media_items.MediaItem{ID: "id_for_" + baseName, Filename: baseName}, nil)
+	}
+
+	_, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	require.NoError(t, err)
+
+	for relPath, content := range queueFiles {
+		_, statErr := os.Stat(filepath.Join(cfg.VideosUploadQueueRoot, relPath))
+		assert.True(t, os.IsNotExist(statErr), "Expected %s to be moved out of the upload queue", relPath)
+
+		data, err := os.ReadFile(filepath.Join(cfg.VideosUploadedRoot, relPath))
+		if assert.NoError(t, err, "Expected %s at the same path under the uploaded dir", relPath) {
+			assert.Equal(t, content, string(data))
+		}
+	}
+	assertDirNotExists(t, filepath.Join(cfg.VideosUploadedRoot, "2024"), "Expected no date dirs under the uploaded dir")
+}
+
+func TestUploadVideos_NewOnly(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := newTestConfig(t, "", "") // No default albums
+	cfg.Upload.NewOnly = true
+	createDirStructure(t, cfg.VideosUploadedRoot, map[string]string{
+		"2024/04/30/2024-04-30-old.mp4":     "uploaded1",
+		"2024/05/01/2024-05-01-morning.mp4": "uploaded2",
+	})
+	// An empty day dir, eg after its files were deleted, isn't the last uploaded date.
+	require.NoError(t, os.MkdirAll(filepath.Join(cfg.VideosUploadedRoot, "2024", "05", "02"), 0755))
+	createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{
+		"2024-04-29-missed.mp4":    "content1",
+		"2024-05-01-afternoon.mp4": "content2",
+		"2024-05-03-new.mp4":       "content3",
+		"undated.mp4":              "content4",
+	})
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	for _, videoFile := range []string{"2024-05-01-afternoon.mp4", "2024-05-03-new.mp4"} {
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, videoFile)).
+			Return("token_for_"+videoFile, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + videoFile, Filename: videoFile}).
+			Return(&media_items.MediaItem{ID: "id_for_" + videoFile, Filename: videoFile}, nil)
+	}
+
+	report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	require.NoError(t, err)
+	assert.Len(t, report.UploadedItems, 2)
+
+	assert.FileExists(t, filepath.Join(cfg.VideosUploadedRoot, "2024", "05", "01", "2024-05-01-afternoon.mp4"))
+	assert.FileExists(t, filepath.Join(cfg.VideosUploadedRoot, "2024", "05", "03", "2024-05-03-new.mp4"))
+	assert.FileExists(t, filepath.Join(cfg.VideosUploadQueueRoot, "2024-04-29-missed.mp4"), "Files before the last uploaded date should stay in the queue")
+	assert.FileExists(t, filepath.Join(cfg.VideosUploadQueueRoot, "undated.mp4"), "Undated files should stay in the queue")
+}
+
+func TestUploadVideos_IncludeExtensions(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := newTestConfig(t, "", "") // No default albums
+	cfg.Upload.IncludeExtensions = []string{"mp4", ".MOV"}
+	createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{
+		"2024-05-01-clip1.MP4": "content1",
+		"2024-05-01-clip2.mov": "content2",
+		"2024-05-01-clip3.MTS": "content3",
+	})
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	for _, videoFile := range []string{"2024-05-01-clip1.MP4", "2024-05-01-clip2.mov"} {
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, videoFile)).
+			Return("token_for_"+videoFile, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + videoFile, Filename: videoFile}).
+			Return(&media_items.MediaItem{ID: "id_for_" + videoFile, Filename: videoFile}, nil)
+	}
+
+	report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	require.NoError(t, err)
+	assert.Len(t, report.UploadedItems, 2)
+	assert.FileExists(t, filepath.Join(cfg.VideosUploadQueueRoot, "2024-05-01-clip3.MTS"), "Files with other extensions should stay in the queue")
+}
+
+func TestLastUploadedDate(t *testing.T) {
+	uploadedRoot := filepath.Join(t.TempDir(), "uploaded")
+	date, err := lastUploadedDate(uploadedRoot)
+	require.NoError(t, err)
+	assert.Empty(t, date, "A missing uploaded dir has no last uploaded date")
+
+	createDirStructure(t, uploadedRoot, map[string]string{
+		"2023/12/31/2023-12-31-a.mp4": "a",
+		"Trips/2025-01-01-b.mp4":      "b", // Not a date dir.
+	})
+	require.NoError(t, os.MkdirAll(filepath.Join(uploadedRoot, "2024", "01", "02"), 0755)) // Empty, so skipped.
+	date, err = lastUploadedDate(uploadedRoot)
+	require.NoError(t, err)
+	assert.Equal(t, "2023-12-31", date)
+}
+
 func TestUploadVideos_FilesToUpload_NoAlbums_KeepFiles(t *testing.T) {
 	ctx := context.Background()
 
@@ -167,7 +304,7 @@ func TestUploadVideos_FilesToUpload_NoAlbums_KeepFiles(t *testing.T) {
 	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: uploadToken, Filename: videoFile}).
 		Return(&media_items.MediaItem{ID: mediaItemID, Filename: videoFile}, nil)
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, true /* keepQueued */, mockGPhotosClient, false)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, true /* keepQueued */, mockGPhotosClient, false)
 	require.NoError(t, err, "UploadVideos failed: %v", err)
 
 	_, statErr := os.Stat(filepath.Join(cfg.VideosUploadQueueRoot, videoFile))
@@ -220,8 +357,9 @@ func TestUploadVideos_FilesToUpload_WithAlbums_CreatesAndAddsToAlbum(t *testing.
 	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), createdAlbumID, []string{mediaItemID}).
 		Return(nil) // Successful addition
 
-	err = UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
+	report, err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
 	require.NoError(t, err, "UploadVideos failed: %v", err)
+	assert.Equal(t, []UploadedItem{{Path: videoFilePath, AlbumTitles: []string{albumTitle}}}, report.UploadedItems)
 
 	// Verify file is moved from uploadQueue
 	_, statErr := os.Stat(videoFilePath)
@@ -235,6 +373,208 @@ func TestUploadVideos_FilesToUpload_WithAlbums_CreatesAndAddsToAlbum(t *testing.
 	assert.NoError(t, statErr, "Expected video file %s to be moved to %s, but it does not exist. Error: %v", videoFileName, expectedDestPath, statErr)
 }
 
+func TestUploadVideos_FilesToUpload_WithMultipleDefaultAlbums(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := newTestConfig(t, "", "Camflow: Videos")
+	cfg.GooglePhotos.Videos.DefaultAlbums = []string{"Family", "Camflow: Videos"}
+
+	videoFileName := "2024-01-28-video1.mp4"
+	videoFilePath := filepath.Join(cfg.VideosUploadQueueRoot, videoFileName)
+	require.NoError(t, os.WriteFile(videoFilePath, []byte("content"), 0644))
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{
+		{ID: "videos-album-id", Title: "Camflow: Videos"},
+		{ID: "family-album-id", Title: "Family"},
+	}, nil)
+
+	uploadToken := "token_for_" + videoFileName
+	mediaItemID := "media_id_for_" + videoFileName
+	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), videoFilePath).Return(uploadToken, nil)
+	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: uploadToken, Filename: videoFileName}).
+		Return(&media_items.MediaItem{ID: mediaItemID, Filename: videoFileName}, nil)
+	// The item should be added to each default album once, although default_album repeats one of default_albums.
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "videos-album-id", []string{mediaItemID}).Return(nil)
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "family-album-id", []string{mediaItemID}).Return(nil)
+
+	report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	require.Len(t, report.UploadedItems, 1)
+	assert.ElementsMatch(t, []string{"Camflow: Videos", "Family"}, report.UploadedItems[0].AlbumTitles)
+}
+
+func TestUploadVideos_CameraModelAlbums(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := newTestConfig(t, "", "Camflow: Videos")
+	// The R5 album is also a default album, so the R5 file should be added to it only once.
+	cfg.GooglePhotos.Videos.DefaultAlbums = []string{"Canon EOS R5"}
+	cfg.GooglePhotos.Videos.CameraModelAlbums = true
+
+	r5Path := filepath.Join(cfg.VideosUploadQueueRoot, "2024-01-28-clip1.mp4")
+	sonyPath := filepath.Join(cfg.VideosUploadQueueRoot, "2024-01-28-clip2.mp4")
+	require.NoError(t, os.WriteFile(r5Path, []byte("content"), 0644))
+	require.NoError(t, os.WriteFile(sonyPath, []byte("content"), 0644))
+
+	// Put an exiftool on the PATH that reports the camera model of each file.
+	exifOutput, err := json.Marshal([]map[string]string{
+		{"SourceFile": r5Path, "Model": "Canon EOS R5"},
+		{"SourceFile": sonyPath, "Model": "ILCE-7M4"},
+	})
+	require.NoError(t, err)
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "exiftool"), []byte("#!/bin/sh\ncat <<'EOF'\n"+string(exifOutput)+"\nEOF\n"), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{
+		{ID: "videos-album-id", Title: "Camflow: Videos"},
+		{ID: "r5-album-id", Title: "Canon EOS R5"},
+	}, nil)
+	mockAlbumsSvc.EXPECT().Create(gomock.Any(), "ILCE-7M4").Return(&albums.Album{ID: "sony-album-id", Title: "ILCE-7M4"}, nil)
+
+	for _, path := range []string{r5Path, sonyPath} {
+		name := filepath.Base(path)
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), path).Return("token_for_"+name, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + name, Filename: name}).
+			Return(&media_items.MediaItem{ID: "media_id_for_" + name, Filename: name}, nil)
+		mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "videos-album-id", []string{"media_id_for_" + name}).Return(nil)
+		mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "r5-album-id", []string{"media_id_for_" + name}).Return(nil)
+	}
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "sony-album-id", []string{"media_id_for_2024-01-28-clip2.mp4"}).Return(nil)
+
+	report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	require.Len(t, report.UploadedItems, 2)
+	albumTitles := make(map[string][]string)
+	for _, item := range report.UploadedItems {
+		albumTitles[item.Path] = item.AlbumTitles
+	}
+	assert.ElementsMatch(t, []string{"Canon EOS R5", "Camflow: Videos"}, albumTitles[r5Path])
+	assert.ElementsMatch(t, []string{"ILCE-7M4", "Canon EOS R5", "Camflow: Videos"}, albumTitles[sonyPath])
+}
+
+func TestUploadVideos_UploadedDate(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		uploadedDate string
+		wantDirs     map[string]string
+	}{
+		{"Name", config.UploadedDateName, map[string]string{
+			"2024-01-28-clip1.mp4": "2024/01/28",
+			"2024-01-28-clip2.mp4": "2024/01/28",
+		}},
+		{"Exif", config.UploadedDateExif, map[string]string{
+			"2024-01-28-clip1.mp4": "2023/12/31",
+			"2024-01-28-clip2.mp4": "2024/01/28", // Without an EXIF date, the name's date is used.
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := newTestConfig(t, "", "")
+			cfg.Upload.UploadedDate = tt.uploadedDate
+			createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{
+				"2024-01-28-clip1.mp4": "content1",
+				"2024-01-28-clip2.mp4": "content2",
+			})
+
+			// Put an exiftool on the PATH that reports a capture date that disagrees with the name of clip1.
+			exifOutput, err := json.Marshal([]map[string]string{
+				{"SourceFile": filepath.Join(cfg.VideosUploadQueueRoot, "2024-01-28-clip1.mp4"), "DateTimeOriginal": "2023:12:31 23:30:00"},
+				{"SourceFile": filepath.Join(cfg.VideosUploadQueueRoot, "2024-01-28-clip2.mp4")},
+			})
+			require.NoError(t, err)
+			binDir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(binDir, "exiftool"), []byte("#!/bin/sh\ncat <<'EOF'\n"+string(exifOutput)+"\nEOF\n"), 0755))
+			t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+			ctrl := gomock.NewController(t)
+			mockGPhotosClient := NewMockGPhotosClient(ctrl)
+			mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+			mockUploaderSvc := NewMockMediaUploader(ctrl)
+			mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+			mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+			mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+			mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+			mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{}, nil).AnyTimes()
+			for name := range tt.wantDirs {
+				mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, name)).Return("token_for_"+name, nil)
+				mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + name, Filename: name}).
+					Return(&media_items.MediaItem{ID: "media_id_for_" + name, Filename: name}, nil)
+			}
+
+			_, err = UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+			require.NoError(t, err)
+			for name, dir := range tt.wantDirs {
+				assert.FileExists(t, filepath.Join(cfg.VideosUploadedRoot, filepath.FromSlash(dir), name))
+			}
+		})
+	}
+}
+
+func TestUploadVideos_FlattenAlbumsFromPath(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "") // No default albums
+	cfg.Upload.FlattenAlbumsFromPath = 2
+	cfg.Upload.KeepQueueStructure = true
+
+	nestedPath := filepath.Join(cfg.VideosUploadQueueRoot, "trip", "day1", "morning", "2024-01-28-clip1.mp4")
+	rootPath := filepath.Join(cfg.VideosUploadQueueRoot, "2024-01-28-clip2.mp4")
+	require.NoError(t, os.MkdirAll(filepath.Dir(nestedPath), 0755))
+	require.NoError(t, os.WriteFile(nestedPath, []byte("content"), 0644))
+	require.NoError(t, os.WriteFile(rootPath, []byte("content"), 0644))
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{}, nil)
+	mockAlbumsSvc.EXPECT().Create(gomock.Any(), "trip / day1").Return(&albums.Album{ID: "trip-album-id", Title: "trip / day1"}, nil)
+	for _, path := range []string{nestedPath, rootPath} {
+		name := filepath.Base(path)
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), path).Return("token_for_"+name, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + name, Filename: name}).
+			Return(&media_items.MediaItem{ID: "media_id_for_" + name, Filename: name}, nil)
+	}
+	// The video directly in the upload queue isn't added to an album.
+	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), "trip-album-id", []string{"media_id_for_2024-01-28-clip1.mp4"}).Return(nil)
+
+	report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	albumTitles := make(map[string][]string)
+	for _, item := range report.UploadedItems {
+		albumTitles[item.Path] = item.AlbumTitles
+	}
+	assert.Equal(t, []string{"trip / day1"}, albumTitles[nestedPath])
+	assert.Empty(t, albumTitles[rootPath])
+}
+
 func TestUploadVideos_ErrorLoadAlbumCache(t *testing.T) {
 	ctx := context.Background()
 
@@ -254,7 +594,7 @@ func TestUploadVideos_ErrorLoadAlbumCache(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockGPhotosClient := NewMockGPhotosClient(ctrl) // Changed from localMocks.NewMockGPhotosClient
 
-	uploadErr := UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
+	_, uploadErr := UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
 	require.Error(t, uploadErr, "UploadVideos expected to fail due to malformed album cache, but succeeded")
 	assert.Contains(t, uploadErr.Error(), "failed to load album cache", "Expected error about loading album cache, got: %v", uploadErr)
 }
@@ -276,7 +616,7 @@ func TestUploadVideos_ErrorGetOrCreateAlbumIDs(t *testing.T) {
 	// List returns a slice directly, not an iterator.
 	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return(nil, errors.New(expectedErrStr))
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
 	require.Error(t, err, "UploadVideos expected to fail due to error in getOrFetchAndCreateAlbumIDs, but succeeded")
 	assert.Contains(t, err.Error(), expectedErrStr, "Expected error '%s', got: %v", expectedErrStr, err)
 }
@@ -298,7 +638,7 @@ func TestUploadVideos_ErrorUploadFile(t *testing.T) {
 	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, videoFileName)).
 		Return("", errors.New(expectedErrStr))
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
 	require.Error(t, err, "UploadVideos expected to fail due to UploadFile error, but succeeded")
 	assert.Contains(t, err.Error(), "failed to upload file", "Error message mismatch")
 	assert.Contains(t, err.Error(), videoFileName, "Error message should contain filename")
@@ -331,7 +671,7 @@ func TestUploadVideos_ErrorCreateMediaItem(t *testing.T) {
 	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: uploadToken, Filename: videoFileName}).
 		Return(nil, errors.New(expectedErrStr))
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
 	// UploadVideos should now return an error when CreateMediaItem fails.
 	require.Error(t, err, "Expected UploadVideos to fail due to CreateMediaItem error, but it succeeded")
 	assert.Contains(t, err.Error(), expectedErrStr, "Error message should include the CreateMediaItem failure")
@@ -381,7 +721,7 @@ func TestUploadVideos_ErrorAddMediaToAlbum_FileKept_WhenAlbumExists(t *testing.T
 	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), existingAlbumID, []string{mediaItemID}).
 		Return(errors.New(expectedAddError))
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
 	require.Error(t, err, "UploadVideos should have returned an error")
 	assert.Contains(t, err.Error(), expectedAddError, "Error message should contain the original error")
 
@@ -390,6 +730,500 @@ func TestUploadVideos_ErrorAddMediaToAlbum_FileKept_WhenAlbumExists(t *testing.T
 	assert.NoError(t, statErr, "Expected video file %s to be kept after AddMediaItems failure, but it was deleted (os.IsNotExist was true for stat error: %v)", videoFilePath, statErr)
 }
 
+func TestUploadVideos_AlbumAddFailurePolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy    string
+		wantMoved bool
+	}{
+		{policy: config.AlbumAddFailureSkipAlbum, wantMoved: true},
+		{policy: config.AlbumAddFailureKeepInQueue, wantMoved: false},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			ctx := context.Background()
+			albumTitle := "ExistingAlbum"
+			cfg := newTestConfig(t, "", albumTitle)
+			cfg.Upload.AlbumAddFailure = tt.policy
+
+			// The first video fails to be added to the album, and the second succeeds.
+			failingFileName := "2024-01-28-video1.mp4"
+			okFileName := "2024-01-29-video2.mp4"
+			failingFilePath := filepath.Join(cfg.VideosUploadQueueRoot, failingFileName)
+			okFilePath := filepath.Join(cfg.VideosUploadQueueRoot, okFileName)
+			require.NoError(t, os.WriteFile(failingFilePath, []byte("content1"), 0644))
+			require.NoError(t, os.WriteFile(okFilePath, []byte("content2"), 0644))
+
+			ctrl := gomock.NewController(t)
+			mockGPhotosClient := NewMockGPhotosClient(ctrl)
+			mockUploaderSvc := NewMockMediaUploader(ctrl)
+			mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+			mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+			mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+			mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+			mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+
+			albumID := "album-id-existing"
+			mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{{ID: albumID, Title: albumTitle}}, nil)
+			for _, fileName := range []string{failingFileName, okFileName} {
+				mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, fileName)).
+					Return("token_for_"+fileName, nil)
+				mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + fileName, Filename: fileName}).
+					Return(&media_items.MediaItem{ID: "media_id_for_" + fileName, Filename: fileName}, nil)
+			}
+			mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), albumID, []string{"media_id_for_" + failingFileName}).
+				Return(errors.New("simulated add to album failure"))
+			mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), albumID, []string{"media_id_for_" + okFileName}).
+				Return(nil)
+
+			report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+			require.NoError(t, err, "An album add failure shouldn't stop the upload with policy %s", tt.policy)
+			assert.Equal(t, []UploadedItem{
+				{Path: failingFilePath, FailedAlbumTitles: []string{albumTitle}},
+				{Path: okFilePath, AlbumTitles: []string{albumTitle}},
+			}, report.UploadedItems)
+
+			_, statErr := os.Stat(failingFilePath)
+			if tt.wantMoved {
+				assert.True(t, os.IsNotExist(statErr), "Expected %s to be moved to the uploaded dir", failingFileName)
+			} else {
+				assert.NoError(t, statErr, "Expected %s to be kept in the upload queue", failingFileName)
+			}
+			_, statErr = os.Stat(okFilePath)
+			assert.True(t, os.IsNotExist(statErr), "Expected %s to be moved to the uploaded dir", okFileName)
+		})
+	}
+}
+
+func TestUploadVideos_Safe(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// failAt is the step that fails: "upload", "create", "album", "verify", or "" for none.
+		failAt    string
+		wantErr   string
+		wantMoved bool
+	}{
+		{name: "Success", wantMoved: true},
+		{name: "UploadFails", failAt: "upload", wantErr: "failed to upload file"},
+		{name: "CreateFails", failAt: "create", wantErr: "failed to create media item"},
+		{name: "AlbumAddFails", failAt: "album"},
+		{name: "VerifyFails", failAt: "verify", wantErr: "failed to verify media item"},
+		{name: "VerifyFindsOtherItem", failAt: "verify-other", wantErr: "was not found"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			albumTitle := "ExistingAlbum"
+			cfg := newTestConfig(t, "", albumTitle)
+			cfg.Upload.Safe = true
+			// Safe keeps files whose album adds failed in the queue, even with this policy.
+			cfg.Upload.AlbumAddFailure = config.AlbumAddFailureSkipAlbum
+
+			fileName := "2024-01-28-video1.mp4"
+			filePath := filepath.Join(cfg.VideosUploadQueueRoot, fileName)
+			require.NoError(t, os.WriteFile(filePath, []byte("content"), 0644))
+
+			ctrl := gomock.NewController(t)
+			mockGPhotosClient := NewMockGPhotosClient(ctrl)
+			mockUploaderSvc := NewMockMediaUploader(ctrl)
+			mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+			mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+			mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+			mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+			mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+
+			albumID := "album-id-existing"
+			mediaItemID := "media_id_for_" + fileName
+			mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{{ID: albumID, Title: albumTitle}}, nil)
+			simulatedErr := errors.New("simulated failure")
+			if tt.failAt == "upload" {
+				mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filePath).Return("", simulatedErr)
+			} else {
+				mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filePath).Return("token", nil)
+			}
+			switch tt.failAt {
+			case "upload":
+			case "create":
+				mockMediaItemsSvc.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil, simulatedErr)
+			default:
+				mockMediaItemsSvc.EXPECT().Create(gomock.Any(), gomock.Any()).
+					Return(&media_items.MediaItem{ID: mediaItemID, Filename: fileName}, nil)
+				var albumErr error
+				if tt.failAt == "album" {
+					albumErr = simulatedErr
+				}
+				mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), albumID, []string{mediaItemID}).Return(albumErr)
+				switch tt.failAt {
+				case "verify":
+					mockMediaItemsSvc.EXPECT().Get(gomock.Any(), mediaItemID).Return(nil, simulatedErr)
+				case "verify-other":
+					mockMediaItemsSvc.EXPECT().Get(gomock.Any(), mediaItemID).Return(&media_items.MediaItem{ID: "other"}, nil)
+				default:
+					mockMediaItemsSvc.EXPECT().Get(gomock.Any(), mediaItemID).Return(&media_items.MediaItem{ID: mediaItemID}, nil)
+				}
+			}
+
+			_, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			_, statErr := os.Stat(filePath)
+			if tt.wantMoved {
+				assert.True(t, os.IsNotExist(statErr), "Expected %s to be moved to the uploaded dir", fileName)
+			} else {
+				assert.NoError(t, statErr, "Expected %s to be kept in the upload queue", fileName)
+			}
+		})
+	}
+}
+
+func TestUploadVideos_ReplaceExisting(t *testing.T) {
+	ctx := context.Background()
+	albumTitle := "ExistingAlbum"
+	albumID := "album-id-existing"
+	cfg := newTestConfig(t, "", albumTitle)
+	cfg.Upload.ReplaceExisting = true
+
+	// Only files in the upload ledger have earlier media items, which camflow created.
+	cacheDir := t.TempDir()
+	ledger := newUploadLedger(getUploadLedgerPath(cacheDir))
+	uploadedAt := time.Date(2024, 1, 29, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, ledger.record(context.Background(), "2024-01-28-edited.mp4", 0, "old-edited", "", nil, uploadedAt))
+	require.NoError(t, ledger.record(context.Background(), "2024-01-28-unchanged.mp4", 0, "id-unchanged", "", nil, uploadedAt))
+	require.NoError(t, ledger.record(context.Background(), "2024-01-28-deleted.mp4", 0, "old-deleted", "", nil, uploadedAt))
+
+	newIDs := map[string]string{
+		"2024-01-28-edited.mp4":    "new-edited",
+		"2024-01-28-unchanged.mp4": "id-unchanged", // Google Photos creates the same media item for the same content.
+		"2024-01-28-deleted.mp4":   "new-deleted",
+		"2024-01-28-new.mp4":       "new-new",
+	}
+	for name := range newIDs {
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.VideosUploadQueueRoot, name), []byte(name), 0644))
+	}
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{{ID: albumID, Title: albumTitle}}, nil)
+
+	for name, id := range newIDs {
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, name)).Return("token_for_"+name, nil)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + name, Filename: name}).
+			Return(&media_items.MediaItem{ID: id, Filename: name}, nil)
+		mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), albumID, []string{id}).Return(nil)
+	}
+	// There is no Get for the new file, so no media item that camflow didn't record is looked up or removed.
+	mockMediaItemsSvc.EXPECT().Get(gomock.Any(), "old-edited").
+		Return(&media_items.MediaItem{ID: "old-edited", ProductURL: "https://photos.google.com/lr/photo/old-edited"}, nil)
+	mockMediaItemsSvc.EXPECT().Get(gomock.Any(), "id-unchanged").
+		Return(&media_items.MediaItem{ID: "id-unchanged", ProductURL: "https://photos.google.com/lr/photo/id-unchanged"}, nil)
+	mockMediaItemsSvc.EXPECT().Get(gomock.Any(), "old-deleted").
+		Return(nil, fmt.Errorf("getting media item old-deleted: %w", &googleapi.Error{Code: http.StatusNotFound}))
+	mockAlbumsSvc.EXPECT().RemoveMediaItems(gomock.Any(), albumID, []string{"old-edited"}).Return(nil)
+
+	report, err := UploadVideos(ctx, cfg, cacheDir, false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://photos.google.com/lr/photo/old-edited"}, report.ReplacedMediaItemURLs())
+}
+
+func TestUploadVideos_Tag(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "")
+	cfg.Upload.Tag = "TRIP-2024-05"
+	cfg.Upload.TagDescription = true
+	cacheDir := t.TempDir()
+	uploadQueueDir := createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{"2024-01-28-video.mp4": "content"})
+	filePath := filepath.Join(uploadQueueDir, "2024-01-28-video.mp4")
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filePath).Return("token", nil)
+	mockMediaItemsSvc.EXPECT().CreateWithDescription(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token", Filename: "2024-01-28-video.mp4"}, "TRIP-2024-05").
+		Return(&media_items.MediaItem{ID: "id-video", Description: "TRIP-2024-05"}, nil)
+
+	_, err := UploadVideos(ctx, cfg, cacheDir, false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+
+	var entries []uploadLedgerEntry
+	require.NoError(t, newUploadLedger(getUploadLedgerPath(cacheDir)).forEach(func(entry uploadLedgerEntry) {
+		entries = append(entries, entry)
+	}))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "id-video", entries[0].MediaItemID)
+	assert.Equal(t, "TRIP-2024-05", entries[0].Tag)
+	assert.Equal(t, filePath, entries[0].Path)
+	assert.Equal(t, int64(len("content")), entries[0].Size)
+}
+
+func TestUploadVideos_MoveFailedTo(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "")
+	cfg.Upload.MaxRetries = 0
+	cfg.Upload.MaxConsecutiveFailures = 5
+	cfg.Upload.MoveFailedTo = filepath.Join(t.TempDir(), "failed")
+	queue := cfg.VideosUploadQueueRoot
+	require.NoError(t, os.MkdirAll(filepath.Join(queue, "trip"), 0755))
+	createTestFiles(t, queue, map[string]string{
+		"trip/2024-01-28-bad.mp4": "bad",
+		"2024-01-29-good.mp4":     "good",
+	})
+	badPath := filepath.Join(queue, "trip", "2024-01-28-bad.mp4")
+	goodPath := filepath.Join(queue, "2024-01-29-good.mp4")
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), badPath).Return("", errors.New("upload rejected"))
+	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), goodPath).Return("token", nil)
+	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), gomock.Any()).Return(&media_items.MediaItem{ID: "id-good"}, nil)
+
+	report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "moved to "+cfg.Upload.MoveFailedTo)
+	movedPath := filepath.Join(cfg.Upload.MoveFailedTo, "trip", "2024-01-28-bad.mp4")
+	assert.Equal(t, []string{movedPath}, report.FailedPaths, "The report should have the paths the files were moved to")
+	assert.FileExists(t, movedPath)
+	assert.NoFileExists(t, badPath)
+	require.Len(t, report.UploadedItems, 1)
+	assert.Equal(t, goodPath, report.UploadedItems[0].Path)
+}
+
+func TestUploadVideos_CheckAPI(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "Videos")
+	cfg.GooglePhotos.Videos.DefaultAlbums = []string{"Trip"}
+	cfg.Upload.CheckAPI = true
+	cacheDir := t.TempDir()
+	videoPath := filepath.Join(cfg.VideosUploadQueueRoot, "2024-01-28-video.mp4")
+	createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{"2024-01-28-video.mp4": "content"})
+	// The cached ID is stale, eg because the album was deleted and made again.
+	cache, err := loadAlbumCache(getAlbumCachePath(cacheDir))
+	require.NoError(t, err)
+	cache.Albums["Videos"] = "id-stale"
+	require.NoError(t, cache.save())
+	cacheData, err := os.ReadFile(getAlbumCachePath(cacheDir))
+	require.NoError(t, err)
+
+	var logs bytes.Buffer
+	origLogger := logger
+	logger = slog.New(slog.NewTextHandler(&logs, nil))
+	defer func() { logger = origLogger }()
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+	mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+	// Only read-only calls are made, so there are no expectations for Uploader(), MediaItems(), or
+	// creating albums. The preflight check is made even though the test config skips it.
+	mockAlbumsSvc.EXPECT().ListPage(gomock.Any(), 1).Return(nil, nil)
+	mockAlbumsSvc.EXPECT().List(gomock.Any()).Return([]albums.Album{{ID: "id-videos", Title: "Videos"}}, nil)
+
+	report, err := UploadVideos(ctx, cfg, cacheDir, false /* keepQueued */, mockGPhotosClient, false)
+	require.NoError(t, err)
+	require.Len(t, report.UploadedItems, 1, "The video should be reported as would be uploaded")
+	assert.FileExists(t, videoPath)
+	assertDirNotExists(t, filepath.Join(cfg.VideosUploadedRoot, "2024"), "Nothing should be moved to the uploaded dir")
+	assert.Contains(t, logs.String(), "Cached album ID doesn't match the album found online")
+	assert.Contains(t, logs.String(), "cached_album_id=id-stale")
+	gotCacheData, err := os.ReadFile(getAlbumCachePath(cacheDir))
+	require.NoError(t, err)
+	assert.Equal(t, string(cacheData), string(gotCacheData), "The album cache shouldn't be changed")
+}
+
+func TestUploadVideos_EmptyUploadToken(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "") // No default albums
+	cfg.Upload.MaxRetries = 1
+	cfg.Upload.MaxConsecutiveFailures = 1
+
+	fileName := "2024-01-01-video1.mp4"
+	filePath := filepath.Join(cfg.VideosUploadQueueRoot, fileName)
+	createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{fileName: "content"})
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+
+	// The empty token is retried like any failed upload, and no media item is created from it.
+	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filePath).Return("", nil).Times(2)
+
+	report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errEmptyUploadToken)
+	assert.Contains(t, err.Error(), fileName)
+	assert.Empty(t, report.UploadedItems)
+	assert.Equal(t, []string{filePath}, report.FailedPaths)
+	assert.FileExists(t, filePath, "Expected the video to be kept in the upload queue")
+	assertDirNotExists(t, filepath.Join(cfg.VideosUploadedRoot, "2024"), "Expected nothing to be moved to the uploaded dir")
+}
+
+func TestUploadVideos_CircuitBreakerStopsOnSustainedFailures(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "") // No default albums
+	cfg.Upload.MaxRetries = 1
+	cfg.Upload.MaxConsecutiveFailures = 3
+
+	fileNames := []string{
+		"2024-01-01-video1.mp4",
+		"2024-01-02-video2.mp4",
+		"2024-01-03-video3.mp4",
+		"2024-01-04-video4.mp4",
+		"2024-01-05-video5.mp4",
+	}
+	for _, fileName := range fileNames {
+		createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{fileName: "content"})
+	}
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+
+	// Each of the first three videos is tried and retried once, and then the upload stops
+	// without trying the remaining videos.
+	for _, fileName := range fileNames[:3] {
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, fileName)).
+			Return("", errors.New("simulated outage")).Times(2)
+	}
+
+	report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "api appears to be failing")
+	assert.Contains(t, err.Error(), "simulated outage")
+	assert.Empty(t, report.UploadedItems)
+
+	for _, fileName := range fileNames {
+		_, statErr := os.Stat(filepath.Join(cfg.VideosUploadQueueRoot, fileName))
+		assert.NoError(t, statErr, "Expected %s to be kept in the upload queue", fileName)
+	}
+}
+
+func TestUploadVideos_CircuitBreakerResetsOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "") // No default albums
+	cfg.Upload.MaxRetries = 1
+	cfg.Upload.MaxConsecutiveFailures = 2
+
+	failingFileNames := []string{"2024-01-01-video1.mp4", "2024-01-03-video3.mp4"}
+	retriedFileName := "2024-01-02-video2.mp4"
+	okFileName := "2024-01-04-video4.mp4"
+	for _, fileName := range append([]string{retriedFileName, okFileName}, failingFileNames...) {
+		createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{fileName: "content"})
+	}
+
+	ctrl := gomock.NewController(t)
+	mockGPhotosClient := NewMockGPhotosClient(ctrl)
+	mockUploaderSvc := NewMockMediaUploader(ctrl)
+	mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+	mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+	mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+
+	for _, fileName := range failingFileNames {
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, fileName)).
+			Return("", errors.New("simulated failure")).Times(2)
+	}
+	// The retried video succeeds on its retry, which resets the count of failures in a row.
+	retriedFilePath := filepath.Join(cfg.VideosUploadQueueRoot, retriedFileName)
+	gomock.InOrder(
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), retriedFilePath).Return("", errors.New("simulated failure")),
+		mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), retriedFilePath).Return("token_for_"+retriedFileName, nil),
+	)
+	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), filepath.Join(cfg.VideosUploadQueueRoot, okFileName)).
+		Return("token_for_"+okFileName, nil)
+	for _, fileName := range []string{retriedFileName, okFileName} {
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token_for_" + fileName, Filename: fileName}).
+			Return(&media_items.MediaItem{ID: "media_id_for_" + fileName, Filename: fileName}, nil)
+	}
+
+	report, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+	require.Error(t, err, "The failed videos should be reported")
+	assert.Contains(t, err.Error(), "failed to upload 2 videos")
+	assert.NotContains(t, err.Error(), "appears to be failing")
+	assert.Len(t, report.UploadedItems, 2)
+	assert.Equal(t, []string{
+		filepath.Join(cfg.VideosUploadQueueRoot, failingFileNames[0]),
+		filepath.Join(cfg.VideosUploadQueueRoot, failingFileNames[1]),
+	}, report.FailedPaths)
+
+	for _, fileName := range failingFileNames {
+		_, statErr := os.Stat(filepath.Join(cfg.VideosUploadQueueRoot, fileName))
+		assert.NoError(t, statErr, "Expected %s to be kept in the upload queue", fileName)
+	}
+	for _, fileName := range []string{retriedFileName, okFileName} {
+		_, statErr := os.Stat(filepath.Join(cfg.VideosUploadQueueRoot, fileName))
+		assert.True(t, os.IsNotExist(statErr), "Expected %s to be moved to the uploaded dir", fileName)
+	}
+}
+
+func TestUploadVideos_Preflight(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t, "", "") // No default albums
+	cfg.Upload.SkipPreflight = false
+	videoFileName := "2024-01-28-video1.mp4"
+	videoPath := filepath.Join(cfg.VideosUploadQueueRoot, videoFileName)
+	createTestFiles(t, cfg.VideosUploadQueueRoot, map[string]string{videoFileName: "content"})
+
+	t.Run("FailureStopsBeforeUploading", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockGPhotosClient := NewMockGPhotosClient(ctrl)
+		mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+		mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+		// No expectations for Uploader() or MediaItems(), as nothing is uploaded.
+		mockAlbumsSvc.EXPECT().ListPage(gomock.Any(), 1).Return(nil, ErrInsufficientScope)
+
+		_, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrInsufficientScope)
+		assert.Contains(t, err.Error(), "preflight")
+		_, statErr := os.Stat(videoPath)
+		assert.NoError(t, statErr, "Expected %s to be kept in the upload queue", videoFileName)
+	})
+
+	t.Run("DryRunSkipsPreflight", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		// No expectations, as a dry run makes no API calls.
+		mockGPhotosClient := NewMockGPhotosClient(ctrl)
+
+		_, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, true /* dryRun */)
+		require.NoError(t, err)
+		_, statErr := os.Stat(videoPath)
+		assert.NoError(t, statErr, "Expected %s to be kept in the upload queue", videoFileName)
+	})
+
+	t.Run("SuccessUploads", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockGPhotosClient := NewMockGPhotosClient(ctrl)
+		mockAlbumsSvc := NewMockAppAlbumsService(ctrl)
+		mockUploaderSvc := NewMockMediaUploader(ctrl)
+		mockMediaItemsSvc := NewMockAppMediaItemsService(ctrl)
+		mockGPhotosClient.EXPECT().Albums().Return(mockAlbumsSvc).AnyTimes()
+		mockGPhotosClient.EXPECT().Uploader().Return(mockUploaderSvc).AnyTimes()
+		mockGPhotosClient.EXPECT().MediaItems().Return(mockMediaItemsSvc).AnyTimes()
+		gomock.InOrder(
+			mockAlbumsSvc.EXPECT().ListPage(gomock.Any(), 1).Return(nil, nil),
+			mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), videoPath).Return("token", nil),
+		)
+		mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: "token", Filename: videoFileName}).
+			Return(&media_items.MediaItem{ID: "media_id", Filename: videoFileName}, nil)
+
+		_, err := UploadVideos(ctx, cfg, t.TempDir(), false /* keepQueued */, mockGPhotosClient, false)
+		require.NoError(t, err)
+	})
+}
+
 func TestUploadVideos_ContextCancellationDuringLimiterWait(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -423,7 +1257,7 @@ func TestUploadVideos_ContextCancellationDuringLimiterWait(t *testing.T) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		errUpload = UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
+		_, errUpload = UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
 	}()
 
 	time.Sleep(20 * time.Millisecond) // Short delay to allow UploadVideos to start
@@ -482,7 +1316,7 @@ func TestUploadVideos_FilesToUpload_WithAlbums_AlbumExists(t *testing.T) {
 	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), existingAlbumID, []string{mediaItemID}).
 		Return(nil) // Successful addition
 
-	err = UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
+	_, err = UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
 	require.NoError(t, err, "UploadVideos failed: %v", err)
 
 	// Verify file is moved from uploadQueue
@@ -536,7 +1370,7 @@ func TestUploadVideos_FilesToUpload_NoAlbums_MoveFiles_WithCleanup(t *testing.T)
 			Return(&media_items.MediaItem{ID: mediaItemID, Filename: baseName}, nil)
 	}
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
 	require.NoError(t, err, "UploadVideos failed: %v", err)
 
 	// Verify files are moved from uploadQueue and exist in VideosUploadedRoot
@@ -596,7 +1430,7 @@ func TestUploadVideos_FilesToUpload_WithAlbums_CleanupOnSuccess(t *testing.T) {
 		Return(&media_items.MediaItem{ID: mediaItemID, Filename: videoFileName}, nil)
 	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), existingAlbumID, []string{mediaItemID}).Return(nil)
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
 	require.NoError(t, err, "UploadVideos failed: %v", err)
 
 	// Verify file is moved
@@ -637,7 +1471,7 @@ func TestUploadVideos_ErrorUploadFile_NoCleanup(t *testing.T) {
 	mockUploaderSvc.EXPECT().UploadFile(gomock.Any(), videoFilePath).
 		Return("", errors.New(expectedErrStr))
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false, mockGPhotosClient, false)
 	require.Error(t, err, "UploadVideos expected to fail due to UploadFile error, but succeeded")
 
 	// Verify file is still in uploadQueue (not moved)
@@ -691,7 +1525,7 @@ func TestUploadVideos_ErrorAddMediaToAlbum_NoCleanup(t *testing.T) {
 	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), existingAlbumID, []string{mediaItemID}).
 		Return(errors.New(expectedAddError))
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
 	require.Error(t, err, "UploadVideos should have returned an error")
 	assert.Contains(t, err.Error(), expectedAddError, "Error message should contain the original error")
 
@@ -727,7 +1561,7 @@ func TestUploadVideos_keepQueued_NoCleanup(t *testing.T) {
 	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: uploadToken, Filename: videoFileName}).
 		Return(&media_items.MediaItem{ID: mediaItemID, Filename: videoFileName}, nil)
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, true /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, true /* keepQueued */, mockGPhotosClient, false /* dryRun */)
 	require.NoError(t, err, "UploadVideos failed: %v", err)
 
 	// Verify file is kept in uploadQueue
@@ -776,7 +1610,7 @@ func TestUploadVideos_FilesToUpload_CleanupFailsButUploadSucceeds(t *testing.T)
 	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: uploadToken2, Filename: "2024-06-01-sibling.mp4"}).
 		Return(&media_items.MediaItem{ID: mediaItemID2, Filename: "2024-06-01-sibling.mp4"}, nil)
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
 	require.NoError(t, err, "UploadVideos should succeed even if cleanup partially fails")
 
 	// Verify both files are moved successfully
@@ -842,7 +1676,7 @@ func TestUploadVideos_MixedSuccessAndFailure_PartialCleanup(t *testing.T) {
 
 	// No mock for third video because it won't be processed due to early exit
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
 	require.Error(t, err, "UploadVideos should fail due to failed upload")
 
 	// Verify first video was successfully moved
@@ -893,7 +1727,7 @@ func TestUploadVideos_CrossFilesystem_NoAlbums_CopyAndDelete(t *testing.T) {
 	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: uploadToken, Filename: videoFileName}).
 		Return(&media_items.MediaItem{ID: mediaItemID, Filename: videoFileName}, nil)
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false)
 	require.NoError(t, err, "UploadVideos should work with cross-filesystem copy+delete")
 
 	// Verify file is moved from uploadQueue using copy+delete
@@ -958,7 +1792,7 @@ func TestUploadVideos_CrossFilesystem_WithAlbums_CopyAndDelete(t *testing.T) {
 		Return(&media_items.MediaItem{ID: mediaItemID, Filename: videoFileName}, nil)
 	mockAlbumsSvc.EXPECT().AddMediaItems(gomock.Any(), existingAlbumID, []string{mediaItemID}).Return(nil)
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, false /* keepQueued */, mockGPhotosClient, false /* dryRun */)
 	require.NoError(t, err, "UploadVideos with albums should work with cross-filesystem copy+delete")
 
 	// Verify file is moved using copy+delete
@@ -1012,7 +1846,7 @@ func TestUploadVideos_CrossFilesystem_KeepFiles_CopyOnly(t *testing.T) {
 	mockMediaItemsSvc.EXPECT().Create(gomock.Any(), media_items.SimpleMediaItem{UploadToken: uploadToken, Filename: videoFileName}).
 		Return(&media_items.MediaItem{ID: mediaItemID, Filename: videoFileName}, nil)
 
-	err := UploadVideos(ctx, cfg, tempConfigDir, true /* keepQueued */, mockGPhotosClient, false /* dryRun */)
+	_, err := UploadVideos(ctx, cfg, tempConfigDir, true /* keepQueued */, mockGPhotosClient, false /* dryRun */)
 	require.NoError(t, err, "UploadVideos with keepQueued should work with cross-filesystem behavior")
 
 	// With keepQueued=true, file should remain in uploadQueue and NOT be moved/copied
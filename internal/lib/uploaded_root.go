@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mountParentDirs are the dirs that external drives are mounted under.
+// It is a variable so that tests can simulate a drive that isn't mounted.
+var mountParentDirs = []string{"/Volumes", "/media", "/mnt", "/run/media"}
+
+// checkUploadedRoot returns an error if files can't be moved into uploadedRoot.
+// In particular, it refuses an uploadedRoot that is on a drive that isn't mounted, which moving files
+// into would create on the filesystem of the mount point, eg filling the system disk.
+// It also refuses an uploadedRoot directly under one of mountParentDirs that is on the same filesystem as
+// it, which is the mount point of a drive that isn't mounted, eg left behind when the drive was removed.
+// Unless dryRun, it also checks that uploadedRoot is writable.
+func checkUploadedRoot(uploadedRoot string, dryRun bool) error {
+	info, err := os.Stat(uploadedRoot)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to check uploaded dir %s: %w", uploadedRoot, err)
+		}
+		return checkMissingDirMounted(uploadedRoot, "uploaded dir")
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("uploaded dir %s is not a directory", uploadedRoot)
+	}
+	if err := checkMountPointMounted(uploadedRoot, "uploaded dir"); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	f, err := os.CreateTemp(uploadedRoot, ".camflow-write-check-*")
+	if err != nil {
+		return fmt.Errorf("uploaded dir %s is not writable: %w", uploadedRoot, err)
+	}
+	f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("failed to remove write check file %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// checkUploadQueueMounted returns an error if uploadQueueRoot, which doesn't exist, is on a drive that isn't
+// mounted, eg a card or external drive that was removed, so that it isn't mistaken for an empty upload queue.
+func checkUploadQueueMounted(uploadQueueRoot string) error {
+	return checkMissingDirMounted(uploadQueueRoot, "upload queue dir")
+}
+
+// checkMissingDirMounted returns an error if dir, which doesn't exist, is under one of mountParentDirs,
+// but the nearest dir of it that exists is on the same filesystem as that mount parent dir,
+// ie no drive is mounted on the way to it. desc describes dir in the error, eg "uploaded dir".
+func checkMissingDirMounted(dir, desc string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for %s: %w", dir, err)
+	}
+	for _, mountParentDir := range mountParentDirs {
+		if !strings.HasPrefix(absDir, mountParentDir+string(filepath.Separator)) {
+			continue
+		}
+		existingParent, err := findExistingParent(absDir)
+		if err != nil {
+			return err
+		}
+		sameFilesystem, err := isSameFilesystem(existingParent, mountParentDir)
+		if err != nil {
+			return fmt.Errorf("failed to check whether the drive of %s %s is mounted: %w", desc, dir, err)
+		}
+		if sameFilesystem {
+			return fmt.Errorf("%s %s doesn't exist and isn't on a mounted drive, is the drive connected?", desc, dir)
+		}
+	}
+	return nil
+}
+
+// checkMountPointMounted returns an error if dir, which exists, is directly under one of mountParentDirs,
+// but is on the same filesystem as that mount parent dir, ie no drive is mounted on it.
+// desc describes dir in the error, eg "uploaded dir".
+func checkMountPointMounted(dir, desc string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for %s: %w", dir, err)
+	}
+	for _, mountParentDir := range mountParentDirs {
+		if filepath.Dir(absDir) != mountParentDir {
+			continue
+		}
+		sameFilesystem, err := isSameFilesystem(absDir, mountParentDir)
+		if err != nil {
+			return fmt.Errorf("failed to check whether the drive of %s %s is mounted: %w", desc, dir, err)
+		}
+		if sameFilesystem {
+			return fmt.Errorf("%s %s isn't on a mounted drive, is the drive connected?", desc, dir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckUploadedRoot(t *testing.T) {
+	// Simulate a drive that would be mounted under a temp dir.
+	mountParentDir := t.TempDir()
+	origMountParentDirs := mountParentDirs
+	mountParentDirs = []string{mountParentDir}
+	defer func() { mountParentDirs = origMountParentDirs }()
+
+	unmounted := filepath.Join(mountParentDir, "Photos Drive", "Uploaded")
+	assert.ErrorContains(t, checkUploadedRoot(unmounted, false), "is the drive connected?")
+	assert.ErrorContains(t, checkUploadedRoot(unmounted, true), "is the drive connected?", "A dry run should also be refused")
+	assertDirNotExists(t, filepath.Join(mountParentDir, "Photos Drive"), "The mount point shouldn't be created")
+
+	// A missing dir elsewhere is created when files are moved into it.
+	assert.NoError(t, checkUploadedRoot(filepath.Join(t.TempDir(), "Uploaded"), false))
+
+	// The mount point of a drive that isn't mounted is on the filesystem of its parent.
+	mountPoint := filepath.Join(mountParentDir, "Uploaded")
+	require.NoError(t, os.Mkdir(mountPoint, 0755))
+	assert.ErrorContains(t, checkUploadedRoot(mountPoint, false), "is the drive connected?")
+	assert.ErrorContains(t, checkUploadedRoot(mountPoint, true), "is the drive connected?", "A dry run should also be refused")
+
+	existing := filepath.Join(mountPoint, "Photos")
+	require.NoError(t, os.Mkdir(existing, 0755))
+	assert.NoError(t, checkUploadedRoot(existing, false))
+	entries, err := os.ReadDir(existing)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "The write check file should be removed")
+
+	notDir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notDir, []byte("content"), 0644))
+	assert.ErrorContains(t, checkUploadedRoot(notDir, false), "is not a directory")
+}
+
+func TestUploadVideos_UploadedRootOnUnmountedDrive(t *testing.T) {
+	mountParentDir := t.TempDir()
+	origMountParentDirs := mountParentDirs
+	mountParentDirs = []string{mountParentDir}
+	defer func() { mountParentDirs = origMountParentDirs }()
+
+	cfg := newTestConfig(t, "", "")
+	cfg.VideosUploadedRoot = filepath.Join(mountParentDir, "Videos Drive", "Uploaded")
+	cfg.LocalVideos.UploadedRoot = cfg.VideosUploadedRoot
+	videoPath := filepath.Join(cfg.VideosUploadQueueRoot, "2024-01-28-video1.mp4")
+	require.NoError(t, os.WriteFile(videoPath, []byte("content"), 0644))
+
+	// Nothing is uploaded, so no API calls are expected.
+	ctrl := gomock.NewController(t)
+	_, err := UploadVideos(context.Background(), cfg, t.TempDir(), false /* keepQueued */, NewMockGPhotosClient(ctrl), false)
+	assert.ErrorContains(t, err, "is the drive connected?")
+	assert.FileExists(t, videoPath)
+	assertDirNotExists(t, filepath.Join(mountParentDir, "Videos Drive"), "The mount point shouldn't be created")
+}
+
+func TestUploadVideos_UploadQueueOnUnmountedDrive(t *testing.T) {
+	mountParentDir := t.TempDir()
+	origMountParentDirs := mountParentDirs
+	mountParentDirs = []string{mountParentDir}
+	defer func() { mountParentDirs = origMountParentDirs }()
+
+	cfg := newTestConfig(t, "", "")
+	// The queue is on a card that was removed, so its parent is missing too.
+	cfg.VideosUploadQueueRoot = filepath.Join(mountParentDir, "EOS_DIGITAL", "Queue")
+	cfg.LocalVideos.UploadQueueRoot = cfg.VideosUploadQueueRoot
+
+	// Nothing is uploaded, so no API calls are expected.
+	ctrl := gomock.NewController(t)
+	_, err := UploadVideos(context.Background(), cfg, t.TempDir(), false /* keepQueued */, NewMockGPhotosClient(ctrl), false)
+	assert.ErrorContains(t, err, "upload queue dir "+cfg.VideosUploadQueueRoot+" doesn't exist and isn't on a mounted drive")
+	_, err = SummarizeVideosUploadQueue(cfg, t.TempDir(), false)
+	assert.ErrorContains(t, err, "is the drive connected?")
+
+	// A missing queue that isn't on a drive is just empty.
+	cfg.VideosUploadQueueRoot = filepath.Join(t.TempDir(), "Queue")
+	cfg.LocalVideos.UploadQueueRoot = cfg.VideosUploadQueueRoot
+	report, err := UploadVideos(context.Background(), cfg, t.TempDir(), false /* keepQueued */, NewMockGPhotosClient(ctrl), false)
+	require.NoError(t, err)
+	assert.Empty(t, report.UploadedItems)
+}
@@ -1,10 +1,13 @@
 package lib
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
@@ -74,12 +77,42 @@ func videoTargetRootDir() (string, error) {
 }
 */
 
+const (
+	// defaultCopyBufferSize is the size of the buffer that files smaller than largeCopyFileSize are copied with.
+	defaultCopyBufferSize = 1 << 20
+	// largeCopyBufferSize is the size of the buffer that files of at least largeCopyFileSize, eg videos,
+	// are copied with. Fewer, bigger reads and writes help most where each one is slow, eg on network
+	// shares, and the progress is still updated every few MiB.
+	largeCopyBufferSize = 8 << 20
+	largeCopyFileSize   = 256 << 20
+	// minCopyBufferSize is the smallest buffer that small files are copied with.
+	minCopyBufferSize = 32 << 10
+)
+
+// copyBufferSize returns the size of the buffer to copy a file of size bytes with. bufferSize, if positive,
+// is the size to use, eg from import.copy_buffer_kib, and otherwise it is picked by the size of the file.
+// Files smaller than the buffer get a buffer of their size, but of at least minCopyBufferSize.
+func copyBufferSize(size int64, bufferSize int) int {
+	if bufferSize <= 0 {
+		bufferSize = defaultCopyBufferSize
+		if size >= largeCopyFileSize {
+			bufferSize = largeCopyBufferSize
+		}
+	}
+	if size < int64(bufferSize) {
+		bufferSize = max(int(size), min(bufferSize, minCopyBufferSize))
+	}
+	return bufferSize
+}
+
 // copyFile creats a copy of src file at dstFinal.
 // It creates the copy first a temporary file and then renames it to dstFinal.
-// It shares its progress via bar.
-func copyFile(src, dstFinal string, size int64, modTime time.Time, bar *progressbar.ProgressBar) error {
+// It copies with a buffer of bufferSize bytes, as for copyBufferSize, and shares its progress via bar
+// after each write, so bigger buffers update bar less often.
+func copyFile(src, dstFinal string, size int64, modTime time.Time, bufferSize int, bar *progressbar.ProgressBar) error {
 	dstTmp := dstFinal + ".tmp"
 
+	defer openFiles.acquire(2)()
 	srcFile, err := os.Open(src)
 	if err != nil {
 		return err
@@ -102,7 +135,7 @@ func copyFile(src, dstFinal string, size int64, modTime time.Time, bar *progress
 		}
 	}()
 
-	buf := make([]byte, 1024*1024)
+	buf := make([]byte, copyBufferSize(size, bufferSize))
 
 	for {
 		n, err := srcFile.Read(buf)
@@ -138,3 +171,144 @@ func copyFile(src, dstFinal string, size int64, modTime time.Time, bar *progress
 
 	return nil
 }
+
+// linkOrCopyFile hard links src to dstFinal using link (normally os.Link), or copies it with copyFile
+// when the filesystem can't link them, eg because they are on different devices.
+// It returns whether the file was linked. bufferSize is as for copyFile.
+func linkOrCopyFile(link func(oldname, newname string) error, src, dstFinal string, size int64, modTime time.Time, bufferSize int, bar *progressbar.ProgressBar) (bool, error) {
+	dstTmp := dstFinal + ".tmp"
+
+	baseName := filepath.Dir(dstFinal)
+	if err := os.MkdirAll(baseName, os.ModePerm); err != nil {
+		return false, fmt.Errorf("failed to create dir %s: %w", baseName, err)
+	}
+	// Link into a temporary name and rename it, like copyFile, so that an existing
+	// destination is replaced. Remove any temporary file left by an interrupted import.
+	if err := os.Remove(dstTmp); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to remove stale tmp file %s: %w", dstTmp, err)
+	}
+
+	if err := link(src, dstTmp); err != nil {
+		unsupported, checkErr := isLinkUnsupported(err, baseName)
+		if checkErr != nil {
+			return false, checkErr
+		}
+		if !unsupported {
+			return false, fmt.Errorf("failed to hard link %s: %w", src, err)
+		}
+		return false, copyFile(src, dstFinal, size, modTime, bufferSize, bar)
+	}
+	if err := os.Rename(dstTmp, dstFinal); err != nil {
+		return false, fmt.Errorf("failed to rename %s: %w", dstTmp, err)
+	}
+	if bar != nil {
+		bar.Add64(size)
+	}
+	// The link shares the source's inode, so it already has the source's modification time.
+	return true, nil
+}
+
+// isAlreadyCopied returns whether dst is already a complete copy of src, whose info is srcInfo,
+// eg because an import stopped after copying src but before deleting it.
+// The sizes and modification times are compared, and with compareContent, also the contents.
+func isAlreadyCopied(src, dst string, srcInfo os.FileInfo, compareContent bool) (bool, error) {
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to stat %s: %w", dst, err)
+	}
+	if !dstInfo.Mode().IsRegular() || dstInfo.Size() != srcInfo.Size() || !dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+		return false, nil
+	}
+	if !compareContent {
+		return true, nil
+	}
+	return sameFileContent(src, dst)
+}
+
+// sameFileContent returns whether the files at a and b have the same content.
+func sameFileContent(a, b string) (bool, error) {
+	defer openFiles.acquire(2)()
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, 1024*1024)
+	bufB := make([]byte, 1024*1024)
+	for {
+		nA, errA := io.ReadFull(fa, bufA)
+		nB, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false, nil
+		}
+		// A short read means that the end of the file was reached.
+		doneA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		doneB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !doneA {
+			return false, fmt.Errorf("failed to read %s: %w", a, errA)
+		}
+		if errB != nil && !doneB {
+			return false, fmt.Errorf("failed to read %s: %w", b, errB)
+		}
+		if doneA || doneB {
+			return doneA && doneB, nil
+		}
+	}
+}
+
+// isLinkUnsupported returns whether err from os.Link into dir means that the files can't be hard linked,
+// rather than that something is wrong.
+func isLinkUnsupported(err error, dir string) (bool, error) {
+	if errors.Is(err, syscall.EXDEV) || // Different filesystems.
+		errors.Is(err, errors.ErrUnsupported) {
+		return true, nil
+	}
+	if !errors.Is(err, syscall.EPERM) {
+		return false, nil
+	}
+	// FAT and exFAT, which don't support links, fail with EPERM, but so does eg a protected file.
+	fat, fatErr := isFATFilesystem(dir)
+	if fatErr != nil {
+		return false, fmt.Errorf("failed to check whether %s supports hard links: %w", dir, fatErr)
+	}
+	return fat, nil
+}
+
+// writeFileAtomic writes data to the file at path, creating it with perm if needed, like os.WriteFile.
+// The data is written to a temporary file in the same dir and synced first, and then renamed over path,
+// so that an interrupted write leaves any earlier file intact rather than a partial one.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync %s: %w", tmpPath, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename %s to %s: %w", tmpPath, path, err)
+	}
+	return nil
+}
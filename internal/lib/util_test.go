@@ -1,8 +1,14 @@
 package lib
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
@@ -12,6 +18,12 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func TestMain(m *testing.M) {
+	// Retry the mocked API calls without waiting. Tests of the backoff set the delays themselves.
+	retryBaseDelay = 0
+	os.Exit(m.Run())
+}
+
 func newTestConfig(t *testing.T, photosDefaultAlbum, videosDefaultAlbum string) config.CamflowConfig {
 	t.Helper()
 
@@ -39,6 +51,8 @@ func newTestConfig(t *testing.T, photosDefaultAlbum, videosDefaultAlbum string)
 			// Does not set ToFav or KeywordAlbums fields.
 		},
 	}
+	// Most tests mock only the API calls of the upload itself.
+	c.Upload.SkipPreflight = true
 	c.LocalPhotos = config.LocalPhotosConfig{
 		ProcessQueueRoot: c.PhotosProcessQueueRoot,
 		UploadQueueDir:   c.PhotosUploadQueueDir,
@@ -79,7 +93,7 @@ func TestCopyFile(t *testing.T) {
 		require.NoError(t, err, "Failed to create source file")
 
 		// Perform the copy
-		err = copyFile(srcFile, dstFile, size, modTime, bar)
+		err = copyFile(srcFile, dstFile, size, modTime, 0, bar)
 		require.NoError(t, err, "copyFile failed unexpectedly")
 
 		// Verify destination file exists
@@ -115,7 +129,7 @@ func TestCopyFile(t *testing.T) {
 		require.NoError(t, err, "Failed to create zero-byte source file")
 
 		// Perform the copy
-		err = copyFile(srcFile, dstFile, size, modTime, bar)
+		err = copyFile(srcFile, dstFile, size, modTime, 0, bar)
 		require.NoError(t, err, "copyFile failed for zero-byte file")
 
 		// Verify destination file exists and is zero size
@@ -148,7 +162,7 @@ func TestCopyFile(t *testing.T) {
 		require.NoError(t, err, "Failed to create source file for error test")
 
 		// Perform the copy - expect failure
-		err = copyFile(srcFile, dstFile, size, modTime, bar)
+		err = copyFile(srcFile, dstFile, size, modTime, 0, bar)
 		require.Error(t, err, "copyFile should have failed when destination directory cannot be created")
 
 		// Check if the error indicates a directory creation problem (optional, depends on exact error wrapping)
@@ -174,7 +188,7 @@ func TestCopyFile(t *testing.T) {
 		modTime := time.Now()
 		size := int64(100) // Size doesn't matter much here
 
-		err := copyFile(srcFile, dstFile, size, modTime, bar)
+		err := copyFile(srcFile, dstFile, size, modTime, 0, bar)
 		require.Error(t, err, "copyFile should fail if source doesn't exist")
 		assert.True(t, os.IsNotExist(err), "Error should be os.IsNotExist for missing source")
 
@@ -183,3 +197,208 @@ func TestCopyFile(t *testing.T) {
 		assert.True(t, os.IsNotExist(err), "Destination file should not exist when source is missing")
 	})
 }
+
+func TestCopyFile_BufferSizes(t *testing.T) {
+	// An odd size, so that the last read doesn't fill the buffer.
+	content := make([]byte, 3<<20+7)
+	_, err := rand.New(rand.NewSource(1)).Read(content)
+	require.NoError(t, err)
+	srcFile := filepath.Join(t.TempDir(), "source.bin")
+	require.NoError(t, os.WriteFile(srcFile, content, 0644))
+	modTime := time.Date(2023, 10, 27, 10, 0, 0, 0, time.UTC)
+
+	for _, bufferSize := range []int{0, 1, 4 << 10, 1 << 20, 64 << 20} {
+		t.Run(fmt.Sprint(bufferSize), func(t *testing.T) {
+			dstFile := filepath.Join(t.TempDir(), "dest.bin")
+			bar := progressbar.NewOptions64(int64(len(content)), progressbar.OptionSetWriter(io.Discard))
+			require.NoError(t, copyFile(srcFile, dstFile, int64(len(content)), modTime, bufferSize, bar))
+			dstContent, err := os.ReadFile(dstFile)
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(content, dstContent), "Destination file content mismatch")
+			assert.Equal(t, int64(len(content)), bar.State().CurrentNum, "The bar should count every byte")
+		})
+	}
+}
+
+func TestCopyBufferSize(t *testing.T) {
+	for _, tc := range []struct {
+		size       int64
+		bufferSize int
+		want       int
+	}{
+		{size: 10 << 20, want: defaultCopyBufferSize},
+		{size: largeCopyFileSize, want: largeCopyBufferSize},
+		{size: 100, want: minCopyBufferSize},
+		{size: 0, want: minCopyBufferSize},
+		{size: 500 << 10, want: 500 << 10},
+		{size: largeCopyFileSize, bufferSize: 2 << 20, want: 2 << 20},
+		{size: 100, bufferSize: 4 << 10, want: 4 << 10},
+		{size: 100, bufferSize: 1, want: 1},
+	} {
+		assert.Equal(t, tc.want, copyBufferSize(tc.size, tc.bufferSize), "size %d, bufferSize %d", tc.size, tc.bufferSize)
+	}
+}
+
+// BenchmarkCopyFile copies a video-sized file with buffers of several sizes, for picking the default sizes.
+// Set TMPDIR to benchmark copies on another filesystem, eg a network share.
+func BenchmarkCopyFile(b *testing.B) {
+	const size = 64 << 20
+	srcFile := filepath.Join(b.TempDir(), "source.bin")
+	require.NoError(b, os.WriteFile(srcFile, make([]byte, size), 0644))
+	dstFile := filepath.Join(b.TempDir(), "dest.bin")
+	modTime := time.Now()
+	for _, bufferSize := range []int{64 << 10, 1 << 20, 8 << 20, 32 << 20} {
+		b.Run(fmt.Sprintf("%dKiB", bufferSize>>10), func(b *testing.B) {
+			b.SetBytes(size)
+			for b.Loop() {
+				if err := copyFile(srcFile, dstFile, size, modTime, bufferSize, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestLinkOrCopyFile(t *testing.T) {
+	bar := progressbar.DefaultBytesSilent(-1, "linking:")
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	content := []byte("test content for linkOrCopyFile")
+	modTime := time.Date(2023, 10, 27, 10, 0, 0, 0, time.UTC)
+
+	newSrcFile := func(t *testing.T, name string) string {
+		srcFile := filepath.Join(srcDir, name)
+		require.NoError(t, os.WriteFile(srcFile, content, 0644))
+		require.NoError(t, os.Chtimes(srcFile, modTime, modTime))
+		return srcFile
+	}
+
+	t.Run("Links", func(t *testing.T) {
+		srcFile := newSrcFile(t, "source_link.txt")
+		dstFile := filepath.Join(dstDir, "subdir", "dest_link.txt")
+		// Plant a tmp file from an interrupted import, which must not block the link.
+		require.NoError(t, os.MkdirAll(filepath.Dir(dstFile), 0755))
+		require.NoError(t, os.WriteFile(dstFile+".tmp", []byte("partial"), 0644))
+
+		linked, err := linkOrCopyFile(os.Link, srcFile, dstFile, int64(len(content)), modTime, 0, bar)
+		require.NoError(t, err)
+		assert.True(t, linked)
+
+		srcInfo, err := os.Stat(srcFile)
+		require.NoError(t, err)
+		dstInfo, err := os.Stat(dstFile)
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(srcInfo, dstInfo), "Destination should be a hard link to the source")
+		assert.True(t, modTime.Equal(dstInfo.ModTime()))
+		_, err = os.Stat(dstFile + ".tmp")
+		assert.True(t, os.IsNotExist(err), "Temporary file should not exist after linking")
+	})
+
+	t.Run("CopiesAcrossDevices", func(t *testing.T) {
+		srcFile := newSrcFile(t, "source_exdev.txt")
+		dstFile := filepath.Join(dstDir, "dest_exdev.txt")
+		crossDeviceLink := func(oldname, newname string) error {
+			return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EXDEV}
+		}
+
+		linked, err := linkOrCopyFile(crossDeviceLink, srcFile, dstFile, int64(len(content)), modTime, 0, bar)
+		require.NoError(t, err)
+		assert.False(t, linked)
+
+		dstContent, err := os.ReadFile(dstFile)
+		require.NoError(t, err)
+		assert.Equal(t, content, dstContent)
+		srcInfo, err := os.Stat(srcFile)
+		require.NoError(t, err)
+		dstInfo, err := os.Stat(dstFile)
+		require.NoError(t, err)
+		assert.False(t, os.SameFile(srcInfo, dstInfo), "Destination should be a copy")
+		assert.True(t, modTime.Equal(dstInfo.ModTime()))
+	})
+
+	t.Run("ErrorPermissionDenied", func(t *testing.T) {
+		srcFile := newSrcFile(t, "source_eperm.txt")
+		dstFile := filepath.Join(dstDir, "dest_eperm.txt")
+		deniedLink := func(oldname, newname string) error {
+			return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EPERM}
+		}
+
+		// The temp dir isn't on FAT, so EPERM is an error rather than links being unsupported.
+		_, err := linkOrCopyFile(deniedLink, srcFile, dstFile, int64(len(content)), modTime, 0, bar)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, syscall.EPERM))
+		_, err = os.Stat(dstFile)
+		assert.True(t, os.IsNotExist(err), "Destination should not be created when linking is denied")
+	})
+
+	t.Run("ErrorOtherLinkFailure", func(t *testing.T) {
+		srcFile := newSrcFile(t, "source_err.txt")
+		dstFile := filepath.Join(dstDir, "dest_err.txt")
+		failingLink := func(oldname, newname string) error {
+			return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EIO}
+		}
+
+		_, err := linkOrCopyFile(failingLink, srcFile, dstFile, int64(len(content)), modTime, 0, bar)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, syscall.EIO))
+		_, err = os.Stat(dstFile)
+		assert.True(t, os.IsNotExist(err), "Destination should not be created when linking fails")
+	})
+}
+
+func TestCopyFileMetadata(t *testing.T) {
+	dir := t.TempDir()
+	srcFile := filepath.Join(dir, "source.JPG")
+	dstFile := filepath.Join(dir, "dest.JPG")
+	require.NoError(t, os.WriteFile(srcFile, []byte("photo"), 0640))
+	require.NoError(t, os.Chmod(srcFile, 0640)) // Don't depend on the umask.
+	require.NoError(t, os.WriteFile(dstFile, []byte("photo"), 0644))
+	atime := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	mtime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(srcFile, atime, mtime))
+	hasXattr := setTestXattr(srcFile, "user.camflow.test", "value") == nil
+
+	require.NoError(t, copyFileMetadata(srcFile, dstFile))
+
+	info, err := os.Stat(dstFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	assert.True(t, mtime.Equal(info.ModTime()), "Modification time mismatch: got %v", info.ModTime())
+	assert.True(t, atime.Equal(fileAccessTime(info)), "Access time mismatch: got %v", fileAccessTime(info))
+	if hasXattr {
+		value, err := getXattr(dstFile, "user.camflow.test")
+		require.NoError(t, err)
+		assert.Equal(t, "value", string(value))
+	} else {
+		t.Log("Extended attributes are not supported on the temp dir's filesystem, not checking them")
+	}
+
+	t.Run("ErrorSourceNotExist", func(t *testing.T) {
+		err := copyFileMetadata(filepath.Join(dir, "missing.JPG"), dstFile)
+		assert.ErrorContains(t, err, "failed to stat")
+	})
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	require.NoError(t, writeFileAtomic(path, []byte("first"), 0600))
+	require.NoError(t, writeFileAtomic(path, []byte("second"), 0600))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "The temporary file shouldn't be left behind")
+
+	// A failed write leaves the earlier file intact.
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".state.json.tmp"), 0755))
+	assert.Error(t, writeFileAtomic(path, []byte("third"), 0600))
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+}
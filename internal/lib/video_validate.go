@@ -0,0 +1,133 @@
+package lib
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isMP4ContainerFile returns whether path has the extension of an MP4 or QuickTime (MOV) file.
+func isMP4ContainerFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".mov", ".m4v":
+		return true
+	}
+	return false
+}
+
+// validateMP4Container checks that the MP4 or QuickTime file at path is a well-formed container:
+// its top-level boxes (atoms) must exactly fill the file and include a moov box, and MP4 files
+// must also have an ftyp box (older QuickTime files don't).
+// This catches files that were truncated, eg by a bad card read, without parsing the media.
+func validateMP4Container(path string) error {
+	defer openFiles.acquire(1)()
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	fileSize := info.Size()
+
+	var boxTypes []string
+	hasFtyp, hasMoov := false, false
+	var offset int64
+	header := make([]byte, 16)
+	for offset < fileSize {
+		if fileSize-offset < 8 {
+			return fmt.Errorf("truncated box header at offset %d", offset)
+		}
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return fmt.Errorf("failed to read box header at offset %d: %w", offset, err)
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			// The box extends to the end of the file.
+			boxSize = fileSize - offset
+		case 1:
+			// The size is in the 64-bit largesize field after the type.
+			if fileSize-offset < 16 {
+				return fmt.Errorf("truncated %q box header at offset %d", boxType, offset)
+			}
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return fmt.Errorf("failed to read %q box size at offset %d: %w", boxType, offset, err)
+			}
+			largeSize := binary.BigEndian.Uint64(header[8:16])
+			if largeSize > uint64(fileSize) {
+				return fmt.Errorf("%q box at offset %d has size %d, past the end of the file (%d bytes)", boxType, offset, largeSize, fileSize)
+			}
+			boxSize = int64(largeSize)
+			headerSize = 16
+		}
+		if boxSize < headerSize {
+			return fmt.Errorf("%q box at offset %d has invalid size %d", boxType, offset, boxSize)
+		}
+		if offset+boxSize > fileSize {
+			return fmt.Errorf("%q box at offset %d has size %d, past the end of the file (%d bytes)", boxType, offset, boxSize, fileSize)
+		}
+
+		boxTypes = append(boxTypes, boxType)
+		switch boxType {
+		case "ftyp":
+			hasFtyp = true
+		case "moov":
+			hasMoov = true
+		}
+		offset += boxSize
+	}
+
+	if len(boxTypes) == 0 {
+		return errors.New("empty file")
+	}
+	if !hasFtyp && strings.ToLower(filepath.Ext(path)) != ".mov" {
+		return fmt.Errorf("missing ftyp box: found %v", boxTypes)
+	}
+	if !hasMoov {
+		return fmt.Errorf("missing moov box: found %v", boxTypes)
+	}
+	return nil
+}
+
+// filterInvalidVideos returns the items, and their exif data, that aren't MP4 or QuickTime files
+// or are well-formed ones, and the paths of the items that were filtered out because they aren't.
+// The files are checked on up to workers goroutines at once, which speeds up big queues on slow drives.
+func filterInvalidVideos(ctx context.Context, items []itemFileInfo, itemExifs []ExifData, workers int) ([]itemFileInfo, []ExifData, []string, error) {
+	// Each file writes its error to its own slot, so that the results are in the order of the items.
+	validateErrs := make([]error, len(items))
+	err := forEachConcurrently(ctx, len(items), workers, func(_ context.Context, i int) error {
+		if isMP4ContainerFile(items[i].path) {
+			validateErrs[i] = validateMP4Container(items[i].path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to validate videos: %w", err)
+	}
+
+	var keptItems []itemFileInfo
+	var keptExifs []ExifData
+	var invalidPaths []string
+	for i, item := range items {
+		if err := validateErrs[i]; err != nil {
+			logger.Warn("Skipping invalid video",
+				slog.String("path", item.path),
+				slog.String("error", err.Error()))
+			invalidPaths = append(invalidPaths, item.path)
+			continue
+		}
+		keptItems = append(keptItems, item)
+		keptExifs = append(keptExifs, itemExifs[i])
+	}
+	return keptItems, keptExifs, invalidPaths, nil
+}
@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mp4Box returns an MP4 box of boxType with payload.
+func mp4Box(boxType string, payload []byte) []byte {
+	box := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(box, uint32(8+len(payload)))
+	copy(box[4:], boxType)
+	return append(box, payload...)
+}
+
+func TestValidateMP4Container(t *testing.T) {
+	ftyp := mp4Box("ftyp", []byte("isom\x00\x00\x02\x00isommp41"))
+	moov := mp4Box("moov", mp4Box("mvhd", make([]byte, 100)))
+	mdat := mp4Box("mdat", make([]byte, 1000))
+	concat := func(boxes ...[]byte) []byte {
+		var b []byte
+		for _, box := range boxes {
+			b = append(b, box...)
+		}
+		return b
+	}
+	// A 64-bit size mdat box: size 1, then the largesize after the type.
+	largeMdat := []byte{0, 0, 0, 1, 'm', 'd', 'a', 't', 0, 0, 0, 0, 0, 0, 0, 24}
+	largeMdat = append(largeMdat, make([]byte, 8)...)
+
+	for _, tt := range []struct {
+		name    string
+		file    string
+		content []byte
+		wantErr string
+	}{
+		{name: "Valid", file: "2024-05-01-MVI_0001.MP4", content: concat(ftyp, moov, mdat)},
+		{name: "ValidMoovAtEnd", file: "2024-05-01-MVI_0001.MP4", content: concat(ftyp, mdat, moov)},
+		{name: "ValidLargeSize", file: "2024-05-01-MVI_0001.MP4", content: concat(ftyp, moov, largeMdat)},
+		{name: "ValidQuickTimeWithoutFtyp", file: "2024-05-01-MVI_0001.MOV", content: concat(moov, mdat)},
+		{name: "Truncated", file: "2024-05-01-MVI_0001.MP4", content: concat(ftyp, moov, mdat)[:len(ftyp)+len(moov)+500], wantErr: `"mdat" box at offset`},
+		{name: "TruncatedHeader", file: "2024-05-01-MVI_0001.MP4", content: concat(ftyp, moov, mdat[:4]), wantErr: "truncated box header"},
+		{name: "MissingMoov", file: "2024-05-01-MVI_0001.MP4", content: concat(ftyp, mdat), wantErr: "missing moov box"},
+		{name: "MissingFtyp", file: "2024-05-01-MVI_0001.MP4", content: concat(moov, mdat), wantErr: "missing ftyp box"},
+		{name: "Empty", file: "2024-05-01-MVI_0001.MP4", content: nil, wantErr: "empty file"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, tt.content, 0644))
+			err := validateMP4Container(path)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterInvalidVideos(t *testing.T) {
+	dir := t.TempDir()
+	validPath := filepath.Join(dir, "2024-05-01-MVI_0001.MP4")
+	truncatedPath := filepath.Join(dir, "2024-05-01-MVI_0002.MP4")
+	photoPath := filepath.Join(dir, "2024-05-01-IMG_0003.JPG")
+	valid := append(mp4Box("ftyp", []byte("isom")), mp4Box("moov", nil)...)
+	require.NoError(t, os.WriteFile(validPath, valid, 0644))
+	require.NoError(t, os.WriteFile(truncatedPath, valid[:len(valid)-2], 0644))
+	require.NoError(t, os.WriteFile(photoPath, []byte("not checked"), 0644))
+
+	items := []itemFileInfo{{path: validPath}, {path: truncatedPath}, {path: photoPath}}
+	exifs := []ExifData{{Path: validPath}, {Path: truncatedPath}, {Path: photoPath}}
+	gotItems, gotExifs, invalidPaths, err := filterInvalidVideos(context.Background(), items, exifs, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []itemFileInfo{items[0], items[2]}, gotItems)
+	assert.Equal(t, []ExifData{exifs[0], exifs[2]}, gotExifs)
+	assert.Equal(t, []string{truncatedPath}, invalidPaths)
+}
+
+func TestFilterInvalidVideos_Concurrency(t *testing.T) {
+	dir := t.TempDir()
+	valid := append(mp4Box("ftyp", []byte("isom")), mp4Box("moov", nil)...)
+	var items []itemFileInfo
+	var exifs []ExifData
+	var wantInvalidPaths []string
+	for i := range 50 {
+		path := filepath.Join(dir, fmt.Sprintf("2024-05-01-MVI_%04d.MP4", i))
+		data := valid
+		if i%3 == 0 {
+			data = valid[:len(valid)-2]
+			wantInvalidPaths = append(wantInvalidPaths, path)
+		}
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		items = append(items, itemFileInfo{path: path})
+		exifs = append(exifs, ExifData{Path: path})
+	}
+
+	wantItems, wantExifs, invalidPaths, err := filterInvalidVideos(context.Background(), items, exifs, 1)
+	require.NoError(t, err)
+	assert.Equal(t, wantInvalidPaths, invalidPaths)
+	// The results shouldn't depend on how many files are checked at once.
+	for _, workers := range []int{2, 8, 100} {
+		gotItems, gotExifs, invalidPaths, err := filterInvalidVideos(context.Background(), items, exifs, workers)
+		require.NoError(t, err)
+		assert.Equal(t, wantItems, gotItems, "workers %d", workers)
+		assert.Equal(t, wantExifs, gotExifs, "workers %d", workers)
+		assert.Equal(t, wantInvalidPaths, invalidPaths, "workers %d", workers)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, _, err = filterInvalidVideos(ctx, items, exifs, 4)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,31 @@
+package lib
+
+import (
+	"context"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// forEachConcurrently calls fn for each index from 0 to n-1, on at most workers goroutines at once.
+// fn should write its result to its own slot, eg of a slice indexed by i, so that the results are
+// in order whatever the concurrency. Once ctx is done or a call fails, no more calls are started,
+// and it returns the first error, or ctx's error. The ctx passed to fn is also canceled when a call fails.
+func forEachConcurrently(ctx context.Context, n, workers int, fn func(ctx context.Context, i int) error) error {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(workers, 1))
+	for i := range n {
+		if gctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			return fn(gctx, i)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
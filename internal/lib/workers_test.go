@@ -0,0 +1,50 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachConcurrently(t *testing.T) {
+	const n, workers = 40, 3
+	var running, maxRunning atomic.Int32
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+	err := forEachConcurrently(context.Background(), n, workers, func(_ context.Context, i int) error {
+		cur := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := maxRunning.Load()
+			if cur <= old || maxRunning.CompareAndSwap(old, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		seen[i] = true
+		mu.Unlock()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, seen, n)
+	assert.LessOrEqual(t, maxRunning.Load(), int32(workers))
+
+	// A failure stops later calls from starting.
+	errFailed := errors.New("failed")
+	var calls atomic.Int32
+	err = forEachConcurrently(context.Background(), n, 1, func(_ context.Context, i int) error {
+		calls.Add(1)
+		if i == 2 {
+			return errFailed
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, errFailed)
+	assert.Equal(t, int32(3), calls.Load())
+}
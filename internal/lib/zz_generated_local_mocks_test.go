@@ -7,6 +7,7 @@ package lib
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	v3 "github.com/gphotosuploader/google-photos-api-client-go/v3"
@@ -146,6 +147,50 @@ func (mr *MockAppAlbumsServiceMockRecorder) List(ctx interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockAppAlbumsService)(nil).List), ctx)
 }
 
+// ListPage mocks base method.
+func (m *MockAppAlbumsService) ListPage(ctx context.Context, pageSize int) ([]albums.Album, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPage", ctx, pageSize)
+	ret0, _ := ret[0].([]albums.Album)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPage indicates an expected call of ListPage.
+func (mr *MockAppAlbumsServiceMockRecorder) ListPage(ctx, pageSize interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPage", reflect.TypeOf((*MockAppAlbumsService)(nil).ListPage), ctx, pageSize)
+}
+
+// RemoveMediaItems mocks base method.
+func (m *MockAppAlbumsService) RemoveMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveMediaItems", ctx, albumID, mediaItemIDs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveMediaItems indicates an expected call of RemoveMediaItems.
+func (mr *MockAppAlbumsServiceMockRecorder) RemoveMediaItems(ctx, albumID, mediaItemIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveMediaItems", reflect.TypeOf((*MockAppAlbumsService)(nil).RemoveMediaItems), ctx, albumID, mediaItemIDs)
+}
+
+// UpdateTitle mocks base method.
+func (m *MockAppAlbumsService) UpdateTitle(ctx context.Context, albumID, title string) (*albums.Album, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTitle", ctx, albumID, title)
+	ret0, _ := ret[0].(*albums.Album)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateTitle indicates an expected call of UpdateTitle.
+func (mr *MockAppAlbumsServiceMockRecorder) UpdateTitle(ctx, albumID, title interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTitle", reflect.TypeOf((*MockAppAlbumsService)(nil).UpdateTitle), ctx, albumID, title)
+}
+
 // MockAppMediaItemsService is a mock of AppMediaItemsService interface.
 type MockAppMediaItemsService struct {
 	ctrl     *gomock.Controller
@@ -183,3 +228,63 @@ func (mr *MockAppMediaItemsServiceMockRecorder) Create(ctx, item interface{}) *g
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockAppMediaItemsService)(nil).Create), ctx, item)
 }
+
+// CreateWithDescription mocks base method.
+func (m *MockAppMediaItemsService) CreateWithDescription(ctx context.Context, item media_items.SimpleMediaItem, description string) (*media_items.MediaItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWithDescription", ctx, item, description)
+	ret0, _ := ret[0].(*media_items.MediaItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWithDescription indicates an expected call of CreateWithDescription.
+func (mr *MockAppMediaItemsServiceMockRecorder) CreateWithDescription(ctx, item, description interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWithDescription", reflect.TypeOf((*MockAppMediaItemsService)(nil).CreateWithDescription), ctx, item, description)
+}
+
+// Get mocks base method.
+func (m *MockAppMediaItemsService) Get(ctx context.Context, mediaItemID string) (*media_items.MediaItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, mediaItemID)
+	ret0, _ := ret[0].(*media_items.MediaItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockAppMediaItemsServiceMockRecorder) Get(ctx, mediaItemID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockAppMediaItemsService)(nil).Get), ctx, mediaItemID)
+}
+
+// ListByAlbum mocks base method.
+func (m *MockAppMediaItemsService) ListByAlbum(ctx context.Context, albumID string) ([]*media_items.MediaItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByAlbum", ctx, albumID)
+	ret0, _ := ret[0].([]*media_items.MediaItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListByAlbum indicates an expected call of ListByAlbum.
+func (mr *MockAppMediaItemsServiceMockRecorder) ListByAlbum(ctx, albumID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByAlbum", reflect.TypeOf((*MockAppMediaItemsService)(nil).ListByAlbum), ctx, albumID)
+}
+
+// Search mocks base method.
+func (m *MockAppMediaItemsService) Search(ctx context.Context, from, to time.Time) ([]*media_items.MediaItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", ctx, from, to)
+	ret0, _ := ret[0].([]*media_items.MediaItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockAppMediaItemsServiceMockRecorder) Search(ctx, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockAppMediaItemsService)(nil).Search), ctx, from, to)
+}
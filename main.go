@@ -3,18 +3,20 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"slices"
 	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/ccfrost/camflow/internal/config"
 	"github.com/ccfrost/camflow/internal/lib"
-	gphotos "github.com/gphotosuploader/google-photos-api-client-go/v3"
 	"github.com/spf13/cobra"
 )
 
@@ -27,8 +29,10 @@ var (
 )
 
 func main() {
-	var configPath, cacheDir string
+	var configPath, cacheDir, profile, accountLabel, progressStyle string
 	var dryRun bool
+	var debugLog, compressLogs bool
+	var debugLogMaxMB, debugLogKeep int
 	var cfg config.CamflowConfig
 
 	rootCmd := cobra.Command{
@@ -43,6 +47,26 @@ func main() {
 			if err := cfg.Validate(); err != nil {
 				return fmt.Errorf("invalid config: %w", err)
 			}
+			if cmd.Flags().Changed("account") {
+				cfg.AccountLabel = accountLabel
+			}
+			if cacheDir, err = lib.ProfileCacheDir(cacheDir, profile); err != nil {
+				return err
+			}
+			if debugLog {
+				if err := lib.EnableDebugLogFile(lib.DebugLogPath(cacheDir), int64(debugLogMaxMB)<<20, debugLogKeep, compressLogs); err != nil {
+					return fmt.Errorf("failed to set up debug log file: %w", err)
+				}
+			}
+			if cfg.AccountLabel != "" {
+				lib.SetLogAccountLabel(cfg.AccountLabel)
+			}
+			if err := lib.SetProgressStyle(progressStyle); err != nil {
+				return err
+			}
+			if err := lib.SetMaxOpenFiles(cfg.MaxOpenFiles); err != nil {
+				return err
+			}
 			return nil
 		},
 	}
@@ -60,13 +84,23 @@ func main() {
 			os.Exit(1)
 		}
 		rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", defaultCacheDir, "Dir to store cache files")
+		rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Name of the profile, eg for another Google Photos account, whose cache files are kept apart under the cache dir")
+		rootCmd.PersistentFlags().StringVar(&accountLabel, "account", "", "Label of the Google Photos account that the run targets, shown in the output, logs, and run reports (overrides account_label)")
 
 		rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Perform a dry run without modifying any files")
+		rootCmd.PersistentFlags().StringVar(&progressStyle, "progress-style", "", "How to show progress: bar, plain for a line every 10s, eg for logs, or none (default bar if stdout is a terminal, else plain)")
+
+		rootCmd.PersistentFlags().BoolVar(&debugLog, "debug-log", false, "Write debug logs to a rotating file under the cache dir, in addition to stderr")
+		rootCmd.PersistentFlags().IntVar(&debugLogMaxMB, "debug-log-max-mb", 10, "Size in MiB at which the debug log file is rotated")
+		rootCmd.PersistentFlags().IntVar(&debugLogKeep, "debug-log-keep", 5, "Number of rotated debug log files to keep")
+		rootCmd.PersistentFlags().BoolVar(&compressLogs, "compress-logs", false, "Gzip rotated debug log files")
 	}
 
 	versionCmd := cobra.Command{
 		Use:   "version",
 		Short: "Print the version number of camflow",
+		// The version doesn't depend on the config, so it is printed even without one.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
 		Run: func(cmd *cobra.Command, args []string) {
 			// If any version info is missing, try to read it from the binary's build info.
 			if version == "dev" || commit == "none" {
@@ -96,6 +130,16 @@ func main() {
 				}
 			}
 
+			short, err := cmd.Flags().GetBool("short")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid short flag:", err)
+				os.Exit(1)
+			}
+			if short {
+				fmt.Println(version)
+				return
+			}
+
 			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 			fmt.Fprintf(w, "Client:\t%s\n", camflow)
 			fmt.Fprintf(w, "Version:\t%s\n", version)
@@ -106,6 +150,7 @@ func main() {
 			w.Flush()
 		},
 	}
+	versionCmd.Flags().Bool("short", false, "Print only the version, eg for scripts")
 	rootCmd.AddCommand(&versionCmd)
 
 	importCmd := cobra.Command{
@@ -113,53 +158,141 @@ func main() {
 		Short: "Import media from the sdcard",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			srcDir, err := cmd.Flags().GetString("src")
+			cleanup, err := cmd.Flags().GetBool("cleanup")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid cleanup flag:", err)
+				os.Exit(1)
+			}
+			if cleanup {
+				// Only the dest flags, which say where the interrupted import was moving media to, apply to a cleanup.
+				for _, name := range []string{"src", "parallel-cards", "keep", "hardlink", "verify", "camera-clock-offset", "takeout", "summary-by-date", "report-skipped", "report-file"} {
+					if cmd.Flags().Changed(name) {
+						fmt.Fprintf(os.Stderr, "error: --%s can't be used with --cleanup\n", name)
+						os.Exit(1)
+					}
+				}
+				if err := applyImportDestFlags(cmd, &cfg); err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				removed, err := lib.CleanupTmpFiles(cfg, dryRun)
+				actionVerb := "Removed"
+				if dryRun {
+					actionVerb = "Would have removed"
+				}
+				fmt.Printf("%s %d leftover temporary file%s\n", actionVerb, len(removed), pluralSuffix(len(removed)))
+				for _, path := range removed {
+					fmt.Printf("\t%s\n", path)
+				}
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			srcDirs, err := cmd.Flags().GetStringArray("src")
 			if err != nil {
 				fmt.Fprintln(os.Stderr, "error: invalid src flag:", err)
 				os.Exit(1)
 			}
-			if srcDir == "" {
-				// TODO: find sd card (diskutil/gemini code)
-				panic("TODO: find sd card")
+			if slices.Contains(srcDirs, "") {
+				fmt.Fprintln(os.Stderr, "error: invalid src flag: must not be empty")
+				os.Exit(1)
+			}
+			if len(srcDirs) == 0 {
+				card, err := lib.DetectCard(cfg.Import.MediaRoots)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Importing from %s\n", card)
+				srcDirs = []string{card}
+			}
+			parallelCards, err := cmd.Flags().GetInt("parallel-cards")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid parallel-cards flag:", err)
+				os.Exit(1)
 			}
 
-			var keep bool
-			keep, err = cmd.Flags().GetBool("keep")
+			keep, output, err := applyImportFlags(cmd, &cfg)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "error: invalid keep flag:", err)
+				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
 			}
 
-			res, err := lib.Import(cfg, srcDir, keep, time.Now(), dryRun)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			startedAt := time.Now()
+			res, err := lib.ImportCards(ctx, cfg, cacheDir, srcDirs, keep, startedAt, parallelCards, dryRun)
+			verifyErr := importVerifyError(res)
+			finishRun(cmd, cfg, lib.NewImportRunReport(cmd.Name(), startedAt, time.Now(), dryRun, res, errors.Join(err, verifyErr)))
 			if err != nil {
+				if output.reportSkipped {
+					printSkippedFiles(res.SkippedFiles)
+				} else {
+					printVerifyFailedFiles(res)
+				}
 				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
 			}
+			printImportResult(res, output, dryRun)
+			if verifyErr != nil {
+				fmt.Fprintln(os.Stderr, "error:", verifyErr)
+				os.Exit(1)
+			}
+		},
+	}
+	importCmd.Flags().StringArrayP("src", "s", nil, "Path to the source sdcard directory; repeat to import from several cards (defaults to the one mounted volume with an import.media_roots dir, eg DCIM)")
+	importCmd.Flags().Int("parallel-cards", 1, fmt.Sprintf("Number of cards to import from at a time, eg from several card readers (at most %d)", lib.MaxParallelCards))
+	addImportFlags(&importCmd)
+	importCmd.Flags().Bool("cleanup", false, "Instead of importing, remove temporary files left by interrupted copies (in the --photos-dest and --videos-dest dirs, if given)")
+	addReportFileFlag(&importCmd)
+	rootCmd.AddCommand(&importCmd)
 
-			// TODO: change relative dirs to print target rather than sdcard dir names (and counts?).
-			optColon := ""
-			if len(res.SrcEntries) > 0 {
-				optColon = ":"
+	importFilesCmd := cobra.Command{
+		Use:   "import-files",
+		Short: "Import the media files listed on stdin",
+		Long: `Import exactly the media files whose paths are listed on stdin, one per line, instead of the files on a card.
+Eg: find /Volumes/EOS_DIGITAL/DCIM -name '*.CR3' -newer last-import | camflow import-files`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			keep, output, err := applyImportFlags(cmd, &cfg)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
 			}
-			actionVerb := "Imported"
-			if dryRun {
-				actionVerb = "Would have imported"
+			paths, err := lib.ReadFileList(cmd.InOrStdin())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
 			}
-			fmt.Printf("%s from %d dir%s%s\n", actionVerb, len(res.SrcEntries), pluralSuffix(len(res.SrcEntries)), optColon)
-			if len(res.SrcEntries) != 0 {
-				for _, entry := range res.SrcEntries {
-					fmt.Printf("\t%s: %d photo%s, %d video%s\n", entry.RelativeDir, entry.PhotoCount, pluralSuffix(entry.PhotoCount), entry.VideoCount, pluralSuffix(entry.VideoCount))
-				}
-				fmt.Printf("%s photos into %d dir%s:\n", actionVerb, len(res.DstEntries), pluralSuffix(len(res.DstEntries)))
-				for _, entry := range res.DstEntries {
-					fmt.Printf("\t%s: %d photo%s\n", entry.RelativeDir, entry.PhotoCount, pluralSuffix(entry.PhotoCount))
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			startedAt := time.Now()
+			res, err := lib.ImportFiles(ctx, cfg, cacheDir, paths, keep, dryRun)
+			verifyErr := importVerifyError(res)
+			finishRun(cmd, cfg, lib.NewImportRunReport(cmd.Name(), startedAt, time.Now(), dryRun, res, errors.Join(err, verifyErr)))
+			if err != nil {
+				if output.reportSkipped {
+					printSkippedFiles(res.SkippedFiles)
+				} else {
+					printVerifyFailedFiles(res)
 				}
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			printImportResult(res, output, dryRun)
+			if verifyErr != nil {
+				fmt.Fprintln(os.Stderr, "error:", verifyErr)
+				os.Exit(1)
 			}
 		},
 	}
-	importCmd.Flags().StringP("src", "s", "/Volumes/EOS_DIGITAL/", "Path to the source sdcard directory (defaults to auto-detect)")
-	importCmd.Flags().BoolP("keep", "k", false, "Keep the source files")
-	rootCmd.AddCommand(&importCmd)
+	addImportFlags(&importFilesCmd)
+	addReportFileFlag(&importFilesCmd)
+	rootCmd.AddCommand(&importFilesCmd)
 
 	uploadPhotosCmd := cobra.Command{
 		Use:   "upload-photos",
@@ -173,27 +306,41 @@ Successfully uploaded photos are deleted from upload queue unless --keep is spec
 				fmt.Fprintln(os.Stderr, "error: invalid keep flag:", err)
 				os.Exit(1)
 			}
-
-			ctx := context.Background()
-			gphotosHttpClient, err := lib.GetAuthenticatedGooglePhotosClient(ctx, cfg, cacheDir)
-			if err != nil {
+			if err := applyUploadFlags(cmd, &cfg); err != nil {
 				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
 			}
-			gphotosClient, err := gphotos.NewClient(gphotosHttpClient)
+			summaryOnly, err := cmd.Flags().GetBool("summary-only")
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "error:", err)
+				fmt.Fprintln(os.Stderr, "error: invalid summary-only flag:", err)
 				os.Exit(1)
 			}
-			wrappedGphotosClient := lib.NewGPhotosClientWrapper(gphotosClient)
+			if summaryOnly {
+				summary, err := lib.SummarizePhotosUploadQueue(cfg, cacheDir, keep)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				printUploadQueueSummary(summary, "photos")
+				return
+			}
 
-			if err := lib.UploadPhotos(ctx, cfg, cacheDir, keep, wrappedGphotosClient, dryRun); err != nil {
+			ctx := context.Background()
+			startedAt := time.Now()
+			report, err := uploadWithGooglePhotos(ctx, cfg, cacheDir, func(gphotosClient lib.GPhotosClient) (lib.UploadReport, error) {
+				return lib.UploadPhotos(ctx, cfg, cacheDir, keep, gphotosClient, dryRun)
+			})
+			printAlbumSummary(report, dryRun || cfg.Upload.CheckAPI)
+			finishRun(cmd, cfg, lib.NewUploadRunReport(cmd.Name(), startedAt, time.Now(), dryRun || cfg.Upload.CheckAPI, report, err))
+			if err != nil {
 				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
 			}
 		},
 	}
 	uploadPhotosCmd.Flags().BoolP("keep", "k", false, "Keep photos in upload queue after upload")
+	addUploadFlags(&uploadPhotosCmd)
+	addReportFileFlag(&uploadPhotosCmd)
 	rootCmd.AddCommand(&uploadPhotosCmd)
 
 	uploadVideosCmd := cobra.Command{
@@ -208,28 +355,158 @@ Successfully uploaded videos are deleted from upload queue unless --keep is spec
 				fmt.Fprintln(os.Stderr, "error: invalid keep flag:", err)
 				os.Exit(1)
 			}
+			if err := applyUploadFlags(cmd, &cfg); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			summaryOnly, err := cmd.Flags().GetBool("summary-only")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid summary-only flag:", err)
+				os.Exit(1)
+			}
+			if summaryOnly {
+				summary, err := lib.SummarizeVideosUploadQueue(cfg, cacheDir, keep)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				printUploadQueueSummary(summary, "videos")
+				return
+			}
 
 			ctx := context.Background()
-			gphotosHttpClient, err := lib.GetAuthenticatedGooglePhotosClient(ctx, cfg, cacheDir)
+			startedAt := time.Now()
+			report, err := uploadWithGooglePhotos(ctx, cfg, cacheDir, func(gphotosClient lib.GPhotosClient) (lib.UploadReport, error) {
+				return lib.UploadVideos(ctx, cfg, cacheDir, keep, gphotosClient, dryRun)
+			})
+			printAlbumSummary(report, dryRun || cfg.Upload.CheckAPI)
+			finishRun(cmd, cfg, lib.NewUploadRunReport(cmd.Name(), startedAt, time.Now(), dryRun || cfg.Upload.CheckAPI, report, err))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	uploadVideosCmd.Flags().BoolP("keep", "k", false, "Keep videos in upload queue after upload")
+	addUploadFlags(&uploadVideosCmd)
+	addReportFileFlag(&uploadVideosCmd)
+	rootCmd.AddCommand(&uploadVideosCmd)
+
+	uploadCmd := cobra.Command{
+		Use:   "upload",
+		Short: "Upload photos and then videos from their upload queues to Google Photos",
+		Long: `Upload photos and then videos from their upload queues to Google Photos, as upload-photos
+and upload-videos do, sharing the API rate limit and album lookups between them.
+The videos are uploaded even if uploading the photos fails. Successfully uploaded files are deleted
+from the upload queues unless --keep is specified.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			keep, err := cmd.Flags().GetBool("keep")
 			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid keep flag:", err)
+				os.Exit(1)
+			}
+			if err := applyUploadFlags(cmd, &cfg); err != nil {
 				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
 			}
-			gphotosClient, err := gphotos.NewClient(gphotosHttpClient)
+			summaryOnly, err := cmd.Flags().GetBool("summary-only")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid summary-only flag:", err)
+				os.Exit(1)
+			}
+			if summaryOnly {
+				photosSummary, err := lib.SummarizePhotosUploadQueue(cfg, cacheDir, keep)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				videosSummary, err := lib.SummarizeVideosUploadQueue(cfg, cacheDir, keep)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				printUploadQueueSummary(photosSummary, "photos")
+				printUploadQueueSummary(videosSummary, "videos")
+				return
+			}
+
+			ctx := context.Background()
+			startedAt := time.Now()
+			report, err := uploadWithGooglePhotos(ctx, cfg, cacheDir, func(gphotosClient lib.GPhotosClient) (lib.UploadReport, error) {
+				return lib.UploadAll(ctx, cfg, cacheDir, keep, gphotosClient, dryRun)
+			})
+			printAlbumSummary(report, dryRun || cfg.Upload.CheckAPI)
+			finishRun(cmd, cfg, lib.NewUploadRunReport(cmd.Name(), startedAt, time.Now(), dryRun || cfg.Upload.CheckAPI, report, err))
 			if err != nil {
 				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
 			}
-			wrappedGphotosClient := lib.NewGPhotosClientWrapper(gphotosClient)
+		},
+	}
+	uploadCmd.Flags().BoolP("keep", "k", false, "Keep photos and videos in the upload queues after upload")
+	addUploadFlags(&uploadCmd)
+	addReportFileFlag(&uploadCmd)
+	rootCmd.AddCommand(&uploadCmd)
+
+	logout := func(cmd *cobra.Command, args []string) {
+		hadToken, err := lib.Logout(cacheDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		if hadToken {
+			fmt.Println("Logged out of Google Photos")
+		} else {
+			fmt.Println("Not logged in to Google Photos")
+		}
+	}
+	const logoutLong = `Delete the saved Google Photos OAuth token.
+The next command that uses Google Photos will ask you to authenticate again.`
+
+	logoutCmd := cobra.Command{
+		Use:   "logout",
+		Short: "Delete the saved Google Photos credentials",
+		Long:  logoutLong,
+		Args:  cobra.NoArgs,
+		Run:   logout,
+	}
+	rootCmd.AddCommand(&logoutCmd)
 
-			if err := lib.UploadVideos(ctx, cfg, cacheDir, keep, wrappedGphotosClient, dryRun); err != nil {
+	authCmd := cobra.Command{
+		Use:   "auth",
+		Short: "Manage the Google Photos credentials",
+	}
+	authLoginCmd := cobra.Command{
+		Use:   "login",
+		Short: "Authenticate with Google Photos and save the credentials",
+		Long: `Authenticate with Google Photos in the browser and save the OAuth token, replacing any saved token.
+Later commands use the saved token, so this can be run as a setup step before the first upload.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			email, err := lib.Login(ctx, cfg, cacheDir)
+			if err != nil {
 				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
 			}
+			if email != "" {
+				fmt.Printf("Logged in to Google Photos as %s\n", email)
+			} else {
+				fmt.Println("Logged in to Google Photos")
+			}
 		},
 	}
-	uploadVideosCmd.Flags().BoolP("keep", "k", false, "Keep videos in upload queue after upload")
-	rootCmd.AddCommand(&uploadVideosCmd)
+	authLogoutCmd := cobra.Command{
+		Use:   "logout",
+		Short: "Delete the saved Google Photos credentials",
+		Long:  logoutLong,
+		Args:  cobra.NoArgs,
+		Run:   logout,
+	}
+	authCmd.AddCommand(&authLoginCmd, &authLogoutCmd)
+	rootCmd.AddCommand(&authCmd)
 
 	markVideosUploadedCmd := cobra.Command{
 		Use:   "mark-videos-uploaded",
@@ -264,25 +541,986 @@ This is a workaround for video uploads not preserving the video's timezone.`,
 	}
 	rootCmd.AddCommand(&markVideosUploadedCmd)
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, "error:", err)
-		os.Exit(1)
+	reorganizeUploadedCmd := cobra.Command{
+		Use:   "reorganize-uploaded",
+		Short: "Move files in the uploaded directories into the current layout",
+		Long: `Move the files in the photo and video uploaded directories into the location camflow
+currently uses for them, based on the date prefix of each file's name, or its EXIF
+capture date if upload.uploaded_date is exif. Their day index entries are moved with them.
+Files whose location is already taken are left in place and reported.
+Directories left empty by the moves are removed.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+			res, err := lib.ReorganizeUploaded(ctx, cfg, dryRun)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+
+			actionVerb := "Moved"
+			if dryRun {
+				actionVerb = "Would have moved"
+			}
+			fmt.Printf("%s %d file%s; %d already in place\n", actionVerb, res.Moved, pluralSuffix(res.Moved), res.InPlace)
+			if len(res.Collisions) > 0 {
+				fmt.Printf("Skipped %d file%s whose destination already exists:\n", len(res.Collisions), pluralSuffix(len(res.Collisions)))
+				for _, path := range res.Collisions {
+					fmt.Printf("\t%s\n", path)
+				}
+			}
+			if len(res.Unparseable) > 0 {
+				fmt.Printf("Skipped %d file%s without a date prefix:\n", len(res.Unparseable), pluralSuffix(len(res.Unparseable)))
+				for _, path := range res.Unparseable {
+					fmt.Printf("\t%s\n", path)
+				}
+			}
+		},
 	}
-}
+	rootCmd.AddCommand(&reorganizeUploadedCmd)
 
-// DefaultCacheDir returns the default cache directory.
-func DefaultCacheDir() (string, error) {
-	// Use the default user cache directory.
-	dir, err := os.UserCacheDir()
-	if err != nil {
-		return "", fmt.Errorf("unable to determine user cache dir: %w", err)
+	commitUploadsCmd := cobra.Command{
+		Use:   "commit-uploads",
+		Short: "Move files uploaded with upload.defer_commit out of the upload queues",
+		Long: `Move the files that were uploaded with upload.defer_commit, and so left in the upload
+queues, to the uploaded directories, eg after checking the uploads in Google Photos.
+Files that were removed or changed since they were uploaded are dropped and reported;
+changed files stay in the upload queue to be uploaded again.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := lib.CommitUploads(cfg, cacheDir, dryRun)
+			actionVerb := "Moved"
+			if dryRun {
+				actionVerb = "Would have moved"
+			}
+			fmt.Printf("%s %d uploaded file%s out of the upload queues\n", actionVerb, len(res.CommittedPaths), pluralSuffix(len(res.CommittedPaths)))
+			if len(res.DroppedPaths) > 0 {
+				fmt.Printf("Dropped %d file%s removed or changed since upload:\n", len(res.DroppedPaths), pluralSuffix(len(res.DroppedPaths)))
+				for _, path := range res.DroppedPaths {
+					fmt.Printf("\t%s\n", path)
+				}
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+		},
 	}
-	return filepath.Join(dir, "camflow"), nil
-}
+	rootCmd.AddCommand(&commitUploadsCmd)
 
-func pluralSuffix(count int) string {
-	if count == 1 {
-		return ""
+	listQuarantineCmd := cobra.Command{
+		Use:   "list-quarantine",
+		Short: "List the files quarantined after failing to upload too many times",
+		Long: `List the files in the quarantine folders of the upload queues, which uploads moved there after
+they failed to upload upload.quarantine_after times, with the number of failures and the last error.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			files, err := lib.ListQuarantine(cfg)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Found %d quarantined file%s\n", len(files), pluralSuffix(len(files)))
+			for _, file := range files {
+				fmt.Printf("\t%s\n", file.Path)
+				if file.Failures > 0 {
+					fmt.Printf("\t\tfailed %d time%s, quarantined %s: %s\n", file.Failures, pluralSuffix(file.Failures), file.QuarantinedAt.Local().Format(time.DateTime), file.LastError)
+				}
+			}
+		},
+	}
+	rootCmd.AddCommand(&listQuarantineCmd)
+
+	requeueQuarantinedCmd := cobra.Command{
+		Use:   "requeue-quarantined [path...]",
+		Short: "Move quarantined files back to the upload queues",
+		Long: `Move the quarantined files at the given paths, or all of the quarantined files if none are
+given, back to the upload queues that they were quarantined from, eg after fixing them.
+Their failure counts are reset, so the next upload tries them again.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			paths, err := lib.RequeueQuarantined(context.Background(), cfg, cacheDir, args, dryRun)
+			actionVerb := "Moved"
+			if dryRun {
+				actionVerb = "Would have moved"
+			}
+			fmt.Printf("%s %d quarantined file%s back to the upload queues\n", actionVerb, len(paths), pluralSuffix(len(paths)))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(&requeueQuarantinedCmd)
+
+	backfillAlbumsCmd := cobra.Command{
+		Use:   "backfill-albums",
+		Short: "Add already-uploaded photos to the albums they are currently mapped to",
+		Long: `Add the photos in the uploaded directory dated from --from to --to, inclusive, to the
+label, subject, and unmatched albums that the config currently maps their metadata to,
+eg after adding a mapping. Photos are found by the media item that camflow recorded when
+uploading them, so photos without a record are skipped with a warning.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fromFlag, err := cmd.Flags().GetString("from")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid from flag:", err)
+				os.Exit(1)
+			}
+			from, err := time.Parse("2006-01-02", fromFlag)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid from flag, expected YYYY-MM-DD:", err)
+				os.Exit(1)
+			}
+			toFlag, err := cmd.Flags().GetString("to")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid to flag:", err)
+				os.Exit(1)
+			}
+			to := time.Now().UTC().Truncate(24 * time.Hour)
+			if toFlag != "" {
+				if to, err = time.Parse("2006-01-02", toFlag); err != nil {
+					fmt.Fprintln(os.Stderr, "error: invalid to flag, expected YYYY-MM-DD:", err)
+					os.Exit(1)
+				}
+			}
+			if to.Before(from) {
+				fmt.Fprintln(os.Stderr, "error: to must not be before from")
+				os.Exit(1)
+			}
+
+			ctx := context.Background()
+			gphotosHttpClient, err := lib.GetAuthenticatedGooglePhotosClient(ctx, cfg, cacheDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			wrappedGphotosClient, err := lib.NewGPhotosClient(gphotosHttpClient, cfg.GooglePhotos.BaseURL)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+
+			res, err := lib.BackfillAlbums(ctx, cfg, cacheDir, from, to, wrappedGphotosClient, dryRun)
+			actionVerb := "Added"
+			if dryRun {
+				actionVerb = "Would have added"
+			}
+			for _, albumCount := range res.AlbumItemCounts {
+				fmt.Printf("%s %d item%s to album %s\n", actionVerb, albumCount.ItemCount, pluralSuffix(albumCount.ItemCount), albumCount.AlbumTitle)
+			}
+			printCreatedAlbums(res.CreatedAlbums, dryRun)
+			if res.AlreadyInAlbumCount > 0 {
+				fmt.Printf("Skipped %d item%s already in their album\n", res.AlreadyInAlbumCount, pluralSuffix(res.AlreadyInAlbumCount))
+			}
+			if len(res.MissingMediaItemIDs) > 0 {
+				fmt.Printf("Skipped %d file%s without a recorded media item:\n", len(res.MissingMediaItemIDs), pluralSuffix(len(res.MissingMediaItemIDs)))
+				for _, path := range res.MissingMediaItemIDs {
+					fmt.Printf("\t%s\n", path)
+				}
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	backfillAlbumsCmd.Flags().String("from", "", "First date of the photos to backfill, as YYYY-MM-DD")
+	backfillAlbumsCmd.Flags().String("to", "", "Last date of the photos to backfill, as YYYY-MM-DD (default today)")
+	backfillAlbumsCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(&backfillAlbumsCmd)
+
+	reconcileCmd := cobra.Command{
+		Use:   "reconcile",
+		Short: "Compare the uploaded files with the media items in Google Photos",
+		Long: `Compare the files in the uploaded directories dated from --from to --to, inclusive, with the
+media items that camflow created in Google Photos, and report the files whose media items are missing,
+eg because they were deleted in Google Photos, and the media items whose files are missing from the
+uploaded directories. Files are matched by the media item that camflow recorded when uploading them,
+so files without a record are reported as unchecked. No files are uploaded or moved.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fromFlag, err := cmd.Flags().GetString("from")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid from flag:", err)
+				os.Exit(1)
+			}
+			from, err := time.Parse("2006-01-02", fromFlag)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid from flag, expected YYYY-MM-DD:", err)
+				os.Exit(1)
+			}
+			toFlag, err := cmd.Flags().GetString("to")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid to flag:", err)
+				os.Exit(1)
+			}
+			to := time.Now().UTC().Truncate(24 * time.Hour)
+			if toFlag != "" {
+				if to, err = time.Parse("2006-01-02", toFlag); err != nil {
+					fmt.Fprintln(os.Stderr, "error: invalid to flag, expected YYYY-MM-DD:", err)
+					os.Exit(1)
+				}
+			}
+			if to.Before(from) {
+				fmt.Fprintln(os.Stderr, "error: to must not be before from")
+				os.Exit(1)
+			}
+			format, err := cmd.Flags().GetString("format")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid format flag:", err)
+				os.Exit(1)
+			}
+			if format != "text" && format != "json" {
+				fmt.Fprintf(os.Stderr, "error: invalid format %q: must be \"text\" or \"json\"\n", format)
+				os.Exit(1)
+			}
+
+			ctx := context.Background()
+			gphotosHttpClient, err := lib.GetAuthenticatedGooglePhotosClient(ctx, cfg, cacheDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			wrappedGphotosClient, err := lib.NewGPhotosClient(gphotosHttpClient, cfg.GooglePhotos.BaseURL)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+
+			res, err := lib.Reconcile(ctx, cfg, cacheDir, from, to, wrappedGphotosClient)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			if format == "json" {
+				if err := lib.WriteReconcileJSON(os.Stdout, res); err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				return
+			}
+			fmt.Printf("Found %d file%s in Google Photos\n", res.MatchedCount, pluralSuffix(res.MatchedCount))
+			if len(res.MissingInCloud) > 0 {
+				fmt.Printf("Missing from Google Photos, %d file%s:\n", len(res.MissingInCloud), pluralSuffix(len(res.MissingInCloud)))
+				for _, f := range res.MissingInCloud {
+					fmt.Printf("\t%s\t%s\n", f.Path, f.MediaItemID)
+				}
+			}
+			if len(res.MissingLocally) > 0 {
+				fmt.Printf("Missing from the uploaded dirs, %d media item%s:\n", len(res.MissingLocally), pluralSuffix(len(res.MissingLocally)))
+				for _, item := range res.MissingLocally {
+					fmt.Printf("\t%s\t%s\t%s\n", item.Filename, item.CreationTime, item.ProductURL)
+				}
+			}
+			if len(res.UnrecordedFiles) > 0 {
+				fmt.Printf("Unchecked, without a recorded media item, %d file%s:\n", len(res.UnrecordedFiles), pluralSuffix(len(res.UnrecordedFiles)))
+				for _, path := range res.UnrecordedFiles {
+					fmt.Printf("\t%s\n", path)
+				}
+			}
+		},
+	}
+	reconcileCmd.Flags().String("from", "", "First date of the files to compare, as YYYY-MM-DD")
+	reconcileCmd.Flags().String("to", "", "Last date of the files to compare, as YYYY-MM-DD (default today)")
+	reconcileCmd.Flags().String("format", "text", "Output format: text or json")
+	reconcileCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(&reconcileCmd)
+
+	listUploadsCmd := cobra.Command{
+		Use:   "list-uploads",
+		Short: "List the uploads recorded in the upload ledger",
+		Long: `List the uploads that camflow recorded in its upload ledger, with the path that each file was
+uploaded from, its size, its media item ID, the albums it was to be added to, and when it was uploaded,
+eg to audit what was uploaded. Pass --from and --to to only list the uploads on those dates, inclusive,
+and --album to only list the uploads to an album. Pass --prune to first drop the ledger entries of the
+files that are no longer in the upload queues or uploaded directories. Pruning is refused if a directory
+is on a drive that isn't mounted, and, unless --allow-empty-roots is passed, if a directory is missing or
+empty, since that would drop the entries of all of its files.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var from, to time.Time
+			for _, dateFlag := range []struct {
+				name string
+				date *time.Time
+			}{{"from", &from}, {"to", &to}} {
+				value, err := cmd.Flags().GetString(dateFlag.name)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: invalid %s flag: %v\n", dateFlag.name, err)
+					os.Exit(1)
+				}
+				if value == "" {
+					continue
+				}
+				if *dateFlag.date, err = time.Parse("2006-01-02", value); err != nil {
+					fmt.Fprintf(os.Stderr, "error: invalid %s flag, expected YYYY-MM-DD: %v\n", dateFlag.name, err)
+					os.Exit(1)
+				}
+			}
+			if !from.IsZero() && !to.IsZero() && to.Before(from) {
+				fmt.Fprintln(os.Stderr, "error: to must not be before from")
+				os.Exit(1)
+			}
+			album, err := cmd.Flags().GetString("album")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid album flag:", err)
+				os.Exit(1)
+			}
+			prune, err := cmd.Flags().GetBool("prune")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid prune flag:", err)
+				os.Exit(1)
+			}
+			allowEmptyRoots, err := cmd.Flags().GetBool("allow-empty-roots")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid allow-empty-roots flag:", err)
+				os.Exit(1)
+			}
+			format, err := cmd.Flags().GetString("format")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid format flag:", err)
+				os.Exit(1)
+			}
+			if format != "text" && format != "json" {
+				fmt.Fprintf(os.Stderr, "error: invalid format %q: must be \"text\" or \"json\"\n", format)
+				os.Exit(1)
+			}
+
+			if prune {
+				pruned, err := lib.PruneUploadLedger(cfg, cacheDir, allowEmptyRoots, dryRun)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				actionVerb := "Dropped"
+				if dryRun {
+					actionVerb = "Would have dropped"
+				}
+				// Keep the JSON output parseable.
+				out := os.Stdout
+				if format == "json" {
+					out = os.Stderr
+				}
+				fmt.Fprintf(out, "%s the ledger entries of %d missing file%s\n", actionVerb, len(pruned), pluralSuffix(len(pruned)))
+				for _, file := range pruned {
+					fmt.Fprintf(out, "\t%s\n", file)
+				}
+			}
+
+			uploads, err := lib.ListUploads(cacheDir, from, to, album)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			if format == "json" {
+				if err := lib.WriteUploadsJSON(os.Stdout, uploads); err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					os.Exit(1)
+				}
+				return
+			}
+			fmt.Printf("Found %d upload%s\n", len(uploads), pluralSuffix(len(uploads)))
+			for _, upload := range uploads {
+				path := upload.Path
+				if path == "" {
+					path = upload.File
+				}
+				fmt.Printf("\t%s\t%s\t%d bytes\t%s\t%s\n", upload.UploadedAt.Local().Format(time.DateTime), path, upload.Size, upload.MediaItemID, strings.Join(upload.Albums, ", "))
+			}
+		},
+	}
+	listUploadsCmd.Flags().String("from", "", "First upload date to list, as YYYY-MM-DD")
+	listUploadsCmd.Flags().String("to", "", "Last upload date to list, as YYYY-MM-DD")
+	listUploadsCmd.Flags().String("album", "", "Only list the uploads to the album with this title")
+	listUploadsCmd.Flags().Bool("prune", false, "Drop the ledger entries of files that are no longer in the upload queues or uploaded dirs")
+	listUploadsCmd.Flags().Bool("allow-empty-roots", false, "With --prune, also prune when an upload queue or uploaded dir is missing or empty, which drops the entries of all of its files")
+	listUploadsCmd.Flags().String("format", "text", "Output format: text or json")
+	rootCmd.AddCommand(&listUploadsCmd)
+
+	mappingReportCmd := cobra.Command{
+		Use:   "mapping-report",
+		Short: "Report which albums each file is added to under the current config",
+		Long: `Report the albums that each file in the photos upload queue is added to under the
+current config, from its metadata and path, eg to check the organization before uploading or
+after changing album mappings. Pass --videos for the videos upload queue, and --uploaded for
+the uploaded dir instead, which also reports the media item recorded for each uploaded file.
+Google Photos isn't called and no files are uploaded or moved.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			videos, err := cmd.Flags().GetBool("videos")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid videos flag:", err)
+				os.Exit(1)
+			}
+			uploaded, err := cmd.Flags().GetBool("uploaded")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid uploaded flag:", err)
+				os.Exit(1)
+			}
+			format, err := cmd.Flags().GetString("format")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid format flag:", err)
+				os.Exit(1)
+			}
+			if format != "csv" && format != "json" {
+				fmt.Fprintf(os.Stderr, "error: invalid format %q: must be \"csv\" or \"json\"\n", format)
+				os.Exit(1)
+			}
+
+			ctx := context.Background()
+			albumMapping := lib.PhotosAlbumMapping
+			if videos {
+				albumMapping = lib.VideosAlbumMapping
+			}
+			mappings, err := albumMapping(ctx, cfg, cacheDir, uploaded)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			if format == "json" {
+				err = lib.WriteAlbumMappingJSON(os.Stdout, mappings)
+			} else {
+				err = lib.WriteAlbumMappingCSV(os.Stdout, mappings)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	mappingReportCmd.Flags().Bool("videos", false, "Report the videos instead of the photos")
+	mappingReportCmd.Flags().Bool("uploaded", false, "Report the files in the uploaded dir instead of the upload queue")
+	mappingReportCmd.Flags().String("format", "csv", "Output format: csv or json")
+	rootCmd.AddCommand(&mappingReportCmd)
+
+	listSupportedFormatsCmd := cobra.Command{
+		Use:   "list-supported-formats",
+		Short: "List the photo and video formats that import and upload recognize",
+		Long: `List the extensions of the photos and videos that import and upload recognize, after any
+configured include and exclude extensions, and the files that they ignore, eg to find out why a file
+wasn't imported or uploaded.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := lib.WriteSupportedFormats(os.Stdout, cfg); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(&listSupportedFormatsCmd)
+
+	findDuplicatesCmd := cobra.Command{
+		Use:   "find-duplicates",
+		Short: "Report imported photos that are likely duplicates",
+		Long: `Report groups of imported photos that look alike, based on the perceptual hashes
+recorded at import time. Requires import.perceptual_hash to be enabled in the config.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			maxDistance, err := cmd.Flags().GetInt("max-distance")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid max-distance flag:", err)
+				os.Exit(1)
+			}
+			if maxDistance < 0 || maxDistance > 64 {
+				fmt.Fprintln(os.Stderr, "error: max-distance must be between 0 and 64")
+				os.Exit(1)
+			}
+
+			groups, err := lib.FindDuplicates(cacheDir, maxDistance)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Found %d group%s of likely duplicates\n", len(groups), pluralSuffix(len(groups)))
+			for i, group := range groups {
+				fmt.Printf("Group %d:\n", i+1)
+				for _, entry := range group {
+					fmt.Printf("\t%s\n", entry.File)
+				}
+			}
+		},
+	}
+	findDuplicatesCmd.Flags().Int("max-distance", 6, "Maximum number of differing hash bits (of 64) for photos to count as duplicates")
+	rootCmd.AddCommand(&findDuplicatesCmd)
+
+	genConfigSchemaCmd := cobra.Command{
+		Use:   "gen-config-schema",
+		Short: "Print a JSON Schema of the config file, for editors to validate and complete it",
+		Args:  cobra.NoArgs,
+		// The schema is needed to write a config, so don't load one.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+		Run: func(cmd *cobra.Command, args []string) {
+			schema, err := config.JSONSchema()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(schema))
+		},
+	}
+	rootCmd.AddCommand(&genConfigSchemaCmd)
+
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// DefaultCacheDir returns the default cache directory.
+func DefaultCacheDir() (string, error) {
+	// Use the default user cache directory.
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine user cache dir: %w", err)
+	}
+	return filepath.Join(dir, "camflow"), nil
+}
+
+func pluralSuffix(count int) string {
+	if count == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// addUploadFlags adds the flags shared by the upload commands, which override the upload config.
+func addUploadFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("summary-only", false, "Only report what is in the upload queue, without uploading or calling Google Photos")
+	cmd.Flags().Int("min-rating", 0, "Only upload files with at least this star rating (1-5); others stay in the upload queue (overrides upload.min_rating)")
+	cmd.Flags().StringSlice("include-extensions", nil, "Only upload files with these extensions, eg jpg,mp4; others stay in the upload queue (overrides upload.include_extensions)")
+	cmd.Flags().StringSlice("exclude-extensions", nil, "Don't upload files with these extensions, eg cr3; they stay in the upload queue (overrides upload.exclude_extensions)")
+	cmd.Flags().Bool("deep-validate", false, "Check that MP4 and MOV files aren't truncated before uploading them (overrides upload.deep_validate)")
+	cmd.Flags().String("photos-base-url", "", "Base URL of the Google Photos API, eg for a proxy (overrides google_photos.base_url)")
+	cmd.Flags().Int("max-retries", config.DefaultMaxRetries, "Number of times to retry a file after the Google Photos API fails with a temporary error (overrides upload.max_retries)")
+	cmd.Flags().Int("max-consecutive-failures", 0, "Stop after this many files in a row fail to upload (overrides upload.max_consecutive_failures)")
+	cmd.Flags().Bool("no-preflight", false, "Skip checking that Google Photos can be called before scanning the upload queue (overrides upload.skip_preflight)")
+	cmd.Flags().Bool("keep-queue-structure", false, "Keep the subdirs of the upload queue under the uploaded dir, instead of moving files to date dirs (overrides upload.keep_queue_structure)")
+	cmd.Flags().Bool("new-only", false, "Only upload files dated on or after the last date in the uploaded dir; older files stay in the upload queue (overrides upload.new_only)")
+	cmd.Flags().Int("flatten-albums-from-path", 0, "Add each file to an album named for the first N dirs of its path in the upload queue, eg 2 for \"trip / day1\" (overrides upload.flatten_albums_from_path)")
+	cmd.Flags().Int("max-albums-per-item", 0, "Add each file to at most this many albums, keeping the default albums first (overrides upload.max_albums_per_item)")
+	cmd.Flags().Bool("only-existing-albums", false, "Stop instead of creating any album that doesn't exist yet (overrides upload.only_existing_albums)")
+	cmd.Flags().Bool("allow-create-albums", false, "Create albums that don't exist yet, even if upload.only_existing_albums or upload.max_new_albums is set")
+	cmd.Flags().Bool("replace-existing", false, "Replace the media items of earlier uploads of the files in their albums (overrides upload.replace_existing)")
+	cmd.Flags().Bool("safe", false, "Fetch each media item back from Google Photos before moving its file, and keep files whose album adds failed in the upload queue (overrides upload.safe)")
+	cmd.Flags().Bool("defer-commit", false, "Leave uploaded files in the upload queue until commit-uploads moves them (overrides upload.defer_commit)")
+	cmd.Flags().Bool("check-api", false, "Do a dry run that also checks Google Photos access and resolves albums online, with read-only API calls")
+	cmd.Flags().String("move-failed-to", "", "Move files that fail to upload to this dir once a run that continued past them ends (overrides upload.move_failed_to)")
+	cmd.Flags().String("tag", "", "Label to record with each upload in the upload ledger, eg TRIP-2024-05 (overrides upload.tag)")
+}
+
+// applyUploadFlags copies the upload flags that were set on cmd into cfg.
+func applyUploadFlags(cmd *cobra.Command, cfg *config.CamflowConfig) error {
+	if cmd.Flags().Changed("min-rating") {
+		minRating, err := cmd.Flags().GetInt("min-rating")
+		if err != nil {
+			return fmt.Errorf("invalid min-rating flag: %w", err)
+		}
+		cfg.Upload.MinRating = minRating
+	}
+	if cmd.Flags().Changed("include-extensions") {
+		includeExtensions, err := cmd.Flags().GetStringSlice("include-extensions")
+		if err != nil {
+			return fmt.Errorf("invalid include-extensions flag: %w", err)
+		}
+		cfg.Upload.IncludeExtensions = includeExtensions
+	}
+	if cmd.Flags().Changed("exclude-extensions") {
+		excludeExtensions, err := cmd.Flags().GetStringSlice("exclude-extensions")
+		if err != nil {
+			return fmt.Errorf("invalid exclude-extensions flag: %w", err)
+		}
+		cfg.Upload.ExcludeExtensions = excludeExtensions
+	}
+	if cmd.Flags().Changed("deep-validate") {
+		deepValidate, err := cmd.Flags().GetBool("deep-validate")
+		if err != nil {
+			return fmt.Errorf("invalid deep-validate flag: %w", err)
+		}
+		cfg.Upload.DeepValidate = deepValidate
+	}
+	if cmd.Flags().Changed("photos-base-url") {
+		baseURL, err := cmd.Flags().GetString("photos-base-url")
+		if err != nil {
+			return fmt.Errorf("invalid photos-base-url flag: %w", err)
+		}
+		if err := cfg.GooglePhotos.SetBaseURL(baseURL); err != nil {
+			return fmt.Errorf("invalid photos-base-url flag: %w", err)
+		}
+	}
+	if cmd.Flags().Changed("max-retries") {
+		maxRetries, err := cmd.Flags().GetInt("max-retries")
+		if err != nil {
+			return fmt.Errorf("invalid max-retries flag: %w", err)
+		}
+		cfg.Upload.MaxRetries = maxRetries
+	}
+	if cmd.Flags().Changed("max-consecutive-failures") {
+		maxConsecutiveFailures, err := cmd.Flags().GetInt("max-consecutive-failures")
+		if err != nil {
+			return fmt.Errorf("invalid max-consecutive-failures flag: %w", err)
+		}
+		cfg.Upload.MaxConsecutiveFailures = maxConsecutiveFailures
+	}
+	if cmd.Flags().Changed("no-preflight") {
+		noPreflight, err := cmd.Flags().GetBool("no-preflight")
+		if err != nil {
+			return fmt.Errorf("invalid no-preflight flag: %w", err)
+		}
+		cfg.Upload.SkipPreflight = noPreflight
+	}
+	if cmd.Flags().Changed("keep-queue-structure") {
+		keepQueueStructure, err := cmd.Flags().GetBool("keep-queue-structure")
+		if err != nil {
+			return fmt.Errorf("invalid keep-queue-structure flag: %w", err)
+		}
+		cfg.Upload.KeepQueueStructure = keepQueueStructure
+	}
+	if cmd.Flags().Changed("new-only") {
+		newOnly, err := cmd.Flags().GetBool("new-only")
+		if err != nil {
+			return fmt.Errorf("invalid new-only flag: %w", err)
+		}
+		cfg.Upload.NewOnly = newOnly
+	}
+	if cmd.Flags().Changed("flatten-albums-from-path") {
+		flattenAlbumsFromPath, err := cmd.Flags().GetInt("flatten-albums-from-path")
+		if err != nil {
+			return fmt.Errorf("invalid flatten-albums-from-path flag: %w", err)
+		}
+		cfg.Upload.FlattenAlbumsFromPath = flattenAlbumsFromPath
+	}
+	if cmd.Flags().Changed("max-albums-per-item") {
+		maxAlbumsPerItem, err := cmd.Flags().GetInt("max-albums-per-item")
+		if err != nil {
+			return fmt.Errorf("invalid max-albums-per-item flag: %w", err)
+		}
+		cfg.Upload.MaxAlbumsPerItem = maxAlbumsPerItem
+	}
+	if cmd.Flags().Changed("only-existing-albums") {
+		onlyExistingAlbums, err := cmd.Flags().GetBool("only-existing-albums")
+		if err != nil {
+			return fmt.Errorf("invalid only-existing-albums flag: %w", err)
+		}
+		cfg.Upload.OnlyExistingAlbums = onlyExistingAlbums
+	}
+	if cmd.Flags().Changed("allow-create-albums") {
+		allowCreateAlbums, err := cmd.Flags().GetBool("allow-create-albums")
+		if err != nil {
+			return fmt.Errorf("invalid allow-create-albums flag: %w", err)
+		}
+		if allowCreateAlbums {
+			cfg.Upload.OnlyExistingAlbums = false
+			cfg.Upload.MaxNewAlbums = 0
+		}
+	}
+	if cmd.Flags().Changed("replace-existing") {
+		replaceExisting, err := cmd.Flags().GetBool("replace-existing")
+		if err != nil {
+			return fmt.Errorf("invalid replace-existing flag: %w", err)
+		}
+		cfg.Upload.ReplaceExisting = replaceExisting
+	}
+	if cmd.Flags().Changed("safe") {
+		safe, err := cmd.Flags().GetBool("safe")
+		if err != nil {
+			return fmt.Errorf("invalid safe flag: %w", err)
+		}
+		cfg.Upload.Safe = safe
+	}
+	if cmd.Flags().Changed("defer-commit") {
+		deferCommit, err := cmd.Flags().GetBool("defer-commit")
+		if err != nil {
+			return fmt.Errorf("invalid defer-commit flag: %w", err)
+		}
+		cfg.Upload.DeferCommit = deferCommit
+	}
+	if cmd.Flags().Changed("check-api") {
+		checkAPI, err := cmd.Flags().GetBool("check-api")
+		if err != nil {
+			return fmt.Errorf("invalid check-api flag: %w", err)
+		}
+		cfg.Upload.CheckAPI = checkAPI
+	}
+	if cmd.Flags().Changed("move-failed-to") {
+		moveFailedTo, err := cmd.Flags().GetString("move-failed-to")
+		if err != nil {
+			return fmt.Errorf("invalid move-failed-to flag: %w", err)
+		}
+		cfg.Upload.MoveFailedTo = moveFailedTo
+	}
+	if cmd.Flags().Changed("tag") {
+		tag, err := cmd.Flags().GetString("tag")
+		if err != nil {
+			return fmt.Errorf("invalid tag flag: %w", err)
+		}
+		cfg.Upload.Tag = tag
+	}
+	return nil
+}
+
+// uploadWithGooglePhotos authenticates with Google Photos and calls upload with the client.
+func uploadWithGooglePhotos(ctx context.Context, cfg config.CamflowConfig, cacheDir string, upload func(lib.GPhotosClient) (lib.UploadReport, error)) (lib.UploadReport, error) {
+	if cfg.AccountLabel != "" {
+		fmt.Printf("Account: %s\n", cfg.AccountLabel)
+	}
+	gphotosHttpClient, err := lib.GetAuthenticatedGooglePhotosClient(ctx, cfg, cacheDir)
+	if err != nil {
+		return lib.UploadReport{}, err
+	}
+	gphotosClient, err := lib.NewGPhotosClient(gphotosHttpClient, cfg.GooglePhotos.BaseURL)
+	if err != nil {
+		return lib.UploadReport{}, err
+	}
+	return upload(gphotosClient)
+}
+
+// addImportFlags adds the flags that are shared by the import commands.
+func addImportFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("keep", "k", false, "Keep the source files")
+	cmd.Flags().Bool("hardlink", false, "Hard link files into the destination instead of copying them, when on the same filesystem (overrides import.hardlink)")
+	cmd.Flags().Bool("verify", false, "Re-read each copy and compare it with the source before deleting the source (overrides import.verify)")
+	cmd.Flags().Duration("camera-clock-offset", 0, "Correct the camera's clock by this much when dating files, eg -1h for a clock an hour fast (overrides import.camera_clock_offset)")
+	cmd.Flags().Bool("takeout", false, "Date files by their Google Takeout sidecars and import them into dirs named for their albums (overrides import.takeout)")
+	cmd.Flags().String("photos-dest", "", "Move photos to this dir instead of the photo process queue, for this import only")
+	cmd.Flags().String("videos-dest", "", "Move videos to this dir instead of the video upload queue, for this import only")
+	cmd.Flags().Bool("summary-by-date", false, "Summarize the imported files by capture date instead of by source dir")
+	cmd.Flags().Bool("report-skipped", false, "List every file that wasn't imported, with the reason")
+}
+
+// importOutput selects what is printed after an import.
+type importOutput struct {
+	summaryByDate bool
+	reportSkipped bool
+}
+
+// applyImportFlags overrides cfg with the import flags that were set, and returns the keep
+// flag and the output flags.
+func applyImportFlags(cmd *cobra.Command, cfg *config.CamflowConfig) (keep bool, output importOutput, err error) {
+	if keep, err = cmd.Flags().GetBool("keep"); err != nil {
+		return false, importOutput{}, fmt.Errorf("invalid keep flag: %w", err)
+	}
+	if cmd.Flags().Changed("hardlink") {
+		if cfg.Import.Hardlink, err = cmd.Flags().GetBool("hardlink"); err != nil {
+			return false, importOutput{}, fmt.Errorf("invalid hardlink flag: %w", err)
+		}
+	}
+	if cmd.Flags().Changed("verify") {
+		if cfg.Import.Verify, err = cmd.Flags().GetBool("verify"); err != nil {
+			return false, importOutput{}, fmt.Errorf("invalid verify flag: %w", err)
+		}
+	}
+	if cmd.Flags().Changed("camera-clock-offset") {
+		if cfg.Import.CameraClockOffset, err = cmd.Flags().GetDuration("camera-clock-offset"); err != nil {
+			return false, importOutput{}, fmt.Errorf("invalid camera-clock-offset flag: %w", err)
+		}
+	}
+	if cmd.Flags().Changed("takeout") {
+		if cfg.Import.Takeout, err = cmd.Flags().GetBool("takeout"); err != nil {
+			return false, importOutput{}, fmt.Errorf("invalid takeout flag: %w", err)
+		}
+	}
+	if err := applyImportDestFlags(cmd, cfg); err != nil {
+		return false, importOutput{}, err
+	}
+	if output.summaryByDate, err = cmd.Flags().GetBool("summary-by-date"); err != nil {
+		return false, importOutput{}, fmt.Errorf("invalid summary-by-date flag: %w", err)
+	}
+	if output.reportSkipped, err = cmd.Flags().GetBool("report-skipped"); err != nil {
+		return false, importOutput{}, fmt.Errorf("invalid report-skipped flag: %w", err)
+	}
+	return keep, output, nil
+}
+
+// applyImportDestFlags overrides where cfg imports media to with the --photos-dest and --videos-dest flags.
+func applyImportDestFlags(cmd *cobra.Command, cfg *config.CamflowConfig) error {
+	var err error
+	if cfg.Import.PhotosDest, err = cmd.Flags().GetString("photos-dest"); err != nil {
+		return fmt.Errorf("invalid photos-dest flag: %w", err)
+	}
+	if cfg.Import.VideosDest, err = cmd.Flags().GetString("videos-dest"); err != nil {
+		return fmt.Errorf("invalid videos-dest flag: %w", err)
+	}
+	return nil
+}
+
+// printImportResult prints the summary of an import, and the files that it skipped: all of them with
+// output.reportSkipped, and otherwise only the zero-byte files, unreadable dirs, and files that failed verification.
+func printImportResult(res lib.ImportResult, output importOutput, dryRun bool) {
+	actionVerb := "Imported"
+	if dryRun {
+		actionVerb = "Would have imported"
+	}
+	if output.summaryByDate {
+		printImportDateSummary(res, actionVerb)
+	} else {
+		printImportDirSummary(res, actionVerb)
+	}
+	if output.reportSkipped {
+		printSkippedFiles(res.SkippedFiles)
+	} else if len(res.ZeroByteFiles) > 0 {
+		fmt.Printf("Skipped %d zero-byte file%s:\n", len(res.ZeroByteFiles), pluralSuffix(len(res.ZeroByteFiles)))
+		for _, path := range res.ZeroByteFiles {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+	if !output.reportSkipped {
+		var unreadableDirs []string
+		for _, f := range res.SkippedFiles {
+			if f.Reason == lib.SkipReasonUnreadableDir {
+				unreadableDirs = append(unreadableDirs, f.Path)
+			}
+		}
+		if len(unreadableDirs) > 0 {
+			fmt.Printf("Skipped %d unreadable dir%s:\n", len(unreadableDirs), pluralSuffix(len(unreadableDirs)))
+			for _, path := range unreadableDirs {
+				fmt.Printf("\t%s\n", path)
+			}
+		}
+		printVerifyFailedFiles(res)
+	}
+}
+
+// printVerifyFailedFiles prints the files of res whose copies failed verification, if any.
+func printVerifyFailedFiles(res lib.ImportResult) {
+	paths := res.VerifyFailedFiles()
+	if len(paths) == 0 {
+		return
+	}
+	fmt.Printf("Kept %d file%s on the source whose copies failed verification:\n", len(paths), pluralSuffix(len(paths)))
+	for _, path := range paths {
+		fmt.Printf("\t%s\n", path)
+	}
+}
+
+// importVerifyError returns the error that an import with files that failed verification exits with,
+// or nil if there are none.
+func importVerifyError(res lib.ImportResult) error {
+	if n := len(res.VerifyFailedFiles()); n > 0 {
+		return fmt.Errorf("%d file%s failed verification after copying", n, pluralSuffix(n))
+	}
+	return nil
+}
+
+// printSkippedFiles prints the files that an import skipped, each with its reason.
+func printSkippedFiles(skipped []lib.SkippedFile) {
+	fmt.Printf("Skipped %d file%s:\n", len(skipped), pluralSuffix(len(skipped)))
+	for _, f := range skipped {
+		fmt.Printf("\t%s\t%s\n", f.Reason, f.Path)
+	}
+}
+
+func addReportFileFlag(cmd *cobra.Command) {
+	cmd.Flags().String("report-file", "", "Also write a JSON summary of the run to this path, even if the run fails")
+}
+
+// finishRun labels report with the account that the run targeted, writes it to the report file,
+// and sends it to the configured notifications.
+func finishRun(cmd *cobra.Command, cfg config.CamflowConfig, report lib.RunReport) {
+	report.AccountLabel = cfg.AccountLabel
+	writeReportFile(cmd, report)
+	notifyRun(cfg.Notifications, report)
+}
+
+// notifyRun sends report to the notifications configured by notificationsCfg, except in dry runs.
+// Failing to send them is only reported, so that it doesn't hide the run's own result.
+func notifyRun(notificationsCfg config.NotificationsConfig, report lib.RunReport) {
+	if report.DryRun {
+		return
+	}
+	notifiers := lib.NewNotifiers(notificationsCfg)
+	if len(notifiers) == 0 {
+		return
+	}
+	if err := lib.Notify(context.Background(), notifiers, report); err != nil {
+		fmt.Fprintln(os.Stderr, "error: failed to send notification:", err)
+	}
+}
+
+// writeReportFile writes report to the path of cmd's --report-file flag, if it is set.
+// Failing to write it is only reported, so that it doesn't hide the run's own result.
+func writeReportFile(cmd *cobra.Command, report lib.RunReport) {
+	path, err := cmd.Flags().GetString("report-file")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: invalid report-file flag:", err)
+		return
+	}
+	if path == "" {
+		return
+	}
+	if err := lib.WriteRunReport(path, report); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
+}
+
+// printImportDirSummary prints the number of files in res imported from each source dir, and of photos
+// imported into each dir.
+func printImportDirSummary(res lib.ImportResult, actionVerb string) {
+	// TODO: change relative dirs to print target rather than sdcard dir names (and counts?).
+	optColon := ""
+	if len(res.SrcEntries) > 0 {
+		optColon = ":"
+	}
+	fmt.Printf("%s from %d dir%s%s\n", actionVerb, len(res.SrcEntries), pluralSuffix(len(res.SrcEntries)), optColon)
+	if len(res.SrcEntries) != 0 {
+		for _, entry := range res.SrcEntries {
+			fmt.Printf("\t%s: %d photo%s, %d video%s\n", entry.RelativeDir, entry.PhotoCount, pluralSuffix(entry.PhotoCount), entry.VideoCount, pluralSuffix(entry.VideoCount))
+		}
+		fmt.Printf("%s photos into %d dir%s:\n", actionVerb, len(res.DstEntries), pluralSuffix(len(res.DstEntries)))
+		for _, entry := range res.DstEntries {
+			fmt.Printf("\t%s: %d photo%s\n", entry.RelativeDir, entry.PhotoCount, pluralSuffix(entry.PhotoCount))
+		}
+	}
+}
+
+// printImportDateSummary prints the number and size of the photos and videos in res imported for each capture date.
+func printImportDateSummary(res lib.ImportResult, actionVerb string) {
+	optColon := ""
+	if len(res.DateEntries) > 0 {
+		optColon = ":"
+	}
+	fmt.Printf("%s from %d date%s%s\n", actionVerb, len(res.DateEntries), pluralSuffix(len(res.DateEntries)), optColon)
+	for _, entry := range res.DateEntries {
+		fmt.Printf("\t%s: %d photo%s (%.1f GiB), %d video%s (%.1f GiB)\n", entry.Date,
+			entry.PhotoCount, pluralSuffix(entry.PhotoCount), float64(entry.PhotoSize)/(1<<30),
+			entry.VideoCount, pluralSuffix(entry.VideoCount), float64(entry.VideoSize)/(1<<30))
+	}
+}
+
+// printAlbumSummary prints the number of media items in report that were added, or failed to be added, to each album,
+// and the albums that were created.
+func printAlbumSummary(report lib.UploadReport, dryRun bool) {
+	for _, albumCount := range report.AlbumItemCounts() {
+		fmt.Printf("Album %s: %d item%s", albumCount.AlbumTitle, albumCount.ItemCount, pluralSuffix(albumCount.ItemCount))
+		if albumCount.FailedItemCount > 0 {
+			fmt.Printf(" (failed to add %d)", albumCount.FailedItemCount)
+		}
+		fmt.Println()
+	}
+	printCreatedAlbums(report.CreatedAlbums, dryRun)
+}
+
+// printCreatedAlbums prints the number of albums that a run created, even if it is none, and their titles.
+func printCreatedAlbums(titles []string, dryRun bool) {
+	actionVerb := "Created"
+	if dryRun {
+		actionVerb = "Would have created"
+	}
+	fmt.Printf("%s %d album%s\n", actionVerb, len(titles), pluralSuffix(len(titles)))
+	for _, title := range titles {
+		fmt.Printf("\t%s\n", title)
+	}
+}
+
+// printUploadQueueSummary prints the summary of an upload queue of itemTypePluralName.
+func printUploadQueueSummary(summary lib.UploadQueueSummary, itemTypePluralName string) {
+	if summary.Count == 0 {
+		fmt.Printf("No %s in the upload queue\n", itemTypePluralName)
+		return
+	}
+	fmt.Printf("%d %s in the upload queue (%.1f GiB)\n", summary.Count, itemTypePluralName, float64(summary.TotalSize)/(1<<30))
+	fmt.Printf("Dated %s to %s\n", summary.FirstDate.Format("2006-01-02"), summary.LastDate.Format("2006-01-02"))
+	if summary.BandwidthKnown {
+		fmt.Printf("Estimated upload time: %s\n", summary.EstimatedDuration)
+	} else {
+		fmt.Printf("Estimated upload time: at least %s (set upload.upload_mbps to account for bandwidth)\n", summary.EstimatedDuration)
 	}
-	return "s"
 }